@@ -0,0 +1,270 @@
+// Package client is a typed Go client of the neodeliver graphql api.
+// Types & operations are generated from the schema by cmd/clientgen (client_gen.go), this file holds the transport.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// error codes exposed in the error extensions
+const (
+	CodeInternal                 = "INTERNAL"
+	CodeRateLimited              = "RATE_LIMITED"
+	CodeForbidden                = "FORBIDDEN"
+	CodeIdempotencyKeyReused     = "IDEMPOTENCY_KEY_REUSED"
+	CodeIdempotencyKeyInProgress = "IDEMPOTENCY_KEY_IN_PROGRESS"
+)
+
+type Client struct {
+	endpoint string
+	http     *http.Client
+	auth     Auth
+	retries  int
+	backoff  time.Duration
+}
+
+type Option func(c *Client)
+
+func New(endpoint string, opts ...Option) *Client {
+	c := &Client{
+		endpoint: endpoint,
+		http:     http.DefaultClient,
+		retries:  2,
+		backoff:  500 * time.Millisecond,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) {
+		c.http = h
+	}
+}
+
+// retry failed requests (network errors, rate limits & server errors), waiting backoff * 2^attempt in between
+// mutations are retried using the same Idempotency-Key, and are thus executed once
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+func WithAuth(a Auth) Option {
+	return func(c *Client) {
+		c.auth = a
+	}
+}
+
+// ---
+
+// authenticate requests
+type Auth interface {
+	Authorize(r *http.Request) error
+}
+
+type AuthFunc func(r *http.Request) error
+
+func (fn AuthFunc) Authorize(r *http.Request) error {
+	return fn(r)
+}
+
+func BearerToken(token string) Auth {
+	return AuthFunc(func(r *http.Request) error {
+		r.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+func APIKeyAuth(key string) Auth {
+	return AuthFunc(func(r *http.Request) error {
+		r.Header.Set("X-API-Key", key)
+		return nil
+	})
+}
+
+// ---
+
+type Error struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (e Error) Code() string {
+	code, _ := e.Extensions["code"].(string)
+	return code
+}
+
+func (e Error) Error() string {
+	if code := e.Code(); code != "" {
+		return code + ": " + e.Message
+	}
+
+	return e.Message
+}
+
+// errors returned by the api, data may be partially decoded
+type Errors struct {
+	Status int
+	List   []Error
+}
+
+func (e *Errors) Error() string {
+	messages := []string{}
+	for _, err := range e.List {
+		messages = append(messages, err.Error())
+	}
+
+	return fmt.Sprintf("graphql: %s (status %d)", strings.Join(messages, ", "), e.Status)
+}
+
+// whether the error contains the given error code
+func IsCode(err error, code string) bool {
+	var list *Errors
+	if !errors.As(err, &list) {
+		return false
+	}
+
+	for _, e := range list.List {
+		if e.Code() == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ---
+
+type request struct {
+	Query         string      `json:"query"`
+	OperationName string      `json:"operationName"`
+	Variables     interface{} `json:"variables,omitempty"`
+}
+
+type response struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []Error         `json:"errors"`
+}
+
+// execute an operation, decoding its data into out
+func (c *Client) Do(ctx context.Context, query string, operationName string, variables interface{}, out interface{}, mutation bool) error {
+	body, err := json.Marshal(request{query, operationName, variables})
+	if err != nil {
+		return err
+	}
+
+	key := ""
+	if mutation {
+		key = idempotencyKey()
+	}
+
+	for attempt := 0; ; attempt++ {
+		wait, err := c.do(ctx, body, key, out)
+		if wait < 0 || attempt >= c.retries {
+			return err
+		} else if wait == 0 {
+			wait = c.backoff * time.Duration(1<<attempt)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// send the request, returns the duration to wait before retrying or -1 when the request should not be retried
+func (c *Client) do(ctx context.Context, body []byte, idempotencyKey string, out interface{}) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/graphql-response+json, application/json;q=0.9")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	if c.auth != nil {
+		if err := c.auth.Authorize(req); err != nil {
+			return -1, err
+		}
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer res.Body.Close()
+	bs, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	r := response{}
+	if err := json.Unmarshal(bs, &r); err != nil {
+		err = fmt.Errorf("graphql: unexpected response (status %d): %w", res.StatusCode, err)
+		return retryAfter(res), err
+	}
+
+	if len(r.Data) > 0 && string(r.Data) != "null" && out != nil {
+		if err := json.Unmarshal(r.Data, out); err != nil {
+			return -1, err
+		}
+	}
+
+	if len(r.Errors) == 0 && res.StatusCode < 300 {
+		return -1, nil
+	}
+
+	err = &Errors{Status: res.StatusCode, List: r.Errors}
+	for _, e := range r.Errors {
+		switch e.Code() {
+		case CodeRateLimited, CodeInternal, CodeIdempotencyKeyInProgress:
+			return retryAfter(res), err
+		}
+	}
+
+	return -1, err
+}
+
+// retry delay of failed responses, -1 for errors which cannot be retried
+func retryAfter(res *http.Response) time.Duration {
+	if s, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+		return time.Duration(s) * time.Second
+	}
+
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests, res.StatusCode == http.StatusConflict, res.StatusCode >= 500:
+		return 0
+	}
+
+	return -1
+}
+
+func idempotencyKey() string {
+	bs := make([]byte, 16)
+	rand.Read(bs)
+	return hex.EncodeToString(bs)
+}
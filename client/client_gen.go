@@ -0,0 +1,1544 @@
+// Code generated by cmd/clientgen. DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+var _ = json.RawMessage{}
+var _ = time.Time{}
+
+type APIKey struct {
+	CreatedAt      time.Time `json:"created_at"`
+	CreatedBy      string    `json:"created_by"`
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	OrganizationID string    `json:"organization_id"`
+	Scopes         []string  `json:"scopes"`
+}
+
+type Auth0Method struct {
+	Confirmed bool   `json:"confirmed"`
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+}
+
+type BulkItemResult struct {
+	Error  *string `json:"error"`
+	ID     *string `json:"id"`
+	Index  int     `json:"index"`
+	Status string  `json:"status"`
+}
+
+type BulkResult struct {
+	Failed    int              `json:"failed"`
+	Items     []BulkItemResult `json:"items"`
+	Succeeded int              `json:"succeeded"`
+	Total     int              `json:"total"`
+}
+
+type Campaign struct {
+	Category        *string   `json:"category"`
+	Channel         string    `json:"channel"`
+	CreatedAt       time.Time `json:"created_at"`
+	Draft           bool      `json:"draft"`
+	ID              string    `json:"id"`
+	OrganizationID  string    `json:"organization_id"`
+	RecipientsCount int       `json:"recipients_count"`
+	Transactional   bool      `json:"transactional"`
+}
+
+type CommunicationCategory struct {
+	Description *string `json:"description"`
+	Key         string  `json:"key"`
+	Name        string  `json:"name"`
+}
+
+type Consent struct {
+	At       time.Time    `json:"at"`
+	Category string       `json:"category"`
+	Channel  string       `json:"channel"`
+	Granted  bool         `json:"granted"`
+	Proof    ConsentProof `json:"proof"`
+	Source   string       `json:"source"`
+}
+
+type ConsentProof struct {
+	Form      *string `json:"form"`
+	ImportID  *string `json:"import_id"`
+	IP        *string `json:"ip"`
+	Text      *string `json:"text"`
+	UserAgent *string `json:"user_agent"`
+}
+
+type Contact struct {
+	Aliases            []string        `json:"aliases"`
+	Attributes         json.RawMessage `json:"attributes"`
+	ConfirmationSentAt *time.Time      `json:"confirmation_sent_at"`
+	Consents           []Consent       `json:"consents"`
+	Email              *string         `json:"email"`
+	ExternalID         *string         `json:"external_id"`
+	FullName           string          `json:"full_name"`
+	GivenName          *string         `json:"given_name"`
+	ID                 string          `json:"id"`
+	Lang               *string         `json:"lang"`
+	LastName           *string         `json:"last_name"`
+	MergeTags          json.RawMessage `json:"merge_tags"`
+	NotificationTokens []string        `json:"notification_tokens"`
+	OrganizationID     string          `json:"organization_id"`
+	PhoneNumber        *string         `json:"phone_number"`
+	Stats              ContactStats    `json:"stats"`
+	Status             string          `json:"status"`
+	SubscribedAt       *time.Time      `json:"subscribed_at"`
+}
+
+type ContactAttribute struct {
+	CreatedAt      time.Time `json:"created_at"`
+	ID             string    `json:"id"`
+	Key            string    `json:"key"`
+	Name           *string   `json:"name"`
+	Options        []string  `json:"options"`
+	OrganizationID string    `json:"organization_id"`
+	Type           string    `json:"type"`
+}
+
+type ContactConsent struct {
+	ActorID        *string      `json:"actor_id"`
+	At             time.Time    `json:"at"`
+	Category       string       `json:"category"`
+	Cause          string       `json:"cause"`
+	Channel        string       `json:"channel"`
+	ContactID      string       `json:"contact_id"`
+	CreatedAt      time.Time    `json:"created_at"`
+	Granted        bool         `json:"granted"`
+	ID             string       `json:"id"`
+	OrganizationID string       `json:"organization_id"`
+	Proof          ConsentProof `json:"proof"`
+	Source         string       `json:"source"`
+}
+
+type ContactDuplicate struct {
+	ContactIDs     []string  `json:"contact_ids"`
+	Contacts       []Contact `json:"contacts"`
+	DetectedAt     time.Time `json:"detected_at"`
+	DetectionID    string    `json:"detection_id"`
+	ID             string    `json:"id"`
+	Matches        []string  `json:"matches"`
+	OrganizationID string    `json:"organization_id"`
+}
+
+type ContactEmailSettings struct {
+	BlacklistMode   bool                     `json:"blacklist_mode"`
+	GoogleAnalytics *GoogleAnalyticsSettings `json:"google_analytics"`
+	RestrictionList []string                 `json:"restriction_list"`
+	UnsubscribeLink bool                     `json:"unsubscribe_link"`
+}
+
+type ContactExport struct {
+	CompletedAt *time.Time `json:"completed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Error       *string    `json:"error"`
+	Expired     bool       `json:"expired"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	Format      string     `json:"format"`
+	ID          string     `json:"id"`
+	Processed   int        `json:"processed"`
+	Size        int        `json:"size"`
+	Status      string     `json:"status"`
+	Total       int        `json:"total"`
+	URL         *string    `json:"url"`
+}
+
+type ContactImport struct {
+	CompletedAt *time.Time           `json:"completed_at"`
+	Created     int                  `json:"created"`
+	CreatedAt   time.Time            `json:"created_at"`
+	Error       *string              `json:"error"`
+	Errors      []ContactImportError `json:"errors"`
+	Failed      int                  `json:"failed"`
+	ID          string               `json:"id"`
+	Processed   int                  `json:"processed"`
+	Skipped     int                  `json:"skipped"`
+	StartedAt   *time.Time           `json:"started_at"`
+	Status      string               `json:"status"`
+	Total       int                  `json:"total"`
+	Updated     int                  `json:"updated"`
+}
+
+type ContactImportError struct {
+	Column  *string `json:"column"`
+	Message string  `json:"message"`
+	Row     int     `json:"row"`
+}
+
+type ContactSMSSettings struct {
+	UnsubscribeLink bool `json:"unsubscribe_link"`
+}
+
+type ContactSettings struct {
+	CommunicationCategories []CommunicationCategory `json:"communication_categories"`
+	Email                   ContactEmailSettings    `json:"email"`
+	OrganizationID          string                  `json:"organization_id"`
+	SMS                     ContactSMSSettings      `json:"sms"`
+	Tracking                TrackingSettings        `json:"tracking"`
+}
+
+type ContactStats struct {
+	Email         ContactStatsItem `json:"email"`
+	Notifications ContactStatsItem `json:"notifications"`
+	SMS           ContactStatsItem `json:"sms"`
+}
+
+type ContactStatsItem struct {
+	CampaignsSent      int       `json:"campaigns_sent"`
+	LastCampaignSent   time.Time `json:"last_campaign_sent"`
+	LastMessageClicked time.Time `json:"last_message_clicked"`
+	LastMessageOpened  time.Time `json:"last_message_opened"`
+	MessagesClicked    int       `json:"messages_clicked"`
+	MessagesOpened     int       `json:"messages_opened"`
+}
+
+type ContactTag struct {
+	ContactID      string `json:"contact_id"`
+	ID             string `json:"id"`
+	OrganizationID string `json:"organization_id"`
+	TagID          string `json:"tag_id"`
+}
+
+type ContactTransition struct {
+	ActorID        *string   `json:"actor_id"`
+	Cause          string    `json:"cause"`
+	ContactID      string    `json:"contact_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	From           *string   `json:"from"`
+	ID             string    `json:"id"`
+	OrganizationID string    `json:"organization_id"`
+	Reason         *string   `json:"reason"`
+	Source         string    `json:"source"`
+	SourceID       *string   `json:"source_id"`
+	To             string    `json:"to"`
+}
+
+type ContactsSearch struct {
+	Contacts  []Contact `json:"contacts"`
+	Total     int       `json:"total"`
+	Truncated bool      `json:"truncated"`
+}
+
+type DuplicatesDetection struct {
+	CompletedAt *time.Time `json:"completed_at"`
+	Contacts    int        `json:"contacts"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Error       *string    `json:"error"`
+	Groups      int        `json:"groups"`
+	ID          string     `json:"id"`
+	Processed   int        `json:"processed"`
+	StartedAt   *time.Time `json:"started_at"`
+	Status      string     `json:"status"`
+	Total       int        `json:"total"`
+}
+
+type EnrollAuthenticationResponse struct {
+	CreatedAt        string `json:"created_at"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	ID               string `json:"id"`
+	Name             string `json:"name"`
+	Type             string `json:"type"`
+}
+
+type GoogleAnalyticsSettings struct {
+	Content string `json:"content"`
+	Medium  string `json:"medium"`
+	Source  string `json:"source"`
+	Term    string `json:"term"`
+}
+
+type InCampaignData struct {
+	Category      *string `json:"category,omitempty"`
+	Channel       *string `json:"channel,omitempty"`
+	Transactional *bool   `json:"transactional,omitempty"`
+}
+
+type InCommunicationCategory struct {
+	Description *string `json:"description,omitempty"`
+	Key         string  `json:"key"`
+	Name        string  `json:"name"`
+}
+
+type InConsentChange struct {
+	Category string `json:"category"`
+	Channel  string `json:"channel"`
+	Granted  bool   `json:"granted"`
+}
+
+type InConsentProof struct {
+	Form      *string `json:"form,omitempty"`
+	ImportID  *string `json:"import_id,omitempty"`
+	IP        *string `json:"ip,omitempty"`
+	Text      *string `json:"text,omitempty"`
+	UserAgent *string `json:"user_agent,omitempty"`
+}
+
+type InContactData struct {
+	Attributes         json.RawMessage `json:"attributes,omitempty"`
+	Email              *string         `json:"email,omitempty"`
+	ExternalID         *string         `json:"external_id,omitempty"`
+	GivenName          *string         `json:"given_name,omitempty"`
+	Lang               *string         `json:"lang,omitempty"`
+	LastName           *string         `json:"last_name,omitempty"`
+	NotificationTokens []string        `json:"notification_tokens,omitempty"`
+	PhoneNumber        *string         `json:"phone_number,omitempty"`
+}
+
+type InContactFilter struct {
+	Email      *string  `json:"email,omitempty"`
+	ExternalID *string  `json:"external_id,omitempty"`
+	Lang       *string  `json:"lang,omitempty"`
+	SegmentID  *string  `json:"segment_id,omitempty"`
+	Status     *string  `json:"status,omitempty"`
+	TagIDs     []string `json:"tag_ids,omitempty"`
+}
+
+type InImportMapping struct {
+	Attribute *string `json:"attribute,omitempty"`
+	Column    string  `json:"column"`
+	Field     string  `json:"field"`
+}
+
+type InMergeField struct {
+	Attribute *string `json:"attribute,omitempty"`
+	ContactID string  `json:"contact_id"`
+	Field     string  `json:"field"`
+}
+
+type InSegmentCondition struct {
+	Attribute *string    `json:"attribute,omitempty"`
+	Channel   *string    `json:"channel,omitempty"`
+	Date      *time.Time `json:"date,omitempty"`
+	Days      *int       `json:"days,omitempty"`
+	Field     string     `json:"field"`
+	Number    *float64   `json:"number,omitempty"`
+	Operator  string     `json:"operator"`
+	Stat      *string    `json:"stat,omitempty"`
+	Value     *string    `json:"value,omitempty"`
+	Values    []string   `json:"values,omitempty"`
+}
+
+type InSegmentData struct {
+	Name         *string         `json:"name,omitempty"`
+	Rules        *InSegmentRules `json:"rules,omitempty"`
+	Subscription *int            `json:"subscription,omitempty"`
+	Type         *string         `json:"type,omitempty"`
+}
+
+type InSegmentRules struct {
+	Conditions []InSegmentCondition `json:"conditions,omitempty"`
+	Groups     []InSegmentRules     `json:"groups,omitempty"`
+	Operator   string               `json:"operator"`
+}
+
+type InTagData struct {
+	Description *string `json:"description,omitempty"`
+	Name        *string `json:"name,omitempty"`
+}
+
+type LoginResponse struct {
+	AccessToken      string `json:"access_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	ExpiresIn        int    `json:"expires_in"`
+	IDToken          string `json:"id_token"`
+	Scope            string `json:"scope"`
+	TokenType        string `json:"token_type"`
+}
+
+type MFAResponse struct {
+	AuthenticatorType string `json:"authenticator_type"`
+	BarcodeURI        string `json:"barcode_uri"`
+	Error             string `json:"error"`
+	Message           string `json:"message"`
+	Secret            string `json:"secret"`
+}
+
+type NewAPIKey struct {
+	CreatedAt      time.Time `json:"created_at"`
+	CreatedBy      string    `json:"created_by"`
+	ID             string    `json:"id"`
+	Key            string    `json:"key"`
+	Name           string    `json:"name"`
+	OrganizationID string    `json:"organization_id"`
+	Scopes         []string  `json:"scopes"`
+}
+
+// An object with a globally unique id
+type Node struct {
+	Typename string `json:"__typename"`
+	ID       string `json:"id"`
+}
+
+type SMTP struct {
+	AllowSelfSigned bool         `json:"allow_self_signed"`
+	Domains         []SMTPDomain `json:"domains"`
+	IPs             []SMTPIp     `json:"i_ps"`
+	OrganizationID  string       `json:"organization_id"`
+	TLSOnly         bool         `json:"tls_only"`
+}
+
+type SMTPDomain struct {
+	Host      string `json:"host"`
+	MailsSent int    `json:"mails_sent"`
+	Region    string `json:"region"`
+	TXTRecord string `json:"txt_record"`
+	Verified  bool   `json:"verified"`
+}
+
+type SMTPIp struct {
+	IP        string `json:"ip"`
+	MailsSent int    `json:"mails_sent"`
+	Region    string `json:"region"`
+	WarmingUp bool   `json:"warming_up"`
+}
+
+type SecuritySettings struct {
+	TwoFactorEnabled bool `json:"two_factor_enabled"`
+}
+
+type Segment struct {
+	ClickRate      int           `json:"click_rate"`
+	ContactsCount  int           `json:"contacts_count"`
+	CreatedAt      time.Time     `json:"created_at"`
+	ID             string        `json:"id"`
+	MailsSentCount int           `json:"mails_sent_count"`
+	Name           *string       `json:"name"`
+	OpenRate       float64       `json:"open_rate"`
+	OpensCount     int           `json:"opens_count"`
+	OrganizationID string        `json:"organization_id"`
+	RefreshedAt    *time.Time    `json:"refreshed_at"`
+	Rules          *SegmentRules `json:"rules"`
+	SnapshotAt     *time.Time    `json:"snapshot_at"`
+	Subscription   *int          `json:"subscription"`
+	Type           *string       `json:"type"`
+}
+
+type SegmentCondition struct {
+	Attribute *string    `json:"attribute"`
+	Channel   *string    `json:"channel"`
+	Date      *time.Time `json:"date"`
+	Days      *int       `json:"days"`
+	Field     string     `json:"field"`
+	Number    *float64   `json:"number"`
+	Operator  string     `json:"operator"`
+	Stat      *string    `json:"stat"`
+	Value     *string    `json:"value"`
+	Values    []string   `json:"values"`
+}
+
+type SegmentPreview struct {
+	ContactsCount int `json:"contacts_count"`
+}
+
+type SegmentRules struct {
+	Conditions []SegmentCondition `json:"conditions"`
+	Groups     []SegmentRules     `json:"groups"`
+	Operator   string             `json:"operator"`
+}
+
+type Tag struct {
+	ContactsCount  int       `json:"contacts_count"`
+	CreatedAt      time.Time `json:"created_at"`
+	Description    *string   `json:"description"`
+	ID             string    `json:"id"`
+	Name           *string   `json:"name"`
+	OrganizationID string    `json:"organization_id"`
+}
+
+type TeamMember struct {
+	CreatedAt           time.Time  `json:"created_at"`
+	Email               string     `json:"email"`
+	ID                  string     `json:"id"`
+	InvitationExpiresAt *time.Time `json:"invitation_expires_at"`
+	IsPending           bool       `json:"is_pending"`
+	Name                string     `json:"name"`
+	OrganizationID      string     `json:"organization_id"`
+	ProfilePicture      string     `json:"profile_picture"`
+	Role                string     `json:"role"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	UserID              string     `json:"user_id"`
+}
+
+type TrackingSettings struct {
+	ClickTracking   bool                     `json:"click_tracking"`
+	GoogleAnalytics *GoogleAnalyticsSettings `json:"google_analytics"`
+	OpenTracking    bool                     `json:"open_tracking"`
+}
+
+type User struct {
+	Country        string    `json:"country"`
+	CreatedAt      time.Time `json:"created_at"`
+	Email          string    `json:"email"`
+	ID             string    `json:"id"`
+	Lang           string    `json:"lang"`
+	Name           string    `json:"name"`
+	ProfilePicture string    `json:"profile_picture"`
+	TimeFormat     string    `json:"time_format"`
+	TimeZone       string    `json:"time_zone"`
+	Title          string    `json:"title"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type UserNotifications struct {
+	Promotions bool `json:"promotions"`
+	Reports    bool `json:"reports"`
+	Security   bool `json:"security"`
+	Tips       bool `json:"tips"`
+	Updates    bool `json:"updates"`
+}
+
+const queryAPIKeys = "query APIKeys($first: Int, $offset: Int) { api_keys(first: $first, offset: $offset) { created_at created_by id name organization_id scopes } }"
+
+type APIKeysArgs struct {
+	First  *int `json:"first,omitempty"`
+	Offset *int `json:"offset,omitempty"`
+}
+
+func (c *Client) APIKeys(ctx context.Context, args APIKeysArgs) ([]APIKey, error) {
+	res := struct {
+		Value []APIKey `json:"api_keys"`
+	}{}
+
+	err := c.Do(ctx, queryAPIKeys, "APIKeys", args, &res, false)
+	return res.Value, err
+}
+
+const queryCampaign = "query Campaign($id: String!) { campaign(id: $id) { category channel created_at draft id organization_id recipients_count transactional } }"
+
+type CampaignArgs struct {
+	ID string `json:"id"`
+}
+
+func (c *Client) Campaign(ctx context.Context, args CampaignArgs) (*Campaign, error) {
+	res := struct {
+		Value *Campaign `json:"campaign"`
+	}{}
+
+	err := c.Do(ctx, queryCampaign, "Campaign", args, &res, false)
+	return res.Value, err
+}
+
+const queryCampaigns = "query Campaigns($first: Int, $offset: Int) { campaigns(first: $first, offset: $offset) { category channel created_at draft id organization_id recipients_count transactional } }"
+
+type CampaignsArgs struct {
+	First  *int `json:"first,omitempty"`
+	Offset *int `json:"offset,omitempty"`
+}
+
+func (c *Client) Campaigns(ctx context.Context, args CampaignsArgs) ([]Campaign, error) {
+	res := struct {
+		Value []Campaign `json:"campaigns"`
+	}{}
+
+	err := c.Do(ctx, queryCampaigns, "Campaigns", args, &res, false)
+	return res.Value, err
+}
+
+const queryContact = "query Contact($id: String!) { contact(id: $id) { aliases attributes confirmation_sent_at consents { at category channel granted proof { form import_id ip text user_agent } source } email external_id full_name given_name id lang last_name merge_tags notification_tokens organization_id phone_number stats { email { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } notifications { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } sms { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } } status subscribed_at } }"
+
+type ContactArgs struct {
+	ID string `json:"id"`
+}
+
+func (c *Client) Contact(ctx context.Context, args ContactArgs) (*Contact, error) {
+	res := struct {
+		Value *Contact `json:"contact"`
+	}{}
+
+	err := c.Do(ctx, queryContact, "Contact", args, &res, false)
+	return res.Value, err
+}
+
+const queryContactAttributes = "query ContactAttributes($first: Int, $offset: Int) { contact_attributes(first: $first, offset: $offset) { created_at id key name options organization_id type } }"
+
+type ContactAttributesArgs struct {
+	First  *int `json:"first,omitempty"`
+	Offset *int `json:"offset,omitempty"`
+}
+
+func (c *Client) ContactAttributes(ctx context.Context, args ContactAttributesArgs) ([]ContactAttribute, error) {
+	res := struct {
+		Value []ContactAttribute `json:"contact_attributes"`
+	}{}
+
+	err := c.Do(ctx, queryContactAttributes, "ContactAttributes", args, &res, false)
+	return res.Value, err
+}
+
+const queryContactConsents = "query ContactConsents($id: String!) { contact_consents(id: $id) { actor_id at category cause channel contact_id created_at granted id organization_id proof { form import_id ip text user_agent } source } }"
+
+type ContactConsentsArgs struct {
+	ID string `json:"id"`
+}
+
+func (c *Client) ContactConsents(ctx context.Context, args ContactConsentsArgs) ([]ContactConsent, error) {
+	res := struct {
+		Value []ContactConsent `json:"contact_consents"`
+	}{}
+
+	err := c.Do(ctx, queryContactConsents, "ContactConsents", args, &res, false)
+	return res.Value, err
+}
+
+const queryContactExport = "query ContactExport($id: String!) { contact_export(id: $id) { completed_at created_at error expired expires_at format id processed size status total url } }"
+
+type ContactExportArgs struct {
+	ID string `json:"id"`
+}
+
+func (c *Client) ContactExport(ctx context.Context, args ContactExportArgs) (*ContactExport, error) {
+	res := struct {
+		Value *ContactExport `json:"contact_export"`
+	}{}
+
+	err := c.Do(ctx, queryContactExport, "ContactExport", args, &res, false)
+	return res.Value, err
+}
+
+const queryContactExports = "query ContactExports($first: Int, $offset: Int) { contact_exports(first: $first, offset: $offset) { completed_at created_at error expired expires_at format id processed size status total url } }"
+
+type ContactExportsArgs struct {
+	First  *int `json:"first,omitempty"`
+	Offset *int `json:"offset,omitempty"`
+}
+
+func (c *Client) ContactExports(ctx context.Context, args ContactExportsArgs) ([]ContactExport, error) {
+	res := struct {
+		Value []ContactExport `json:"contact_exports"`
+	}{}
+
+	err := c.Do(ctx, queryContactExports, "ContactExports", args, &res, false)
+	return res.Value, err
+}
+
+const queryContactImport = "query ContactImport($id: String!) { contact_import(id: $id) { completed_at created created_at error errors { column message row } failed id processed skipped started_at status total updated } }"
+
+type ContactImportArgs struct {
+	ID string `json:"id"`
+}
+
+func (c *Client) ContactImport(ctx context.Context, args ContactImportArgs) (*ContactImport, error) {
+	res := struct {
+		Value *ContactImport `json:"contact_import"`
+	}{}
+
+	err := c.Do(ctx, queryContactImport, "ContactImport", args, &res, false)
+	return res.Value, err
+}
+
+const queryContactImports = "query ContactImports($first: Int, $offset: Int) { contact_imports(first: $first, offset: $offset) { completed_at created created_at error errors { column message row } failed id processed skipped started_at status total updated } }"
+
+type ContactImportsArgs struct {
+	First  *int `json:"first,omitempty"`
+	Offset *int `json:"offset,omitempty"`
+}
+
+func (c *Client) ContactImports(ctx context.Context, args ContactImportsArgs) ([]ContactImport, error) {
+	res := struct {
+		Value []ContactImport `json:"contact_imports"`
+	}{}
+
+	err := c.Do(ctx, queryContactImports, "ContactImports", args, &res, false)
+	return res.Value, err
+}
+
+const queryContactSettings = "query ContactSettings { contact_settings { communication_categories { description key name } email { blacklist_mode google_analytics { content medium source term } restriction_list unsubscribe_link } organization_id sms { unsubscribe_link } tracking { click_tracking google_analytics { content medium source term } open_tracking } } }"
+
+func (c *Client) ContactSettings(ctx context.Context) (*ContactSettings, error) {
+	res := struct {
+		Value *ContactSettings `json:"contact_settings"`
+	}{}
+
+	err := c.Do(ctx, queryContactSettings, "ContactSettings", nil, &res, false)
+	return res.Value, err
+}
+
+const queryContactTransitions = "query ContactTransitions($id: String!) { contact_transitions(id: $id) { actor_id cause contact_id created_at from id organization_id reason source source_id to } }"
+
+type ContactTransitionsArgs struct {
+	ID string `json:"id"`
+}
+
+func (c *Client) ContactTransitions(ctx context.Context, args ContactTransitionsArgs) ([]ContactTransition, error) {
+	res := struct {
+		Value []ContactTransition `json:"contact_transitions"`
+	}{}
+
+	err := c.Do(ctx, queryContactTransitions, "ContactTransitions", args, &res, false)
+	return res.Value, err
+}
+
+const queryContacts = "query Contacts($first: Int, $offset: Int, $search: String) { contacts(first: $first, offset: $offset, search: $search) { aliases attributes confirmation_sent_at consents { at category channel granted proof { form import_id ip text user_agent } source } email external_id full_name given_name id lang last_name merge_tags notification_tokens organization_id phone_number stats { email { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } notifications { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } sms { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } } status subscribed_at } }"
+
+type ContactsArgs struct {
+	First  *int    `json:"first,omitempty"`
+	Offset *int    `json:"offset,omitempty"`
+	Search *string `json:"search,omitempty"`
+}
+
+func (c *Client) Contacts(ctx context.Context, args ContactsArgs) ([]Contact, error) {
+	res := struct {
+		Value []Contact `json:"contacts"`
+	}{}
+
+	err := c.Do(ctx, queryContacts, "Contacts", args, &res, false)
+	return res.Value, err
+}
+
+const queryDuplicates = "query Duplicates($first: Int, $offset: Int) { duplicates(first: $first, offset: $offset) { contact_ids contacts { aliases attributes confirmation_sent_at consents { at category channel granted source } email external_id full_name given_name id lang last_name merge_tags notification_tokens organization_id phone_number stats {  } status subscribed_at } detected_at detection_id id matches organization_id } }"
+
+type DuplicatesArgs struct {
+	First  *int `json:"first,omitempty"`
+	Offset *int `json:"offset,omitempty"`
+}
+
+func (c *Client) Duplicates(ctx context.Context, args DuplicatesArgs) ([]ContactDuplicate, error) {
+	res := struct {
+		Value []ContactDuplicate `json:"duplicates"`
+	}{}
+
+	err := c.Do(ctx, queryDuplicates, "Duplicates", args, &res, false)
+	return res.Value, err
+}
+
+const queryDuplicatesDetection = "query DuplicatesDetection($id: String!) { duplicates_detection(id: $id) { completed_at contacts created_at error groups id processed started_at status total } }"
+
+type DuplicatesDetectionArgs struct {
+	ID string `json:"id"`
+}
+
+func (c *Client) DuplicatesDetection(ctx context.Context, args DuplicatesDetectionArgs) (*DuplicatesDetection, error) {
+	res := struct {
+		Value *DuplicatesDetection `json:"duplicates_detection"`
+	}{}
+
+	err := c.Do(ctx, queryDuplicatesDetection, "DuplicatesDetection", args, &res, false)
+	return res.Value, err
+}
+
+const queryListMFA = "query ListMFA { list_mfa { confirmed id type } }"
+
+func (c *Client) ListMFA(ctx context.Context) ([]Auth0Method, error) {
+	res := struct {
+		Value []Auth0Method `json:"list_mfa"`
+	}{}
+
+	err := c.Do(ctx, queryListMFA, "ListMFA", nil, &res, false)
+	return res.Value, err
+}
+
+const queryNode = "query Node($id: ID!) { node(id: $id) { __typename id } }"
+
+type NodeArgs struct {
+	ID string `json:"id"`
+}
+
+// Fetch any object by its id
+func (c *Client) Node(ctx context.Context, args NodeArgs) (*Node, error) {
+	res := struct {
+		Value *Node `json:"node"`
+	}{}
+
+	err := c.Do(ctx, queryNode, "Node", args, &res, false)
+	return res.Value, err
+}
+
+const queryNodes = "query Nodes($ids: [ID!]!) { nodes(ids: $ids) { __typename id } }"
+
+type NodesArgs struct {
+	IDs []string `json:"ids"`
+}
+
+// Fetch a list of objects by their ids
+func (c *Client) Nodes(ctx context.Context, args NodesArgs) ([]*Node, error) {
+	res := struct {
+		Value []*Node `json:"nodes"`
+	}{}
+
+	err := c.Do(ctx, queryNodes, "Nodes", args, &res, false)
+	return res.Value, err
+}
+
+const queryPreviewSegment = "query PreviewSegment($rules: InSegmentRules!) { preview_segment(rules: $rules) { contacts_count } }"
+
+type PreviewSegmentArgs struct {
+	Rules InSegmentRules `json:"rules"`
+}
+
+func (c *Client) PreviewSegment(ctx context.Context, args PreviewSegmentArgs) (SegmentPreview, error) {
+	res := struct {
+		Value SegmentPreview `json:"preview_segment"`
+	}{}
+
+	err := c.Do(ctx, queryPreviewSegment, "PreviewSegment", args, &res, false)
+	return res.Value, err
+}
+
+const querySearchContacts = "query SearchContacts($first: Int, $offset: Int, $query: String!) { search_contacts(first: $first, offset: $offset, query: $query) { contacts { aliases attributes confirmation_sent_at consents { at category channel granted source } email external_id full_name given_name id lang last_name merge_tags notification_tokens organization_id phone_number stats {  } status subscribed_at } total truncated } }"
+
+type SearchContactsArgs struct {
+	First  *int   `json:"first,omitempty"`
+	Offset *int   `json:"offset,omitempty"`
+	Query  string `json:"query"`
+}
+
+func (c *Client) SearchContacts(ctx context.Context, args SearchContactsArgs) (ContactsSearch, error) {
+	res := struct {
+		Value ContactsSearch `json:"search_contacts"`
+	}{}
+
+	err := c.Do(ctx, querySearchContacts, "SearchContacts", args, &res, false)
+	return res.Value, err
+}
+
+const querySecuritySettings = "query SecuritySettings { security_settings { two_factor_enabled } }"
+
+func (c *Client) SecuritySettings(ctx context.Context) (SecuritySettings, error) {
+	res := struct {
+		Value SecuritySettings `json:"security_settings"`
+	}{}
+
+	err := c.Do(ctx, querySecuritySettings, "SecuritySettings", nil, &res, false)
+	return res.Value, err
+}
+
+const querySegmentContacts = "query SegmentContacts($first: Int, $id: String!, $offset: Int) { segment_contacts(first: $first, id: $id, offset: $offset) { aliases attributes confirmation_sent_at consents { at category channel granted proof { form import_id ip text user_agent } source } email external_id full_name given_name id lang last_name merge_tags notification_tokens organization_id phone_number stats { email { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } notifications { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } sms { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } } status subscribed_at } }"
+
+type SegmentContactsArgs struct {
+	First  *int   `json:"first,omitempty"`
+	ID     string `json:"id"`
+	Offset *int   `json:"offset,omitempty"`
+}
+
+func (c *Client) SegmentContacts(ctx context.Context, args SegmentContactsArgs) ([]Contact, error) {
+	res := struct {
+		Value []Contact `json:"segment_contacts"`
+	}{}
+
+	err := c.Do(ctx, querySegmentContacts, "SegmentContacts", args, &res, false)
+	return res.Value, err
+}
+
+const querySegments = "query Segments($first: Int, $offset: Int) { segments(first: $first, offset: $offset) { click_rate contacts_count created_at id mails_sent_count name open_rate opens_count organization_id refreshed_at rules { conditions { attribute channel date days field number operator stat value values } operator } snapshot_at subscription type } }"
+
+type SegmentsArgs struct {
+	First  *int `json:"first,omitempty"`
+	Offset *int `json:"offset,omitempty"`
+}
+
+func (c *Client) Segments(ctx context.Context, args SegmentsArgs) ([]Segment, error) {
+	res := struct {
+		Value []Segment `json:"segments"`
+	}{}
+
+	err := c.Do(ctx, querySegments, "Segments", args, &res, false)
+	return res.Value, err
+}
+
+const querySMTP = "query SMTP { smtp { allow_self_signed domains { host mails_sent region txt_record verified } i_ps { ip mails_sent region warming_up } organization_id tls_only } }"
+
+func (c *Client) SMTP(ctx context.Context) (*SMTP, error) {
+	res := struct {
+		Value *SMTP `json:"smtp"`
+	}{}
+
+	err := c.Do(ctx, querySMTP, "SMTP", nil, &res, false)
+	return res.Value, err
+}
+
+const queryTags = "query Tags($first: Int, $offset: Int) { tags(first: $first, offset: $offset) { contacts_count created_at description id name organization_id } }"
+
+type TagsArgs struct {
+	First  *int `json:"first,omitempty"`
+	Offset *int `json:"offset,omitempty"`
+}
+
+func (c *Client) Tags(ctx context.Context, args TagsArgs) ([]Tag, error) {
+	res := struct {
+		Value []Tag `json:"tags"`
+	}{}
+
+	err := c.Do(ctx, queryTags, "Tags", args, &res, false)
+	return res.Value, err
+}
+
+const queryTeamMembers = "query TeamMembers($first: Int, $offset: Int) { team_members(first: $first, offset: $offset) { created_at email id invitation_expires_at is_pending name organization_id profile_picture role updated_at user_id } }"
+
+type TeamMembersArgs struct {
+	First  *int `json:"first,omitempty"`
+	Offset *int `json:"offset,omitempty"`
+}
+
+func (c *Client) TeamMembers(ctx context.Context, args TeamMembersArgs) ([]TeamMember, error) {
+	res := struct {
+		Value []TeamMember `json:"team_members"`
+	}{}
+
+	err := c.Do(ctx, queryTeamMembers, "TeamMembers", args, &res, false)
+	return res.Value, err
+}
+
+const queryUser = "query User { user { country created_at email id lang name profile_picture time_format time_zone title updated_at } }"
+
+func (c *Client) User(ctx context.Context) (*User, error) {
+	res := struct {
+		Value *User `json:"user"`
+	}{}
+
+	err := c.Do(ctx, queryUser, "User", nil, &res, false)
+	return res.Value, err
+}
+
+const mutationAcceptInvitation = "mutation AcceptInvitation($token: String!) { accept_invitation(token: $token) { created_at email id invitation_expires_at is_pending name organization_id profile_picture role updated_at user_id } }"
+
+type AcceptInvitationArgs struct {
+	Token string `json:"token"`
+}
+
+func (c *Client) AcceptInvitation(ctx context.Context, args AcceptInvitationArgs) (TeamMember, error) {
+	res := struct {
+		Value TeamMember `json:"accept_invitation"`
+	}{}
+
+	err := c.Do(ctx, mutationAcceptInvitation, "AcceptInvitation", args, &res, true)
+	return res.Value, err
+}
+
+const mutationAddContact = "mutation AddContact($attributes: JSON, $email: String, $external_id: String, $given_name: String, $lang: String, $last_name: String, $notification_tokens: [String!], $phone_number: String) { add_contact(attributes: $attributes, email: $email, external_id: $external_id, given_name: $given_name, lang: $lang, last_name: $last_name, notification_tokens: $notification_tokens, phone_number: $phone_number) { aliases attributes confirmation_sent_at consents { at category channel granted proof { form import_id ip text user_agent } source } email external_id full_name given_name id lang last_name merge_tags notification_tokens organization_id phone_number stats { email { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } notifications { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } sms { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } } status subscribed_at } }"
+
+type AddContactArgs struct {
+	Attributes         json.RawMessage `json:"attributes,omitempty"`
+	Email              *string         `json:"email,omitempty"`
+	ExternalID         *string         `json:"external_id,omitempty"`
+	GivenName          *string         `json:"given_name,omitempty"`
+	Lang               *string         `json:"lang,omitempty"`
+	LastName           *string         `json:"last_name,omitempty"`
+	NotificationTokens []string        `json:"notification_tokens,omitempty"`
+	PhoneNumber        *string         `json:"phone_number,omitempty"`
+}
+
+func (c *Client) AddContact(ctx context.Context, args AddContactArgs) (Contact, error) {
+	res := struct {
+		Value Contact `json:"add_contact"`
+	}{}
+
+	err := c.Do(ctx, mutationAddContact, "AddContact", args, &res, true)
+	return res.Value, err
+}
+
+const mutationAddRestrictedEmail = "mutation AddRestrictedEmail($email: String!) { add_restricted_email(email: $email) { communication_categories { description key name } email { blacklist_mode google_analytics { content medium source term } restriction_list unsubscribe_link } organization_id sms { unsubscribe_link } tracking { click_tracking google_analytics { content medium source term } open_tracking } } }"
+
+type AddRestrictedEmailArgs struct {
+	Email string `json:"email"`
+}
+
+func (c *Client) AddRestrictedEmail(ctx context.Context, args AddRestrictedEmailArgs) (ContactSettings, error) {
+	res := struct {
+		Value ContactSettings `json:"add_restricted_email"`
+	}{}
+
+	err := c.Do(ctx, mutationAddRestrictedEmail, "AddRestrictedEmail", args, &res, true)
+	return res.Value, err
+}
+
+const mutationAddTag = "mutation AddTag($description: String, $name: String) { add_tag(description: $description, name: $name) { contacts_count created_at description id name organization_id } }"
+
+type AddTagArgs struct {
+	Description *string `json:"description,omitempty"`
+	Name        *string `json:"name,omitempty"`
+}
+
+func (c *Client) AddTag(ctx context.Context, args AddTagArgs) (Tag, error) {
+	res := struct {
+		Value Tag `json:"add_tag"`
+	}{}
+
+	err := c.Do(ctx, mutationAddTag, "AddTag", args, &res, true)
+	return res.Value, err
+}
+
+const mutationAssignTag = "mutation AssignTag($contact_id: String!, $tag_id: String!) { assign_tag(contact_id: $contact_id, tag_id: $tag_id) { contact_id id organization_id tag_id } }"
+
+type AssignTagArgs struct {
+	ContactID string `json:"contact_id"`
+	TagID     string `json:"tag_id"`
+}
+
+func (c *Client) AssignTag(ctx context.Context, args AssignTagArgs) (ContactTag, error) {
+	res := struct {
+		Value ContactTag `json:"assign_tag"`
+	}{}
+
+	err := c.Do(ctx, mutationAssignTag, "AssignTag", args, &res, true)
+	return res.Value, err
+}
+
+const mutationAssignTags = "mutation AssignTags($filter: InContactFilter, $ids: [String!], $tag_ids: [String!]) { assign_tags(filter: $filter, ids: $ids, tag_ids: $tag_ids) { failed items { error id index status } succeeded total } }"
+
+type AssignTagsArgs struct {
+	Filter *InContactFilter `json:"filter,omitempty"`
+	IDs    []string         `json:"ids,omitempty"`
+	TagIDs []string         `json:"tag_ids,omitempty"`
+}
+
+func (c *Client) AssignTags(ctx context.Context, args AssignTagsArgs) (BulkResult, error) {
+	res := struct {
+		Value BulkResult `json:"assign_tags"`
+	}{}
+
+	err := c.Do(ctx, mutationAssignTags, "AssignTags", args, &res, true)
+	return res.Value, err
+}
+
+const mutationBulkDeleteContacts = "mutation BulkDeleteContacts($filter: InContactFilter, $ids: [String!]) { bulk_delete_contacts(filter: $filter, ids: $ids) { failed items { error id index status } succeeded total } }"
+
+type BulkDeleteContactsArgs struct {
+	Filter *InContactFilter `json:"filter,omitempty"`
+	IDs    []string         `json:"ids,omitempty"`
+}
+
+func (c *Client) BulkDeleteContacts(ctx context.Context, args BulkDeleteContactsArgs) (BulkResult, error) {
+	res := struct {
+		Value BulkResult `json:"bulk_delete_contacts"`
+	}{}
+
+	err := c.Do(ctx, mutationBulkDeleteContacts, "BulkDeleteContacts", args, &res, true)
+	return res.Value, err
+}
+
+const mutationBulkUpsertContacts = "mutation BulkUpsertContacts($contacts: [InContactData!], $mode: String, $tag_ids: [String!]) { bulk_upsert_contacts(contacts: $contacts, mode: $mode, tag_ids: $tag_ids) { failed items { error id index status } succeeded total } }"
+
+type BulkUpsertContactsArgs struct {
+	Contacts []InContactData `json:"contacts,omitempty"`
+	Mode     *string         `json:"mode,omitempty"`
+	TagIDs   []string        `json:"tag_ids,omitempty"`
+}
+
+func (c *Client) BulkUpsertContacts(ctx context.Context, args BulkUpsertContactsArgs) (BulkResult, error) {
+	res := struct {
+		Value BulkResult `json:"bulk_upsert_contacts"`
+	}{}
+
+	err := c.Do(ctx, mutationBulkUpsertContacts, "BulkUpsertContacts", args, &res, true)
+	return res.Value, err
+}
+
+const mutationConfirmMFA = "mutation ConfirmMFA($current_password: String!, $type: String!, $verification_code: String!) { confirm_mfa(current_password: $current_password, type: $type, verification_code: $verification_code) { access_token error error_description expires_in id_token scope token_type } }"
+
+type ConfirmMFAArgs struct {
+	CurrentPassword  string `json:"current_password"`
+	Type             string `json:"type"`
+	VerificationCode string `json:"verification_code"`
+}
+
+func (c *Client) ConfirmMFA(ctx context.Context, args ConfirmMFAArgs) (LoginResponse, error) {
+	res := struct {
+		Value LoginResponse `json:"confirm_mfa"`
+	}{}
+
+	err := c.Do(ctx, mutationConfirmMFA, "ConfirmMFA", args, &res, true)
+	return res.Value, err
+}
+
+const mutationCreateAPIKey = "mutation CreateAPIKey($name: String!, $scopes: [String!]) { create_api_key(name: $name, scopes: $scopes) { created_at created_by id key name organization_id scopes } }"
+
+type CreateAPIKeyArgs struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+func (c *Client) CreateAPIKey(ctx context.Context, args CreateAPIKeyArgs) (NewAPIKey, error) {
+	res := struct {
+		Value NewAPIKey `json:"create_api_key"`
+	}{}
+
+	err := c.Do(ctx, mutationCreateAPIKey, "CreateAPIKey", args, &res, true)
+	return res.Value, err
+}
+
+const mutationCreateCampaign = "mutation CreateCampaign($category: String, $channel: String!, $transactional: Boolean) { create_campaign(category: $category, channel: $channel, transactional: $transactional) { category channel created_at draft id organization_id recipients_count transactional } }"
+
+type CreateCampaignArgs struct {
+	Category      *string `json:"category,omitempty"`
+	Channel       string  `json:"channel"`
+	Transactional *bool   `json:"transactional,omitempty"`
+}
+
+func (c *Client) CreateCampaign(ctx context.Context, args CreateCampaignArgs) (Campaign, error) {
+	res := struct {
+		Value Campaign `json:"create_campaign"`
+	}{}
+
+	err := c.Do(ctx, mutationCreateCampaign, "CreateCampaign", args, &res, true)
+	return res.Value, err
+}
+
+const mutationCreateContactAttribute = "mutation CreateContactAttribute($key: String!, $name: String, $options: [String!], $type: String!) { create_contact_attribute(key: $key, name: $name, options: $options, type: $type) { created_at id key name options organization_id type } }"
+
+type CreateContactAttributeArgs struct {
+	Key     string   `json:"key"`
+	Name    *string  `json:"name,omitempty"`
+	Options []string `json:"options,omitempty"`
+	Type    string   `json:"type"`
+}
+
+func (c *Client) CreateContactAttribute(ctx context.Context, args CreateContactAttributeArgs) (ContactAttribute, error) {
+	res := struct {
+		Value ContactAttribute `json:"create_contact_attribute"`
+	}{}
+
+	err := c.Do(ctx, mutationCreateContactAttribute, "CreateContactAttribute", args, &res, true)
+	return res.Value, err
+}
+
+const mutationCreateSegment = "mutation CreateSegment($name: String, $rules: InSegmentRules, $subscription: Int, $type: String) { create_segment(name: $name, rules: $rules, subscription: $subscription, type: $type) { click_rate contacts_count created_at id mails_sent_count name open_rate opens_count organization_id refreshed_at rules { conditions { attribute channel date days field number operator stat value values } operator } snapshot_at subscription type } }"
+
+type CreateSegmentArgs struct {
+	Name         *string         `json:"name,omitempty"`
+	Rules        *InSegmentRules `json:"rules,omitempty"`
+	Subscription *int            `json:"subscription,omitempty"`
+	Type         *string         `json:"type,omitempty"`
+}
+
+func (c *Client) CreateSegment(ctx context.Context, args CreateSegmentArgs) (Segment, error) {
+	res := struct {
+		Value Segment `json:"create_segment"`
+	}{}
+
+	err := c.Do(ctx, mutationCreateSegment, "CreateSegment", args, &res, true)
+	return res.Value, err
+}
+
+const mutationDeleteContact = "mutation DeleteContact($id: String!) { delete_contact(id: $id) }"
+
+type DeleteContactArgs struct {
+	ID string `json:"id"`
+}
+
+func (c *Client) DeleteContact(ctx context.Context, args DeleteContactArgs) (bool, error) {
+	res := struct {
+		Value bool `json:"delete_contact"`
+	}{}
+
+	err := c.Do(ctx, mutationDeleteContact, "DeleteContact", args, &res, true)
+	return res.Value, err
+}
+
+const mutationDeleteContactAttribute = "mutation DeleteContactAttribute($id: String!) { delete_contact_attribute(id: $id) }"
+
+type DeleteContactAttributeArgs struct {
+	ID string `json:"id"`
+}
+
+func (c *Client) DeleteContactAttribute(ctx context.Context, args DeleteContactAttributeArgs) (bool, error) {
+	res := struct {
+		Value bool `json:"delete_contact_attribute"`
+	}{}
+
+	err := c.Do(ctx, mutationDeleteContactAttribute, "DeleteContactAttribute", args, &res, true)
+	return res.Value, err
+}
+
+const mutationDeleteSegment = "mutation DeleteSegment($id: String!) { delete_segment(id: $id) }"
+
+type DeleteSegmentArgs struct {
+	ID string `json:"id"`
+}
+
+func (c *Client) DeleteSegment(ctx context.Context, args DeleteSegmentArgs) (bool, error) {
+	res := struct {
+		Value bool `json:"delete_segment"`
+	}{}
+
+	err := c.Do(ctx, mutationDeleteSegment, "DeleteSegment", args, &res, true)
+	return res.Value, err
+}
+
+const mutationDeleteTag = "mutation DeleteTag($id: String!) { delete_tag(id: $id) }"
+
+type DeleteTagArgs struct {
+	ID string `json:"id"`
+}
+
+func (c *Client) DeleteTag(ctx context.Context, args DeleteTagArgs) (bool, error) {
+	res := struct {
+		Value bool `json:"delete_tag"`
+	}{}
+
+	err := c.Do(ctx, mutationDeleteTag, "DeleteTag", args, &res, true)
+	return res.Value, err
+}
+
+const mutationDetectDuplicates = "mutation DetectDuplicates { detect_duplicates { completed_at contacts created_at error groups id processed started_at status total } }"
+
+func (c *Client) DetectDuplicates(ctx context.Context) (DuplicatesDetection, error) {
+	res := struct {
+		Value DuplicatesDetection `json:"detect_duplicates"`
+	}{}
+
+	err := c.Do(ctx, mutationDetectDuplicates, "DetectDuplicates", nil, &res, true)
+	return res.Value, err
+}
+
+const mutationEditNotificationPreferences = "mutation EditNotificationPreferences($promotions: Boolean!, $reports: Boolean!, $security: Boolean!, $tips: Boolean!, $updates: Boolean!) { edit_notification_preferences(promotions: $promotions, reports: $reports, security: $security, tips: $tips, updates: $updates) { promotions reports security tips updates } }"
+
+type EditNotificationPreferencesArgs struct {
+	Promotions bool `json:"promotions"`
+	Reports    bool `json:"reports"`
+	Security   bool `json:"security"`
+	Tips       bool `json:"tips"`
+	Updates    bool `json:"updates"`
+}
+
+func (c *Client) EditNotificationPreferences(ctx context.Context, args EditNotificationPreferencesArgs) (UserNotifications, error) {
+	res := struct {
+		Value UserNotifications `json:"edit_notification_preferences"`
+	}{}
+
+	err := c.Do(ctx, mutationEditNotificationPreferences, "EditNotificationPreferences", args, &res, true)
+	return res.Value, err
+}
+
+const mutationEditUser = "mutation EditUser($lang: String, $name: String, $title: String) { edit_user(lang: $lang, name: $name, title: $title) { country created_at email id lang name profile_picture time_format time_zone title updated_at } }"
+
+type EditUserArgs struct {
+	Lang  *string `json:"lang,omitempty"`
+	Name  *string `json:"name,omitempty"`
+	Title *string `json:"title,omitempty"`
+}
+
+func (c *Client) EditUser(ctx context.Context, args EditUserArgs) (User, error) {
+	res := struct {
+		Value User `json:"edit_user"`
+	}{}
+
+	err := c.Do(ctx, mutationEditUser, "EditUser", args, &res, true)
+	return res.Value, err
+}
+
+const mutationEnrollAuthenticationMethod = "mutation EnrollAuthenticationMethod($current_password: String!, $secret: String!) { enroll_authentication_method(current_password: $current_password, secret: $secret) { created_at error error_description id name type } }"
+
+type EnrollAuthenticationMethodArgs struct {
+	CurrentPassword string `json:"current_password"`
+	Secret          string `json:"secret"`
+}
+
+func (c *Client) EnrollAuthenticationMethod(ctx context.Context, args EnrollAuthenticationMethodArgs) (EnrollAuthenticationResponse, error) {
+	res := struct {
+		Value EnrollAuthenticationResponse `json:"enroll_authentication_method"`
+	}{}
+
+	err := c.Do(ctx, mutationEnrollAuthenticationMethod, "EnrollAuthenticationMethod", args, &res, true)
+	return res.Value, err
+}
+
+const mutationEnrollMFA = "mutation EnrollMFA($type: String!) { enroll_mfa(type: $type) { authenticator_type barcode_uri error message secret } }"
+
+type EnrollMFAArgs struct {
+	Type string `json:"type"`
+}
+
+func (c *Client) EnrollMFA(ctx context.Context, args EnrollMFAArgs) (MFAResponse, error) {
+	res := struct {
+		Value MFAResponse `json:"enroll_mfa"`
+	}{}
+
+	err := c.Do(ctx, mutationEnrollMFA, "EnrollMFA", args, &res, true)
+	return res.Value, err
+}
+
+const mutationExportContacts = "mutation ExportContacts($columns: [String!], $filter: InContactFilter, $format: String) { export_contacts(columns: $columns, filter: $filter, format: $format) { completed_at created_at error expired expires_at format id processed size status total url } }"
+
+type ExportContactsArgs struct {
+	Columns []string         `json:"columns,omitempty"`
+	Filter  *InContactFilter `json:"filter,omitempty"`
+	Format  *string          `json:"format,omitempty"`
+}
+
+func (c *Client) ExportContacts(ctx context.Context, args ExportContactsArgs) (ContactExport, error) {
+	res := struct {
+		Value ContactExport `json:"export_contacts"`
+	}{}
+
+	err := c.Do(ctx, mutationExportContacts, "ExportContacts", args, &res, true)
+	return res.Value, err
+}
+
+const mutationImportContacts = "mutation ImportContacts($consent_proof: InConsentProof, $consents: [InConsentChange!], $delimiter: String, $mapping: [InImportMapping!], $mode: String, $tag_ids: [String!], $upload_id: String!) { import_contacts(consent_proof: $consent_proof, consents: $consents, delimiter: $delimiter, mapping: $mapping, mode: $mode, tag_ids: $tag_ids, upload_id: $upload_id) { completed_at created created_at error errors { column message row } failed id processed skipped started_at status total updated } }"
+
+type ImportContactsArgs struct {
+	ConsentProof *InConsentProof   `json:"consent_proof,omitempty"`
+	Consents     []InConsentChange `json:"consents,omitempty"`
+	Delimiter    *string           `json:"delimiter,omitempty"`
+	Mapping      []InImportMapping `json:"mapping,omitempty"`
+	Mode         *string           `json:"mode,omitempty"`
+	TagIDs       []string          `json:"tag_ids,omitempty"`
+	UploadID     string            `json:"upload_id"`
+}
+
+func (c *Client) ImportContacts(ctx context.Context, args ImportContactsArgs) (ContactImport, error) {
+	res := struct {
+		Value ContactImport `json:"import_contacts"`
+	}{}
+
+	err := c.Do(ctx, mutationImportContacts, "ImportContacts", args, &res, true)
+	return res.Value, err
+}
+
+const mutationInviteUser = "mutation InviteUser($email: String!, $role: String!) { invite_user(email: $email, role: $role) { created_at email id invitation_expires_at is_pending name organization_id profile_picture role updated_at user_id } }"
+
+type InviteUserArgs struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+func (c *Client) InviteUser(ctx context.Context, args InviteUserArgs) (TeamMember, error) {
+	res := struct {
+		Value TeamMember `json:"invite_user"`
+	}{}
+
+	err := c.Do(ctx, mutationInviteUser, "InviteUser", args, &res, true)
+	return res.Value, err
+}
+
+const mutationMergeContacts = "mutation MergeContacts($fields: [InMergeField!], $ids: [String!], $survivor_id: String!) { merge_contacts(fields: $fields, ids: $ids, survivor_id: $survivor_id) { aliases attributes confirmation_sent_at consents { at category channel granted proof { form import_id ip text user_agent } source } email external_id full_name given_name id lang last_name merge_tags notification_tokens organization_id phone_number stats { email { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } notifications { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } sms { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } } status subscribed_at } }"
+
+type MergeContactsArgs struct {
+	Fields     []InMergeField `json:"fields,omitempty"`
+	IDs        []string       `json:"ids,omitempty"`
+	SurvivorID string         `json:"survivor_id"`
+}
+
+func (c *Client) MergeContacts(ctx context.Context, args MergeContactsArgs) (Contact, error) {
+	res := struct {
+		Value Contact `json:"merge_contacts"`
+	}{}
+
+	err := c.Do(ctx, mutationMergeContacts, "MergeContacts", args, &res, true)
+	return res.Value, err
+}
+
+const mutationRevokeAPIKey = "mutation RevokeAPIKey($id: String!) { revoke_api_key(id: $id) }"
+
+type RevokeAPIKeyArgs struct {
+	ID string `json:"id"`
+}
+
+func (c *Client) RevokeAPIKey(ctx context.Context, args RevokeAPIKeyArgs) (bool, error) {
+	res := struct {
+		Value bool `json:"revoke_api_key"`
+	}{}
+
+	err := c.Do(ctx, mutationRevokeAPIKey, "RevokeAPIKey", args, &res, true)
+	return res.Value, err
+}
+
+const mutationSetCommunicationCategories = "mutation SetCommunicationCategories($categories: [InCommunicationCategory!]) { set_communication_categories(categories: $categories) { communication_categories { description key name } email { blacklist_mode google_analytics { content medium source term } restriction_list unsubscribe_link } organization_id sms { unsubscribe_link } tracking { click_tracking google_analytics { content medium source term } open_tracking } } }"
+
+type SetCommunicationCategoriesArgs struct {
+	Categories []InCommunicationCategory `json:"categories,omitempty"`
+}
+
+func (c *Client) SetCommunicationCategories(ctx context.Context, args SetCommunicationCategoriesArgs) (ContactSettings, error) {
+	res := struct {
+		Value ContactSettings `json:"set_communication_categories"`
+	}{}
+
+	err := c.Do(ctx, mutationSetCommunicationCategories, "SetCommunicationCategories", args, &res, true)
+	return res.Value, err
+}
+
+const mutationSetContactConsents = "mutation SetContactConsents($at: DateTime, $consents: [InConsentChange!], $id: String!, $proof: InConsentProof) { set_contact_consents(at: $at, consents: $consents, id: $id, proof: $proof) { aliases attributes confirmation_sent_at consents { at category channel granted proof { form import_id ip text user_agent } source } email external_id full_name given_name id lang last_name merge_tags notification_tokens organization_id phone_number stats { email { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } notifications { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } sms { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } } status subscribed_at } }"
+
+type SetContactConsentsArgs struct {
+	At       *time.Time        `json:"at,omitempty"`
+	Consents []InConsentChange `json:"consents,omitempty"`
+	ID       string            `json:"id"`
+	Proof    *InConsentProof   `json:"proof,omitempty"`
+}
+
+func (c *Client) SetContactConsents(ctx context.Context, args SetContactConsentsArgs) (Contact, error) {
+	res := struct {
+		Value Contact `json:"set_contact_consents"`
+	}{}
+
+	err := c.Do(ctx, mutationSetContactConsents, "SetContactConsents", args, &res, true)
+	return res.Value, err
+}
+
+const mutationSetContactsStatus = "mutation SetContactsStatus($filter: InContactFilter, $ids: [String!], $reason: String, $status: String!) { set_contacts_status(filter: $filter, ids: $ids, reason: $reason, status: $status) { failed items { error id index status } succeeded total } }"
+
+type SetContactsStatusArgs struct {
+	Filter *InContactFilter `json:"filter,omitempty"`
+	IDs    []string         `json:"ids,omitempty"`
+	Reason *string          `json:"reason,omitempty"`
+	Status string           `json:"status"`
+}
+
+func (c *Client) SetContactsStatus(ctx context.Context, args SetContactsStatusArgs) (BulkResult, error) {
+	res := struct {
+		Value BulkResult `json:"set_contacts_status"`
+	}{}
+
+	err := c.Do(ctx, mutationSetContactsStatus, "SetContactsStatus", args, &res, true)
+	return res.Value, err
+}
+
+const mutationSnapshotSegment = "mutation SnapshotSegment($id: String!) { snapshot_segment(id: $id) { click_rate contacts_count created_at id mails_sent_count name open_rate opens_count organization_id refreshed_at rules { conditions { attribute channel date days field number operator stat value values } operator } snapshot_at subscription type } }"
+
+type SnapshotSegmentArgs struct {
+	ID string `json:"id"`
+}
+
+func (c *Client) SnapshotSegment(ctx context.Context, args SnapshotSegmentArgs) (Segment, error) {
+	res := struct {
+		Value Segment `json:"snapshot_segment"`
+	}{}
+
+	err := c.Do(ctx, mutationSnapshotSegment, "SnapshotSegment", args, &res, true)
+	return res.Value, err
+}
+
+const mutationSubscribeContact = "mutation SubscribeContact($consents: [InConsentChange!], $data: InContactData!, $double_opt_in: Boolean, $proof: InConsentProof, $reason: String) { subscribe_contact(consents: $consents, data: $data, double_opt_in: $double_opt_in, proof: $proof, reason: $reason) { aliases attributes confirmation_sent_at consents { at category channel granted proof { form import_id ip text user_agent } source } email external_id full_name given_name id lang last_name merge_tags notification_tokens organization_id phone_number stats { email { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } notifications { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } sms { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } } status subscribed_at } }"
+
+type SubscribeContactArgs struct {
+	Consents    []InConsentChange `json:"consents,omitempty"`
+	Data        InContactData     `json:"data"`
+	DoubleOptIn *bool             `json:"double_opt_in,omitempty"`
+	Proof       *InConsentProof   `json:"proof,omitempty"`
+	Reason      *string           `json:"reason,omitempty"`
+}
+
+func (c *Client) SubscribeContact(ctx context.Context, args SubscribeContactArgs) (Contact, error) {
+	res := struct {
+		Value Contact `json:"subscribe_contact"`
+	}{}
+
+	err := c.Do(ctx, mutationSubscribeContact, "SubscribeContact", args, &res, true)
+	return res.Value, err
+}
+
+const mutationUnassignTags = "mutation UnassignTags($filter: InContactFilter, $ids: [String!], $tag_ids: [String!]) { unassign_tags(filter: $filter, ids: $ids, tag_ids: $tag_ids) { failed items { error id index status } succeeded total } }"
+
+type UnassignTagsArgs struct {
+	Filter *InContactFilter `json:"filter,omitempty"`
+	IDs    []string         `json:"ids,omitempty"`
+	TagIDs []string         `json:"tag_ids,omitempty"`
+}
+
+func (c *Client) UnassignTags(ctx context.Context, args UnassignTagsArgs) (BulkResult, error) {
+	res := struct {
+		Value BulkResult `json:"unassign_tags"`
+	}{}
+
+	err := c.Do(ctx, mutationUnassignTags, "UnassignTags", args, &res, true)
+	return res.Value, err
+}
+
+const mutationUpdateCampaign = "mutation UpdateCampaign($data: InCampaignData!, $id: String!) { update_campaign(data: $data, id: $id) { category channel created_at draft id organization_id recipients_count transactional } }"
+
+type UpdateCampaignArgs struct {
+	Data InCampaignData `json:"data"`
+	ID   string         `json:"id"`
+}
+
+func (c *Client) UpdateCampaign(ctx context.Context, args UpdateCampaignArgs) (Campaign, error) {
+	res := struct {
+		Value Campaign `json:"update_campaign"`
+	}{}
+
+	err := c.Do(ctx, mutationUpdateCampaign, "UpdateCampaign", args, &res, true)
+	return res.Value, err
+}
+
+const mutationUpdateContact = "mutation UpdateContact($data: InContactData!, $id: String!) { update_contact(data: $data, id: $id) { aliases attributes confirmation_sent_at consents { at category channel granted proof { form import_id ip text user_agent } source } email external_id full_name given_name id lang last_name merge_tags notification_tokens organization_id phone_number stats { email { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } notifications { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } sms { campaigns_sent last_campaign_sent last_message_clicked last_message_opened messages_clicked messages_opened } } status subscribed_at } }"
+
+type UpdateContactArgs struct {
+	Data InContactData `json:"data"`
+	ID   string        `json:"id"`
+}
+
+func (c *Client) UpdateContact(ctx context.Context, args UpdateContactArgs) (Contact, error) {
+	res := struct {
+		Value Contact `json:"update_contact"`
+	}{}
+
+	err := c.Do(ctx, mutationUpdateContact, "UpdateContact", args, &res, true)
+	return res.Value, err
+}
+
+const mutationUpdateContactAttribute = "mutation UpdateContactAttribute($id: String!, $name: String, $options: [String!]) { update_contact_attribute(id: $id, name: $name, options: $options) { created_at id key name options organization_id type } }"
+
+type UpdateContactAttributeArgs struct {
+	ID      string   `json:"id"`
+	Name    *string  `json:"name,omitempty"`
+	Options []string `json:"options,omitempty"`
+}
+
+func (c *Client) UpdateContactAttribute(ctx context.Context, args UpdateContactAttributeArgs) (ContactAttribute, error) {
+	res := struct {
+		Value ContactAttribute `json:"update_contact_attribute"`
+	}{}
+
+	err := c.Do(ctx, mutationUpdateContactAttribute, "UpdateContactAttribute", args, &res, true)
+	return res.Value, err
+}
+
+const mutationUpdatePassword = "mutation UpdatePassword($new: String!, $old: String!) { update_password(new: $new, old: $old) }"
+
+type UpdatePasswordArgs struct {
+	New string `json:"new"`
+	Old string `json:"old"`
+}
+
+func (c *Client) UpdatePassword(ctx context.Context, args UpdatePasswordArgs) (bool, error) {
+	res := struct {
+		Value bool `json:"update_password"`
+	}{}
+
+	err := c.Do(ctx, mutationUpdatePassword, "UpdatePassword", args, &res, true)
+	return res.Value, err
+}
+
+const mutationUpdateSegment = "mutation UpdateSegment($data: InSegmentData!, $id: String!) { update_segment(data: $data, id: $id) { click_rate contacts_count created_at id mails_sent_count name open_rate opens_count organization_id refreshed_at rules { conditions { attribute channel date days field number operator stat value values } operator } snapshot_at subscription type } }"
+
+type UpdateSegmentArgs struct {
+	Data InSegmentData `json:"data"`
+	ID   string        `json:"id"`
+}
+
+func (c *Client) UpdateSegment(ctx context.Context, args UpdateSegmentArgs) (Segment, error) {
+	res := struct {
+		Value Segment `json:"update_segment"`
+	}{}
+
+	err := c.Do(ctx, mutationUpdateSegment, "UpdateSegment", args, &res, true)
+	return res.Value, err
+}
+
+const mutationUpdateTag = "mutation UpdateTag($data: InTagData!, $id: String!) { update_tag(data: $data, id: $id) { contacts_count created_at description id name organization_id } }"
+
+type UpdateTagArgs struct {
+	Data InTagData `json:"data"`
+	ID   string    `json:"id"`
+}
+
+func (c *Client) UpdateTag(ctx context.Context, args UpdateTagArgs) (Tag, error) {
+	res := struct {
+		Value Tag `json:"update_tag"`
+	}{}
+
+	err := c.Do(ctx, mutationUpdateTag, "UpdateTag", args, &res, true)
+	return res.Value, err
+}
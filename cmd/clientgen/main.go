@@ -0,0 +1,343 @@
+// Generate the typed go client (client/client_gen.go) from the graphql schema
+// usage: go run ./cmd/clientgen [-out client/client_gen.go], main_test.go fails on a stale client
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"sort"
+	"strings"
+
+	gographql "github.com/graphql-go/graphql"
+	"github.com/inconshreveable/log15"
+	"neodeliver.com/modules"
+)
+
+// depth of nested objects selected by operations
+const maxDepth = 3
+
+func main() {
+	out := flag.String("out", "client/client_gen.go", "generated file")
+	flag.Parse()
+
+	log15.Root().SetHandler(log15.DiscardHandler())
+	schema := modules.Build()
+
+	src, err := generate(schema)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if err := os.WriteFile(*out, src, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+type generator struct {
+	schema gographql.Schema
+	buf    bytes.Buffer
+}
+
+func generate(schema gographql.Schema) ([]byte, error) {
+	g := &generator{schema: schema}
+	g.printf("// Code generated by cmd/clientgen. DO NOT EDIT.\n\n")
+	g.printf("package client\n\n")
+	g.printf("import (\n\"context\"\n\"encoding/json\"\n\"time\"\n)\n\n")
+	g.printf("var _ = json.RawMessage{}\nvar _ = time.Time{}\n\n")
+
+	names := []string{}
+	for name := range schema.TypeMap() {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.HasPrefix(name, "__") || isRoot(schema, name) {
+			continue
+		}
+
+		switch t := schema.TypeMap()[name].(type) {
+		case *gographql.Object:
+			g.object(t.Name(), t.Description(), t.Fields())
+		case *gographql.Interface:
+			g.object(t.Name(), t.Description(), t.Fields())
+		case *gographql.InputObject:
+			g.input(t)
+		case *gographql.Enum:
+			g.enum(t)
+		}
+	}
+
+	g.operations(schema.QueryType(), "query")
+	if schema.MutationType() != nil {
+		g.operations(schema.MutationType(), "mutation")
+	}
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("could not format generated client: %w\n%s", err, g.buf.String())
+	}
+
+	return src, nil
+}
+
+func isRoot(schema gographql.Schema, name string) bool {
+	if schema.QueryType() != nil && schema.QueryType().Name() == name {
+		return true
+	}
+
+	return schema.MutationType() != nil && schema.MutationType().Name() == name
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// ---
+
+func (g *generator) comment(description string) {
+	for _, line := range strings.Split(strings.TrimSpace(description), "\n") {
+		if line != "" {
+			g.printf("// %s\n", line)
+		}
+	}
+}
+
+func (g *generator) object(name string, description string, fields gographql.FieldDefinitionMap) {
+	g.comment(description)
+	g.printf("type %s struct {\n", name)
+	if _, ok := g.schema.TypeMap()[name].(*gographql.Interface); ok {
+		g.printf("Typename string `json:\"__typename\"`\n")
+	}
+
+	for _, fieldName := range sortedKeys(fields) {
+		f := fields[fieldName]
+		if hasRequiredArgs(f.Args) {
+			continue
+		}
+
+		g.comment(f.Description)
+		g.printf("%s %s `json:\"%s\"`\n", goName(fieldName), goType(f.Type, false), fieldName)
+	}
+
+	g.printf("}\n\n")
+}
+
+func (g *generator) input(t *gographql.InputObject) {
+	g.comment(t.Description())
+	g.printf("type %s struct {\n", t.Name())
+
+	fields := t.Fields()
+	names := []string{}
+	for name := range fields {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		f := fields[name]
+		g.comment(f.Description())
+		g.printf("%s %s `json:\"%s%s\"`\n", goName(name), goType(f.Type, false), name, omitEmpty(f.Type))
+	}
+
+	g.printf("}\n\n")
+}
+
+func (g *generator) enum(t *gographql.Enum) {
+	g.comment(t.Description())
+	g.printf("type %s string\n\nconst (\n", t.Name())
+	for _, v := range t.Values() {
+		g.printf("%s%s %s = %q\n", t.Name(), goName(strings.ToLower(v.Name)), t.Name(), v.Name)
+	}
+
+	g.printf(")\n\n")
+}
+
+// one method per root field, with an arguments struct when the field has arguments
+func (g *generator) operations(root *gographql.Object, kind string) {
+	fields := root.Fields()
+	for _, name := range sortedKeys(fields) {
+		f := fields[name]
+		method := goName(name)
+
+		// arguments are built from maps, sort them to keep the output stable
+		sort.Slice(f.Args, func(i, j int) bool {
+			return f.Args[i].Name() < f.Args[j].Name()
+		})
+
+		// operation document
+		vars, args := []string{}, []string{}
+		for _, a := range f.Args {
+			vars = append(vars, "$"+a.Name()+": "+a.Type.String())
+			args = append(args, a.Name()+": $"+a.Name())
+		}
+
+		query := kind + " " + method
+		if len(vars) > 0 {
+			query += "(" + strings.Join(vars, ", ") + ")"
+		}
+
+		query += " { " + name
+		if len(args) > 0 {
+			query += "(" + strings.Join(args, ", ") + ")"
+		}
+
+		query += g.selection(f.Type, 0, map[string]bool{}) + " }"
+		g.printf("const %s%s = %q\n\n", kind, method, query)
+
+		// arguments
+		params, variables := "", "nil"
+		if len(f.Args) > 0 {
+			g.printf("type %sArgs struct {\n", method)
+			for _, a := range f.Args {
+				g.printf("%s %s `json:\"%s%s\"`\n", goName(a.Name()), goType(a.Type, false), a.Name(), omitEmpty(a.Type))
+			}
+
+			g.printf("}\n\n")
+			params, variables = ", args "+method+"Args", "args"
+		}
+
+		g.comment(f.Description)
+		result := goType(f.Type, false)
+		g.printf("func (c *Client) %s(ctx context.Context%s) (%s, error) {\n", method, params, result)
+		g.printf("res := struct {\nValue %s `json:\"%s\"`\n}{}\n\n", result, name)
+		g.printf("err := c.Do(ctx, %s%s, %q, %s, &res, %t)\n", kind, method, method, variables, kind == "mutation")
+		g.printf("return res.Value, err\n}\n\n")
+	}
+}
+
+// select scalar fields & nested objects up to maxDepth, without cycles
+func (g *generator) selection(t gographql.Type, depth int, visited map[string]bool) string {
+	named := gographql.GetNamed(t)
+
+	var fields gographql.FieldDefinitionMap
+	prefix, typeName := "", ""
+	switch n := named.(type) {
+	case *gographql.Object:
+		fields, typeName = n.Fields(), n.Name()
+	case *gographql.Interface:
+		fields, typeName = n.Fields(), n.Name()
+		prefix = "__typename "
+	default:
+		return ""
+	}
+
+	if depth >= maxDepth || visited[typeName] {
+		return ""
+	}
+
+	visited[typeName] = true
+	defer delete(visited, typeName)
+
+	parts := []string{}
+	for _, name := range sortedKeys(fields) {
+		f := fields[name]
+		if hasRequiredArgs(f.Args) {
+			continue
+		}
+
+		switch gographql.GetNamed(f.Type).(type) {
+		case *gographql.Object, *gographql.Interface:
+			if sub := g.selection(f.Type, depth+1, visited); sub != "" {
+				parts = append(parts, name+sub)
+			}
+		default:
+			parts = append(parts, name)
+		}
+	}
+
+	return " { " + prefix + strings.Join(parts, " ") + " }"
+}
+
+// ---
+
+func goType(t gographql.Type, nonNull bool) string {
+	switch tt := t.(type) {
+	case *gographql.NonNull:
+		return goType(tt.OfType, true)
+	case *gographql.List:
+		return "[]" + goType(tt.OfType, false)
+	}
+
+	res := ""
+	switch t.Name() {
+	case "String", "ID":
+		res = "string"
+	case "Int":
+		res = "int"
+	case "Float":
+		res = "float64"
+	case "Boolean":
+		res = "bool"
+	case "DateTime":
+		res = "time.Time"
+	case "Decimal":
+		res = "string"
+	default:
+		if _, ok := t.(*gographql.Scalar); ok {
+			res = "json.RawMessage"
+		} else {
+			res = t.Name()
+		}
+	}
+
+	if !nonNull && res != "json.RawMessage" {
+		return "*" + res
+	}
+
+	return res
+}
+
+func omitEmpty(t gographql.Type) string {
+	if _, ok := t.(*gographql.NonNull); ok {
+		return ""
+	}
+
+	return ",omitempty"
+}
+
+func hasRequiredArgs(args []*gographql.Argument) bool {
+	for _, a := range args {
+		if _, ok := a.Type.(*gographql.NonNull); ok && a.DefaultValue == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedKeys(fields gographql.FieldDefinitionMap) []string {
+	keys := []string{}
+	for k := range fields {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+var initialisms = map[string]string{
+	"api": "API", "id": "ID", "ids": "IDs", "ip": "IP", "mfa": "MFA", "sms": "SMS", "smtp": "SMTP",
+	"tls": "TLS", "txt": "TXT", "uri": "URI", "url": "URL",
+}
+
+// snake_case graphql names to exported go names
+func goName(name string) string {
+	res := ""
+	for _, part := range strings.Split(name, "_") {
+		if part == "" {
+			continue
+		} else if v, ok := initialisms[part]; ok {
+			res += v
+		} else {
+			res += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+
+	return res
+}
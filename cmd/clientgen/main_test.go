@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+	"neodeliver.com/modules"
+)
+
+// the committed client must match the schema, regenerate it with: go run ./cmd/clientgen
+func TestClientUpToDate(t *testing.T) {
+	log15.Root().SetHandler(log15.DiscardHandler())
+	src, err := generate(modules.Build())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := os.ReadFile("../../client/client_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(current, src) {
+		return
+	}
+
+	want, got := bytes.Split(src, []byte("\n")), bytes.Split(current, []byte("\n"))
+	for i := range want {
+		if i >= len(got) || !bytes.Equal(want[i], got[i]) {
+			t.Fatalf("client/client_gen.go is stale from line %d, run: go run ./cmd/clientgen\nwant: %s", i+1, want[i])
+		}
+	}
+
+	t.Fatalf("client/client_gen.go is stale from line %d, run: go run ./cmd/clientgen", len(want)+1)
+}
@@ -4,34 +4,47 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"os"
 
 	gographql "github.com/graphql-go/graphql"
-	"github.com/inconshreveable/log15"
-	"neodeliver.com/engine/graphql"
+	"neodeliver.com/engine/config"
+	"neodeliver.com/engine/jobs"
+	"neodeliver.com/engine/logger"
+	"neodeliver.com/engine/tracing"
 	"neodeliver.com/modules"
 )
 
 func main() {
-	instance := modules.Build()
+	cfg, err := config.Load()
+	if err != nil {
+		panic(err)
+	}
 
-	if os.Getenv("TEST") == "1" {
-		testSchema(instance)
-	} else {
-		httpServer(instance)
+	if err := logger.Init(cfg.Log); err != nil {
+		panic(err)
 	}
-}
 
-func httpServer(s gographql.Schema) {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	defer logger.Flush()
+	logger.Root().Info("Loaded configuration", cfg.Redacted()...)
+
+	shutdown, err := tracing.Init(context.Background(), "neodeliver-api", cfg.Tracing)
+	if err != nil {
+		panic(err)
 	}
 
-	fmt.Println("Listening on port " + port + "...")
-	http.HandleFunc("/", graphql.Route(s))
-	http.ListenAndServe(":"+port, nil)
+	if os.Getenv("TEST") == "1" {
+		defer shutdown(context.Background())
+		testSchema(modules.Build())
+		return
+	}
+
+	srv := modules.Server(cfg).OnShutdown(shutdown)
+	jobs.Start(context.Background())
+	if err := srv.Run(context.Background()); err != nil {
+		logger.Root().Crit("Server stopped unexpectedly", "err", err)
+		logger.Flush()
+		os.Exit(1)
+	}
 }
 
 func testSchema(s gographql.Schema) {
@@ -48,7 +61,7 @@ func testSchema(s gographql.Schema) {
 	params := gographql.Params{Schema: s, RequestString: query, Context: context.Background()}
 	r := gographql.Do(params)
 	if len(r.Errors) > 0 {
-		log15.Error("failed to execute graphql operation, errors", "err", r.Errors)
+		logger.Root().Error("failed to execute graphql operation, errors", "err", r.Errors)
 		panic("failed to execute graphql operation")
 	}
 
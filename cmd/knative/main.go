@@ -3,19 +3,16 @@ package main
 import (
 	"fmt"
 	"log"
-	"os"
+	"strconv"
 
 	// Blank-import the function package so the init() runs
 	"github.com/GoogleCloudPlatform/functions-framework-go/funcframework"
 	_ "neodeliver.com"
+	"neodeliver.com/engine/config"
 )
 
 func main() {
-	// Use PORT environment variable, or default to 8080.
-	port := "8080"
-	if envPort := os.Getenv("PORT"); envPort != "" {
-		port = envPort
-	}
+	port := strconv.Itoa(config.Get().Port)
 
 	fmt.Println("Starting up http server on port " + port)
 	if err := funcframework.Start(port); err != nil {
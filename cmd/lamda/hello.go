@@ -1,34 +1,45 @@
 package main
 
 import (
-	"fmt"
-	"net/http"
+	"context"
 	"os"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/awslabs/aws-lambda-go-api-proxy/httpadapter"
-	"neodeliver.com/engine/graphql"
+	"neodeliver.com/engine/config"
+	"neodeliver.com/engine/jobs"
+	"neodeliver.com/engine/logger"
+	"neodeliver.com/engine/tracing"
 	"neodeliver.com/modules"
 )
 
 func main() {
-	instance := modules.Build()
-	http.HandleFunc("/", graphql.Route(instance))
+	cfg, err := config.Load()
+	if err != nil {
+		panic(err)
+	}
+
+	if err := logger.Init(cfg.Log); err != nil {
+		panic(err)
+	}
+
+	defer logger.Flush()
+	logger.Root().Info("Loaded configuration", cfg.Redacted()...)
 
+	shutdown, err := tracing.Init(context.Background(), "neodeliver-api", cfg.Tracing)
+	if err != nil {
+		panic(err)
+	}
+
+	srv := modules.Server(cfg).OnShutdown(shutdown)
 	if runtime_api, _ := os.LookupEnv("AWS_LAMBDA_RUNTIME_API"); runtime_api != "" {
-		fmt.Println("Starting up in Lambda Runtime")
-		adapter := httpadapter.New(http.DefaultServeMux).ProxyWithContext
+		logger.Root().Info("Starting up in Lambda Runtime")
+		adapter := httpadapter.New(srv.Handler()).ProxyWithContext
 		lambda.Start(adapter)
 	} else {
-		port := os.Getenv("PORT")
-		fmt.Println("Starting up http server on port " + port)
-		srv := &http.Server{
-			Addr: ":" + port,
-		}
-
-		err := srv.ListenAndServe()
-		if err != nil {
-			fmt.Println("Could not start server: ", err)
+		jobs.Start(context.Background())
+		if err := srv.Run(context.Background()); err != nil {
+			logger.Root().Error("Could not start server", "err", err)
 		}
 	}
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+
+	"github.com/inconshreveable/log15"
+	"neodeliver.com/engine/config"
+	"neodeliver.com/engine/tracing"
+	"neodeliver.com/smtp/sender"
+)
+
+// send ./mail.eml to mail-tester.com, used to check the deliverability of the smtp sender
+
+func main() {
+	ctx := context.Background()
+	cfg, err := config.Load()
+	if err != nil {
+		panic(err)
+	}
+
+	shutdown, err := tracing.Init(ctx, "neodeliver-smtp-sender", cfg.Tracing)
+	if err != nil {
+		panic(err)
+	}
+
+	defer shutdown(ctx)
+
+	bs, err := sender.LoadEmlFile("./mail.eml")
+	if err != nil {
+		panic(err)
+	}
+
+	to := "test-nar3e0x15@srv1.mail-tester.com"
+	if err := sender.Send(ctx, "sacha@skyhark.be", to, bs); err != nil {
+		log15.Error("Could not send email", "err", err)
+	}
+}
@@ -0,0 +1,305 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Typed application configuration, loaded once at startup
+// Values are read from the environment, then the optional CONFIG_FILE, then the .env file, then the defaults
+// -------------------------------------------------------------------------------------
+
+const (
+	Development = "development"
+	Test        = "test"
+	Production  = "production"
+)
+
+type Config struct {
+	Env            string `env:"APP_ENV" default:"development" doc:"development, test or production"`
+	Port           int    `env:"PORT" default:"8080"`
+	OrganizationID string `env:"NEODELIVER_ORGANIZATION_ID" doc:"organization owning neodeliver's own mailing lists"`
+	Database       string `env:"DATABASE" default:"mongodb" doc:"mongodb or memory (data is lost on restart, used by tests & local development)"`
+
+	Server        Server
+	CORS          CORS
+	GraphQL       GraphQL
+	Playground    Playground
+	RateLimit     RateLimit
+	Idempotency   Idempotency
+	Mongo         Mongo
+	Storage       Storage
+	Jobs          Jobs
+	Exports       Exports
+	Segments      Segments
+	Confirmations Confirmations
+	Auth0         Auth0
+	Invitations   Invitations
+	DKIM          DKIM
+	Mailer        Mailer
+	Log           Log
+	Tracing       Tracing
+}
+
+type Server struct {
+	ReadTimeout       time.Duration `env:"SERVER_READ_TIMEOUT" default:"15s"`
+	ReadHeaderTimeout time.Duration `env:"SERVER_READ_HEADER_TIMEOUT" default:"5s"`
+	WriteTimeout      time.Duration `env:"SERVER_WRITE_TIMEOUT" default:"30s"`
+	IdleTimeout       time.Duration `env:"SERVER_IDLE_TIMEOUT" default:"120s"`
+	ShutdownDelay     time.Duration `env:"SERVER_SHUTDOWN_DELAY" default:"0s" doc:"delay between failing readiness & draining connections"`
+	ShutdownTimeout   time.Duration `env:"SERVER_SHUTDOWN_TIMEOUT" default:"30s"`
+	MaxBodyBytes      int64         `env:"SERVER_MAX_BODY_BYTES" default:"1048576"`
+	TrustedProxies    int           `env:"SERVER_TRUSTED_PROXIES" default:"0" doc:"number of proxies appending to X-Forwarded-For"`
+	InternalPort      int           `env:"SERVER_INTERNAL_PORT" default:"9090" doc:"port of the internal listener (metrics), never to be exposed publicly, 0 to disable"`
+}
+
+type CORS struct {
+	AllowedOrigins []string      `env:"CORS_ALLOWED_ORIGINS" doc:"comma separated list of origins allowed to call the api, or *"`
+	AllowedHeaders []string      `env:"CORS_ALLOWED_HEADERS" default:"Authorization,Content-Type,Idempotency-Key,X-API-Key"`
+	MaxAge         time.Duration `env:"CORS_MAX_AGE" default:"10m"`
+}
+
+type GraphQL struct {
+	Introspection bool `env:"GRAPHQL_INTROSPECTION" default:"true" production:"false" doc:"allow __schema & __type queries, disabled by default in production"`
+}
+
+type Playground struct {
+	Enabled        bool   `env:"PLAYGROUND_ENABLED" default:"true" production:"false" doc:"disabled by default in production"`
+	Path           string `env:"PLAYGROUND_PATH" default:"/graphiql"`
+	DefaultHeaders string `env:"PLAYGROUND_DEFAULT_HEADERS" doc:"json encoded headers of new tabs, eg: {\"Authorization\": \"Bearer \"}"`
+}
+
+type RateLimit struct {
+	Enabled    bool   `env:"RATE_LIMIT_ENABLED" default:"true"`
+	Store      string `env:"RATE_LIMIT_STORE" default:"memory" doc:"memory or mongodb, shared by all instances"`
+	HTTP       string `env:"RATE_LIMIT_HTTP" default:"ip:600/1m" doc:"limits of http requests"`
+	Operations string `env:"RATE_LIMIT_OPERATIONS" doc:"limits by operation, eg: add_contact=organization:100/1m;ip:50/1m,update_password=user:5/15m"`
+}
+
+type Idempotency struct {
+	Store       string        `env:"IDEMPOTENCY_STORE" default:"mongodb" doc:"mongodb or memory"`
+	TTL         time.Duration `env:"IDEMPOTENCY_TTL" default:"24h" doc:"duration responses are kept for replays"`
+	LockTimeout time.Duration `env:"IDEMPOTENCY_LOCK_TIMEOUT" default:"1m" doc:"duration after which keys of interrupted requests can be reused"`
+	WaitTimeout time.Duration `env:"IDEMPOTENCY_WAIT_TIMEOUT" default:"10s" doc:"maximum wait for concurrent requests using the same key"`
+}
+
+type Mongo struct {
+	URI                    string        `env:"MONGODB_URI,mongodb" secret:"true"`
+	Database               string        `env:"MONGODB_DATABASE" default:"neodeliver"`
+	MaxPoolSize            int           `env:"MONGODB_MAX_POOL_SIZE" default:"100" doc:"maximum number of connections per server"`
+	MinPoolSize            int           `env:"MONGODB_MIN_POOL_SIZE" default:"0"`
+	MaxConnIdleTime        time.Duration `env:"MONGODB_MAX_CONN_IDLE_TIME" default:"5m" doc:"idle connections are closed after this duration"`
+	ConnectTimeout         time.Duration `env:"MONGODB_CONNECT_TIMEOUT" default:"10s"`
+	ServerSelectionTimeout time.Duration `env:"MONGODB_SERVER_SELECTION_TIMEOUT" default:"5s" doc:"maximum wait for an available server before failing operations"`
+	SocketTimeout          time.Duration `env:"MONGODB_SOCKET_TIMEOUT" default:"30s" doc:"maximum duration of socket reads & writes, 0 for none"`
+	ReadPreference         string        `env:"MONGODB_READ_PREFERENCE" default:"primary" doc:"primary, primaryPreferred, secondary, secondaryPreferred or nearest"`
+	WriteConcern           string        `env:"MONGODB_WRITE_CONCERN" default:"majority" doc:"majority or the number of acknowledging members"`
+}
+
+type Storage struct {
+	Backend        string        `env:"STORAGE_BACKEND" default:"mongodb" doc:"mongodb (gridfs), local or memory"`
+	Dir            string        `env:"STORAGE_DIR" default:"./data/files" doc:"directory of the local backend"`
+	URL            string        `env:"STORAGE_URL" doc:"public url of the api prefixing download urls, relative urls are returned when empty"`
+	SigningSecret  string        `env:"STORAGE_SIGNING_SECRET" default:"dev_token" secret:"true" doc:"secret signing download urls"`
+	URLTTL         time.Duration `env:"STORAGE_URL_TTL" default:"15m" doc:"validity of download urls"`
+	MaxUploadBytes int64         `env:"STORAGE_MAX_UPLOAD_BYTES" default:"104857600"`
+}
+
+type Jobs struct {
+	Concurrency   int           `env:"JOBS_CONCURRENCY" default:"2" doc:"background jobs executed in parallel by each instance"`
+	PollInterval  time.Duration `env:"JOBS_POLL_INTERVAL" default:"10s"`
+	Lease         time.Duration `env:"JOBS_LEASE" default:"1m" doc:"jobs of stopped instances are resumed once their lease expires"`
+	MaxAttempts   int           `env:"JOBS_MAX_ATTEMPTS" default:"3"`
+	TriggerToken  string        `env:"JOBS_TRIGGER_TOKEN" secret:"true" doc:"bearer token of the jobs trigger endpoint (eg: called by Cloud Scheduler), disabled when empty"`
+	TriggerBudget time.Duration `env:"JOBS_TRIGGER_BUDGET" default:"4m" doc:"duration the trigger endpoint starts pending jobs for"`
+}
+
+type Exports struct {
+	Retention time.Duration `env:"EXPORTS_RETENTION" default:"168h" doc:"duration export files are kept once completed"`
+}
+
+type Segments struct {
+	RefreshInterval time.Duration `env:"SEGMENTS_REFRESH_INTERVAL" default:"1h" doc:"interval between refreshes of the segments counters, 0 to disable"`
+}
+
+type Confirmations struct {
+	Secret      string        `env:"CONFIRMATIONS_SECRET" default:"dev_token" secret:"true" doc:"secret signing double opt-in confirmation links"`
+	TTL         time.Duration `env:"CONFIRMATIONS_TTL" default:"72h" doc:"validity of confirmation links"`
+	URL         string        `env:"CONFIRMATIONS_URL" doc:"public url of the api prefixing confirmation links, relative links are generated when empty"`
+	RedirectURL string        `env:"CONFIRMATIONS_REDIRECT_URL" doc:"page contacts are redirected to once confirmed, a confirmation page is shown when empty"`
+}
+
+type Auth0 struct {
+	Tenant               string `env:"AUTH0_TENANT"`
+	Token                string `env:"AUTH0_TOKEN" secret:"true" doc:"management api token, fetched using the client credentials when empty"`
+	ClientID             string `env:"AUTH0_MANAGEMENT_CLIENT_ID"`
+	ClientSecret         string `env:"AUTH0_MANAGEMENT_CLIENT_SECRET" secret:"true"`
+	Audience             string `env:"AUTH0_MANAGEMENT_AUDIENCE"`
+	Connection           string `env:"AUTH0_MANAGEMENT_CONNECTION"`
+	PasswordClientID     string `env:"AUTH0_PASSWORD_CLIENT_ID"`
+	PasswordClientSecret string `env:"AUTH0_PASSWORD_CLIENT_SECRET" secret:"true"`
+	AccessToken          string `env:"AUTH0_ACCESS_TOKEN" secret:"true" doc:"user access token, only used for testing"`
+}
+
+type Invitations struct {
+	Secret string `env:"INVITATIONS_SECRET" default:"dev_token" secret:"true"`
+}
+
+type DKIM struct {
+	PrivateKey string `env:"DKIM_PRIVATE_KEY" default:"./ssl/private.key" doc:"path to the pem encoded private key"`
+	Domain     string `env:"DKIM_DOMAIN" default:"neodeliver.io"`
+	Selector   string `env:"DKIM_SELECTOR" default:"n1"`
+}
+
+type Mailer struct {
+	From     string `env:"MAILER_FROM" doc:"sender of transactional emails (eg: confirmation links), sending is disabled when empty"`
+	Hostname string `env:"MAILER_HOSTNAME" default:"92.eu.neodeliver.io" doc:"hostname announced to the receiving smtp servers"`
+}
+
+type Log struct {
+	Format    string `env:"LOG_FORMAT" default:"text" doc:"json or text"`
+	Level     string `env:"LOG_LEVEL" default:"info"`
+	SentryDSN string `env:"SENTRY_DSN" secret:"true"`
+}
+
+type Tracing struct {
+	Exporter string `env:"TRACING_EXPORTER" default:"none" doc:"otlp, stdout or none"`
+}
+
+// ---
+
+var (
+	current *Config
+	mu      sync.RWMutex
+)
+
+// current configuration, loaded on first use
+// entrypoints should call Load beforehand to fail on invalid configurations
+func Get() *Config {
+	mu.RLock()
+	c := current
+	mu.RUnlock()
+
+	if c != nil {
+		return c
+	}
+
+	c, err := Load()
+	if err != nil {
+		panic(err)
+	}
+
+	return c
+}
+
+// inject the configuration, used by tests & tools
+func Set(c *Config) {
+	mu.Lock()
+	current = c
+	mu.Unlock()
+}
+
+// load, validate & set the current configuration
+func Load() (*Config, error) {
+	c, err := Read()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	Set(c)
+	return c, nil
+}
+
+func (c *Config) IsProduction() bool {
+	return c.Env == Production
+}
+
+// ---
+
+// minimum length of secrets in production
+const minSecretLength = 32
+
+// verify the configuration, insecure defaults & missing values are rejected in production
+func (c *Config) Validate() error {
+	errs := []string{}
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(oneOf(c.Env, Development, Test, Production), "APP_ENV: unknown environment %q", c.Env)
+	check(c.Port > 0 && c.Port < 65536, "PORT: invalid port %d", c.Port)
+	check(c.Server.InternalPort >= 0 && c.Server.InternalPort < 65536 && c.Server.InternalPort != c.Port, "SERVER_INTERNAL_PORT: invalid port %d, must differ from PORT", c.Server.InternalPort)
+	check(c.Server.MaxBodyBytes > 0, "SERVER_MAX_BODY_BYTES: must be positive")
+	check(c.Server.ShutdownTimeout > 0, "SERVER_SHUTDOWN_TIMEOUT: must be positive")
+	check(c.Server.TrustedProxies >= 0, "SERVER_TRUSTED_PROXIES: must be positive")
+	check(oneOf(c.RateLimit.Store, "memory", "mongodb"), "RATE_LIMIT_STORE: unknown store %q", c.RateLimit.Store)
+	check(oneOf(c.Idempotency.Store, "memory", "mongodb"), "IDEMPOTENCY_STORE: unknown store %q", c.Idempotency.Store)
+	check(c.Idempotency.TTL > 0 && c.Idempotency.LockTimeout > 0, "IDEMPOTENCY_TTL & IDEMPOTENCY_LOCK_TIMEOUT: must be positive")
+	check(oneOf(c.Database, "memory", "mongodb"), "DATABASE: unknown database %q", c.Database)
+	check(c.Mongo.Database != "", "MONGODB_DATABASE: required")
+	check(c.Mongo.MaxPoolSize >= 0 && c.Mongo.MinPoolSize >= 0 && (c.Mongo.MaxPoolSize == 0 || c.Mongo.MinPoolSize <= c.Mongo.MaxPoolSize), "MONGODB_MIN_POOL_SIZE & MONGODB_MAX_POOL_SIZE: invalid pool size")
+	check(c.Mongo.ConnectTimeout > 0 && c.Mongo.ServerSelectionTimeout > 0, "MONGODB_CONNECT_TIMEOUT & MONGODB_SERVER_SELECTION_TIMEOUT: must be positive")
+	check(oneOf(c.Mongo.ReadPreference, "primary", "primaryPreferred", "secondary", "secondaryPreferred", "nearest"), "MONGODB_READ_PREFERENCE: unknown read preference %q", c.Mongo.ReadPreference)
+	check(c.Mongo.WriteConcern == "majority" || isNumber(c.Mongo.WriteConcern), "MONGODB_WRITE_CONCERN: expected majority or a number")
+	check(oneOf(c.Storage.Backend, "mongodb", "local", "memory"), "STORAGE_BACKEND: unknown backend %q", c.Storage.Backend)
+	check(c.Storage.URLTTL > 0 && c.Storage.MaxUploadBytes > 0, "STORAGE_URL_TTL & STORAGE_MAX_UPLOAD_BYTES: must be positive")
+	check(c.Jobs.Concurrency > 0 && c.Jobs.MaxAttempts > 0, "JOBS_CONCURRENCY & JOBS_MAX_ATTEMPTS: must be positive")
+	check(c.Jobs.PollInterval > 0 && c.Jobs.Lease > 0, "JOBS_POLL_INTERVAL & JOBS_LEASE: must be positive")
+	check(c.Jobs.TriggerBudget > 0, "JOBS_TRIGGER_BUDGET: must be positive")
+	check(c.Exports.Retention > 0, "EXPORTS_RETENTION: must be positive")
+	check(c.Segments.RefreshInterval >= 0, "SEGMENTS_REFRESH_INTERVAL: must be positive")
+	check(c.Confirmations.TTL > 0, "CONFIRMATIONS_TTL: must be positive")
+	check(strings.HasPrefix(c.Playground.Path, "/") && c.Playground.Path != "/", "PLAYGROUND_PATH: must be a sub path, eg: /graphiql")
+	check(c.Playground.DefaultHeaders == "" || json.Valid([]byte(c.Playground.DefaultHeaders)), "PLAYGROUND_DEFAULT_HEADERS: invalid json")
+	check(oneOf(c.Log.Format, "json", "text"), "LOG_FORMAT: unknown format %q", c.Log.Format)
+	check(oneOf(strings.ToLower(c.Log.Level), "debug", "dbug", "info", "warn", "error", "eror", "crit"), "LOG_LEVEL: unknown level %q", c.Log.Level)
+	check(oneOf(c.Tracing.Exporter, "otlp", "stdout", "none"), "TRACING_EXPORTER: unknown exporter %q", c.Tracing.Exporter)
+
+	if c.IsProduction() {
+		check(c.Database == "mongodb", "DATABASE: the in-memory database is not allowed in production")
+		check(c.Mongo.URI != "", "MONGODB_URI: required in production")
+		check(c.OrganizationID != "", "NEODELIVER_ORGANIZATION_ID: required in production")
+		check(c.Auth0.Tenant != "", "AUTH0_TENANT: required in production")
+		check(c.Auth0.ClientID != "" && c.Auth0.ClientSecret != "", "AUTH0_MANAGEMENT_CLIENT_ID & AUTH0_MANAGEMENT_CLIENT_SECRET: required in production")
+		check(c.Auth0.AccessToken == "", "AUTH0_ACCESS_TOKEN: test access token is not allowed in production")
+		check(c.Invitations.Secret != "dev_token", "INVITATIONS_SECRET: insecure default value in production")
+		check(len(c.Invitations.Secret) >= minSecretLength, "INVITATIONS_SECRET: must be at least %d characters in production", minSecretLength)
+		check(c.Confirmations.Secret != "dev_token", "CONFIRMATIONS_SECRET: insecure default value in production")
+		check(len(c.Confirmations.Secret) >= minSecretLength, "CONFIRMATIONS_SECRET: must be at least %d characters in production", minSecretLength)
+		check(c.Jobs.TriggerToken == "" || len(c.Jobs.TriggerToken) >= minSecretLength, "JOBS_TRIGGER_TOKEN: must be at least %d characters in production", minSecretLength)
+		check(len(c.Storage.SigningSecret) >= minSecretLength, "STORAGE_SIGNING_SECRET: must be at least %d characters in production", minSecretLength)
+		check(c.Storage.Backend != "memory", "STORAGE_BACKEND: the memory backend is not allowed in production")
+	}
+
+	if len(errs) > 0 {
+		return errors.New("invalid configuration:\n  " + strings.Join(errs, "\n  "))
+	}
+
+	return nil
+}
+
+func oneOf(v string, values ...string) bool {
+	for _, value := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isNumber(v string) bool {
+	n, err := strconv.Atoi(v)
+	return err == nil && n >= 0
+}
@@ -0,0 +1,21 @@
+package config
+
+import "testing"
+
+func TestProductionDefaults(t *testing.T) {
+	t.Setenv("APP_ENV", Development)
+	if c, err := Read(); err != nil || !c.Playground.Enabled || !c.GraphQL.Introspection {
+		t.Errorf("development config %+v %+v (%v), want the playground & introspection enabled", c.Playground, c.GraphQL, err)
+	}
+
+	t.Setenv("APP_ENV", Production)
+	if c, err := Read(); err != nil || c.Playground.Enabled || c.GraphQL.Introspection {
+		t.Errorf("production config %+v %+v (%v), want the playground & introspection disabled", c.Playground, c.GraphQL, err)
+	}
+
+	// explicit values win over the production defaults
+	t.Setenv("PLAYGROUND_ENABLED", "true")
+	if c, err := Read(); err != nil || !c.Playground.Enabled || c.GraphQL.Introspection {
+		t.Errorf("production config %+v %+v (%v), want the playground enabled", c.Playground, c.GraphQL, err)
+	}
+}
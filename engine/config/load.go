@@ -0,0 +1,185 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const redacted = "[REDACTED]"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// read the configuration without validating it
+// CONFIG_FILE points to an optional file using the .env syntax (KEY=value or KEY: value)
+// the production tag overrides the default of a field in production, APP_ENV being read first
+func Read() (*Config, error) {
+	sources := []func(key string) (string, bool){os.LookupEnv}
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		file, err := godotenv.Read(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read config file %s: %w", path, err)
+		}
+
+		sources = append(sources, lookupMap(file))
+	}
+
+	// the .env file is optional & never overwrites the environment
+	if dotenv, err := godotenv.Read(); err == nil {
+		sources = append(sources, lookupMap(dotenv))
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read .env file: %w", err)
+	}
+
+	c := &Config{}
+	err := fields(reflect.ValueOf(c).Elem(), func(f reflect.StructField, v reflect.Value) error {
+		value, ok := f.Tag.Get("default"), false
+		if v, defined := f.Tag.Lookup("production"); defined && c.IsProduction() {
+			value = v
+		}
+
+		for _, key := range strings.Split(f.Tag.Get("env"), ",") {
+			for _, source := range sources {
+				var s string
+				if s, ok = source(key); ok {
+					value = s
+					break
+				}
+			}
+
+			if ok {
+				break
+			}
+		}
+
+		if err := set(v, value); err != nil {
+			return fmt.Errorf("%s: %w", envName(f), err)
+		}
+
+		return nil
+	})
+
+	return c, err
+}
+
+// effective configuration as key/value pairs, secrets are redacted
+func (c *Config) Redacted() []interface{} {
+	res := []interface{}{}
+	fields(reflect.ValueOf(c).Elem(), func(f reflect.StructField, v reflect.Value) error {
+		value := fmt.Sprint(v.Interface())
+		if list, ok := v.Interface().([]string); ok {
+			value = strings.Join(list, ",")
+		}
+
+		if f.Tag.Get("secret") == "true" && value != "" {
+			value = redacted
+		}
+
+		res = append(res, envName(f), value)
+		return nil
+	})
+
+	return res
+}
+
+// ---
+
+func lookupMap(mp map[string]string) func(key string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := mp[key]
+		return v, ok
+	}
+}
+
+// walk through all configuration fields having an env tag
+func fields(v reflect.Value, fn func(f reflect.StructField, v reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type.Kind() == reflect.Struct && f.Type != durationType {
+			if err := fields(v.Field(i), fn); err != nil {
+				return err
+			}
+
+			continue
+		} else if f.Tag.Get("env") == "" {
+			continue
+		}
+
+		if err := fn(f, v.Field(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func envName(f reflect.StructField) string {
+	return strings.Split(f.Tag.Get("env"), ",")[0]
+}
+
+func set(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		if s == "" {
+			return nil
+		}
+
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", s)
+		}
+
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported config type %s", v.Type())
+		}
+
+		list := []string{}
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+
+		v.Set(reflect.ValueOf(list))
+	case reflect.Int, reflect.Int64:
+		if s == "" {
+			return nil
+		}
+
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+
+		v.SetInt(i)
+	case reflect.Bool:
+		if s == "" {
+			return nil
+		}
+
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported config type %s", v.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// emulation of the aggregation stages used by the modules in memory: $match, $group, $sort, $skip & $limit
+// groups are keyed by a field path, a document of field paths or null & support the $sum, $avg, $min & $max accumulators
+// -------------------------------------------------------------------------------------
+
+func aggregate(docs []bson.M, pipeline []bson.M) ([]bson.M, error) {
+	for _, stage := range pipeline {
+		if len(stage) != 1 {
+			return nil, fmt.Errorf("aggregation stages must have a single operator, got %d", len(stage))
+		}
+
+		for op, arg := range stage {
+			var err error
+			switch op {
+			case "$match", "$group":
+				var d bson.M
+				if d, err = toDocument(arg); err == nil && op == "$match" {
+					docs, err = aggregateMatch(docs, d)
+				} else if err == nil {
+					docs, err = aggregateGroup(docs, d)
+				}
+			case "$sort":
+				// sorts keep the order of their keys, unlike the documents of other stages
+				s, ok := arg.(bson.D)
+				if m, isMap := arg.(bson.M); isMap && len(m) == 1 {
+					for k, v := range m {
+						s, ok = bson.D{{Key: k, Value: v}}, true
+					}
+				}
+
+				if !ok {
+					return nil, fmt.Errorf("$sort argument must be a bson.D")
+				}
+
+				sortDocuments(docs, s)
+			case "$skip", "$limit":
+				n, ok := toFloat(arg)
+				if !ok || n < 0 {
+					return nil, fmt.Errorf("%s argument must be a positive number", op)
+				} else if op == "$skip" && int(n) < len(docs) {
+					docs = docs[int(n):]
+				} else if op == "$skip" {
+					docs = nil
+				} else if int(n) < len(docs) {
+					docs = docs[:int(n)]
+				}
+			default:
+				return nil, fmt.Errorf("unsupported aggregation stage %s", op)
+			}
+
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return docs, nil
+}
+
+func aggregateMatch(docs []bson.M, filter bson.M) ([]bson.M, error) {
+	res := []bson.M{}
+	for _, doc := range docs {
+		ok, err := matchDocument(doc, filter)
+		if err != nil {
+			return nil, err
+		} else if ok {
+			res = append(res, doc)
+		}
+	}
+
+	return res, nil
+}
+
+func aggregateGroup(docs []bson.M, spec bson.M) ([]bson.M, error) {
+	if _, ok := spec["_id"]; !ok {
+		return nil, fmt.Errorf("$group requires an _id")
+	}
+
+	groups, counts := []bson.M{}, []map[string]int{}
+	for _, doc := range docs {
+		id := expression(doc, spec["_id"])
+
+		i := 0
+		for i < len(groups) && !equalValues(groups[i]["_id"], id) {
+			i++
+		}
+
+		if i == len(groups) {
+			groups, counts = append(groups, bson.M{"_id": id}), append(counts, map[string]int{})
+		}
+
+		for field, acc := range spec {
+			if field == "_id" {
+				continue
+			}
+
+			ops, ok := acc.(bson.M)
+			if !ok || len(ops) != 1 {
+				return nil, fmt.Errorf("$group field %s must be a single accumulator", field)
+			}
+
+			for op, e := range ops {
+				v := expression(doc, e)
+				current, exists := groups[i][field]
+				switch op {
+				case "$sum", "$avg":
+					if !exists {
+						groups[i][field] = int32(0)
+					}
+
+					if _, ok := toFloat(v); ok {
+						groups[i][field] = addNumbers(groups[i][field], v)
+						counts[i][field]++
+					}
+				case "$min", "$max":
+					cmp := compareValues(v, current)
+					if v != nil && (!exists || current == nil || (op == "$min" && cmp < 0) || (op == "$max" && cmp > 0)) {
+						groups[i][field] = v
+					} else if !exists {
+						groups[i][field] = nil
+					}
+				default:
+					return nil, fmt.Errorf("unsupported accumulator %s", op)
+				}
+			}
+		}
+	}
+
+	// averages of the summed values
+	for i, g := range groups {
+		for field, acc := range spec {
+			if ops, ok := acc.(bson.M); ok && ops["$avg"] != nil {
+				total, _ := toFloat(g[field])
+				if counts[i][field] == 0 {
+					g[field] = nil
+				} else {
+					g[field] = total / float64(counts[i][field])
+				}
+			}
+		}
+	}
+
+	return groups, nil
+}
+
+// value of an aggregation expression: "$field.path", a document of expressions or a literal
+func expression(doc bson.M, e interface{}) interface{} {
+	switch t := e.(type) {
+	case string:
+		if strings.HasPrefix(t, "$") {
+			v, _ := lookupFirst(doc, t[1:])
+			return v
+		}
+	case bson.M:
+		res := bson.M{}
+		for k, v := range t {
+			res[k] = expression(doc, v)
+		}
+
+		return res
+	}
+
+	return e
+}
+
+func sortDocuments(docs []bson.M, s bson.D) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, e := range s {
+			a, _ := lookupFirst(docs[i], e.Key)
+			b, _ := lookupFirst(docs[j], e.Key)
+			if cmp := compareValues(a, b); cmp != 0 {
+				return (cmp < 0) == (direction(e.Value) > 0)
+			}
+		}
+
+		return false
+	})
+}
@@ -2,138 +2,329 @@ package db
 
 import (
 	"context"
-	"os"
-	"reflect"
-	"regexp"
-	"strings"
-	"time"
+	"errors"
 	"fmt"
+	"strconv"
+	"sync"
 
-	"github.com/gertd/go-pluralize"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"neodeliver.com/engine/config"
 )
 
-var client *mongo.Client
+var (
+	client   *mongo.Client
+	clientMu sync.Mutex
+)
+
+var commandMonitors []*event.CommandMonitor
+var poolMonitors []*event.PoolMonitor
+
+// register monitors on mongodb commands & connection pool events
+// monitors have to be registered before the client connects
+func Monitor(command *event.CommandMonitor, pool *event.PoolMonitor) {
+	if command != nil {
+		commandMonitors = append(commandMonitors, command)
+	}
+
+	if pool != nil {
+		poolMonitors = append(poolMonitors, pool)
+	}
+}
+
+// mongodb database, only used by mongodb specific stores, modules should use Coll
+// the client is created on first use and shared by all goroutines
+func Client() (*mongo.Database, error) {
+	clientMu.Lock()
+	defer clientMu.Unlock()
 
-func Client() *mongo.Database {
+	c := config.Get().Mongo
 	if client == nil {
-		uri := os.Getenv("mongodb")
+		opts, err := clientOptions(c)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.ConnectTimeout)
+		defer cancel()
 
-		serverAPI := options.ServerAPI(options.ServerAPIVersion1)
-		opts := options.Client().ApplyURI(uri).SetServerAPIOptions(serverAPI)
-		// Create a new client and connect to the server
-		c, err := mongo.Connect(context.TODO(), opts)
+		// connections are established in the background, failures surface on the first operation or Ping
+		res, err := mongo.Connect(ctx, opts)
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("could not connect to mongodb: %w", err)
 		}
 
-		client = c
+		client = res
 	}
 
-	return client.Database("neodeliver")
+	return client.Database(c.Database), nil
 }
 
-func Close() {
-	if client != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		if err := client.Disconnect(ctx); err != nil {
-			panic(err)
+func clientOptions(c config.Mongo) (*options.ClientOptions, error) {
+	mode, err := readpref.ModeFromString(c.ReadPreference)
+	if err != nil {
+		return nil, err
+	}
+
+	rp, err := readpref.New(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	wc := writeconcern.Majority()
+	if c.WriteConcern != "majority" {
+		w, err := strconv.Atoi(c.WriteConcern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid write concern %q", c.WriteConcern)
 		}
 
-		client = nil
+		wc = &writeconcern.WriteConcern{W: w}
 	}
+
+	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
+	opts := options.Client().ApplyURI(c.URI).SetServerAPIOptions(serverAPI).
+		SetMaxPoolSize(uint64(c.MaxPoolSize)).
+		SetMinPoolSize(uint64(c.MinPoolSize)).
+		SetMaxConnIdleTime(c.MaxConnIdleTime).
+		SetConnectTimeout(c.ConnectTimeout).
+		SetServerSelectionTimeout(c.ServerSelectionTimeout).
+		SetSocketTimeout(c.SocketTimeout).
+		SetReadPreference(rp).
+		SetWriteConcern(wc)
+
+	opts.SetMonitor(commandMonitor()).SetPoolMonitor(poolMonitor())
+	return opts, opts.Validate()
 }
 
 // ---
 
-func Find(ctx context.Context, o interface{}, filter interface{}, opts ...*options.FindOneOptions) (interface{}, error) {
-	c := Client()
-	result := o
-	err := c.Collection(CollectionName(o)).FindOne(ctx, filter, opts...).Decode(&result)
-	return result, err
+type mongoDatabase struct{}
+
+func (mongoDatabase) Collection(name string) Collection {
+	return mongoCollection{name}
 }
 
-func Count(ctx context.Context, o interface{}, filter interface{}, opts ...*options.CountOptions) (int64, error) {
-	c := Client()
-	count, err := c.Collection(CollectionName(o)).CountDocuments(ctx, filter, opts...)
+func (mongoDatabase) Ping(ctx context.Context) error {
+	d, err := Client()
 	if err != nil {
-		return 0, err
+		return err
+	}
+
+	return d.Client().Ping(ctx, readpref.Primary())
+}
+
+func (mongoDatabase) Close(ctx context.Context) error {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+
+	if client == nil {
+		return nil
 	}
-	return count, err
+
+	err := client.Disconnect(ctx)
+	client = nil
+	return err
 }
 
-func Save(ctx context.Context, o interface{}) (*mongo.InsertOneResult, error) {
-	c := Client().Collection(CollectionName(o))
-	insertResult, err := c.InsertOne(ctx, o)
-	return insertResult, err
+type mongoCollection struct {
+	name string
 }
 
-func Update(ctx context.Context, o interface{}, filter interface{}, update interface{}) error {
-	c := Client().Collection(CollectionName(o))
-	after := options.After
-	upsert := true
+func (m mongoCollection) collection() (*mongo.Collection, error) {
+	d, err := Client()
+	if err != nil {
+		return nil, err
+	}
 
-	// TODO filter out nil fields
-	fmt.Println(update)
-	update = FilterNilFields(update)
-	fmt.Println(update)
+	return d.Collection(m.name), nil
+}
 
-	res := c.FindOneAndUpdate(ctx, filter, map[string]interface{}{"$set": update}, &options.FindOneAndUpdateOptions{
-		ReturnDocument: &after,
-		Upsert:         &upsert,
-	})
+func (m mongoCollection) FindOne(ctx context.Context, filter interface{}, result interface{}) error {
+	c, err := m.collection()
+	if err != nil {
+		return err
+	}
+
+	return c.FindOne(ctx, orEmpty(filter)).Decode(result)
+}
 
-	if err := res.Err(); err != nil {
+func (m mongoCollection) Find(ctx context.Context, filter interface{}, results interface{}, opts FindOptions) error {
+	o := options.Find().SetSkip(opts.Skip).SetLimit(opts.Limit)
+	if opts.Sort != nil {
+		o.SetSort(opts.Sort)
+	}
+
+	c, err := m.collection()
+	if err != nil {
+		return err
+	}
+
+	cur, err := c.Find(ctx, orEmpty(filter), o)
+	if err != nil {
+		return err
+	}
+
+	return cur.All(ctx, results)
+}
+
+func (m mongoCollection) Aggregate(ctx context.Context, pipeline []bson.M, results interface{}) error {
+	c, err := m.collection()
+	if err != nil {
+		return err
+	}
+
+	cur, err := c.Aggregate(ctx, pipeline)
+	if err != nil {
 		return err
 	}
 
-	return res.Decode(o)
+	return cur.All(ctx, results)
 }
 
-func Delete(ctx context.Context, o interface{}, filter interface{}) error {
-	c := Client().Collection(CollectionName(o))
-	_, err := c.DeleteOne(ctx, filter)
+func (m mongoCollection) Count(ctx context.Context, filter interface{}) (int64, error) {
+	c, err := m.collection()
+	if err != nil {
+		return 0, err
+	}
+
+	return c.CountDocuments(ctx, orEmpty(filter))
+}
+
+func (m mongoCollection) InsertOne(ctx context.Context, document interface{}) error {
+	c, err := m.collection()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.InsertOne(ctx, document)
 	return err
 }
 
-func CollectionName(o interface{}) string {
-	name := ToSnakeCase(reflect.TypeOf(o).Elem().Name())
-	return pluralize.NewClient().Plural(name)
+func (m mongoCollection) FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, upsert bool, result interface{}) error {
+	c, err := m.collection()
+	if err != nil {
+		return err
+	}
+
+	res := c.FindOneAndUpdate(ctx, orEmpty(filter), update, options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetUpsert(upsert))
+
+	if err := res.Err(); err != nil || result == nil {
+		return err
+	}
+
+	return res.Decode(result)
 }
 
-// ---
+func (m mongoCollection) UpdateMany(ctx context.Context, filter interface{}, update interface{}) (int64, error) {
+	c, err := m.collection()
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := c.UpdateMany(ctx, orEmpty(filter), update)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.MatchedCount, nil
+}
+
+func (m mongoCollection) DeleteOne(ctx context.Context, filter interface{}) (int64, error) {
+	c, err := m.collection()
+	if err != nil {
+		return 0, err
+	}
 
-var matchFirstCap = regexp.MustCompile("(.)([A-Z][a-z]+)")
-var matchAllCap = regexp.MustCompile("([a-z0-9])([A-Z])")
+	res, err := c.DeleteOne(ctx, orEmpty(filter))
+	if err != nil {
+		return 0, err
+	}
 
-func ToSnakeCase(str string) string {
-	snake := matchFirstCap.ReplaceAllString(str, "${1}_${2}")
-	snake = matchAllCap.ReplaceAllString(snake, "${1}_${2}")
-	return strings.ToLower(snake)
+	return res.DeletedCount, nil
 }
 
-func FilterNilFields(obj interface{}) interface{} {
-	objValue := reflect.ValueOf(obj)
-	objType := objValue.Type()
-	fmt.Println(objValue, objType)
-	
-	// Create a new instance of the same type as the input object
-	result := reflect.New(objType).Elem()
+func (m mongoCollection) DeleteMany(ctx context.Context, filter interface{}) (int64, error) {
+	c, err := m.collection()
+	if err != nil {
+		return 0, err
+	}
 
-	// Iterate over the fields of the object
-	for i := 0; i < objValue.NumField(); i++ {
-		fieldValue := objValue.Field(i)
+	res, err := c.DeleteMany(ctx, orEmpty(filter))
+	if err != nil {
+		return 0, err
+	}
 
-		// Check if the field value is nil
-		if fieldValue.IsNil() {
-			continue // Skip nil fields
+	return res.DeletedCount, nil
+}
+
+func orEmpty(filter interface{}) interface{} {
+	if filter == nil {
+		return bson.D{}
+	}
+
+	return filter
+}
+
+func (m mongoCollection) BulkWrite(ctx context.Context, models []WriteModel) (BulkResult, error) {
+	res := BulkResult{UpsertedIDs: map[int]interface{}{}, Errors: map[int]error{}}
+	if len(models) == 0 {
+		return res, nil
+	}
+
+	c, err := m.collection()
+	if err != nil {
+		return res, err
+	}
+
+	writes := make([]mongo.WriteModel, len(models))
+	for i, model := range models {
+		switch t := model.(type) {
+		case InsertModel:
+			writes[i] = mongo.NewInsertOneModel().SetDocument(t.Document)
+		case UpdateModel:
+			if t.Multi {
+				writes[i] = mongo.NewUpdateManyModel().SetFilter(orEmpty(t.Filter)).SetUpdate(t.Update).SetUpsert(t.Upsert)
+			} else {
+				writes[i] = mongo.NewUpdateOneModel().SetFilter(orEmpty(t.Filter)).SetUpdate(t.Update).SetUpsert(t.Upsert)
+			}
+		case DeleteModel:
+			if t.Multi {
+				writes[i] = mongo.NewDeleteManyModel().SetFilter(orEmpty(t.Filter))
+			} else {
+				writes[i] = mongo.NewDeleteOneModel().SetFilter(orEmpty(t.Filter))
+			}
+		default:
+			return res, fmt.Errorf("unsupported write model %T", model)
 		}
+	}
 
-		// Set the field value in the result object
-		result.Field(i).Set(fieldValue)
+	r, err := c.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+
+	// write errors are reported by model, other errors (network, write concern...) fail the whole batch
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, e := range bulkErr.WriteErrors {
+			res.Errors[e.Index] = mongo.WriteException{WriteErrors: []mongo.WriteError{e.WriteError}}
+		}
+	} else if err != nil {
+		return res, err
+	}
+
+	if r != nil {
+		res.Inserted = r.InsertedCount
+		res.Matched = r.MatchedCount
+		res.Upserted = r.UpsertedCount
+		res.Deleted = r.DeletedCount
+		for i, id := range r.UpsertedIDs {
+			res.UpsertedIDs[int(i)] = id
+		}
 	}
 
-	return result.Interface()
+	return res, nil
 }
@@ -0,0 +1,235 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gertd/go-pluralize"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"neodeliver.com/engine/config"
+)
+
+// Storage of the modules, backed by mongodb or kept in memory (tests & local development)
+// filters & updates use the mongodb query language
+// -------------------------------------------------------------------------------------
+
+var ErrNoDocuments = mongo.ErrNoDocuments
+
+type Database interface {
+	Collection(name string) Collection
+	// verify the database is reachable
+	Ping(ctx context.Context) error
+	Close(ctx context.Context) error
+}
+
+type Collection interface {
+	// decode the first document matching filter into result, ErrNoDocuments when none matches
+	FindOne(ctx context.Context, filter interface{}, result interface{}) error
+	// decode the documents matching filter into results, a pointer to a slice
+	Find(ctx context.Context, filter interface{}, results interface{}, opts FindOptions) error
+	// decode the documents of the aggregation pipeline into results, a pointer to a slice
+	Aggregate(ctx context.Context, pipeline []bson.M, results interface{}) error
+	Count(ctx context.Context, filter interface{}) (int64, error)
+	InsertOne(ctx context.Context, document interface{}) error
+	// update the first document matching filter and decode it into result (optional) once updated
+	FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, upsert bool, result interface{}) error
+	// update the documents matching filter, returns the number of matched documents
+	UpdateMany(ctx context.Context, filter interface{}, update interface{}) (int64, error)
+	DeleteOne(ctx context.Context, filter interface{}) (int64, error)
+	DeleteMany(ctx context.Context, filter interface{}) (int64, error)
+	// execute the writes in a single round trip, unordered: failed writes don't prevent the others
+	BulkWrite(ctx context.Context, models []WriteModel) (BulkResult, error)
+}
+
+type FindOptions struct {
+	Sort  bson.D
+	Skip  int64
+	Limit int64 // 0 for no limit
+}
+
+// InsertModel, UpdateModel or DeleteModel
+type WriteModel interface {
+	writeModel()
+}
+
+type InsertModel struct {
+	Document interface{}
+}
+
+type UpdateModel struct {
+	Filter interface{}
+	Update interface{}
+	Upsert bool
+	Multi  bool // update all matching documents
+}
+
+type DeleteModel struct {
+	Filter interface{}
+	Multi  bool // delete all matching documents
+}
+
+func (InsertModel) writeModel() {}
+func (UpdateModel) writeModel() {}
+func (DeleteModel) writeModel() {}
+
+type BulkResult struct {
+	Inserted    int64
+	Matched     int64
+	Upserted    int64
+	Deleted     int64
+	UpsertedIDs map[int]interface{} // by model index
+	Errors      map[int]error       // by model index, only set for failed writes
+}
+
+var (
+	database Database
+	mu       sync.Mutex
+)
+
+// overwrite the database, used by tests
+func SetDatabase(d Database) {
+	mu.Lock()
+	database = d
+	mu.Unlock()
+}
+
+func current() Database {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if database == nil {
+		switch config.Get().Database {
+		case "memory":
+			database = NewMemory()
+		default:
+			database = mongoDatabase{}
+		}
+	}
+
+	return database
+}
+
+// collection of the current database
+func Coll(name string) Collection {
+	return current().Collection(name)
+}
+
+// whether the in-memory database is used, stores backed by mongodb should then fallback to memory
+func InMemory() bool {
+	_, ok := current().(*Memory)
+	return ok
+}
+
+// verify the database is reachable
+func Ping(ctx context.Context) error {
+	return current().Ping(ctx)
+}
+
+func Close(ctx context.Context) error {
+	mu.Lock()
+	d := database
+	mu.Unlock()
+
+	if d == nil {
+		return nil
+	}
+
+	return d.Close(ctx)
+}
+
+// ---
+
+func Find(ctx context.Context, o interface{}, filter interface{}) (interface{}, error) {
+	err := Coll(CollectionName(o)).FindOne(ctx, filter, o)
+	return o, err
+}
+
+func Count(ctx context.Context, o interface{}, filter interface{}) (int64, error) {
+	return Coll(CollectionName(o)).Count(ctx, filter)
+}
+
+func Save(ctx context.Context, o interface{}) error {
+	return Coll(CollectionName(o)).InsertOne(ctx, o)
+}
+
+func Update(ctx context.Context, o interface{}, filter interface{}, update interface{}) error {
+	// TODO filter out nil fields
+	update = FilterNilFields(update)
+
+	return Coll(CollectionName(o)).FindOneAndUpdate(ctx, filter, map[string]interface{}{"$set": update}, true, o)
+}
+
+func Delete(ctx context.Context, o interface{}, filter interface{}) error {
+	_, err := Coll(CollectionName(o)).DeleteOne(ctx, filter)
+	return err
+}
+
+func CollectionName(o interface{}) string {
+	name := ToSnakeCase(reflect.TypeOf(o).Elem().Name())
+	return pluralize.NewClient().Plural(name)
+}
+
+// ---
+
+var matchFirstCap = regexp.MustCompile("(.)([A-Z][a-z]+)")
+var matchAllCap = regexp.MustCompile("([a-z0-9])([A-Z])")
+
+func ToSnakeCase(str string) string {
+	snake := matchFirstCap.ReplaceAllString(str, "${1}_${2}")
+	snake = matchAllCap.ReplaceAllString(snake, "${1}_${2}")
+	return strings.ToLower(snake)
+}
+
+func FilterNilFields(obj interface{}) interface{} {
+	objValue := reflect.ValueOf(obj)
+	objType := objValue.Type()
+
+	// maps are filtered by key
+	if objType.Kind() == reflect.Map {
+		result := reflect.MakeMap(objType)
+		for _, k := range objValue.MapKeys() {
+			if v := objValue.MapIndex(k); !isNil(v) {
+				result.SetMapIndex(k, v)
+			}
+		}
+
+		return result.Interface()
+	}
+
+	// Create a new instance of the same type as the input object
+	result := reflect.New(objType).Elem()
+
+	// Iterate over the fields of the object
+	for i := 0; i < objValue.NumField(); i++ {
+		fieldValue := objValue.Field(i)
+
+		// Check if the field value is nil
+		if fieldValue.IsNil() {
+			continue // Skip nil fields
+		}
+
+		// Set the field value in the result object
+		result.Field(i).Set(fieldValue)
+	}
+
+	return result.Interface()
+}
+
+func isNil(v reflect.Value) bool {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return v.IsNil()
+	}
+
+	return false
+}
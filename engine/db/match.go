@@ -0,0 +1,753 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Query & update operators of the in-memory database
+// -------------------------------------------------------------------------------------
+
+func matchDocument(doc bson.M, filter bson.M) (bool, error) {
+	for key, cond := range filter {
+		ok, err := matchKey(doc, key, cond)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func matchKey(doc bson.M, key string, cond interface{}) (bool, error) {
+	switch key {
+	case "$and", "$or", "$nor":
+		list, ok := cond.(bson.A)
+		if !ok {
+			return false, fmt.Errorf("%s argument must be an array", key)
+		}
+
+		matches := 0
+		for _, item := range list {
+			f, ok := item.(bson.M)
+			if !ok {
+				return false, fmt.Errorf("%s entries must be documents", key)
+			}
+
+			ok, err := matchDocument(doc, f)
+			if err != nil {
+				return false, err
+			} else if ok {
+				matches++
+			}
+		}
+
+		switch key {
+		case "$and":
+			return matches == len(list), nil
+		case "$or":
+			return matches > 0, nil
+		default:
+			return matches == 0, nil
+		}
+	}
+
+	if strings.HasPrefix(key, "$") {
+		return false, fmt.Errorf("unsupported query operator %s", key)
+	}
+
+	values, exists := lookup(doc, key)
+	return matchCondition(values, exists, cond)
+}
+
+// match the values of a field against an equality or operators condition
+func matchCondition(values []interface{}, exists bool, cond interface{}) (bool, error) {
+	ops, ok := cond.(bson.M)
+	if !ok || !isOperators(ops) {
+		return matchEquality(values, exists, cond), nil
+	}
+
+	for op, arg := range ops {
+		ok, err := matchOperator(values, exists, op, arg, ops)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func isOperators(m bson.M) bool {
+	for k := range m {
+		if strings.HasPrefix(k, "$") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchEquality(values []interface{}, exists bool, cond interface{}) bool {
+	if r, ok := cond.(primitive.Regex); ok {
+		ok, _ := matchRegex(values, r.Pattern, r.Options)
+		return ok
+	}
+
+	if cond == nil && !exists {
+		return true
+	}
+
+	for _, v := range expand(values) {
+		if equalValues(v, cond) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchOperator(values []interface{}, exists bool, op string, arg interface{}, ops bson.M) (bool, error) {
+	switch op {
+	case "$eq":
+		return matchEquality(values, exists, arg), nil
+	case "$ne":
+		return !matchEquality(values, exists, arg), nil
+	case "$in", "$nin":
+		list, ok := arg.(bson.A)
+		if !ok {
+			return false, fmt.Errorf("%s argument must be an array", op)
+		}
+
+		found := false
+		for _, item := range list {
+			if matchEquality(values, exists, item) {
+				found = true
+				break
+			}
+		}
+
+		return found == (op == "$in"), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		for _, v := range expand(values) {
+			if !comparable(v, arg) {
+				continue
+			}
+
+			cmp := compareValues(v, arg)
+			if (op == "$gt" && cmp > 0) || (op == "$gte" && cmp >= 0) || (op == "$lt" && cmp < 0) || (op == "$lte" && cmp <= 0) {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	case "$exists":
+		want, _ := arg.(bool)
+		if f, ok := toFloat(arg); ok {
+			want = f != 0
+		}
+
+		return exists == want, nil
+	case "$regex":
+		options, _ := ops["$options"].(string)
+		switch r := arg.(type) {
+		case string:
+			return matchRegex(values, r, options)
+		case primitive.Regex:
+			return matchRegex(values, r.Pattern, r.Options+options)
+		}
+
+		return false, fmt.Errorf("$regex argument must be a string")
+	case "$options":
+		return true, nil
+	case "$not":
+		ok, err := matchCondition(values, exists, arg)
+		return !ok, err
+	case "$all":
+		list, ok := arg.(bson.A)
+		if !ok {
+			return false, fmt.Errorf("$all argument must be an array")
+		}
+
+		for _, item := range list {
+			if !matchEquality(values, exists, item) {
+				return false, nil
+			}
+		}
+
+		return len(list) > 0, nil
+	case "$size":
+		n, ok := toFloat(arg)
+		if !ok {
+			return false, fmt.Errorf("$size argument must be a number")
+		}
+
+		for _, v := range values {
+			if a, ok := v.(bson.A); ok && float64(len(a)) == n {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	case "$elemMatch":
+		f, ok := arg.(bson.M)
+		if !ok {
+			return false, fmt.Errorf("$elemMatch argument must be a document")
+		}
+
+		for _, v := range values {
+			a, _ := v.(bson.A)
+			for _, item := range a {
+				var ok bool
+				var err error
+				if doc, isDoc := item.(bson.M); isDoc && !isOperators(f) {
+					ok, err = matchDocument(doc, f)
+				} else {
+					ok, err = matchCondition([]interface{}{item}, true, f)
+				}
+
+				if err != nil {
+					return false, err
+				} else if ok {
+					return true, nil
+				}
+			}
+		}
+
+		return false, nil
+	}
+
+	return false, fmt.Errorf("unsupported query operator %s", op)
+}
+
+func matchRegex(values []interface{}, pattern string, options string) (bool, error) {
+	flags := ""
+	for _, o := range options {
+		if strings.ContainsRune("imsx", o) && o != 'x' {
+			flags += string(o)
+		}
+	}
+
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+
+	for _, v := range expand(values) {
+		if s, ok := v.(string); ok && r.MatchString(s) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// field values at a dotted path, traversing arrays of documents
+func lookup(doc bson.M, path string) ([]interface{}, bool) {
+	key, rest, nested := strings.Cut(path, ".")
+	v, ok := doc[key]
+	if !ok {
+		return nil, false
+	} else if !nested {
+		return []interface{}{v}, true
+	}
+
+	switch t := v.(type) {
+	case bson.M:
+		return lookup(t, rest)
+	case bson.A:
+		// numeric index or field of the array documents
+		index, sub, _ := strings.Cut(rest, ".")
+		if i, err := strconv.Atoi(index); err == nil {
+			if i < 0 || i >= len(t) {
+				return nil, false
+			} else if sub == "" {
+				return []interface{}{t[i]}, true
+			} else if d, ok := t[i].(bson.M); ok {
+				return lookup(d, sub)
+			}
+
+			return nil, false
+		}
+
+		res, found := []interface{}{}, false
+		for _, item := range t {
+			if d, ok := item.(bson.M); ok {
+				values, ok := lookup(d, rest)
+				res = append(res, values...)
+				found = found || ok
+			}
+		}
+
+		return res, found
+	}
+
+	return nil, false
+}
+
+func lookupFirst(doc bson.M, path string) (interface{}, bool) {
+	values, ok := lookup(doc, path)
+	if !ok || len(values) == 0 {
+		return nil, false
+	}
+
+	return values[0], true
+}
+
+// values & the elements of array values, matched by equality & comparison operators
+func expand(values []interface{}) []interface{} {
+	res := []interface{}{}
+	for _, v := range values {
+		res = append(res, v)
+		if a, ok := v.(bson.A); ok {
+			res = append(res, a...)
+		}
+	}
+
+	return res
+}
+
+// ---
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+
+	return 0, false
+}
+
+func toTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case primitive.DateTime:
+		return t.Time(), true
+	case time.Time:
+		return t, true
+	}
+
+	return time.Time{}, false
+}
+
+// values of the same kind can be compared with $gt, $lt...
+func comparable(a, b interface{}) bool {
+	return typeOrder(a) == typeOrder(b)
+}
+
+// sort order of bson types
+func typeOrder(v interface{}) int {
+	if _, ok := toFloat(v); ok {
+		return 2
+	} else if _, ok := toTime(v); ok {
+		return 7
+	}
+
+	switch v.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return 1
+	case string:
+		return 3
+	case bson.M:
+		return 4
+	case bson.A:
+		return 5
+	case primitive.Binary:
+		return 6
+	case primitive.ObjectID:
+		return 8
+	case bool:
+		return 9
+	case primitive.Timestamp:
+		return 10
+	}
+
+	return 11
+}
+
+func compareValues(a, b interface{}) int {
+	if oa, ob := typeOrder(a), typeOrder(b); oa != ob {
+		return oa - ob
+	}
+
+	if fa, ok := toFloat(a); ok {
+		fb, _ := toFloat(b)
+		return compareFloat(fa, fb)
+	} else if ta, ok := toTime(a); ok {
+		tb, _ := toTime(b)
+		return ta.Compare(tb)
+	}
+
+	switch t := a.(type) {
+	case string:
+		return strings.Compare(t, b.(string))
+	case primitive.ObjectID:
+		id := b.(primitive.ObjectID)
+		return bytes.Compare(t[:], id[:])
+	case bool:
+		if t == b.(bool) {
+			return 0
+		} else if t {
+			return 1
+		}
+
+		return -1
+	case bson.A:
+		other := b.(bson.A)
+		for i := 0; i < len(t) && i < len(other); i++ {
+			if cmp := compareValues(t[i], other[i]); cmp != 0 {
+				return cmp
+			}
+		}
+
+		return len(t) - len(other)
+	}
+
+	if equalValues(a, b) {
+		return 0
+	}
+
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func compareFloat(a, b float64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+
+	return 0
+}
+
+func equalValues(a, b interface{}) bool {
+	if typeOrder(a) != typeOrder(b) {
+		return false
+	}
+
+	switch t := a.(type) {
+	case bson.M:
+		other := b.(bson.M)
+		if len(t) != len(other) {
+			return false
+		}
+
+		for k, v := range t {
+			if w, ok := other[k]; !ok || !equalValues(v, w) {
+				return false
+			}
+		}
+
+		return true
+	case bson.A:
+		other := b.(bson.A)
+		if len(t) != len(other) {
+			return false
+		}
+
+		for i := range t {
+			if !equalValues(t[i], other[i]) {
+				return false
+			}
+		}
+
+		return true
+	case nil, primitive.Null, primitive.Undefined:
+		return true
+	}
+
+	return compareValues(a, b) == 0
+}
+
+// ---
+
+// apply the update operators to a copy of the document
+// updates without operators replace the document, keeping its _id
+func applyUpdate(doc bson.M, update bson.M, insert bool) (bson.M, error) {
+	res := normalize(doc).(bson.M)
+	if !isOperators(update) {
+		replacement := normalize(update).(bson.M)
+		if id, ok := res["_id"]; ok {
+			replacement["_id"] = id
+		}
+
+		return replacement, nil
+	}
+
+	for op, arg := range update {
+		fields, ok := arg.(bson.M)
+		if !ok {
+			return nil, fmt.Errorf("%s argument must be a document", op)
+		}
+
+		for path, v := range fields {
+			var err error
+			switch op {
+			case "$set":
+				err = setPath(res, path, normalize(v))
+			case "$setOnInsert":
+				if insert {
+					err = setPath(res, path, normalize(v))
+				}
+			case "$unset":
+				unsetPath(res, path)
+			case "$inc":
+				current, _ := lookupFirst(res, path)
+				err = setPath(res, path, addNumbers(current, v))
+			case "$min", "$max":
+				current, exists := lookupFirst(res, path)
+				cmp := compareValues(v, current)
+				if !exists || (op == "$min" && cmp < 0) || (op == "$max" && cmp > 0) {
+					err = setPath(res, path, normalize(v))
+				}
+			case "$push", "$addToSet":
+				err = pushPath(res, path, v, op == "$addToSet")
+			case "$pull":
+				err = pullPath(res, path, v)
+			case "$currentDate":
+				err = setPath(res, path, primitive.NewDateTimeFromTime(time.Now()))
+			default:
+				return nil, fmt.Errorf("unsupported update operator %s", op)
+			}
+
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// replace the positional $ of the update paths by the index of the first array element matched by the filter
+func resolvePositional(doc bson.M, filter bson.M, update bson.M) (bson.M, error) {
+	res := bson.M{}
+	for op, arg := range update {
+		fields, ok := arg.(bson.M)
+		if !ok || !strings.HasPrefix(op, "$") {
+			res[op] = arg
+			continue
+		}
+
+		resolved := bson.M{}
+		for path, v := range fields {
+			prefix, rest, found := strings.Cut(path, ".$")
+			if !found || (rest != "" && !strings.HasPrefix(rest, ".")) {
+				resolved[path] = v
+				continue
+			}
+
+			i, err := positionalIndex(doc, filter, prefix)
+			if err != nil {
+				return nil, err
+			}
+
+			resolved[prefix+"."+strconv.Itoa(i)+rest] = v
+		}
+
+		res[op] = resolved
+	}
+
+	return res, nil
+}
+
+func positionalIndex(doc bson.M, filter bson.M, prefix string) (int, error) {
+	list, _ := lookupFirst(doc, prefix)
+	a, ok := list.(bson.A)
+	if !ok {
+		return 0, fmt.Errorf("the positional operator did not find the array %s", prefix)
+	}
+
+	for i, item := range a {
+		matched, conditions := true, 0
+		for k, cond := range filter {
+			var ok bool
+			var err error
+			if k == prefix {
+				ok, err = matchCondition([]interface{}{bson.A{item}}, true, cond)
+			} else if sub, found := strings.CutPrefix(k, prefix+"."); found {
+				d, _ := item.(bson.M)
+				ok, err = matchKey(d, sub, cond)
+			} else {
+				continue
+			}
+
+			if err != nil {
+				return 0, err
+			}
+
+			conditions++
+			matched = matched && ok
+		}
+
+		if conditions > 0 && matched {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("the positional operator did not find the match needed from the query on %s", prefix)
+}
+
+// document inserted by upserts, made of the equality conditions of the filter
+func upsertDocument(filter bson.M) bson.M {
+	res := bson.M{}
+	for k, v := range filter {
+		if strings.HasPrefix(k, "$") {
+			continue
+		}
+
+		if ops, ok := v.(bson.M); ok && isOperators(ops) {
+			if eq, ok := ops["$eq"]; ok {
+				setPath(res, k, eq)
+			}
+
+			continue
+		}
+
+		setPath(res, k, v)
+	}
+
+	return res
+}
+
+func setPath(doc bson.M, path string, v interface{}) error {
+	key, rest, nested := strings.Cut(path, ".")
+	if !nested {
+		doc[key] = v
+		return nil
+	}
+
+	switch t := doc[key].(type) {
+	case nil:
+		sub := bson.M{}
+		doc[key] = sub
+		return setPath(sub, rest, v)
+	case bson.M:
+		return setPath(t, rest, v)
+	case bson.A:
+		index, sub, _ := strings.Cut(rest, ".")
+		i, err := strconv.Atoi(index)
+		if err != nil || i < 0 || i >= len(t) {
+			return fmt.Errorf("cannot update %s: invalid array index %s", path, index)
+		} else if sub == "" {
+			t[i] = v
+			return nil
+		} else if d, ok := t[i].(bson.M); ok {
+			return setPath(d, sub, v)
+		}
+	}
+
+	return fmt.Errorf("cannot update %s: %s is not a document", path, key)
+}
+
+func unsetPath(doc bson.M, path string) {
+	key, rest, nested := strings.Cut(path, ".")
+	if !nested {
+		delete(doc, key)
+	} else if sub, ok := doc[key].(bson.M); ok {
+		unsetPath(sub, rest)
+	}
+}
+
+func addNumbers(a, b interface{}) interface{} {
+	fa, _ := toFloat(a)
+	fb, _ := toFloat(b)
+
+	switch {
+	case isFloat(a) || isFloat(b):
+		return fa + fb
+	case isInt64(a) || isInt64(b):
+		return int64(fa) + int64(fb)
+	}
+
+	return int32(fa) + int32(fb)
+}
+
+func isFloat(v interface{}) bool {
+	_, ok := v.(float64)
+	return ok
+}
+
+func isInt64(v interface{}) bool {
+	switch v.(type) {
+	case int64, int:
+		return true
+	}
+
+	return false
+}
+
+func pushPath(doc bson.M, path string, v interface{}, unique bool) error {
+	items := bson.A{normalize(v)}
+	if m, ok := v.(bson.M); ok {
+		if each, ok := m["$each"].(bson.A); ok {
+			items = normalize(each).(bson.A)
+		}
+	}
+
+	current, _ := lookupFirst(doc, path)
+	list, ok := current.(bson.A)
+	if current != nil && !ok {
+		return fmt.Errorf("cannot push to %s: not an array", path)
+	}
+
+	list = append(bson.A{}, list...)
+	for _, item := range items {
+		exists := false
+		for _, existing := range list {
+			if unique && equalValues(existing, item) {
+				exists = true
+				break
+			}
+		}
+
+		if !exists {
+			list = append(list, item)
+		}
+	}
+
+	return setPath(doc, path, list)
+}
+
+func pullPath(doc bson.M, path string, cond interface{}) error {
+	current, _ := lookupFirst(doc, path)
+	list, ok := current.(bson.A)
+	if !ok {
+		return nil
+	}
+
+	res := bson.A{}
+	for _, item := range list {
+		var match bool
+		var err error
+		if c, isDoc := cond.(bson.M); isDoc && !isOperators(c) {
+			d, _ := item.(bson.M)
+			match, err = matchDocument(d, c)
+		} else {
+			match, err = matchCondition([]interface{}{item}, true, cond)
+		}
+
+		if err != nil {
+			return err
+		} else if !match {
+			res = append(res, item)
+		}
+	}
+
+	return setPath(doc, path, res)
+}
@@ -0,0 +1,427 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// in-memory database, supporting the query & update operators used by the modules
+// documents are stored as bson.M, encoded & decoded through their bson tags like mongodb does
+type Memory struct {
+	mu          sync.Mutex
+	collections map[string][]bson.M
+}
+
+func NewMemory() *Memory {
+	return &Memory{collections: map[string][]bson.M{}}
+}
+
+func (m *Memory) Collection(name string) Collection {
+	return &memoryCollection{m, name}
+}
+
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *Memory) Close(ctx context.Context) error {
+	return nil
+}
+
+type memoryCollection struct {
+	m    *Memory
+	name string
+}
+
+// documents matching filter, in insertion order
+func (c *memoryCollection) match(filter interface{}) ([]int, error) {
+	f, err := toDocument(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []int{}
+	for i, doc := range c.m.collections[c.name] {
+		ok, err := matchDocument(doc, f)
+		if err != nil {
+			return nil, err
+		} else if ok {
+			res = append(res, i)
+		}
+	}
+
+	return res, nil
+}
+
+func (c *memoryCollection) FindOne(ctx context.Context, filter interface{}, result interface{}) error {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+
+	found, err := c.match(filter)
+	if err != nil {
+		return err
+	} else if len(found) == 0 {
+		return ErrNoDocuments
+	}
+
+	return decode(c.m.collections[c.name][found[0]], result)
+}
+
+func (c *memoryCollection) Find(ctx context.Context, filter interface{}, results interface{}, opts FindOptions) error {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+
+	rv := reflect.ValueOf(results)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("results argument must be a pointer to a slice, got %T", results)
+	}
+
+	found, err := c.match(filter)
+	if err != nil {
+		return err
+	}
+
+	docs := []bson.M{}
+	for _, i := range found {
+		docs = append(docs, c.m.collections[c.name][i])
+	}
+
+	if len(opts.Sort) > 0 {
+		sortDocuments(docs, opts.Sort)
+	}
+
+	if opts.Skip >= int64(len(docs)) {
+		docs = nil
+	} else {
+		docs = docs[opts.Skip:]
+	}
+
+	if opts.Limit > 0 && opts.Limit < int64(len(docs)) {
+		docs = docs[:opts.Limit]
+	}
+
+	return decodeAll(docs, rv)
+}
+
+func (c *memoryCollection) Aggregate(ctx context.Context, pipeline []bson.M, results interface{}) error {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+
+	rv := reflect.ValueOf(results)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("results argument must be a pointer to a slice, got %T", results)
+	}
+
+	docs, err := aggregate(append([]bson.M{}, c.m.collections[c.name]...), pipeline)
+	if err != nil {
+		return err
+	}
+
+	return decodeAll(docs, rv)
+}
+
+// decode the documents into the slice pointed by rv
+func decodeAll(docs []bson.M, rv reflect.Value) error {
+	slice := reflect.MakeSlice(rv.Elem().Type(), 0, len(docs))
+	for _, doc := range docs {
+		item := reflect.New(slice.Type().Elem())
+		if err := decode(doc, item.Interface()); err != nil {
+			return err
+		}
+
+		slice = reflect.Append(slice, item.Elem())
+	}
+
+	rv.Elem().Set(slice)
+	return nil
+}
+
+func (c *memoryCollection) Count(ctx context.Context, filter interface{}) (int64, error) {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+
+	found, err := c.match(filter)
+	return int64(len(found)), err
+}
+
+func (c *memoryCollection) InsertOne(ctx context.Context, document interface{}) error {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+
+	doc, err := toDocument(document)
+	if err != nil {
+		return err
+	}
+
+	return c.insert(doc)
+}
+
+func (c *memoryCollection) insert(doc bson.M) error {
+	if _, ok := doc["_id"]; !ok {
+		doc["_id"] = primitive.NewObjectID()
+	}
+
+	for _, existing := range c.m.collections[c.name] {
+		if equalValues(existing["_id"], doc["_id"]) {
+			return mongo.WriteException{WriteErrors: []mongo.WriteError{{
+				Code:    11000,
+				Message: fmt.Sprintf("E11000 duplicate key error collection: %s index: _id_ dup key: { _id: %v }", c.name, doc["_id"]),
+			}}}
+		}
+	}
+
+	c.m.collections[c.name] = append(c.m.collections[c.name], doc)
+	return nil
+}
+
+func (c *memoryCollection) FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, upsert bool, result interface{}) error {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+
+	u, err := toDocument(update)
+	if err != nil {
+		return err
+	}
+
+	found, err := c.match(filter)
+	if err != nil {
+		return err
+	}
+
+	var doc bson.M
+	if len(found) > 0 {
+		doc, err = c.apply(c.m.collections[c.name][found[0]], filter, u)
+		if err != nil {
+			return err
+		}
+
+		c.m.collections[c.name][found[0]] = doc
+	} else if upsert {
+		f, err := toDocument(filter)
+		if err != nil {
+			return err
+		}
+
+		if doc, err = applyUpdate(upsertDocument(f), u, true); err != nil {
+			return err
+		} else if err := c.insert(doc); err != nil {
+			return err
+		}
+	} else {
+		return ErrNoDocuments
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return decode(doc, result)
+}
+
+func (c *memoryCollection) UpdateMany(ctx context.Context, filter interface{}, update interface{}) (int64, error) {
+	matched, _, err := c.update(filter, update, false, true)
+	return matched, err
+}
+
+func (c *memoryCollection) DeleteOne(ctx context.Context, filter interface{}) (int64, error) {
+	return c.delete(filter, 1)
+}
+
+func (c *memoryCollection) DeleteMany(ctx context.Context, filter interface{}) (int64, error) {
+	return c.delete(filter, -1)
+}
+
+func (c *memoryCollection) delete(filter interface{}, limit int) (int64, error) {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+
+	found, err := c.match(filter)
+	if err != nil {
+		return 0, err
+	} else if limit > 0 && len(found) > limit {
+		found = found[:limit]
+	}
+
+	removed := map[int]bool{}
+	for _, i := range found {
+		removed[i] = true
+	}
+
+	docs := []bson.M{}
+	for i, doc := range c.m.collections[c.name] {
+		if !removed[i] {
+			docs = append(docs, doc)
+		}
+	}
+
+	c.m.collections[c.name] = docs
+	return int64(len(found)), nil
+}
+
+// ---
+
+// encode a struct, map or bson document into a bson.M, nested documents being bson.M & arrays bson.A
+func toDocument(v interface{}) (bson.M, error) {
+	if v == nil {
+		return bson.M{}, nil
+	}
+
+	bs, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := bson.M{}
+	if err := bson.Unmarshal(bs, &doc); err != nil {
+		return nil, err
+	}
+
+	return normalize(doc).(bson.M), nil
+}
+
+func normalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	case bson.M:
+		res := bson.M{}
+		for k, v := range t {
+			res[k] = normalize(v)
+		}
+
+		return res
+	case bson.D:
+		res := bson.M{}
+		for _, e := range t {
+			res[e.Key] = normalize(e.Value)
+		}
+
+		return res
+	case bson.A:
+		res := bson.A{}
+		for _, v := range t {
+			res = append(res, normalize(v))
+		}
+
+		return res
+	}
+
+	return v
+}
+
+func decode(doc bson.M, result interface{}) error {
+	bs, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	return bson.Unmarshal(bs, result)
+}
+
+func direction(v interface{}) int {
+	if f, ok := toFloat(v); ok && f < 0 {
+		return -1
+	}
+
+	return 1
+}
+
+func (c *memoryCollection) BulkWrite(ctx context.Context, models []WriteModel) (BulkResult, error) {
+	res := BulkResult{UpsertedIDs: map[int]interface{}{}, Errors: map[int]error{}}
+	for i, model := range models {
+		var err error
+		switch t := model.(type) {
+		case InsertModel:
+			if err = c.InsertOne(ctx, t.Document); err == nil {
+				res.Inserted++
+			}
+		case UpdateModel:
+			var matched int64
+			var id interface{}
+			if matched, id, err = c.update(t.Filter, t.Update, t.Upsert, t.Multi); err == nil && id != nil {
+				res.Upserted++
+				res.UpsertedIDs[i] = id
+			}
+
+			res.Matched += matched
+		case DeleteModel:
+			limit := 1
+			if t.Multi {
+				limit = -1
+			}
+
+			var deleted int64
+			deleted, err = c.delete(t.Filter, limit)
+			res.Deleted += deleted
+		default:
+			return res, fmt.Errorf("unsupported write model %T", model)
+		}
+
+		if err != nil {
+			res.Errors[i] = err
+		}
+	}
+
+	return res, nil
+}
+
+// apply the update to a matched document, resolving positional $ paths against the filter
+func (c *memoryCollection) apply(doc bson.M, filter interface{}, update bson.M) (bson.M, error) {
+	f, err := toDocument(filter)
+	if err != nil {
+		return nil, err
+	} else if update, err = resolvePositional(doc, f, update); err != nil {
+		return nil, err
+	}
+
+	return applyUpdate(doc, update, false)
+}
+
+// update the first or all matching documents, returns the number of matched documents or the id of the upserted one
+func (c *memoryCollection) update(filter interface{}, update interface{}, upsert bool, multi bool) (int64, interface{}, error) {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+
+	u, err := toDocument(update)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	found, err := c.match(filter)
+	if err != nil {
+		return 0, nil, err
+	} else if !multi && len(found) > 1 {
+		found = found[:1]
+	}
+
+	for _, i := range found {
+		doc, err := c.apply(c.m.collections[c.name][i], filter, u)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		c.m.collections[c.name][i] = doc
+	}
+
+	if len(found) > 0 || !upsert {
+		return int64(len(found)), nil, nil
+	}
+
+	f, err := toDocument(filter)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	doc, err := applyUpdate(upsertDocument(f), u, true)
+	if err != nil {
+		return 0, nil, err
+	} else if err := c.insert(doc); err != nil {
+		return 0, nil, err
+	}
+
+	return 0, doc["_id"], nil
+}
@@ -0,0 +1,345 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func memoryFixture(t *testing.T) Collection {
+	t.Helper()
+
+	c := NewMemory().Collection("contacts")
+	for _, doc := range []bson.M{
+		{"_id": "a", "status": "ACTIVE", "tags": bson.A{"t1", "t2"}, "score": 3, "events": bson.A{bson.M{"kind": "open", "count": 2}}},
+		{"_id": "b", "status": "PENDING", "tags": bson.A{"t2"}, "score": 7, "events": bson.A{bson.M{"kind": "click", "count": 1}}},
+		{"_id": "c", "status": "UNSUBSCRIBED", "tags": bson.A{}, "score": 5},
+		{"_id": "d", "status": "ACTIVE", "score": 1, "email": "john.doe@example.com"},
+	} {
+		if err := c.InsertOne(context.Background(), doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return c
+}
+
+func findIDs(t *testing.T, c Collection, filter bson.M) []string {
+	t.Helper()
+
+	list := []struct {
+		ID string `bson:"_id"`
+	}{}
+
+	if err := c.Find(context.Background(), filter, &list, FindOptions{Sort: bson.D{{Key: "_id", Value: 1}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []string{}
+	for _, d := range list {
+		ids = append(ids, d.ID)
+	}
+
+	return ids
+}
+
+func TestMemoryQueryOperators(t *testing.T) {
+	c := memoryFixture(t)
+	tests := []struct {
+		name   string
+		filter bson.M
+		want   []string
+	}{
+		{"equality", bson.M{"status": "ACTIVE"}, []string{"a", "d"}},
+		{"array equality", bson.M{"tags": "t2"}, []string{"a", "b"}},
+		{"$in", bson.M{"status": bson.M{"$in": bson.A{"PENDING", "UNSUBSCRIBED"}}}, []string{"b", "c"}},
+		{"$in array field", bson.M{"tags": bson.M{"$in": bson.A{"t1", "t3"}}}, []string{"a"}},
+		{"$nin", bson.M{"status": bson.M{"$nin": bson.A{"ACTIVE"}}}, []string{"b", "c"}},
+		{"$nin array field", bson.M{"tags": bson.M{"$nin": bson.A{"t2"}}}, []string{"c", "d"}},
+		{"$nin missing field", bson.M{"email": bson.M{"$nin": bson.A{"x@example.com"}}}, []string{"a", "b", "c", "d"}},
+		{"$all", bson.M{"tags": bson.M{"$all": bson.A{"t1", "t2"}}}, []string{"a"}},
+		{"$all empty", bson.M{"tags": bson.M{"$all": bson.A{}}}, []string{}},
+		{"$elemMatch document", bson.M{"events": bson.M{"$elemMatch": bson.M{"kind": "open", "count": bson.M{"$gte": 2}}}}, []string{"a"}},
+		{"$elemMatch no match", bson.M{"events": bson.M{"$elemMatch": bson.M{"kind": "click", "count": bson.M{"$gt": 1}}}}, []string{}},
+		{"$elemMatch operators", bson.M{"tags": bson.M{"$elemMatch": bson.M{"$in": bson.A{"t1"}}}}, []string{"a"}},
+		{"$nor", bson.M{"$nor": bson.A{bson.M{"status": "ACTIVE"}, bson.M{"score": bson.M{"$gt": 6}}}}, []string{"c"}},
+		{"$or", bson.M{"$or": bson.A{bson.M{"_id": "a"}, bson.M{"score": 5}}}, []string{"a", "c"}},
+		{"$and", bson.M{"$and": bson.A{bson.M{"status": "ACTIVE"}, bson.M{"score": bson.M{"$lt": 2}}}}, []string{"d"}},
+		{"$not", bson.M{"score": bson.M{"$not": bson.M{"$gte": 5}}}, []string{"a", "d"}},
+		{"$size", bson.M{"tags": bson.M{"$size": 0}}, []string{"c"}},
+		{"$exists", bson.M{"tags": bson.M{"$exists": false}}, []string{"d"}},
+		{"$regex", bson.M{"email": bson.M{"$regex": "^JOHN", "$options": "i"}}, []string{"d"}},
+		{"dotted path", bson.M{"events.kind": "click"}, []string{"b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findIDs(t, c, tt.filter); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryQueryErrors(t *testing.T) {
+	c := memoryFixture(t)
+	for _, filter := range []bson.M{
+		{"status": bson.M{"$in": "ACTIVE"}},
+		{"tags": bson.M{"$all": "t1"}},
+		{"tags": bson.M{"$elemMatch": "t1"}},
+		{"status": bson.M{"$near": 1}},
+	} {
+		if err := c.Find(context.Background(), filter, &[]bson.M{}, FindOptions{}); err == nil {
+			t.Errorf("%v: expected an error", filter)
+		}
+	}
+}
+
+func TestMemoryUpdateOperators(t *testing.T) {
+	tests := []struct {
+		name   string
+		doc    bson.M
+		update bson.M
+		want   bson.M
+	}{
+		{
+			"$addToSet",
+			bson.M{"_id": "a", "tags": bson.A{"t1"}},
+			bson.M{"$addToSet": bson.M{"tags": "t1"}},
+			bson.M{"_id": "a", "tags": bson.A{"t1"}},
+		},
+		{
+			"$addToSet $each",
+			bson.M{"_id": "a", "tags": bson.A{"t1"}},
+			bson.M{"$addToSet": bson.M{"tags": bson.M{"$each": bson.A{"t1", "t2", "t2"}}}},
+			bson.M{"_id": "a", "tags": bson.A{"t1", "t2"}},
+		},
+		{
+			"$addToSet missing field",
+			bson.M{"_id": "a"},
+			bson.M{"$addToSet": bson.M{"tags": "t1"}},
+			bson.M{"_id": "a", "tags": bson.A{"t1"}},
+		},
+		{
+			"$push",
+			bson.M{"_id": "a", "tags": bson.A{"t1"}},
+			bson.M{"$push": bson.M{"tags": "t1"}},
+			bson.M{"_id": "a", "tags": bson.A{"t1", "t1"}},
+		},
+		{
+			"$pull value",
+			bson.M{"_id": "a", "tags": bson.A{"t1", "t2", "t1"}},
+			bson.M{"$pull": bson.M{"tags": "t1"}},
+			bson.M{"_id": "a", "tags": bson.A{"t2"}},
+		},
+		{
+			"$pull $in",
+			bson.M{"_id": "a", "tags": bson.A{"t1", "t2", "t3"}},
+			bson.M{"$pull": bson.M{"tags": bson.M{"$in": bson.A{"t1", "t3"}}}},
+			bson.M{"_id": "a", "tags": bson.A{"t2"}},
+		},
+		{
+			"$pull document",
+			bson.M{"_id": "a", "events": bson.A{bson.M{"kind": "open"}, bson.M{"kind": "click"}}},
+			bson.M{"$pull": bson.M{"events": bson.M{"kind": "open"}}},
+			bson.M{"_id": "a", "events": bson.A{bson.M{"kind": "click"}}},
+		},
+		{
+			"$inc",
+			bson.M{"_id": "a", "count": int32(2)},
+			bson.M{"$inc": bson.M{"count": int32(-3)}},
+			bson.M{"_id": "a", "count": int32(-1)},
+		},
+		{
+			"$inc missing nested field",
+			bson.M{"_id": "a"},
+			bson.M{"$inc": bson.M{"stats.opens": int64(1)}},
+			bson.M{"_id": "a", "stats": bson.M{"opens": int64(1)}},
+		},
+		{
+			"$inc float",
+			bson.M{"_id": "a", "rate": int32(1)},
+			bson.M{"$inc": bson.M{"rate": 0.5}},
+			bson.M{"_id": "a", "rate": 1.5},
+		},
+		{
+			"$set & $unset",
+			bson.M{"_id": "a", "name": "x", "old": true},
+			bson.M{"$set": bson.M{"name": "y"}, "$unset": bson.M{"old": ""}},
+			bson.M{"_id": "a", "name": "y"},
+		},
+		{
+			"$min & $max",
+			bson.M{"_id": "a", "low": int32(5), "high": int32(5)},
+			bson.M{"$min": bson.M{"low": int32(3)}, "$max": bson.M{"high": int32(3)}},
+			bson.M{"_id": "a", "low": int32(3), "high": int32(5)},
+		},
+		{
+			"replacement keeps _id",
+			bson.M{"_id": "a", "name": "x"},
+			bson.M{"email": "y@example.com"},
+			bson.M{"_id": "a", "email": "y@example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			c := NewMemory().Collection("test")
+			if err := c.InsertOne(ctx, tt.doc); err != nil {
+				t.Fatal(err)
+			}
+
+			got := bson.M{}
+			if err := c.FindOneAndUpdate(ctx, bson.M{"_id": "a"}, tt.update, false, &got); err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryUpsert(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemory().Collection("test")
+
+	// inserted documents are made of the equality conditions, $setOnInsert & the update
+	got := bson.M{}
+	filter := bson.M{"_id": "a", "organization_id": "org", "status": bson.M{"$eq": "ACTIVE"}, "score": bson.M{"$gt": 1}}
+	update := bson.M{"$setOnInsert": bson.M{"created": true}, "$inc": bson.M{"count": int32(1)}}
+	if err := c.FindOneAndUpdate(ctx, filter, update, true, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := bson.M{"_id": "a", "organization_id": "org", "status": "ACTIVE", "created": true, "count": int32(1)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("inserted %v, want %v", got, want)
+	}
+
+	// existing documents ignore $setOnInsert
+	update = bson.M{"$setOnInsert": bson.M{"created": false}, "$inc": bson.M{"count": int32(1)}}
+	if err := c.FindOneAndUpdate(ctx, bson.M{"_id": "a"}, update, true, &got); err != nil {
+		t.Fatal(err)
+	} else if got["created"] != true || got["count"] != int32(2) {
+		t.Errorf("updated %v, want created true & count 2", got)
+	}
+
+	if err := c.FindOneAndUpdate(ctx, bson.M{"_id": "b"}, update, false, nil); err != ErrNoDocuments {
+		t.Errorf("got %v, want ErrNoDocuments without upsert", err)
+	}
+
+	// bulk upserts report the ids of inserted documents
+	res, err := c.BulkWrite(ctx, []WriteModel{
+		UpdateModel{Filter: bson.M{"_id": "a"}, Update: bson.M{"$set": bson.M{"x": 1}}, Upsert: true},
+		UpdateModel{Filter: bson.M{"_id": "b"}, Update: bson.M{"$set": bson.M{"x": 1}}, Upsert: true},
+		InsertModel{Document: bson.M{"_id": "a"}},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	} else if res.Matched != 1 || res.Upserted != 1 || res.UpsertedIDs[1] != "b" {
+		t.Errorf("got %+v, want 1 matched & b upserted", res)
+	} else if res.Errors[2] == nil {
+		t.Errorf("expected a duplicate key error")
+	}
+
+	if n, err := c.Count(ctx, bson.M{"x": 1}); err != nil || n != 2 {
+		t.Errorf("counted %d (%v), want 2", n, err)
+	}
+}
+
+func TestMemoryPositionalUpdate(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemory().Collection("test")
+	doc := bson.M{"_id": "a", "tags": bson.A{"t1", "t2"}, "events": bson.A{bson.M{"kind": "open", "count": int32(2)}, bson.M{"kind": "click", "count": int32(1)}}}
+	if err := c.InsertOne(ctx, doc); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		filter bson.M
+		update bson.M
+	}{
+		{"$elemMatch", bson.M{"_id": "a", "events": bson.M{"$elemMatch": bson.M{"kind": "click"}}}, bson.M{"$inc": bson.M{"events.$.count": int32(1)}}},
+		{"dotted field", bson.M{"_id": "a", "events.kind": "click", "events.count": bson.M{"$gte": 2}}, bson.M{"$set": bson.M{"events.$.kind": "tap"}}},
+		{"array value", bson.M{"_id": "a", "tags": "t2"}, bson.M{"$set": bson.M{"tags.$": "t3"}}},
+	}
+
+	for _, tt := range tests {
+		if err := c.FindOneAndUpdate(ctx, tt.filter, tt.update, false, nil); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+	}
+
+	got := bson.M{}
+	want := bson.M{"_id": "a", "tags": bson.A{"t1", "t3"}, "events": bson.A{bson.M{"kind": "open", "count": int32(2)}, bson.M{"kind": "tap", "count": int32(2)}}}
+	if err := c.FindOne(ctx, bson.M{"_id": "a"}, &got); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// the positional operator requires a condition on the array
+	if _, err := c.UpdateMany(ctx, bson.M{"_id": "a"}, bson.M{"$set": bson.M{"tags.$": "t4"}}); err == nil {
+		t.Errorf("expected an error without a condition on the array")
+	}
+}
+
+func TestMemoryAggregate(t *testing.T) {
+	c := memoryFixture(t)
+	tests := []struct {
+		name     string
+		pipeline []bson.M
+		want     []bson.M
+	}{
+		{
+			"$group null",
+			[]bson.M{{"$match": bson.M{"status": "ACTIVE"}}, {"$group": bson.M{"_id": nil, "n": bson.M{"$sum": 1}, "score": bson.M{"$sum": "$score"}}}},
+			[]bson.M{{"_id": nil, "n": int32(2), "score": int32(4)}},
+		},
+		{
+			"$group by field & $sort",
+			[]bson.M{{"$group": bson.M{"_id": "$status", "n": bson.M{"$sum": 1}}}, {"$sort": bson.D{{Key: "n", Value: -1}, {Key: "_id", Value: 1}}}},
+			[]bson.M{{"_id": "ACTIVE", "n": int32(2)}, {"_id": "PENDING", "n": int32(1)}, {"_id": "UNSUBSCRIBED", "n": int32(1)}},
+		},
+		{
+			"$min $max $avg",
+			[]bson.M{{"$group": bson.M{"_id": nil, "min": bson.M{"$min": "$score"}, "max": bson.M{"$max": "$score"}, "avg": bson.M{"$avg": "$score"}}}},
+			[]bson.M{{"_id": nil, "min": int32(1), "max": int32(7), "avg": 4.0}},
+		},
+		{
+			"$sum of missing fields",
+			[]bson.M{{"$group": bson.M{"_id": nil, "opens": bson.M{"$sum": "$stats.opens"}}}},
+			[]bson.M{{"_id": nil, "opens": int32(0)}},
+		},
+		{
+			"no match",
+			[]bson.M{{"$match": bson.M{"status": "BOUNCED"}}, {"$group": bson.M{"_id": nil, "n": bson.M{"$sum": 1}}}},
+			[]bson.M{},
+		},
+		{
+			"$sort $skip $limit",
+			[]bson.M{{"$sort": bson.D{{Key: "score", Value: -1}}}, {"$skip": 1}, {"$limit": 2}, {"$group": bson.M{"_id": "$_id"}}},
+			[]bson.M{{"_id": "c"}, {"_id": "a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []bson.M{}
+			if err := c.Aggregate(context.Background(), tt.pipeline, &got); err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if err := c.Aggregate(context.Background(), []bson.M{{"$lookup": bson.M{}}}, &[]bson.M{}); err == nil {
+		t.Errorf("expected an error for unsupported stages")
+	}
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// dispatch command events to all registered monitors
+func commandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, m := range commandMonitors {
+				if m.Started != nil {
+					m.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, m := range commandMonitors {
+				if m.Succeeded != nil {
+					m.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, m := range commandMonitors {
+				if m.Failed != nil {
+					m.Failed(ctx, e)
+				}
+			}
+		},
+	}
+}
+
+// dispatch connection pool events to all registered monitors
+func poolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			for _, m := range poolMonitors {
+				if m.Event != nil {
+					m.Event(e)
+				}
+			}
+		},
+	}
+}
@@ -8,9 +8,11 @@ import (
 )
 
 type Builder struct {
-	query    graphql.Fields
-	mutation graphql.Fields
-	builder  *TypesBuilder
+	query       graphql.Fields
+	mutation    graphql.Fields
+	builder     *TypesBuilder
+	middlewares []Middleware
+	extensions  []graphql.Extension
 }
 
 func New() *Builder {
@@ -133,13 +135,44 @@ func (g *Builder) MongoQuery(o interface{}) *QueryParams {
 
 // ---
 
+// add extension notified about the parsing, validation & execution of operations
+func (g *Builder) Extension(ext graphql.Extension) {
+	g.extensions = append(g.extensions, ext)
+}
+
+// ---
+
 func (g *Builder) Build() (graphql.Schema, error) {
+	// add node & nodes queries
+	if len(g.builder.nodes) > 0 {
+		if err := g.builder.validateNodes(); err != nil {
+			return graphql.Schema{}, err
+		}
+
+		if g.query == nil {
+			g.query = graphql.Fields{}
+		}
+
+		for k, v := range g.builder.nodeFields() {
+			if _, ok := g.query[k]; ok {
+				panic("duplicate query method: " + k)
+			}
+
+			g.query[k] = v
+		}
+	}
+
+	if err := g.applyScopes(); err != nil {
+		return graphql.Schema{}, err
+	}
+
+	g.applyMiddlewares()
 
 	schemaConfig := graphql.SchemaConfig{
 		// Subscription *Object
 		// Directives   []*Directive
-		// Extensions   []Extension
-		Types: g.builder.GetTypes(),
+		Extensions: g.extensions,
+		Types:      g.builder.GetTypes(),
 	}
 
 	if g.query != nil {
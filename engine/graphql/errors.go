@@ -0,0 +1,35 @@
+package graphql
+
+// Structured graphql errors, exposing their code within the error extensions
+// -------------------------------------------------------------------------------------
+
+const (
+	ErrInternal    = "INTERNAL"
+	ErrRateLimited = "RATE_LIMITED"
+	ErrForbidden   = "FORBIDDEN"
+
+	ErrIdempotencyKeyReused     = "IDEMPOTENCY_KEY_REUSED"
+	ErrIdempotencyKeyInProgress = "IDEMPOTENCY_KEY_IN_PROGRESS"
+)
+
+type Error struct {
+	Code    string
+	Message string
+}
+
+func NewError(code string, message string) Error {
+	return Error{
+		Code:    code,
+		Message: message,
+	}
+}
+
+func (e Error) Error() string {
+	return e.Message
+}
+
+func (e Error) Extensions() map[string]interface{} {
+	return map[string]interface{}{
+		"code": e.Code,
+	}
+}
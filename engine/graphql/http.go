@@ -0,0 +1,388 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/graphql-go/graphql/language/visitor"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"neodeliver.com/engine/config"
+	"neodeliver.com/engine/idempotency"
+	"neodeliver.com/engine/logger"
+	"neodeliver.com/engine/rbac"
+	"neodeliver.com/engine/server"
+	"neodeliver.com/engine/tracing"
+)
+
+// GraphQL over HTTP (https://graphql.github.io/graphql-over-http/draft/)
+// queries are accepted as GET & POST requests, mutations only as POST requests
+// -------------------------------------------------------------------------------------
+
+const (
+	mediaTypeGraphqlResponse = "application/graphql-response+json"
+	mediaTypeJSON            = "application/json"
+)
+
+type Request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+	Extensions    map[string]interface{} `json:"extensions"`
+}
+
+func Route(schema graphql.Schema) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		server.SecurityHeaders(w)
+		if server.CORS(w, r) {
+			return
+		}
+
+		// redirect browsers to the playground
+		if c := config.Get().Playground; c.Enabled && r.Method == http.MethodGet && r.URL.Query().Get("query") == "" && acceptsHTML(r) {
+			http.Redirect(w, r, c.Path, http.StatusFound)
+			return
+		}
+
+		mediaType := negotiate(r.Header.Get("Accept"))
+		w.Header().Add("Vary", "Accept")
+		if mediaType == "" {
+			writeRequestError(w, mediaTypeJSON, http.StatusNotAcceptable, "unsupported Accept header, expected "+mediaTypeGraphqlResponse+" or "+mediaTypeJSON)
+			return
+		}
+
+		payload, status, err := readRequest(r)
+		if status == http.StatusMethodNotAllowed {
+			w.Header().Set("Allow", "GET, POST, OPTIONS")
+		}
+
+		if err != nil {
+			writeRequestError(w, mediaType, status, err.Error())
+			return
+		}
+
+		// mutations have side effects, which are not allowed through GET requests
+		doc := parseDocument(payload.Query)
+		if r.Method == http.MethodGet {
+			if op := operationType(doc, payload.OperationName); op != "" && op != ast.OperationTypeQuery {
+				w.Header().Set("Allow", http.MethodPost)
+				writeRequestError(w, mediaType, http.StatusMethodNotAllowed, "only queries can be sent using GET requests")
+				return
+			}
+		}
+
+		if !config.Get().GraphQL.Introspection && usesIntrospection(doc) {
+			writeRequestError(w, mediaType, validationStatus(mediaType), "introspection is disabled")
+			return
+		}
+
+		// continue the trace of the caller (W3C trace context)
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Tracer.Start(ctx, "graphql.request", trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("graphql.operation.name", payload.OperationName),
+		))
+
+		defer span.End()
+
+		// request scoped logger & sentry hub
+		scope := logger.NewScope(r)
+		scope.SetOperation(payload.OperationName)
+		ctx = logger.NewContext(ctx, scope)
+		w.Header().Set("X-Request-ID", scope.RequestID)
+
+		ctx = context.WithValue(ctx, "rbac", func() (rbac.RBAC, error) {
+			res, err := rbac.Load(r)
+			if err == nil {
+				scope.SetUser(res.UserID, res.OrganizationID)
+			}
+
+			return res, err
+		})
+
+		ctx = context.WithValue(ctx, "client_ip", server.ClientIP(r))
+		ctx = context.WithValue(ctx, headersKey{}, &responseHeaders{header: w.Header()})
+
+		// replay the response of retried mutations
+		var idem *idempotency.Request
+		if key := r.Header.Get(idempotencyHeader); key != "" && operationType(doc, payload.OperationName) == ast.OperationTypeMutation {
+			req, record, status, err := beginIdempotent(ctx, key, payload)
+			if err != nil {
+				writeError(w, mediaType, status, err)
+				return
+			} else if record != nil {
+				w.Header().Set("Idempotent-Replayed", "true")
+				writeBody(w, mediaType, record.Status, record.Response)
+				return
+			}
+
+			idem = req
+		}
+
+		result := graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  payload.Query,
+			VariableValues: payload.Variables,
+			OperationName:  payload.OperationName,
+			Context:        ctx,
+		})
+
+		if len(result.Errors) > 0 {
+			span.SetAttributes(attribute.Int("graphql.errors", len(result.Errors)))
+			span.SetStatus(codes.Error, result.Errors[0].Message)
+		}
+
+		// requests failing before execution (parse, validation or variables errors) are client errors
+		var body []byte
+		status = http.StatusOK
+		if !isRequestError(result) {
+			body, _ = json.Marshal(result)
+		} else {
+			status = validationStatus(mediaType)
+			body, _ = json.Marshal(map[string]interface{}{"errors": result.Errors})
+		}
+
+		if idem != nil {
+			completeIdempotent(ctx, idem, result, status, body)
+		}
+
+		writeBody(w, mediaType, status, body)
+	}
+}
+
+// ---
+
+type headersKey struct{}
+
+type responseHeaders struct {
+	mu     sync.Mutex
+	header http.Header
+}
+
+// update the http response headers from resolvers, ignored outside of http requests
+func ResponseHeaders(ctx context.Context, fn func(h http.Header)) {
+	if h, ok := ctx.Value(headersKey{}).(*responseHeaders); ok {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		fn(h.header)
+	}
+}
+
+func readRequest(r *http.Request) (Request, int, error) {
+	payload := Request{}
+
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		payload.Query = q.Get("query")
+		payload.OperationName = q.Get("operationName")
+
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &payload.Variables); err != nil {
+				return payload, http.StatusBadRequest, errors.New("variables must be a json encoded object")
+			}
+		}
+
+		if v := q.Get("extensions"); v != "" {
+			if err := json.Unmarshal([]byte(v), &payload.Extensions); err != nil {
+				return payload, http.StatusBadRequest, errors.New("extensions must be a json encoded object")
+			}
+		}
+	case http.MethodPost:
+		if t, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); t != mediaTypeJSON {
+			return payload, http.StatusUnsupportedMediaType, errors.New("unsupported Content-Type, expected " + mediaTypeJSON)
+		}
+
+		var tooLarge *http.MaxBytesError
+		if err := json.NewDecoder(r.Body).Decode(&payload); errors.As(err, &tooLarge) {
+			return payload, http.StatusRequestEntityTooLarge, errors.New("request body too large")
+		} else if err == io.EOF {
+			return payload, http.StatusBadRequest, errors.New("empty request body")
+		} else if err != nil {
+			return payload, http.StatusBadRequest, errors.New("invalid json body: " + err.Error())
+		}
+	default:
+		return payload, http.StatusMethodNotAllowed, errors.New("only GET & POST requests are supported")
+	}
+
+	if payload.Query == "" {
+		return payload, http.StatusBadRequest, errors.New("no query provided")
+	}
+
+	return payload, 0, nil
+}
+
+// parse the query document, syntax errors are reported by the execution
+func parseDocument(query string) *ast.Document {
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(query)}),
+	})
+
+	if err != nil {
+		return nil
+	}
+
+	return doc
+}
+
+// type of the executed operation, empty when the document is invalid
+func operationType(doc *ast.Document, operationName string) string {
+	if doc == nil {
+		return ""
+	}
+
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+
+		if operationName == "" || (op.Name != nil && op.Name.Value == operationName) {
+			return op.Operation
+		}
+	}
+
+	return ""
+}
+
+// whether the document queries the schema (__schema or __type fields), __typename is allowed
+func usesIntrospection(doc *ast.Document) bool {
+	if doc == nil {
+		return false
+	}
+
+	found := false
+	visitor.Visit(doc, &visitor.VisitorOptions{
+		Enter: func(p visitor.VisitFuncParams) (string, interface{}) {
+			if f, ok := p.Node.(*ast.Field); ok && f.Name != nil && (f.Name.Value == "__schema" || f.Name.Value == "__type") {
+				found = true
+				return visitor.ActionBreak, nil
+			}
+
+			return visitor.ActionNoChange, nil
+		},
+	}, nil)
+
+	return found
+}
+
+// legacy application/json clients expect validation errors with a 200 status
+func validationStatus(mediaType string) int {
+	if mediaType == mediaTypeGraphqlResponse {
+		return http.StatusBadRequest
+	}
+
+	return http.StatusOK
+}
+
+// errors raised before execution have no path
+func isRequestError(result *graphql.Result) bool {
+	if result.Data != nil || len(result.Errors) == 0 {
+		return false
+	}
+
+	for _, err := range result.Errors {
+		if len(err.Path) > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// select the response media type from the Accept header, empty when none is supported
+// requests without Accept header are answered using application/json for legacy clients
+func negotiate(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return mediaTypeJSON
+	}
+
+	type accepted struct {
+		mediaType string
+		q         float64
+	}
+
+	list := []accepted{}
+	for _, part := range strings.Split(accept, ",") {
+		t, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		if q > 0 {
+			list = append(list, accepted{t, q})
+		}
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].q > list[j].q
+	})
+
+	for _, a := range list {
+		switch a.mediaType {
+		case mediaTypeGraphqlResponse, "application/*", "*/*":
+			return mediaTypeGraphqlResponse
+		case mediaTypeJSON:
+			return mediaTypeJSON
+		}
+	}
+
+	return ""
+}
+
+func acceptsHTML(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if t, _, _ := mime.ParseMediaType(strings.TrimSpace(part)); t == "text/html" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// request errors have no data entry
+func writeRequestError(w http.ResponseWriter, mediaType string, status int, message string) {
+	writeError(w, mediaType, status, errors.New(message))
+}
+
+// write a request error, exposing the code of structured errors
+func writeError(w http.ResponseWriter, mediaType string, status int, err error) {
+	e := map[string]interface{}{"message": err.Error()}
+	if ext, ok := err.(interface{ Extensions() map[string]interface{} }); ok {
+		e["extensions"] = ext.Extensions()
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"errors": []interface{}{e},
+	})
+
+	writeBody(w, mediaType, status, body)
+}
+
+func writeBody(w http.ResponseWriter, mediaType string, status int, body []byte) {
+	w.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(body)
+}
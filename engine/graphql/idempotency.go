@@ -0,0 +1,81 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"neodeliver.com/engine/idempotency"
+	"neodeliver.com/engine/logger"
+	"neodeliver.com/engine/rbac"
+)
+
+// Idempotency-Key header support of mutations
+// retried mutations using the same key replay the first response instead of being executed again
+// -------------------------------------------------------------------------------------
+
+const (
+	idempotencyHeader         = "Idempotency-Key"
+	maxIdempotencyKeyLength   = 255
+	idempotencyStorageTimeout = 5 * time.Second
+)
+
+// lock the idempotency key, returns the stored record when the request has to be replayed
+func beginIdempotent(ctx context.Context, key string, payload Request) (*idempotency.Request, *idempotency.Record, int, error) {
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, nil, http.StatusBadRequest, errors.New("idempotency key too long")
+	}
+
+	r, err := rbac.FromContext(ctx)
+	if err != nil {
+		return nil, nil, http.StatusUnauthorized, err
+	}
+
+	variables, _ := json.Marshal(payload.Variables)
+	fingerprint := idempotency.Fingerprint(payload.Query, payload.OperationName, string(variables))
+
+	req, record, err := idempotency.Begin(ctx, r.OrganizationID, payload.OperationName, key, fingerprint)
+	switch {
+	case errors.Is(err, idempotency.ErrKeyReused):
+		return nil, nil, http.StatusUnprocessableEntity, NewError(ErrIdempotencyKeyReused, err.Error())
+	case errors.Is(err, idempotency.ErrInProgress):
+		return nil, nil, http.StatusConflict, NewError(ErrIdempotencyKeyInProgress, err.Error())
+	case err != nil:
+		logger.Report(ctx, err, "Could not verify idempotency key")
+		return nil, nil, http.StatusInternalServerError, NewError(ErrInternal, "internal error")
+	}
+
+	return req, record, 0, nil
+}
+
+// store the response, unless the request failed because of a transient error
+// stored even when the client is gone, keeping the logger & trace of the request
+func completeIdempotent(ctx context.Context, req *idempotency.Request, result *graphql.Result, status int, body []byte) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), idempotencyStorageTimeout)
+	defer cancel()
+
+	var err error
+	if isTransient(result) {
+		err = req.Release(ctx)
+	} else {
+		err = req.Complete(ctx, status, body)
+	}
+
+	if err != nil {
+		logger.Report(ctx, err, "Could not store idempotent response")
+	}
+}
+
+func isTransient(result *graphql.Result) bool {
+	for _, err := range result.Errors {
+		switch err.Extensions["code"] {
+		case ErrInternal, ErrRateLimited:
+			return true
+		}
+	}
+
+	return false
+}
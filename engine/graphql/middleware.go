@@ -0,0 +1,127 @@
+package graphql
+
+import (
+	"runtime/debug"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/graphql-go/graphql"
+	"neodeliver.com/engine/logger"
+)
+
+// Resolver middlewares wrap field resolvers (logging, timing, auth, caching, error translation...)
+// -------------------------------------------------------------------------------------
+
+type Middleware func(next graphql.FieldResolveFn) graphql.FieldResolveFn
+
+// add middlewares to all resolved fields (root queries, mutations & computed fields)
+// global middlewares are applied when building the schema and wrap field middlewares
+func (g *Builder) Use(mw ...Middleware) {
+	g.middlewares = append(g.middlewares, mw...)
+}
+
+// add middlewares to a single query
+func (g *Builder) UseQuery(name string, mw ...Middleware) {
+	field, ok := g.query[name]
+	if !ok {
+		panic("unknown query method: " + name)
+	}
+
+	wrapField(field, mw)
+}
+
+// add middlewares to a single mutation
+func (g *Builder) UseMutation(name string, mw ...Middleware) {
+	field, ok := g.mutation[name]
+	if !ok {
+		panic("unknown mutation method: " + name)
+	}
+
+	wrapField(field, mw)
+}
+
+// add middlewares to the query, last added middlewares are executed first
+func (q *QueryParams) Use(mw ...Middleware) *QueryParams {
+	wrapField(q.field, mw)
+	return q
+}
+
+// ---
+
+func wrapField(field *graphql.Field, mw []Middleware) {
+	resolve := field.Resolve
+	if resolve == nil {
+		resolve = graphql.DefaultResolveFn
+	}
+
+	field.Resolve = Chain(mw...)(resolve)
+}
+
+// combine middlewares, the first middleware being the outermost one
+func Chain(mw ...Middleware) Middleware {
+	return func(next graphql.FieldResolveFn) graphql.FieldResolveFn {
+		for i := len(mw) - 1; i >= 0; i-- {
+			next = mw[i](next)
+		}
+
+		return next
+	}
+}
+
+// apply global middlewares on all fields having a resolver
+func (g *Builder) applyMiddlewares() {
+	mw := append([]Middleware{recoverer}, g.middlewares...)
+
+	fields := []*graphql.Field{}
+	for _, f := range g.query {
+		fields = append(fields, f)
+	}
+
+	for _, f := range g.mutation {
+		fields = append(fields, f)
+	}
+
+	fields = append(fields, g.builder.resolvers...)
+	for _, f := range fields {
+		wrapField(f, mw)
+	}
+}
+
+// ---
+
+// recover from resolver panics, the error is returned for the field without interrupting the request
+func recoverer(next graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (res interface{}, err error) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+
+			stack := string(debug.Stack())
+			field := p.Info.FieldName
+			if p.Info.ParentType != nil {
+				field = p.Info.ParentType.Name() + "." + field
+			}
+
+			logger.FromContext(p.Context).Error("Recovered GraphQL panic", "field", field, "panic", r, "stack", stack)
+
+			hub := sentry.GetHubFromContext(p.Context)
+			if hub == nil {
+				hub = sentry.CurrentHub().Clone()
+			}
+
+			hub.WithScope(func(scope *sentry.Scope) {
+				scope.SetTag("graphql.field", field)
+				scope.SetExtra("graphql.path", p.Info.Path.AsArray())
+				scope.SetExtra("stack", stack)
+				hub.RecoverWithContext(p.Context, r)
+			})
+
+			hub.Flush(time.Second)
+			res, err = nil, NewError(ErrInternal, "internal error")
+		}()
+
+		return next(p)
+	}
+}
@@ -1,11 +1,11 @@
 package graphql
 
 import (
+	"errors"
 	"reflect"
 
 	"github.com/graphql-go/graphql"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"neodeliver.com/engine/db"
 	"neodeliver.com/engine/rbac"
 )
@@ -24,8 +24,14 @@ func (q *QueryParams) resolveOne(t reflect.Type) graphql.FieldResolveFn {
 	getDefault, hasDefault := t.MethodByName("Default")
 
 	return func(p graphql.ResolveParams) (interface{}, error) {
-		client := db.Client()
-		coll := client.Collection(q.collection)
+		// reject ids of other object types
+		if id, ok := p.Args["id"].(string); ok {
+			if err := q.build.validateID(t, id); err != nil {
+				return nil, err
+			}
+		}
+
+		coll := db.Coll(q.collection)
 
 		// add where clause
 		var filter interface{} = bson.D{}
@@ -38,9 +44,9 @@ func (q *QueryParams) resolveOne(t reflect.Type) graphql.FieldResolveFn {
 		}
 
 		// find doc
-		res := coll.FindOne(p.Context, filter)
-		if err := res.Err(); err != nil {
-			if err.Error() == "mongo: no documents in result" {
+		result := reflect.New(t).Interface()
+		if err := coll.FindOne(p.Context, filter, result); err != nil {
+			if errors.Is(err, db.ErrNoDocuments) {
 				if hasDefault {
 					r, _ := rbac.FromContext(p.Context)
 
@@ -59,16 +65,13 @@ func (q *QueryParams) resolveOne(t reflect.Type) graphql.FieldResolveFn {
 			return nil, err
 		}
 
-		result := reflect.New(t).Interface()
-		err := res.Decode(result)
-		return resultToGraphqlMap(result), err
+		return resultToGraphqlMap(result), nil
 	}
 }
 
 func (q *QueryParams) resolveMany(t reflect.Type) graphql.FieldResolveFn {
 	return func(p graphql.ResolveParams) (interface{}, error) {
-		client := db.Client()
-		coll := client.Collection(q.collection)
+		coll := db.Coll(q.collection)
 
 		// add where clause
 		var filter interface{} = bson.D{}
@@ -80,28 +83,18 @@ func (q *QueryParams) resolveMany(t reflect.Type) graphql.FieldResolveFn {
 			}
 		}
 
-		first := int64(0)
-		skip := int64(0)
+		opts := db.FindOptions{}
 		if v, ok := p.Args["first"].(int); ok {
-			first = int64(v)
+			opts.Limit = int64(v)
 		}
 
 		if v, ok := p.Args["offset"].(int); ok {
-			skip = int64(v)
+			opts.Skip = int64(v)
 		}
 
 		// find doc
-		cur, err := coll.Find(p.Context, filter, &options.FindOptions{
-			Limit: &first,
-			Skip:  &skip,
-		})
-
-		if err != nil {
-			return nil, err
-		}
-
 		result := reflect.New(t).Interface()
-		err = cur.All(p.Context, result)
+		err := coll.Find(p.Context, filter, result, opts)
 
 		return resultToGraphqlMap(result), err
 	}
@@ -141,17 +134,16 @@ func (q *QueryParams) mergedArgs() graphql.FieldConfigArgument {
 
 // execute function after resolve
 func (q *QueryParams) After(fn func(graphql.ResolveParams, interface{}) (interface{}, error)) *QueryParams {
-	resolve := q.field.Resolve
-	q.field.Resolve = func(p graphql.ResolveParams) (interface{}, error) {
-		result, err := resolve(p)
-		if err != nil {
-			return nil, err
-		}
-
-		return fn(p, result)
-	}
+	return q.Use(func(next graphql.FieldResolveFn) graphql.FieldResolveFn {
+		return func(p graphql.ResolveParams) (interface{}, error) {
+			result, err := next(p)
+			if err != nil {
+				return nil, err
+			}
 
-	return q
+			return fn(p, result)
+		}
+	})
 }
 
 // ---
@@ -0,0 +1,222 @@
+package graphql
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	pluralize "github.com/gertd/go-pluralize"
+	"github.com/graphql-go/graphql"
+	"neodeliver.com/engine/db"
+	"neodeliver.com/engine/rbac"
+)
+
+// Global object identification
+// Object ids are prefixed by their type (eg: ctc_...), which allows to fetch any object by id
+// -------------------------------------------------------------------------------------
+
+type NodeParams struct {
+	prefix     string
+	kind       reflect.Type
+	collection string
+	where      func(r rbac.RBAC, id string) map[string]interface{}
+}
+
+// register object type as node, identified by the given id prefix
+func (g *Builder) Node(prefix string, o interface{}) *NodeParams {
+	t := reflect.TypeOf(o)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	for _, n := range g.builder.nodes {
+		if n.prefix == prefix {
+			panic("duplicate node prefix: " + prefix)
+		} else if n.kind == t {
+			panic("duplicate node type: " + t.Name())
+		}
+	}
+
+	n := &NodeParams{
+		prefix:     prefix,
+		kind:       t,
+		collection: pluralize.NewClient().Plural(ToSnakeCase(t.Name())),
+		where: func(r rbac.RBAC, id string) map[string]interface{} {
+			return map[string]interface{}{
+				"_id":             id,
+				"organization_id": r.OrganizationID,
+			}
+		},
+	}
+
+	// keep longest prefixes first, as prefixes may overlap (eg: ctc_ & ctc_tag_)
+	g.builder.nodes = append(g.builder.nodes, n)
+	sort.SliceStable(g.builder.nodes, func(i, j int) bool {
+		return len(g.builder.nodes[i].prefix) > len(g.builder.nodes[j].prefix)
+	})
+
+	return n
+}
+
+// overwrite the filter used to fetch the node from its collection
+func (n *NodeParams) Where(fn func(r rbac.RBAC, id string) map[string]interface{}) *NodeParams {
+	n.where = fn
+	return n
+}
+
+// ---
+
+// find the node type matching the prefix of the given id
+func (t *TypesBuilder) nodeByID(id string) *NodeParams {
+	for _, n := range t.nodes {
+		if strings.HasPrefix(id, n.prefix) {
+			return n
+		}
+	}
+
+	return nil
+}
+
+func (t *TypesBuilder) nodeByType(kind reflect.Type) *NodeParams {
+	for _, n := range t.nodes {
+		if n.kind == kind {
+			return n
+		}
+	}
+
+	return nil
+}
+
+// verify the id prefix matches the expected object type
+func (t *TypesBuilder) validateID(kind reflect.Type, id string) error {
+	n := t.nodeByType(kind)
+	if n == nil {
+		return nil
+	} else if t.nodeByID(id) != n {
+		return fmt.Errorf("invalid id %q: expected %s prefix", id, n.prefix)
+	}
+
+	return nil
+}
+
+func (t *TypesBuilder) nodeInterface() *graphql.Interface {
+	if t.node != nil {
+		return t.node
+	}
+
+	t.node = graphql.NewInterface(graphql.InterfaceConfig{
+		Name:        "Node",
+		Description: "An object with a globally unique id",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.ID),
+			},
+		},
+		ResolveType: func(p graphql.ResolveTypeParams) *graphql.Object {
+			id := ""
+			if mp, ok := p.Value.(map[string]interface{}); ok {
+				id, _ = mp["id"].(string)
+			}
+
+			if n := t.nodeByID(id); n != nil {
+				obj, _ := t.InternalType(n.kind.Name(), n.kind, false).(*graphql.Object)
+				return obj
+			}
+
+			return nil
+		},
+	})
+
+	return t.node
+}
+
+// fetch node from its collection
+func (t *TypesBuilder) resolveNode(p graphql.ResolveParams, id string) (interface{}, error) {
+	n := t.nodeByID(id)
+	if n == nil {
+		return nil, fmt.Errorf("invalid id %q: unknown prefix", id)
+	}
+
+	r, err := rbac.FromContext(p.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	result := reflect.New(n.kind).Interface()
+	if err := db.Coll(n.collection).FindOne(p.Context, n.where(r, id), result); err != nil {
+		if errors.Is(err, db.ErrNoDocuments) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return resultToGraphqlMap(result), nil
+}
+
+// node types are identified by their id field
+func (t *TypesBuilder) validateNodes() error {
+	for _, n := range t.nodes {
+		hasID := false
+		FieldsFactory(n.kind, func(name string, field reflect.StructField) {
+			hasID = hasID || name == "id"
+		})
+
+		if !hasID {
+			return fmt.Errorf("node type %s has no id field", n.kind.Name())
+		}
+	}
+
+	return nil
+}
+
+// node & nodes root queries
+func (t *TypesBuilder) nodeFields() graphql.Fields {
+	// make sure all node types are part of the schema
+	for _, n := range t.nodes {
+		t.Type(n.kind, false, false)
+	}
+
+	return graphql.Fields{
+		"node": &graphql.Field{
+			Type:        t.nodeInterface(),
+			Description: "Fetch any object by its id",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.ID),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id, _ := p.Args["id"].(string)
+				return t.resolveNode(p, id)
+			},
+		},
+		"nodes": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.NewList(t.nodeInterface())),
+			Description: "Fetch a list of objects by their ids",
+			Args: graphql.FieldConfigArgument{
+				"ids": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.ID))),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				ids, _ := p.Args["ids"].([]interface{})
+				res := []interface{}{}
+
+				for _, v := range ids {
+					id, _ := v.(string)
+					node, err := t.resolveNode(p, id)
+					if err != nil {
+						return nil, err
+					}
+
+					res = append(res, node)
+				}
+
+				return res, nil
+			},
+		},
+	}
+}
@@ -0,0 +1,18 @@
+package graphql
+
+import (
+	"testing"
+)
+
+type nodeWithoutID struct {
+	Name string `json:"name"`
+}
+
+func TestNodeWithoutID(t *testing.T) {
+	g := New()
+	g.Node("nid_", nodeWithoutID{})
+
+	if _, err := g.Build(); err == nil || err.Error() != "node type nodeWithoutID has no id field" {
+		t.Errorf("unexpected build error: %v", err)
+	}
+}
@@ -1,111 +1,61 @@
 package graphql
 
 import (
-	"context"
+	"embed"
 	"encoding/json"
-	"io"
+	"html/template"
+	"io/fs"
 	"net/http"
+	"strings"
 
-	"github.com/graphql-go/graphql"
-	"neodeliver.com/engine/rbac"
+	"neodeliver.com/engine/config"
+	"neodeliver.com/engine/server"
 )
 
-func Route(schema graphql.Schema) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		payload := struct {
-			Query         string                 `json:"query"`
-			Variables     map[string]interface{} `json:"variables"`
-			OperationName string                 `json:"operationName"`
-		}{}
+// Self hosted GraphiQL playground, served from its own path
+// the pinned GraphiQL build is embedded in the binary (see playground/fetch.sh)
+// -------------------------------------------------------------------------------------
 
-		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && err != io.EOF {
-			http.Error(w, err.Error(), 400)
-		} else if payload.Query == "" && r.Method == "GET" {
-			bs := ServePlayground()
-			w.Header().Set("Content-Type", "text/html")
-			w.Write(bs)
-			return
-		} else if payload.Query == "" {
-			http.Error(w, "no query provided", 400)
-			return
-		}
+//go:embed playground
+var embeddedPlayground embed.FS
 
-		ctx := r.Context()
-		ctx = context.WithValue(ctx, "rbac", func() (rbac.RBAC, error) {
-			return rbac.Load(r)
-		})
+// files of the playground, replaced by tests as the GraphiQL build is not committed
+var playgroundFS fs.FS = embeddedPlayground
 
-		ctx = context.WithValue(ctx, "client_ip", "::1") // TODO set client ip
+const playgroundCSP = "default-src 'self'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; font-src 'self' data:; connect-src 'self'; frame-ancestors 'none'"
 
-		result := graphql.Do(graphql.Params{
-			Schema:         schema,
-			RequestString:  payload.Query,
-			VariableValues: payload.Variables,
-			OperationName:  payload.OperationName,
-			Context:        ctx,
-		})
+// playground handler, endpoint being the path of the graphql route
+func Playground(endpoint string, c config.Playground) http.Handler {
+	path := strings.TrimSuffix(c.Path, "/")
+	assets, _ := fs.Sub(playgroundFS, "playground")
+	files := http.StripPrefix(path, http.FileServer(http.FS(assets)))
+	page := template.Must(template.ParseFS(assets, "index.html"))
 
-		json.NewEncoder(w).Encode(result)
-	}
-}
+	settings, _ := json.Marshal(map[string]interface{}{
+		"endpoint":       endpoint,
+		"defaultHeaders": c.DefaultHeaders,
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.SecurityHeaders(w)
+		w.Header().Set("Content-Security-Policy", playgroundCSP)
 
-func ServePlayground() []byte {
-	return []byte(`<!DOCTYPE html>
-	<html>
-	
-	<head>
-	  <meta charset=utf-8/>
-	  <meta name="viewport" content="user-scalable=no, initial-scale=1.0, minimum-scale=1.0, maximum-scale=1.0, minimal-ui">
-	  <title>GraphQL Playground</title>
-	  <link rel="stylesheet" href="//cdn.jsdelivr.net/npm/graphql-playground-react/build/static/css/index.css" />
-	  <link rel="shortcut icon" href="//cdn.jsdelivr.net/npm/graphql-playground-react/build/favicon.png" />
-	  <script src="//cdn.jsdelivr.net/npm/graphql-playground-react/build/static/js/middleware.js"></script>
-	</head>
-	
-	<body>
-	  <div id="root">
-		<style>
-		  body {
-			background-color: rgb(23, 42, 58);
-			font-family: Open Sans, sans-serif;
-			height: 90vh;
-		  }
-	
-		  #root {
-			height: 100%;
-			width: 100%;
-			display: flex;
-			align-items: center;
-			justify-content: center;
-		  }
-	
-		  .loading {
-			font-size: 32px;
-			font-weight: 200;
-			color: rgba(255, 255, 255, .6);
-			margin-left: 20px;
-		  }
-	
-		  img {
-			width: 78px;
-			height: 78px;
-		  }
-	
-		  .title {
-			font-weight: 400;
-		  }
-		</style>
-		<img src='//cdn.jsdelivr.net/npm/graphql-playground-react/build/logo.png' alt=''>
-		<div class="loading"> Loading
-		  <span class="title">GraphQL Playground</span>
-		</div>
-	  </div>
-	  <script>window.addEventListener('load', function (event) {
-		  GraphQLPlayground.init(document.getElementById('root'), {
-			// options as 'endpoint' belong here
-		  })
-		})</script>
-	</body>
-	
-	</html>`)
+		if r.URL.Path != path && r.URL.Path != path+"/" {
+			files.ServeHTTP(w, r)
+			return
+		}
+
+		if _, err := fs.Stat(assets, "vendor/graphiql.min.js"); err != nil {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("GraphiQL assets are not vendored, run engine/graphql/playground/fetch.sh and rebuild the server"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		page.Execute(w, map[string]interface{}{
+			"Path":   path,
+			"Config": string(settings),
+		})
+	})
 }
@@ -0,0 +1,39 @@
+#!/bin/sh
+# Download the pinned GraphiQL build embedded in the api binary
+# files are verified against the committed vendor/SHA256SUMS, a version bump requires reviewing & updating them first
+# usage: ./engine/graphql/playground/fetch.sh
+set -eu
+
+REACT_VERSION=18.2.0
+GRAPHIQL_VERSION=3.0.9
+EXPLORER_VERSION=1.0.2
+
+cd "$(dirname "$0")/vendor"
+
+if [ ! -s SHA256SUMS ]; then
+  echo "vendor/SHA256SUMS is missing, pin the checksums of the reviewed files first" >&2
+  exit 1
+fi
+
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+fetch() {
+  curl -fsSL "https://unpkg.com/$1" -o "$tmp/$2"
+}
+
+fetch "react@$REACT_VERSION/umd/react.production.min.js" react.production.min.js
+fetch "react-dom@$REACT_VERSION/umd/react-dom.production.min.js" react-dom.production.min.js
+fetch "graphiql@$GRAPHIQL_VERSION/graphiql.min.js" graphiql.min.js
+fetch "graphiql@$GRAPHIQL_VERSION/graphiql.min.css" graphiql.min.css
+fetch "@graphiql/plugin-explorer@$EXPLORER_VERSION/dist/index.umd.js" plugin-explorer.umd.js
+fetch "@graphiql/plugin-explorer@$EXPLORER_VERSION/dist/style.css" plugin-explorer.css
+
+# every downloaded file must match its pinned checksum, nothing is replaced otherwise
+(cd "$tmp" && sha256sum --strict -c "$OLDPWD/SHA256SUMS")
+if [ "$(wc -l < SHA256SUMS)" -ne "$(ls "$tmp" | wc -l)" ]; then
+  echo "vendor/SHA256SUMS does not pin every downloaded file" >&2
+  exit 1
+fi
+
+mv "$tmp"/* .
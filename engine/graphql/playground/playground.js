@@ -0,0 +1,21 @@
+// GraphiQL setup, the configuration is rendered by the server within the root element
+(function () {
+  var root = document.getElementById('graphiql');
+  var config = JSON.parse(root.getAttribute('data-config'));
+
+  var fetcher = GraphiQL.createFetcher({
+    url: config.endpoint,
+    headers: { Accept: 'application/graphql-response+json' },
+  });
+
+  // tabs, queries & headers are saved in the local storage of the browser
+  ReactDOM.createRoot(root).render(
+    React.createElement(GraphiQL, {
+      fetcher: fetcher,
+      defaultHeaders: config.defaultHeaders || undefined,
+      shouldPersistHeaders: true,
+      defaultEditorToolsVisibility: 'headers',
+      plugins: [GraphiQLPluginExplorer.explorerPlugin()],
+    }),
+  );
+})();
@@ -0,0 +1,54 @@
+package graphql
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"neodeliver.com/engine/config"
+)
+
+func TestPlayground(t *testing.T) {
+	index, err := embeddedPlayground.ReadFile("playground/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := config.Playground{Path: "/graphiql", DefaultHeaders: `{"Authorization": "Bearer "}`}
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		Playground("/", c).ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	// without the vendored GraphiQL build, the page explains how to fetch it
+	playgroundFS = fstest.MapFS{"playground/index.html": {Data: index}}
+	defer func() { playgroundFS = embeddedPlayground }()
+
+	if w := get("/graphiql"); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "fetch.sh") {
+		t.Errorf("got %d %s without assets, want 503", w.Code, w.Body.String())
+	}
+
+	// stub assets of the pinned build
+	playgroundFS = fstest.MapFS{
+		"playground/index.html":             {Data: index},
+		"playground/vendor/graphiql.min.js": {Data: []byte("window.GraphiQL = {}")},
+	}
+
+	for _, path := range []string{"/graphiql", "/graphiql/"} {
+		w := get(path)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `src="/graphiql/vendor/graphiql.min.js"`) || !strings.Contains(w.Body.String(), "Authorization") {
+			t.Errorf("%s: got %d %s, want the playground page", path, w.Code, w.Body.String())
+		} else if csp := w.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "default-src 'self'") {
+			t.Errorf("%s: content security policy %q, want self hosted assets only", path, csp)
+		}
+	}
+
+	if w := get("/graphiql/vendor/graphiql.min.js"); w.Code != http.StatusOK || w.Body.String() != "window.GraphiQL = {}" {
+		t.Errorf("got %d %s, want the asset", w.Code, w.Body.String())
+	} else if w := get("/graphiql/vendor/missing.js"); w.Code != http.StatusNotFound {
+		t.Errorf("got %d for a missing asset, want 404", w.Code)
+	}
+}
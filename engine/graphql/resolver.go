@@ -6,11 +6,8 @@ import (
 	"fmt"
 	"reflect"
 	"runtime"
-	"runtime/debug"
 	"strings"
-	"time"
 
-	"github.com/getsentry/sentry-go"
 	validate "github.com/go-playground/validator/v10"
 	"github.com/graphql-go/graphql"
 	"neodeliver.com/engine/rbac"
@@ -19,6 +16,9 @@ import (
 // Building graphql queries
 // -------------------------------------------------------------------------------------
 
+// map key holding the original object of converted results
+const sourceKey = "__source"
+
 // Parse graphql method response
 type argumentsCreatorFn = func(graphql.ResolveParams, []reflect.Value) ([]reflect.Value, error)
 
@@ -128,8 +128,8 @@ func (t *TypesBuilder) graphqlArguments(in reflect.Type, superCreate argumentsCr
 	return args, createArguments
 }
 
-// Transform graphql query method
-func (t *TypesBuilder) toGraphqlResolver(v reflect.Value, locked func(graphql.ResolveParams) bool) (graphql.FieldResolveFn, graphql.FieldConfigArgument) {
+// Parse the arguments of a resolver function, skipping the first `offset` inputs (eg: method receivers)
+func (t *TypesBuilder) resolverArguments(fn reflect.Type, offset int) (graphql.FieldConfigArgument, argumentsCreatorFn) {
 	args := graphql.FieldConfigArgument{}
 	var createArguments argumentsCreatorFn
 
@@ -150,8 +150,8 @@ func (t *TypesBuilder) toGraphqlResolver(v reflect.Value, locked func(graphql.Re
 	}
 
 	// Parse query argumentss
-	for i := 0; i < v.Type().NumIn(); i++ {
-		in := v.Type().In(i)
+	for i := offset; i < fn.NumIn(); i++ {
+		in := fn.In(i)
 		if n := in.Name(); n == "ResolveParams" {
 			mixin(func(p graphql.ResolveParams, v []reflect.Value) ([]reflect.Value, error) {
 				return append(v, reflect.ValueOf(p)), nil
@@ -175,6 +175,13 @@ func (t *TypesBuilder) toGraphqlResolver(v reflect.Value, locked func(graphql.Re
 		createArguments = func(p graphql.ResolveParams, v []reflect.Value) ([]reflect.Value, error) { return v, nil }
 	}
 
+	return args, createArguments
+}
+
+// Transform graphql query method
+func (t *TypesBuilder) toGraphqlResolver(v reflect.Value, locked func(graphql.ResolveParams) bool) (graphql.FieldResolveFn, graphql.FieldConfigArgument) {
+	args, createArguments := t.resolverArguments(v.Type(), 0)
+
 	return func(p graphql.ResolveParams) (interface{}, error) {
 		if locked != nil && !locked(p) {
 			return nil, errors.New("action not permitted")
@@ -184,16 +191,6 @@ func (t *TypesBuilder) toGraphqlResolver(v reflect.Value, locked func(graphql.Re
 		// log15.Info(strings.Join(colls, ", "))
 		// log15.Info(sql.ToQuery("users", colls, ""))
 
-		defer func() {
-			if r := recover(); r != nil {
-				fmt.Println("Recovered GraphQL error", r)
-				fmt.Println(string(debug.Stack()))
-				sentry.CurrentHub().Recover(r)
-				sentry.Flush(time.Second)
-				panic(r)
-			}
-		}()
-
 		args, err := createArguments(p, []reflect.Value{})
 		if err != nil {
 			return nil, err
@@ -204,6 +201,57 @@ func (t *TypesBuilder) toGraphqlResolver(v reflect.Value, locked func(graphql.Re
 	}, args
 }
 
+// Transform a method of an output type into a computed graphql field
+// the method is expected to be taken from the pointer method set of the type
+func (t *TypesBuilder) methodField(m reflect.Method) *graphql.Field {
+	args, createArguments := t.resolverArguments(m.Type, 1)
+	receiver := m.Type.In(0)
+
+	field := &graphql.Field{
+		Args: args,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			source := p.Source
+			if mp, ok := source.(map[string]interface{}); ok {
+				source = mp[sourceKey]
+			}
+
+			self := reflect.ValueOf(source)
+			if self.IsValid() && self.Kind() != reflect.Ptr {
+				ptr := reflect.New(self.Type())
+				ptr.Elem().Set(self)
+				self = ptr
+			}
+
+			if !self.IsValid() || self.Type() != receiver {
+				return nil, fmt.Errorf("could not resolve %s: unexpected source object", p.Info.FieldName)
+			}
+
+			args, err := createArguments(p, []reflect.Value{self})
+			if err != nil {
+				return nil, err
+			}
+
+			res, err := resultify(m.Func.Call(args))
+			if err != nil {
+				return nil, err
+			}
+
+			return resultToGraphqlMap(res), nil
+		},
+	}
+
+	// Add output type
+	if m.Type.NumOut() > 0 {
+		out := m.Type.Out(0)
+		if out.Name() != "error" {
+			field.Type = t.Type(out, false, false)
+		}
+	}
+
+	t.resolvers = append(t.resolvers, field)
+	return field
+}
+
 func (t *TypesBuilder) Method(fn interface{}, locked func(graphql.ResolveParams) bool) (string, *graphql.Field) {
 	v := reflect.ValueOf(fn)
 	name := runtime.FuncForPC(v.Pointer()).Name()
@@ -270,6 +318,10 @@ func resultToGraphqlMap(i interface{}) interface{} {
 
 	t := reflect.TypeOf(i)
 	if t.Kind() == reflect.Pointer || t.Kind() == reflect.UnsafePointer {
+		if reflect.ValueOf(i).IsNil() {
+			return nil
+		}
+
 		t = t.Elem()
 		i = reflect.ValueOf(i).Elem().Interface()
 	}
@@ -290,6 +342,12 @@ func resultToGraphqlMap(i interface{}) interface{} {
 	if t.Kind() == reflect.Struct && t.Name() != "Time" {
 		res := map[string]interface{}{}
 		resultToGraphqlMapToMap(i, res)
+
+		// keep original object to resolve computed fields
+		if _, ok := i.(interface{ GraphqlMethods() []string }); ok {
+			res[sourceKey] = i
+		}
+
 		return res
 	}
 
@@ -319,17 +377,26 @@ func resultToGraphqlMapToMap(i interface{}, res map[string]interface{}) {
 
 		f := val.Field(i)
 		if field.Anonymous {
-			if !f.IsZero() {
+			if f.Kind() == reflect.Pointer && !f.IsNil() {
+				f = f.Elem()
+			}
+
+			if f.Kind() == reflect.Struct {
 				resultToGraphqlMapToMap(f.Interface(), res)
 			}
 
 			continue
 		}
 
-		if f.IsZero() {
-			res[name] = nil
-		} else {
-			res[name] = resultToGraphqlMap(f.Interface())
+		// zero values of non pointer fields are valid values of their non null fields
+		switch f.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Map:
+			if f.IsNil() {
+				res[name] = nil
+				continue
+			}
 		}
+
+		res[name] = resultToGraphqlMap(f.Interface())
 	}
 }
@@ -0,0 +1,39 @@
+package graphql
+
+import (
+	"reflect"
+	"testing"
+)
+
+type ResultStats struct {
+	Processed int `json:"processed"`
+}
+
+type resultJob struct {
+	ResultStats
+	Done   bool     `json:"done"`
+	Error  *string  `json:"error"`
+	Errors []string `json:"errors"`
+	Params map[string]string
+	Parent *resultJob `json:"parent"`
+}
+
+func TestResultToGraphqlMap(t *testing.T) {
+	got := resultToGraphqlMap(resultJob{})
+	want := map[string]interface{}{
+		"processed": 0,
+		"done":      false,
+		"error":     nil,
+		"errors":    []interface{}{},
+		"params":    nil,
+		"parent":    nil,
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+
+	if got := resultToGraphqlMap((*resultJob)(nil)); got != nil {
+		t.Errorf("nil pointer converted to %#v", got)
+	}
+}
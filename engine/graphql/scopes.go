@@ -0,0 +1,50 @@
+package graphql
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/graphql-go/graphql"
+	"neodeliver.com/engine/rbac"
+)
+
+// Api keys only execute the root queries & mutations granted by their scopes (rbac.RegisterScope)
+// -------------------------------------------------------------------------------------
+
+// reject the operation when the api key of the request has no scope granting it
+func authorize(operation string) Middleware {
+	return func(next graphql.FieldResolveFn) graphql.FieldResolveFn {
+		return func(p graphql.ResolveParams) (interface{}, error) {
+			// unauthenticated requests are rejected by the resolvers requiring authentication
+			r, err := rbac.FromContext(p.Context)
+			if err == nil && !r.Allowed(operation) {
+				return nil, NewError(ErrForbidden, fmt.Sprintf("The API key has no scope granting %s", operation))
+			}
+
+			return next(p)
+		}
+	}
+}
+
+// authorize the root fields & verify the scopes only grant existing operations
+func (g *Builder) applyScopes() error {
+	unknown := []string{}
+	for op := range rbac.ScopedOperations() {
+		if g.query[op] == nil && g.mutation[op] == nil {
+			unknown = append(unknown, op)
+		}
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("scopes grant unknown operations: %v", unknown)
+	}
+
+	for _, fields := range []graphql.Fields{g.query, g.mutation} {
+		for name, f := range fields {
+			wrapField(f, []Middleware{authorize(name)})
+		}
+	}
+
+	return nil
+}
@@ -16,7 +16,10 @@ func ToSnakeCase(str string) string {
 // -------------------------------------------------------------------------------------
 
 type TypesBuilder struct {
-	types map[string]graphql.Type
+	types     map[string]graphql.Type
+	nodes     []*NodeParams
+	node      *graphql.Interface
+	resolvers []*graphql.Field // computed fields
 }
 
 func NewTypesBuilder() *TypesBuilder {
@@ -56,6 +59,24 @@ func FieldsFactory(kind reflect.Type, fieldHandler func(string, reflect.StructFi
 	}
 }
 
+// list methods exposed as graphql fields by implementing GraphqlMethods()
+func MethodsFactory(kind reflect.Type, methodHandler func(string, reflect.Method)) {
+	obj, ok := reflect.New(kind).Interface().(interface{ GraphqlMethods() []string })
+	if !ok {
+		return
+	}
+
+	ptr := reflect.PointerTo(kind)
+	for _, n := range obj.GraphqlMethods() {
+		method, ok := ptr.MethodByName(n)
+		if !ok {
+			panic("unknown graphql method on " + kind.Name() + ": " + n)
+		}
+
+		methodHandler(ToSnakeCase(n), method)
+	}
+}
+
 func (t *TypesBuilder) InternalType(name string, kind reflect.Type, inputType bool) graphql.Type {
 	key := "out_" + name
 	if inputType {
@@ -70,29 +91,65 @@ func (t *TypesBuilder) InternalType(name string, kind reflect.Type, inputType bo
 		kind = kind.Elem()
 	}
 
+	// fields are built lazily, types may reference themselves (eg: nested groups of rules)
 	if inputType {
-		fields := graphql.InputObjectConfigFieldMap{}
-		FieldsFactory(kind, func(name string, field reflect.StructField) {
-			fields[name] = &graphql.InputObjectFieldConfig{
-				Type: t.Type(field.Type, inputType, false),
-			}
-		})
-
+		var fields graphql.InputObjectConfigFieldMap
 		t.types[key] = graphql.NewInputObject(graphql.InputObjectConfig{
-			Name:   "In" + name,
-			Fields: fields,
+			Name: "In" + name,
+			Fields: graphql.InputObjectConfigFieldMapThunk(func() graphql.InputObjectConfigFieldMap {
+				if fields != nil {
+					return fields
+				}
+
+				fields = graphql.InputObjectConfigFieldMap{}
+				FieldsFactory(kind, func(name string, field reflect.StructField) {
+					fields[name] = &graphql.InputObjectFieldConfig{
+						Type: t.Type(field.Type, inputType, false),
+					}
+				})
+
+				return fields
+			}),
 		})
 	} else {
-		fields := graphql.Fields{}
-		FieldsFactory(kind, func(name string, field reflect.StructField) {
-			fields[name] = &graphql.Field{
-				Type: t.Type(field.Type, inputType, false),
-			}
-		})
-
+		var fields graphql.Fields
 		t.types[key] = graphql.NewObject(graphql.ObjectConfig{
-			Name:   name,
-			Fields: fields,
+			Name: name,
+			Fields: graphql.FieldsThunk(func() graphql.Fields {
+				if fields != nil {
+					return fields
+				}
+
+				fields = graphql.Fields{}
+				FieldsFactory(kind, func(name string, field reflect.StructField) {
+					fields[name] = &graphql.Field{
+						Type: t.Type(field.Type, inputType, false),
+					}
+				})
+
+				// add computed fields resolved by methods
+				MethodsFactory(kind, func(name string, method reflect.Method) {
+					if _, ok := fields[name]; ok {
+						panic("duplicate field on " + kind.Name() + ": " + name)
+					}
+
+					fields[name] = t.methodField(method)
+				})
+
+				// node types are resolved once all types have been registered
+				if id, ok := fields["id"]; ok && t.nodeByType(kind) != nil {
+					id.Type = graphql.NewNonNull(graphql.ID)
+				}
+
+				return fields
+			}),
+			Interfaces: graphql.InterfacesThunk(func() []*graphql.Interface {
+				if t.nodeByType(kind) != nil {
+					return []*graphql.Interface{t.nodeInterface()}
+				}
+
+				return nil
+			}),
 		})
 	}
 
@@ -0,0 +1,157 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/segmentio/ksuid"
+	"neodeliver.com/engine/config"
+	"neodeliver.com/engine/db"
+	"neodeliver.com/engine/logger"
+)
+
+// Idempotency keys, allowing clients to safely retry mutations
+// the first response for a key, organization & operation is stored and replayed on retries
+// -------------------------------------------------------------------------------------
+
+var (
+	ErrInProgress = errors.New("a request using the same idempotency key is in progress")
+	ErrKeyReused  = errors.New("the idempotency key was already used with a different payload")
+	ErrLeaseLost  = errors.New("the idempotency key lock was taken over by another request")
+)
+
+// interval between checks while waiting for a concurrent request
+const pollInterval = 100 * time.Millisecond
+
+type Record struct {
+	ID             string    `bson:"_id"`
+	OrganizationID string    `bson:"organization_id"`
+	Key            string    `bson:"key"`
+	Operation      string    `bson:"operation"`
+	Fingerprint    string    `bson:"fingerprint"`
+	Lease          string    `bson:"lease"` // token of the request holding the lock
+	Completed      bool      `bson:"completed"`
+	Status         int       `bson:"status"`
+	Response       []byte    `bson:"response"`
+	LockedUntil    time.Time `bson:"locked_until"`
+	ExpiresAt      time.Time `bson:"expires_at"`
+}
+
+type Store interface {
+	// lock the record, returns the existing record when its key is locked or completed
+	Lock(ctx context.Context, r Record) (*Record, error)
+	// store the response of the record & release the lock, unless the lease was taken over (ErrLeaseLost)
+	Complete(ctx context.Context, id, lease string, status int, response []byte) error
+	// drop the record, allowing a retry to execute the request again, unless the lease was taken over (ErrLeaseLost)
+	Release(ctx context.Context, id, lease string) error
+}
+
+var (
+	store Store
+	mu    sync.Mutex
+)
+
+// overwrite the record storage, used by tests
+func SetStore(s Store) {
+	mu.Lock()
+	store = s
+	mu.Unlock()
+}
+
+func currentStore() Store {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if store == nil {
+		if config.Get().Idempotency.Store == "memory" || db.InMemory() {
+			store = NewMemoryStore()
+		} else {
+			s := NewMongoStore()
+			if err := s.CreateIndexes(context.Background()); err != nil {
+				// expired records are ignored without the index, but never removed
+				logger.Report(context.Background(), err, "Could not create the idempotency keys index")
+			}
+
+			store = s
+		}
+	}
+
+	return store
+}
+
+// ---
+
+type Request struct {
+	id    string
+	lease string
+}
+
+// start a request using an idempotency key
+// the stored record is returned when the request was already completed, otherwise the caller has to Complete or Release the request
+func Begin(ctx context.Context, organizationID, operation, key, fingerprint string) (*Request, *Record, error) {
+	c := config.Get().Idempotency
+	s := currentStore()
+
+	now := time.Now()
+	r := Record{
+		ID:             ID(organizationID, operation, key),
+		OrganizationID: organizationID,
+		Key:            key,
+		Operation:      operation,
+		Fingerprint:    fingerprint,
+		Lease:          ksuid.New().String(),
+		LockedUntil:    now.Add(c.LockTimeout),
+		ExpiresAt:      now.Add(c.TTL),
+	}
+
+	// wait for concurrent requests using the same key to complete
+	deadline := now.Add(c.WaitTimeout)
+	for {
+		existing, err := s.Lock(ctx, r)
+		if err != nil {
+			return nil, nil, err
+		} else if existing == nil {
+			return &Request{id: r.ID, lease: r.Lease}, nil, nil
+		} else if existing.Fingerprint != fingerprint {
+			return nil, nil, ErrKeyReused
+		} else if existing.Completed {
+			return nil, existing, nil
+		} else if time.Now().After(deadline) {
+			return nil, nil, ErrInProgress
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func (r *Request) Complete(ctx context.Context, status int, response []byte) error {
+	return currentStore().Complete(ctx, r.id, r.lease, status, response)
+}
+
+func (r *Request) Release(ctx context.Context) error {
+	return currentStore().Release(ctx, r.id, r.lease)
+}
+
+// record id, keys are scoped by organization & operation
+func ID(organizationID, operation, key string) string {
+	return Fingerprint(organizationID, operation, key)
+}
+
+// hash of the given values
+func Fingerprint(values ...string) string {
+	h := sha256.New()
+	for _, v := range values {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
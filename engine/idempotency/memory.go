@@ -0,0 +1,67 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// in memory records, keys are only shared by requests of the same instance
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]*Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[string]*Record{}}
+}
+
+func (s *MemoryStore) Lock(ctx context.Context, r Record) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, existing := range s.records {
+		if existing.ExpiresAt.Before(now) {
+			delete(s.records, id)
+		}
+	}
+
+	// take over locks of interrupted requests
+	existing, ok := s.records[r.ID]
+	if !ok || (!existing.Completed && existing.Fingerprint == r.Fingerprint && existing.LockedUntil.Before(now)) {
+		s.records[r.ID] = &r
+		return nil, nil
+	}
+
+	res := *existing
+	return &res, nil
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, id, lease string, status int, response []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[id]
+	if !ok || r.Lease != lease || r.Completed {
+		return ErrLeaseLost
+	}
+
+	r.Completed = true
+	r.Status = status
+	r.Response = response
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, id, lease string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[id]
+	if !ok || r.Lease != lease || r.Completed {
+		return ErrLeaseLost
+	}
+
+	delete(s.records, id)
+	return nil
+}
@@ -0,0 +1,115 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"neodeliver.com/engine/config"
+)
+
+func setup(t *testing.T, lockTimeout time.Duration) {
+	c, err := config.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Idempotency.LockTimeout = lockTimeout
+	c.Idempotency.WaitTimeout = 0
+	config.Set(c)
+	SetStore(NewMemoryStore())
+
+	t.Cleanup(func() {
+		config.Set(nil)
+		SetStore(nil)
+	})
+}
+
+func TestReplay(t *testing.T) {
+	setup(t, time.Minute)
+	ctx := context.Background()
+
+	req, record, err := Begin(ctx, "org_1", "add_contact", "key", "a")
+	if err != nil || req == nil || record != nil {
+		t.Fatalf("first request: %v %v %v", req, record, err)
+	}
+
+	// concurrent requests wait for the first one, then give up
+	if _, _, err := Begin(ctx, "org_1", "add_contact", "key", "a"); !errors.Is(err, ErrInProgress) {
+		t.Errorf("concurrent request: got %v, want ErrInProgress", err)
+	}
+
+	if err := req.Complete(ctx, 200, []byte("ok")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, record, err := Begin(ctx, "org_1", "add_contact", "key", "a"); err != nil || record == nil || string(record.Response) != "ok" {
+		t.Errorf("retry: got %v %v, want the stored response", record, err)
+	}
+
+	if _, _, err := Begin(ctx, "org_1", "add_contact", "key", "b"); !errors.Is(err, ErrKeyReused) {
+		t.Errorf("other payload: got %v, want ErrKeyReused", err)
+	}
+
+	// keys are scoped by organization & operation
+	if req, _, err := Begin(ctx, "org_2", "add_contact", "key", "b"); err != nil || req == nil {
+		t.Errorf("other organization: got %v %v, want a new request", req, err)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	setup(t, time.Minute)
+	ctx := context.Background()
+
+	req, _, _ := Begin(ctx, "org_1", "add_contact", "key", "a")
+	if err := req.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// released keys are executed again
+	if req, record, err := Begin(ctx, "org_1", "add_contact", "key", "a"); err != nil || req == nil || record != nil {
+		t.Errorf("retry: got %v %v %v, want a new request", req, record, err)
+	}
+}
+
+func TestLeaseLost(t *testing.T) {
+	// locks of interrupted requests are taken over immediately
+	setup(t, -time.Second)
+	ctx := context.Background()
+
+	first, _, _ := Begin(ctx, "org_1", "add_contact", "key", "a")
+	second, _, err := Begin(ctx, "org_1", "add_contact", "key", "a")
+	if err != nil || second == nil {
+		t.Fatalf("takeover: got %v %v", second, err)
+	}
+
+	// the interrupted request can't overwrite nor drop the record of the request taking over
+	if err := first.Complete(ctx, 500, []byte("first")); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("complete: got %v, want ErrLeaseLost", err)
+	}
+
+	if err := first.Release(ctx); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("release: got %v, want ErrLeaseLost", err)
+	}
+
+	if err := second.Complete(ctx, 200, []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, record, _ := Begin(ctx, "org_1", "add_contact", "key", "a"); record == nil || string(record.Response) != "second" {
+		t.Errorf("replay: got %v, want the response of the second request", record)
+	}
+}
+
+func TestExpiredRecords(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+
+	r := Record{ID: "1", Fingerprint: "a", Lease: "l1", Completed: true, ExpiresAt: time.Now().Add(-time.Second)}
+	s.records[r.ID] = &r
+
+	if existing, err := s.Lock(ctx, Record{ID: "1", Fingerprint: "b", Lease: "l2", ExpiresAt: time.Now().Add(time.Hour)}); err != nil || existing != nil {
+		t.Errorf("got %v %v, want the expired record replaced", existing, err)
+	}
+}
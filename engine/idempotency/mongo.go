@@ -0,0 +1,113 @@
+package idempotency
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"neodeliver.com/engine/db"
+)
+
+// records stored in the idempotency_keys collection, removed by a ttl index once expired
+type MongoStore struct {
+	collection string
+}
+
+func NewMongoStore() *MongoStore {
+	return &MongoStore{collection: "idempotency_keys"}
+}
+
+// remove expired records, created at startup
+func (s *MongoStore) CreateIndexes(ctx context.Context) error {
+	c, err := s.coll(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+
+	return err
+}
+
+func (s *MongoStore) coll(ctx context.Context) (*mongo.Collection, error) {
+	d, err := db.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	return d.Collection(s.collection), nil
+}
+
+func (s *MongoStore) Lock(ctx context.Context, r Record) (*Record, error) {
+	c, err := s.coll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = c.InsertOne(ctx, r)
+	if err == nil {
+		return nil, nil
+	} else if !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+
+	// take over expired records, until the ttl index removes them (once a minute), & locks of interrupted requests
+	now := time.Now()
+	res, err := c.ReplaceOne(ctx, bson.M{"_id": r.ID, "$or": bson.A{
+		bson.M{"expires_at": bson.M{"$lte": now}},
+		bson.M{"completed": false, "fingerprint": r.Fingerprint, "locked_until": bson.M{"$lt": now}},
+	}}, r)
+
+	if err != nil {
+		return nil, err
+	} else if res.ModifiedCount == 1 {
+		return nil, nil
+	}
+
+	existing := &Record{}
+	err = c.FindOne(ctx, bson.M{"_id": r.ID, "expires_at": bson.M{"$gt": now}}).Decode(existing)
+	if err == mongo.ErrNoDocuments {
+		// expired in the meantime
+		return s.Lock(ctx, r)
+	}
+
+	return existing, err
+}
+
+func (s *MongoStore) Complete(ctx context.Context, id, lease string, status int, response []byte) error {
+	c, err := s.coll(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.UpdateOne(ctx, bson.M{"_id": id, "lease": lease, "completed": false}, bson.M{"$set": bson.M{
+		"completed": true,
+		"status":    status,
+		"response":  response,
+	}})
+
+	if err == nil && res.MatchedCount == 0 {
+		return ErrLeaseLost
+	}
+
+	return err
+}
+
+func (s *MongoStore) Release(ctx context.Context, id, lease string) error {
+	c, err := s.coll(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.DeleteOne(ctx, bson.M{"_id": id, "lease": lease, "completed": false})
+	if err == nil && res.DeletedCount == 0 {
+		return ErrLeaseLost
+	}
+
+	return err
+}
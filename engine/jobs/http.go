@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"neodeliver.com/engine/config"
+)
+
+// path of TriggerHandler, called by a scheduler on deployments without polling instances
+const TriggerPath = "/jobs/run"
+
+// execute the pending jobs on POST requests authenticated by the JOBS_TRIGGER_TOKEN bearer token (eg: from Cloud Scheduler)
+// the endpoint is not found when no token is configured
+func TriggerHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := config.Get().Jobs
+		if c.TriggerToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(c.TriggerToken)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		} else if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		n := RunPending(r.Context(), c.TriggerBudget)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"executed": n})
+	})
+}
@@ -0,0 +1,509 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/segmentio/ksuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"neodeliver.com/engine/config"
+	"neodeliver.com/engine/db"
+	"neodeliver.com/engine/logger"
+	"neodeliver.com/engine/rbac"
+)
+
+// Background jobs (imports, exports...) persisted in the jobs collection
+// jobs are executed by polling instances (or RunPending on serverless deployments) & resumed by any instance once their lease expires
+// -------------------------------------------------------------------------------------
+
+const collection = "jobs"
+
+const (
+	ScheduledPrefixID = "sch_"
+	MigrationPrefixID = "mig_"
+)
+
+type Status string
+
+const (
+	Pending   Status = "PENDING"
+	Running   Status = "RUNNING"
+	Completed Status = "COMPLETED"
+	Failed    Status = "FAILED"
+)
+
+// returned by Progress once the job was taken over by another instance, handlers should then stop
+var ErrLeaseLost = errors.New("job lease lost")
+
+type Job struct {
+	ID             string     `bson:"_id"`
+	OrganizationID string     `bson:"organization_id"`
+	Type           string     `bson:"type"`
+	Status         Status     `bson:"status"`
+	Params         bson.Raw   `bson:"params,omitempty"`
+	Processed      int64      `bson:"processed"`
+	Total          int64      `bson:"total"`
+	Result         bson.Raw   `bson:"result,omitempty"`
+	Error          string     `bson:"error,omitempty"`
+	Attempts       int        `bson:"attempts"`
+	Lease          string     `bson:"lease,omitempty"`
+	LockedUntil    time.Time  `bson:"locked_until"`
+	CreatedAt      time.Time  `bson:"created_at"`
+	StartedAt      *time.Time `bson:"started_at,omitempty"`
+	CompletedAt    *time.Time `bson:"completed_at,omitempty"`
+}
+
+// executes a job, resumed jobs are executed again from their last Progress
+type Handler func(ctx context.Context, j *Job) error
+
+var (
+	handlers   = map[string]Handler{}
+	schedules  = map[string]time.Duration{}
+	migrations = []string{}
+	mu         sync.Mutex
+	slots      chan struct{}
+	base       context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+	polling    bool
+	inline     bool
+)
+
+// register the handler of a job type, before jobs are enqueued or started
+func Register(kind string, h Handler) {
+	mu.Lock()
+	handlers[kind] = h
+	mu.Unlock()
+}
+
+// enqueue a job of the type every interval, once for all instances (jobs of schedules have no organization)
+func Schedule(kind string, interval time.Duration) {
+	mu.Lock()
+	schedules[kind] = interval
+	mu.Unlock()
+}
+
+// enqueue a job of the type once for all instances & deployments, eg: to backfill a field of existing documents
+// migrations have no organization, failed migrations are retried by the next instance starting
+func Migrate(kind string) {
+	mu.Lock()
+	migrations = append(migrations, kind)
+	mu.Unlock()
+}
+
+func init() {
+	base, cancel = context.WithCancel(context.Background())
+}
+
+func acquire() bool {
+	mu.Lock()
+	if slots == nil {
+		slots = make(chan struct{}, config.Get().Jobs.Concurrency)
+	}
+	mu.Unlock()
+
+	if base.Err() != nil {
+		return false
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func release() {
+	<-slots
+}
+
+// execute the enqueued jobs in the background of the instance without polling, used by tests
+func Inline(enabled bool) {
+	mu.Lock()
+	inline = enabled
+	mu.Unlock()
+}
+
+// persist a job, executed in the background when the instance polls (or executes jobs inline) & a slot is available
+// otherwise it's picked up by the next poll or RunPending
+func Enqueue(ctx context.Context, id, organizationID, kind string, params interface{}) (*Job, error) {
+	raw, err := bson.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Job{
+		ID:             id,
+		OrganizationID: organizationID,
+		Type:           kind,
+		Status:         Pending,
+		Params:         raw,
+		CreatedAt:      time.Now(),
+	}
+
+	if err := db.Coll(collection).InsertOne(ctx, j); err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	background := polling || inline
+	mu.Unlock()
+
+	if background && acquire() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer release()
+			if j := claim(bson.M{"_id": id}); j != nil {
+				run(j)
+			}
+		}()
+	}
+
+	return j, nil
+}
+
+// job of an organization, db.ErrNoDocuments when missing
+func Get(ctx context.Context, organizationID, id string) (*Job, error) {
+	j := &Job{}
+	err := db.Coll(collection).FindOne(ctx, bson.M{"_id": id, "organization_id": organizationID}, j)
+	if err != nil {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// jobs of an organization by type, most recent first
+func List(ctx context.Context, organizationID, kind string, opts db.FindOptions) ([]Job, error) {
+	opts.Sort = bson.D{{Key: "created_at", Value: -1}}
+
+	res := []Job{}
+	err := db.Coll(collection).Find(ctx, bson.M{"organization_id": organizationID, "type": kind}, &res, opts)
+	return res, err
+}
+
+// decode the job parameters
+func (j *Job) Decode(params interface{}) error {
+	return bson.Unmarshal(j.Params, params)
+}
+
+// decode the job result, left untouched when no result was stored
+func (j *Job) DecodeResult(result interface{}) error {
+	if len(j.Result) == 0 {
+		return nil
+	}
+
+	return bson.Unmarshal(j.Result, result)
+}
+
+// checkpoint the progress of the job, result (optional) being the partial result to resume from
+func (j *Job) Progress(ctx context.Context, processed, total int64, result interface{}) error {
+	set := bson.M{"processed": processed, "total": total}
+	if result != nil {
+		raw, err := bson.Marshal(result)
+		if err != nil {
+			return err
+		}
+
+		// stored as a document, bson.Raw values are only encoded as documents within structs
+		set["result"] = result
+		j.Result = raw
+	}
+
+	j.Processed, j.Total = processed, total
+	n, err := db.Coll(collection).UpdateMany(ctx, bson.M{"_id": j.ID, "lease": j.Lease}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	} else if n == 0 {
+		return ErrLeaseLost
+	}
+
+	return nil
+}
+
+// ---
+
+// start polling for pending jobs & jobs of stopped instances
+func Start(ctx context.Context) {
+	mu.Lock()
+	if polling {
+		mu.Unlock()
+		return
+	}
+
+	polling = true
+	mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(config.Get().Jobs.PollInterval)
+		defer ticker.Stop()
+
+		migrate(time.Now())
+
+		for {
+			schedule(time.Now())
+			for acquire() {
+				wg.Add(1)
+				j := claim(bson.M{})
+				if j == nil {
+					wg.Done()
+					release()
+					break
+				}
+
+				go func() {
+					defer wg.Done()
+					defer release()
+					run(j)
+				}()
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-base.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// enqueue the migrations & scheduled jobs, then execute the pending jobs until none is left or the budget is spent
+// used by serverless deployments whose instances are frozen between requests (eg: triggered by Cloud Scheduler)
+// jobs started within the budget are awaited, returns the number of executed jobs
+func RunPending(ctx context.Context, budget time.Duration) int {
+	deadline := time.Now().Add(budget)
+	migrate(time.Now())
+	schedule(time.Now())
+
+	var running sync.WaitGroup
+	n := 0
+	for ctx.Err() == nil && base.Err() == nil && time.Now().Before(deadline) {
+		if !acquire() {
+			// wait for a running job to complete
+			select {
+			case <-ctx.Done():
+			case <-time.After(100 * time.Millisecond):
+			}
+
+			continue
+		}
+
+		wg.Add(1)
+		running.Add(1)
+		j := claim(bson.M{})
+		if j == nil {
+			wg.Done()
+			running.Done()
+			release()
+			break
+		}
+
+		n++
+		go func() {
+			defer wg.Done()
+			defer running.Done()
+			defer release()
+			run(j)
+		}()
+	}
+
+	running.Wait()
+	return n
+}
+
+// stop polling & interrupt running jobs, releasing them to be resumed by other instances
+func Stop(ctx context.Context) error {
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// wait for the running jobs to complete, used by tests
+func Wait() {
+	wg.Wait()
+}
+
+// enqueue the scheduled jobs of the current period, ids being derived from the period so instances enqueue each job once
+func schedule(now time.Time) {
+	mu.Lock()
+	list := map[string]time.Duration{}
+	for kind, interval := range schedules {
+		list[kind] = interval
+	}
+	mu.Unlock()
+
+	for kind, interval := range list {
+		period := now.Truncate(interval)
+		err := db.Coll(collection).InsertOne(base, &Job{
+			ID:        fmt.Sprintf("%s%s_%d", ScheduledPrefixID, kind, period.Unix()),
+			Type:      kind,
+			Status:    Pending,
+			CreatedAt: now,
+		})
+
+		if err != nil && !mongo.IsDuplicateKeyError(err) && !errors.Is(err, context.Canceled) {
+			logger.Report(base, err, "Could not schedule job", "type", kind)
+		}
+	}
+}
+
+// enqueue the migrations not enqueued yet, their ids being derived from their type
+func migrate(now time.Time) {
+	mu.Lock()
+	list := append([]string{}, migrations...)
+	mu.Unlock()
+
+	for _, kind := range list {
+		id := MigrationPrefixID + kind
+		err := db.Coll(collection).InsertOne(base, &Job{
+			ID:        id,
+			Type:      kind,
+			Status:    Pending,
+			CreatedAt: now,
+		})
+
+		if mongo.IsDuplicateKeyError(err) {
+			_, err = db.Coll(collection).UpdateMany(base, bson.M{"_id": id, "status": Failed}, bson.M{
+				"$set":   bson.M{"status": Pending, "attempts": 0},
+				"$unset": bson.M{"error": ""},
+			})
+		}
+
+		if err != nil && !errors.Is(err, context.Canceled) {
+			logger.Report(base, err, "Could not enqueue migration", "type", kind)
+		}
+	}
+}
+
+// lock a pending job matching filter or a job whose lease expired, nil when none is available
+func claim(filter bson.M) *Job {
+	c := config.Get().Jobs
+	now := time.Now()
+
+	j := &Job{}
+	err := db.Coll(collection).FindOneAndUpdate(base, bson.M{"$and": []bson.M{filter, {"$or": []bson.M{
+		{"status": Pending},
+		{"status": Running, "locked_until": bson.M{"$lt": now}},
+	}}}}, bson.M{
+		"$set": bson.M{
+			"status":       Running,
+			"lease":        ksuid.New().String(),
+			"locked_until": now.Add(c.Lease),
+			"started_at":   now,
+		},
+		"$inc": bson.M{"attempts": 1},
+	}, false, j)
+
+	if errors.Is(err, db.ErrNoDocuments) || errors.Is(err, context.Canceled) {
+		return nil
+	} else if err != nil {
+		logger.Report(base, err, "Could not claim job")
+		return nil
+	}
+
+	return j
+}
+
+func run(j *Job) {
+	c := config.Get().Jobs
+	log := logger.Root().New("job", j.ID, "type", j.Type, "attempt", j.Attempts)
+
+	mu.Lock()
+	h, ok := handlers[j.Type]
+	mu.Unlock()
+
+	if !ok {
+		finish(j, errors.New("unknown job type "+j.Type))
+		return
+	} else if j.Attempts > c.MaxAttempts {
+		finish(j, errors.New("job interrupted too many times"))
+		return
+	}
+
+	ctx, stop := context.WithCancel(rbac.NewContext(base, rbac.RBAC{OrganizationID: j.OrganizationID}))
+	defer stop()
+
+	// extend the lease while the job is running, stopping the job when taken over
+	go func() {
+		ticker := time.NewTicker(c.Lease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n, err := db.Coll(collection).UpdateMany(ctx, bson.M{"_id": j.ID, "lease": j.Lease}, bson.M{"$set": bson.M{"locked_until": time.Now().Add(c.Lease)}})
+				if err == nil && n == 0 {
+					log.Warn("Job lease lost, stopping")
+					stop()
+					return
+				}
+			}
+		}
+	}()
+
+	log.Info("Running job")
+	err := execute(ctx, h, j)
+
+	if base.Err() != nil {
+		// interrupted by Stop, resumed by the next instance polling
+		log.Info("Job interrupted, releasing")
+		db.Coll(collection).UpdateMany(context.Background(), bson.M{"_id": j.ID, "lease": j.Lease}, bson.M{
+			"$set": bson.M{"status": Pending, "lease": "", "locked_until": time.Time{}},
+			"$inc": bson.M{"attempts": -1},
+		})
+
+		return
+	} else if errors.Is(err, ErrLeaseLost) || ctx.Err() != nil {
+		return
+	}
+
+	if err != nil {
+		log.Warn("Job failed", "err", err)
+	}
+
+	finish(j, err)
+}
+
+func execute(ctx context.Context, h Handler, j *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+			logger.Report(ctx, err, "Job panicked", "job", j.ID)
+		}
+	}()
+
+	return h(ctx, j)
+}
+
+func finish(j *Job, err error) {
+	set := bson.M{"status": Completed, "completed_at": time.Now(), "lease": ""}
+	if err != nil {
+		set["status"] = Failed
+		set["error"] = err.Error()
+	}
+
+	if _, err := db.Coll(collection).UpdateMany(context.Background(), bson.M{"_id": j.ID, "lease": j.Lease}, bson.M{"$set": set}); err != nil {
+		logger.Report(context.Background(), err, "Could not complete job", "job", j.ID)
+	}
+}
@@ -0,0 +1,129 @@
+package jobs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"neodeliver.com/engine/config"
+	"neodeliver.com/engine/db"
+)
+
+func setup(t *testing.T, token string) {
+	c, err := config.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Jobs.TriggerToken = token
+	config.Set(c)
+	db.SetDatabase(db.NewMemory())
+
+	t.Cleanup(func() {
+		Wait()
+		config.Set(nil)
+		db.SetDatabase(nil)
+	})
+}
+
+func TestRunPending(t *testing.T) {
+	setup(t, "")
+	ctx := context.Background()
+
+	var executed atomic.Int32
+	Register("tests.count", func(ctx context.Context, j *Job) error {
+		executed.Add(1)
+		return nil
+	})
+
+	// without polling nor inline execution, enqueued jobs are only persisted
+	for _, id := range []string{"job_1", "job_2", "job_3"} {
+		if _, err := Enqueue(ctx, id, "org_1", "tests.count", struct{}{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	Wait()
+	if j, err := Get(ctx, "org_1", "job_1"); err != nil || j.Status != Pending || executed.Load() != 0 {
+		t.Fatalf("job %+v (%v) executed %d times, want pending", j, err, executed.Load())
+	}
+
+	if n := RunPending(ctx, time.Minute); n != 3 || executed.Load() != 3 {
+		t.Errorf("executed %d jobs (%d handler calls), want 3", n, executed.Load())
+	}
+
+	for _, id := range []string{"job_1", "job_2", "job_3"} {
+		if j, err := Get(ctx, "org_1", id); err != nil || j.Status != Completed {
+			t.Errorf("job %s: %+v (%v), want completed", id, j, err)
+		}
+	}
+
+	// nothing left to run, no job is started once the budget is spent
+	if n := RunPending(ctx, time.Minute); n != 0 {
+		t.Errorf("executed %d jobs, want none", n)
+	}
+
+	Enqueue(ctx, "job_4", "org_1", "tests.count", struct{}{})
+	if n := RunPending(ctx, 0); n != 0 {
+		t.Errorf("executed %d jobs without budget, want none", n)
+	}
+}
+
+func TestInline(t *testing.T) {
+	setup(t, "")
+	Inline(true)
+	defer Inline(false)
+
+	Register("tests.inline", func(ctx context.Context, j *Job) error {
+		return nil
+	})
+
+	ctx := context.Background()
+	if _, err := Enqueue(ctx, "job_1", "org_1", "tests.inline", struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+
+	Wait()
+	if j, err := Get(ctx, "org_1", "job_1"); err != nil || j.Status != Completed {
+		t.Errorf("job %+v (%v), want completed", j, err)
+	}
+}
+
+func TestTriggerHandler(t *testing.T) {
+	trigger := func(method, token string) int {
+		r := httptest.NewRequest(method, TriggerPath, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		w := httptest.NewRecorder()
+		TriggerHandler().ServeHTTP(w, r)
+		return w.Code
+	}
+
+	setup(t, "")
+	if code := trigger(http.MethodPost, "secret"); code != http.StatusNotFound {
+		t.Errorf("got %d without token configured, want 404", code)
+	}
+
+	setup(t, "secret")
+	if code := trigger(http.MethodPost, ""); code != http.StatusUnauthorized {
+		t.Errorf("got %d without token, want 401", code)
+	} else if code := trigger(http.MethodPost, "other"); code != http.StatusUnauthorized {
+		t.Errorf("got %d with another token, want 401", code)
+	} else if code := trigger(http.MethodGet, "secret"); code != http.StatusMethodNotAllowed {
+		t.Errorf("got %d on GET, want 405", code)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, TriggerPath, nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	TriggerHandler().ServeHTTP(w, r)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"executed"`) {
+		t.Errorf("got %d %s, want the executed jobs", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,164 @@
+package logger
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/inconshreveable/log15"
+	"neodeliver.com/engine/config"
+)
+
+// Structured logging, scoped to the current request & reported to sentry
+// -------------------------------------------------------------------------------------
+
+const redacted = "[REDACTED]"
+
+// keys holding sensitive values, which are never written to logs or sent to sentry
+var sensitiveKey = regexp.MustCompile(`(?i)(pass(word)?|secret|token|authorization|cookie|api_?key|dsn)`)
+
+// Configure the root logger & sentry client
+// the sentry client is only enabled when a dsn is configured
+func Init(c config.Log) error {
+	format := log15.LogfmtFormat()
+	if strings.ToLower(c.Format) == "json" {
+		format = log15.JsonFormat()
+	}
+
+	level := log15.LvlInfo
+	if c.Level != "" {
+		var err error
+		if level, err = log15.LvlFromString(strings.ToLower(c.Level)); err != nil {
+			return err
+		}
+	}
+
+	handler := log15.StreamHandler(os.Stdout, format)
+	handler = log15.LvlFilterHandler(level, redactHandler(log15.LazyHandler(handler)))
+	log15.Root().SetHandler(handler)
+
+	if c.SentryDSN != "" {
+		return sentry.Init(sentry.ClientOptions{
+			Dsn:        c.SentryDSN,
+			BeforeSend: redactEvent,
+		})
+	}
+
+	return nil
+}
+
+// root logger, used outside of requests
+func Root() log15.Logger {
+	return log15.Root()
+}
+
+// ---
+
+type contextKey struct{}
+
+type scoped struct {
+	logger log15.Logger
+	scope  *Scope
+}
+
+// attach logger & scope to the context
+func NewContext(ctx context.Context, scope *Scope) context.Context {
+	logger := log15.New(
+		"request_id", scope.RequestID,
+		"operation", log15.Lazy{Fn: func() string { return scope.get().Operation }},
+		"user", log15.Lazy{Fn: func() string { return scope.get().UserID }},
+		"organization", log15.Lazy{Fn: func() string { return scope.get().OrganizationID }},
+	)
+
+	ctx = sentry.SetHubOnContext(ctx, scope.hub)
+	return context.WithValue(ctx, contextKey{}, scoped{
+		logger: logger,
+		scope:  scope,
+	})
+}
+
+// logger of the current request, falls back on the root logger
+func FromContext(ctx context.Context) log15.Logger {
+	if s, ok := ctx.Value(contextKey{}).(scoped); ok {
+		return s.logger
+	}
+
+	return log15.Root()
+}
+
+// scope of the current request, nil when not within a request
+func ScopeFromContext(ctx context.Context) *Scope {
+	if s, ok := ctx.Value(contextKey{}).(scoped); ok {
+		return s.scope
+	}
+
+	return nil
+}
+
+// log error & report it to sentry with the request scope
+func Report(ctx context.Context, err error, msg string, kv ...interface{}) {
+	FromContext(ctx).Error(msg, append(kv, "err", err)...)
+
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sentry.CurrentHub()
+	}
+
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetExtra("message", msg)
+		for i := 0; i+1 < len(kv); i += 2 {
+			if k, ok := kv[i].(string); ok {
+				scope.SetExtra(k, redact(k, kv[i+1]))
+			}
+		}
+
+		hub.CaptureException(err)
+	})
+}
+
+// wait for sentry events to be sent
+func Flush() {
+	sentry.Flush(2 * time.Second)
+}
+
+// ---
+
+func redact(key string, value interface{}) interface{} {
+	if sensitiveKey.MatchString(key) {
+		return redacted
+	}
+
+	return value
+}
+
+func redactHandler(next log15.Handler) log15.Handler {
+	return log15.FuncHandler(func(r *log15.Record) error {
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			if k, ok := r.Ctx[i].(string); ok {
+				r.Ctx[i+1] = redact(k, r.Ctx[i+1])
+			}
+		}
+
+		return next.Log(r)
+	})
+}
+
+func redactEvent(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+	for k, v := range event.Extra {
+		event.Extra[k] = redact(k, v)
+	}
+
+	if event.Request != nil {
+		for k := range event.Request.Headers {
+			event.Request.Headers[k] = redact(k, event.Request.Headers[k]).(string)
+		}
+
+		event.Request.Cookies = ""
+		event.Request.Data = ""
+	}
+
+	return event
+}
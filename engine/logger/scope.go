@@ -0,0 +1,70 @@
+package logger
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/segmentio/ksuid"
+)
+
+// Request scope shared by logs & sentry events
+type Scope struct {
+	RequestID      string
+	Operation      string
+	UserID         string
+	OrganizationID string
+
+	mu  sync.RWMutex
+	hub *sentry.Hub
+}
+
+// create the scope of an incoming http request, with a newly generated request id
+func NewScope(r *http.Request) *Scope {
+	s := &Scope{
+		RequestID: "req_" + ksuid.New().String(),
+		hub:       sentry.CurrentHub().Clone(),
+	}
+
+	s.hub.ConfigureScope(func(scope *sentry.Scope) {
+		scope.SetRequest(r)
+		scope.SetTag("request_id", s.RequestID)
+	})
+
+	return s
+}
+
+func (s *Scope) SetOperation(name string) {
+	s.mu.Lock()
+	s.Operation = name
+	s.mu.Unlock()
+
+	s.hub.ConfigureScope(func(scope *sentry.Scope) {
+		scope.SetTag("operation", name)
+	})
+}
+
+func (s *Scope) SetUser(userID string, organizationID string) {
+	s.mu.Lock()
+	s.UserID = userID
+	s.OrganizationID = organizationID
+	s.mu.Unlock()
+
+	s.hub.ConfigureScope(func(scope *sentry.Scope) {
+		scope.SetUser(sentry.User{ID: userID})
+		scope.SetTag("organization", organizationID)
+	})
+}
+
+// copy of the scope values, safe for concurrent use
+func (s *Scope) get() Scope {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return Scope{
+		RequestID:      s.RequestID,
+		Operation:      s.Operation,
+		UserID:         s.UserID,
+		OrganizationID: s.OrganizationID,
+	}
+}
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var operationDuration = register(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "graphql_operation_duration_seconds",
+	Help:      "Duration of graphql operations execution by operation type & name.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"type", "name"}))
+
+var resolverDuration = register(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "graphql_resolver_duration_seconds",
+	Help:      "Duration of graphql field resolvers by parent type & field.",
+	Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+}, []string{"parent", "field"}))
+
+var errorsTotal = register(prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "graphql_errors_total",
+	Help:      "Number of graphql errors returned by error code.",
+}, []string{"code"}))
+
+// operation names are provided by clients
+var operationNames = newBoundedLabel(200)
+
+// ---
+
+// time field resolvers
+func resolverMiddleware(next graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		start := time.Now()
+		res, err := next(p)
+
+		parent := "unknown"
+		if p.Info.ParentType != nil {
+			parent = p.Info.ParentType.Name()
+		}
+
+		resolverDuration.WithLabelValues(parent, p.Info.FieldName).Observe(time.Since(start).Seconds())
+		return res, err
+	}
+}
+
+// ---
+
+type operationKey struct{}
+
+type operation struct {
+	start time.Time
+	name  string
+	kind  string
+}
+
+// graphql extension measuring operations & counting errors
+type extension struct{}
+
+func (extension) Name() string {
+	return "metrics"
+}
+
+func (extension) Init(ctx context.Context, p *graphql.Params) context.Context {
+	return context.WithValue(ctx, operationKey{}, &operation{
+		start: time.Now(),
+		name:  p.OperationName,
+		kind:  "unknown",
+	})
+}
+
+func (extension) ParseDidStart(ctx context.Context) (context.Context, graphql.ParseFinishFunc) {
+	return ctx, func(err error) {
+		if err != nil {
+			errorsTotal.WithLabelValues("GRAPHQL_PARSE_FAILED").Inc()
+		}
+	}
+}
+
+func (extension) ValidationDidStart(ctx context.Context) (context.Context, graphql.ValidationFinishFunc) {
+	return ctx, func(errs []gqlerrors.FormattedError) {
+		if len(errs) > 0 {
+			errorsTotal.WithLabelValues("GRAPHQL_VALIDATION_FAILED").Add(float64(len(errs)))
+		}
+	}
+}
+
+func (extension) ExecutionDidStart(ctx context.Context) (context.Context, graphql.ExecutionFinishFunc) {
+	return ctx, func(res *graphql.Result) {
+		op, ok := ctx.Value(operationKey{}).(*operation)
+		if !ok {
+			return
+		}
+
+		operationDuration.WithLabelValues(op.kind, operationNames.Value(op.name)).Observe(time.Since(op.start).Seconds())
+		for _, err := range res.Errors {
+			errorsTotal.WithLabelValues(errorCode(err)).Inc()
+		}
+	}
+}
+
+func (extension) ResolveFieldDidStart(ctx context.Context, info *graphql.ResolveInfo) (context.Context, graphql.ResolveFieldFinishFunc) {
+	if op, ok := ctx.Value(operationKey{}).(*operation); ok && op.kind == "unknown" {
+		if def, ok := info.Operation.(*ast.OperationDefinition); ok {
+			op.kind = def.Operation
+		}
+	}
+
+	return ctx, func(interface{}, error) {}
+}
+
+func (extension) HasResult() bool {
+	return false
+}
+
+func (extension) GetResult(context.Context) interface{} {
+	return nil
+}
+
+// ---
+
+func errorCode(err gqlerrors.FormattedError) string {
+	if code, ok := err.Extensions["code"].(string); ok && labelPattern.MatchString(code) {
+		return code
+	}
+
+	return "UNKNOWN"
+}
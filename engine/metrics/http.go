@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var httpRequests = register(prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "http_requests_total",
+	Help:      "Number of http requests by handler, method & status code.",
+}, []string{"handler", "method", "code"}))
+
+var httpDuration = register(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "http_request_duration_seconds",
+	Help:      "Duration of http requests by handler & method.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"handler", "method"}))
+
+var httpInFlight = register(prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "http_requests_in_flight",
+	Help:      "Number of http requests currently being served by handler.",
+}, []string{"handler"}))
+
+// instrument http handler, the handler name is used as label
+func HTTP(handler string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		inFlight := httpInFlight.WithLabelValues(handler)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		method := httpMethod(r.Method)
+		httpRequests.WithLabelValues(handler, method, strconv.Itoa(rec.status)).Inc()
+		httpDuration.WithLabelValues(handler, method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// only keep known methods to bound label values
+func httpMethod(m string) string {
+	switch m {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions, http.MethodHead:
+		return m
+	}
+
+	return "OTHER"
+}
+
+// ---
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(bs []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(bs)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// ---
+
+func register[T prometheus.Collector](c T) T {
+	Registry.MustRegister(c)
+	return c
+}
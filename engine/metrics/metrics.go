@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"net/http"
+	"regexp"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"neodeliver.com/engine/db"
+	"neodeliver.com/engine/graphql"
+)
+
+// Prometheus metrics of the api, graphql resolvers & mongodb client
+// Label values are bounded: ids or user provided values must never be used as label
+// -------------------------------------------------------------------------------------
+
+const namespace = "neodeliver"
+
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// serve metrics in the prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// mongodb monitors are shared by all schemas (modules.Build is called by each test)
+var monitorOnce sync.Once
+
+// collect graphql operations, resolvers & mongodb commands metrics
+func Instrument(s *graphql.Builder) {
+	s.Extension(extension{})
+	s.Use(resolverMiddleware)
+	monitorOnce.Do(func() {
+		db.Monitor(commandMonitor(), poolMonitor())
+	})
+}
+
+// ---
+
+var labelPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// limits the number of distinct values a label can take
+// new values are replaced by "other" once the limit is reached
+type boundedLabel struct {
+	mu     sync.Mutex
+	max    int
+	values map[string]bool
+}
+
+func newBoundedLabel(max int) *boundedLabel {
+	return &boundedLabel{
+		max:    max,
+		values: map[string]bool{},
+	}
+}
+
+func (b *boundedLabel) Value(v string) string {
+	if v == "" {
+		return "anonymous"
+	} else if !labelPattern.MatchString(v) {
+		return "invalid"
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.values[v] {
+		return v
+	} else if len(b.values) >= b.max {
+		return "other"
+	}
+
+	b.values[v] = true
+	return v
+}
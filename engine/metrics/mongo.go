@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+var mongoDuration = register(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "mongo_command_duration_seconds",
+	Help:      "Duration of mongodb commands by command, collection & status.",
+	Buckets:   []float64{.0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+}, []string{"command", "collection", "status"}))
+
+var mongoConnections = register(prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "mongo_pool_connections",
+	Help:      "Number of open connections within the mongodb connection pool.",
+}))
+
+var mongoConnectionsInUse = register(prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "mongo_pool_connections_in_use",
+	Help:      "Number of connections checked out of the mongodb connection pool.",
+}))
+
+var mongoCheckoutFailures = register(prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "mongo_pool_checkout_failures_total",
+	Help:      "Number of failed connection checkouts from the mongodb connection pool.",
+}))
+
+// collection names are bounded by our code, but commands may target arbitrary names (eg: admin commands)
+var collectionNames = newBoundedLabel(100)
+
+// collections of running commands, by request id
+var mongoCommands sync.Map
+
+func commandMonitor() *event.CommandMonitor {
+	finish := func(id int64, command string, duration time.Duration, status string) {
+		collection := "none"
+		if v, ok := mongoCommands.LoadAndDelete(id); ok {
+			collection = v.(string)
+		}
+
+		mongoDuration.WithLabelValues(command, collection, status).Observe(duration.Seconds())
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			collection := "none"
+			if v, ok := e.Command.Lookup(e.CommandName).StringValueOK(); ok {
+				collection = collectionNames.Value(v)
+			}
+
+			mongoCommands.Store(e.RequestID, collection)
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			finish(e.RequestID, e.CommandName, e.Duration, "success")
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			finish(e.RequestID, e.CommandName, e.Duration, "failure")
+		},
+	}
+}
+
+func poolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			switch e.Type {
+			case event.ConnectionCreated:
+				mongoConnections.Inc()
+			case event.ConnectionClosed:
+				mongoConnections.Dec()
+			case event.GetSucceeded:
+				mongoConnectionsInUse.Inc()
+			case event.ConnectionReturned:
+				mongoConnectionsInUse.Dec()
+			case event.GetFailed:
+				mongoCheckoutFailures.Inc()
+			}
+		},
+	}
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"neodeliver.com/engine/config"
+	"neodeliver.com/engine/graphql"
+	"neodeliver.com/engine/logger"
+	"neodeliver.com/engine/server"
+)
+
+// limit http requests by ip address, using the RATE_LIMIT_HTTP rules
+func HTTP(handler string, next http.Handler) http.Handler {
+	c := config.Get().RateLimit
+	list, err := ParseRuleList(c.HTTP)
+	if err != nil {
+		panic(fmt.Errorf("RATE_LIMIT_HTTP: %w", err))
+	}
+
+	for _, r := range list {
+		if r.Scope != ScopeIP {
+			panic("RATE_LIMIT_HTTP: only ip limits are supported, authentication is verified by resolvers")
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.Enabled || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		s, _, err := current()
+		if err != nil {
+			panic(err)
+		}
+
+		ip := server.ClientIP(r)
+		buckets := []Bucket{}
+		for _, rule := range list {
+			buckets = append(buckets, Bucket{rule.key("http:"+handler, ip), rule})
+		}
+
+		results, err := s.Take(r.Context(), buckets)
+		if err != nil {
+			logger.Report(r.Context(), err, "Could not verify rate limit", "handler", handler)
+			results = nil
+		}
+
+		for _, res := range results {
+			SetHeaders(w.Header(), res)
+		}
+
+		if _, ok := denied(results); ok {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"errors": []interface{}{map[string]interface{}{
+					"message":    "rate limit exceeded",
+					"extensions": graphql.NewError(graphql.ErrRateLimited, "").Extensions(),
+				}},
+			})
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
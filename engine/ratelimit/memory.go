@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// in memory buckets, limits are enforced per instance
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time // time at which the bucket is full again
+}
+
+const sweepInterval = time.Minute
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*bucket{},
+		swept:   time.Now(),
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, buckets []Bucket) ([]Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	// refill the buckets, tokens are only taken once all buckets have one
+	list := make([]*bucket, len(buckets))
+	allowed := true
+	for i, k := range buckets {
+		b, ok := s.buckets[k.Key]
+		if !ok {
+			b = &bucket{tokens: float64(k.Rule.Limit), updated: now}
+			s.buckets[k.Key] = b
+		}
+
+		b.tokens = math.Min(float64(k.Rule.Limit), b.tokens+now.Sub(b.updated).Seconds()*k.Rule.rate())
+		b.updated = now
+		allowed = allowed && b.tokens >= 1
+		list[i] = b
+	}
+
+	res := make([]Result, len(buckets))
+	for i, b := range list {
+		ok := b.tokens >= 1
+		if allowed {
+			b.tokens--
+		}
+
+		res[i] = result(buckets[i].Rule, b.tokens, ok)
+		b.full = now.Add(res[i].Reset)
+	}
+
+	return res, nil
+}
+
+// drop full buckets, which are equivalent to missing ones
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.swept) < sweepInterval {
+		return
+	}
+
+	s.swept = now
+	for k, b := range s.buckets {
+		if b.full.Before(now) {
+			delete(s.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"neodeliver.com/engine/db"
+)
+
+// buckets shared by all instances, stored in the rate_limits collection
+// buckets are updated atomically using the database clock & expire once full
+type MongoStore struct {
+	collection string
+}
+
+func NewMongoStore() *MongoStore {
+	return &MongoStore{collection: "rate_limits"}
+}
+
+// expire full buckets, created at startup
+func (s *MongoStore) CreateIndexes(ctx context.Context) error {
+	d, err := db.Client()
+	if err != nil {
+		return err
+	}
+
+	_, err = d.Collection(s.collection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+
+	return err
+}
+
+// buckets are first refilled & checked, then tokens are taken
+// tokens taken before a concurrent request emptied a later bucket are given back
+func (s *MongoStore) Take(ctx context.Context, buckets []Bucket) ([]Result, error) {
+	d, err := db.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	c := d.Collection(s.collection)
+	res := make([]Result, len(buckets))
+	for i, b := range buckets {
+		if res[i], err = s.update(ctx, c, b, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, ok := denied(res); ok {
+		return res, nil
+	}
+
+	for i, b := range buckets {
+		if res[i], err = s.update(ctx, c, b, 1); err != nil || !res[i].Allowed {
+			for _, t := range buckets[:i] {
+				s.update(ctx, c, t, -1)
+			}
+
+			return res, err
+		}
+	}
+
+	return res, nil
+}
+
+// refill the bucket & take cost tokens when one is available, negative costs giving tokens back
+func (s *MongoStore) update(ctx context.Context, c *mongo.Collection, b Bucket, cost float64) (Result, error) {
+	limit := float64(b.Rule.Limit)
+	elapsed := bson.M{"$divide": bson.A{
+		bson.M{"$subtract": bson.A{"$$NOW", bson.M{"$ifNull": bson.A{"$updated_at", "$$NOW"}}}},
+		1000,
+	}}
+
+	tokens := interface{}(bson.M{"$cond": bson.A{"$allowed", bson.M{"$subtract": bson.A{"$tokens", cost}}, "$tokens"}})
+	if cost < 0 {
+		tokens = bson.M{"$min": bson.A{limit, bson.M{"$subtract": bson.A{"$tokens", cost}}}}
+	}
+
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"tokens": bson.M{"$min": bson.A{limit, bson.M{"$add": bson.A{
+				bson.M{"$ifNull": bson.A{"$tokens", limit}},
+				bson.M{"$multiply": bson.A{elapsed, b.Rule.rate()}},
+			}}}},
+			"updated_at": "$$NOW",
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"allowed": bson.M{"$gte": bson.A{"$tokens", 1}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"tokens":     tokens,
+			"expires_at": bson.M{"$add": bson.A{"$$NOW", b.Rule.Period.Milliseconds()}},
+		}}},
+	}
+
+	doc := struct {
+		Tokens  float64 `bson:"tokens"`
+		Allowed bool    `bson:"allowed"`
+	}{}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := c.FindOneAndUpdate(ctx, bson.M{"_id": b.Key}, update, opts).Decode(&doc)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result(b.Rule, doc.Tokens, doc.Allowed), nil
+}
@@ -0,0 +1,352 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gographql "github.com/graphql-go/graphql"
+	"neodeliver.com/engine/config"
+	"neodeliver.com/engine/db"
+	"neodeliver.com/engine/graphql"
+	"neodeliver.com/engine/logger"
+	"neodeliver.com/engine/rbac"
+)
+
+// Token bucket rate limiting of http requests & graphql operations
+// buckets are keyed by organization, api key, user or ip address
+// -------------------------------------------------------------------------------------
+
+type Scope string
+
+const (
+	ScopeOrganization Scope = "organization"
+	ScopeAPIKey       Scope = "api_key"
+	ScopeUser         Scope = "user"
+	ScopeIP           Scope = "ip"
+)
+
+// bucket of Limit tokens, refilled over Period
+type Rule struct {
+	Scope  Scope
+	Limit  int
+	Period time.Duration
+}
+
+func Organization(limit int, period time.Duration) Rule {
+	return Rule{ScopeOrganization, limit, period}
+}
+
+func APIKey(limit int, period time.Duration) Rule {
+	return Rule{ScopeAPIKey, limit, period}
+}
+
+func User(limit int, period time.Duration) Rule {
+	return Rule{ScopeUser, limit, period}
+}
+
+func IP(limit int, period time.Duration) Rule {
+	return Rule{ScopeIP, limit, period}
+}
+
+// bucket key, rules of an operation may only differ by their period
+func (r Rule) key(operation string, id string) string {
+	return string(r.Scope) + ":" + operation + ":" + r.Period.String() + ":" + id
+}
+
+// tokens per second
+func (r Rule) rate() float64 {
+	return float64(r.Limit) / r.Period.Seconds()
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until a token is available
+}
+
+func result(r Rule, tokens float64, allowed bool) Result {
+	res := Result{
+		Allowed:   allowed,
+		Limit:     r.Limit,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(r.Limit) - tokens) / r.rate() * float64(time.Second)),
+	}
+
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) / r.rate() * float64(time.Second))
+	}
+
+	return res
+}
+
+// bucket of a rule, identified by its key
+type Bucket struct {
+	Key  string
+	Rule Rule
+}
+
+// bucket storage, shared stores allow to limit requests across instances
+type Store interface {
+	// take a token from each bucket when all of them have one, a denied request consumes no token
+	// results are returned in the order of the buckets, denying buckets being not Allowed
+	Take(ctx context.Context, buckets []Bucket) ([]Result, error)
+}
+
+// ---
+
+var (
+	store    Store
+	defaults = map[string][]Rule{}
+	rules    map[string][]Rule
+	mu       sync.Mutex
+)
+
+// default limits of a root query or mutation, overwritten by RATE_LIMIT_OPERATIONS
+func Register(operation string, r ...Rule) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	defaults[operation] = r
+	rules = nil
+}
+
+// overwrite the bucket storage, used by tests
+func SetStore(s Store) {
+	mu.Lock()
+	store = s
+	mu.Unlock()
+}
+
+func current() (Store, map[string][]Rule, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	c := config.Get().RateLimit
+	if store == nil {
+		if c.Store == "mongodb" && !db.InMemory() {
+			s := NewMongoStore()
+			if err := s.CreateIndexes(context.Background()); err != nil {
+				// buckets still work without the index, full buckets are then never removed
+				logger.Report(context.Background(), err, "Could not create the rate limits index")
+			}
+
+			store = s
+		} else {
+			store = NewMemoryStore()
+		}
+	}
+
+	if rules == nil {
+		overrides, err := ParseRules(c.Operations)
+		if err != nil {
+			return nil, nil, fmt.Errorf("RATE_LIMIT_OPERATIONS: %w", err)
+		}
+
+		rules = map[string][]Rule{}
+		for k, v := range defaults {
+			rules[k] = v
+		}
+
+		for k, v := range overrides {
+			rules[k] = v
+		}
+	}
+
+	return store, rules, nil
+}
+
+// limit root queries & mutations
+func Instrument(s *graphql.Builder) {
+	if _, _, err := current(); err != nil {
+		panic(err)
+	}
+
+	s.Use(middleware)
+}
+
+func middleware(next gographql.FieldResolveFn) gographql.FieldResolveFn {
+	return func(p gographql.ResolveParams) (interface{}, error) {
+		if !config.Get().RateLimit.Enabled || !isRootField(p.Info) {
+			return next(p)
+		}
+
+		s, all, err := current()
+		if err != nil {
+			return nil, err
+		}
+
+		operation := p.Info.FieldName
+		if len(all[operation]) == 0 {
+			return next(p)
+		}
+
+		// unauthenticated requests are only limited by ip, the resolver rejecting them when authentication is required
+		r, err := rbac.FromContext(p.Context)
+		if err != nil {
+			r = rbac.RBAC{}
+		}
+
+		ip, _ := p.Context.Value("client_ip").(string)
+		buckets := []Bucket{}
+		for _, rule := range all[operation] {
+			if id := identifier(rule.Scope, r, ip); id != "" {
+				buckets = append(buckets, Bucket{rule.key(operation, id), rule})
+			}
+		}
+
+		if len(buckets) == 0 {
+			return next(p)
+		}
+
+		list, err := s.Take(p.Context, buckets)
+		if err != nil {
+			// never block requests because of the storage
+			logger.Report(p.Context, err, "Could not verify rate limit", "operation", operation)
+			return next(p)
+		}
+
+		graphql.ResponseHeaders(p.Context, func(h http.Header) {
+			for _, res := range list {
+				SetHeaders(h, res)
+			}
+		})
+
+		if res, ok := denied(list); ok {
+			return nil, graphql.NewError(graphql.ErrRateLimited, fmt.Sprintf("rate limit exceeded, retry in %ds", seconds(res.RetryAfter)))
+		}
+
+		return next(p)
+	}
+}
+
+// longest wait of the denying buckets
+func denied(list []Result) (Result, bool) {
+	res, ok := Result{}, false
+	for _, r := range list {
+		if !r.Allowed && (!ok || r.RetryAfter > res.RetryAfter) {
+			res, ok = r, true
+		}
+	}
+
+	return res, ok
+}
+
+func isRootField(info gographql.ResolveInfo) bool {
+	if info.ParentType == nil {
+		return false
+	}
+
+	for _, t := range []*gographql.Object{info.Schema.QueryType(), info.Schema.MutationType()} {
+		if t != nil && t.Name() == info.ParentType.Name() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bucket identifier of the scope, empty when the scope does not apply to the request
+func identifier(scope Scope, r rbac.RBAC, ip string) string {
+	switch scope {
+	case ScopeOrganization:
+		return r.OrganizationID
+	case ScopeAPIKey:
+		return r.APIKeyID
+	case ScopeUser:
+		return r.UserID
+	case ScopeIP:
+		return ip
+	}
+
+	return ""
+}
+
+// set the RateLimit headers (https://datatracker.ietf.org/doc/draft-ietf-httpapi-ratelimit-headers/)
+// the most restrictive limit is kept when several limits apply to the request
+func SetHeaders(h http.Header, res Result) {
+	if v := h.Get("RateLimit-Remaining"); v != "" {
+		if remaining, err := strconv.Atoi(v); err == nil && remaining < res.Remaining && res.Allowed {
+			return
+		}
+	}
+
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+
+	if !res.Allowed {
+		h.Set("Retry-After", strconv.Itoa(seconds(res.RetryAfter)))
+	}
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ---
+
+// parse rules formatted as operation=scope:limit/period;scope:limit/period,operation=...
+func ParseRules(s string) (map[string][]Rule, error) {
+	res := map[string][]Rule{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		operation, list, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid limits %q, expected operation=scope:limit/period", item)
+		}
+
+		r, err := ParseRuleList(list)
+		if err != nil {
+			return nil, err
+		}
+
+		res[strings.TrimSpace(operation)] = r
+	}
+
+	return res, nil
+}
+
+// parse rules formatted as scope:limit/period;scope:limit/period
+func ParseRuleList(s string) ([]Rule, error) {
+	res := []Rule{}
+	for _, item := range strings.Split(s, ";") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		scope, value, ok1 := strings.Cut(item, ":")
+		limit, period, ok2 := strings.Cut(value, "/")
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("invalid limit %q, expected scope:limit/period", item)
+		}
+
+		r := Rule{Scope: Scope(scope)}
+		switch r.Scope {
+		case ScopeOrganization, ScopeAPIKey, ScopeUser, ScopeIP:
+		default:
+			return nil, fmt.Errorf("invalid limit %q, unknown scope %s", item, scope)
+		}
+
+		var err error
+		if r.Limit, err = strconv.Atoi(limit); err != nil || r.Limit <= 0 {
+			return nil, fmt.Errorf("invalid limit %q, expected a positive number of requests", item)
+		} else if r.Period, err = time.ParseDuration(period); err != nil || r.Period <= 0 {
+			return nil, fmt.Errorf("invalid limit %q, expected a positive period (eg: 1m)", item)
+		}
+
+		res = append(res, r)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gographql "github.com/graphql-go/graphql"
+	"neodeliver.com/engine/config"
+	"neodeliver.com/engine/rbac"
+)
+
+func TestMiddleware(t *testing.T) {
+	c, err := config.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.RateLimit.Enabled = true
+	c.RateLimit.Operations = ""
+	config.Set(c)
+	defer config.Set(nil)
+
+	SetStore(NewMemoryStore())
+	defer SetStore(nil)
+	Register("limited", IP(1, time.Minute), User(10, time.Minute))
+
+	resolve := func(p gographql.ResolveParams) (interface{}, error) {
+		return true, nil
+	}
+
+	schema, err := gographql.NewSchema(gographql.SchemaConfig{
+		Query: gographql.NewObject(gographql.ObjectConfig{
+			Name: "Query",
+			Fields: gographql.Fields{
+				"limited": &gographql.Field{Type: gographql.Boolean, Resolve: middleware(resolve)},
+				"open":    &gographql.Field{Type: gographql.Boolean, Resolve: middleware(resolve)},
+			},
+		}),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// unauthenticated requests
+	ctx := context.WithValue(context.Background(), "rbac", func() (rbac.RBAC, error) {
+		return rbac.RBAC{}, errors.New("invalid token")
+	})
+
+	ctx = context.WithValue(ctx, "client_ip", "192.0.2.1")
+	tests := []struct {
+		query   string
+		limited bool
+	}{
+		{`{ open }`, false},
+		{`{ limited }`, false},
+		{`{ open }`, false},
+		{`{ limited }`, true},
+	}
+
+	for i, tt := range tests {
+		res := gographql.Do(gographql.Params{Schema: schema, RequestString: tt.query, Context: ctx})
+		if limited := len(res.Errors) > 0; limited != tt.limited {
+			t.Errorf("#%d %s: errors %v, want limited %v", i, tt.query, res.Errors, tt.limited)
+		}
+	}
+}
+
+func TestMemoryStoreDenied(t *testing.T) {
+	s := NewMemoryStore()
+	ip := Bucket{"ip", IP(2, time.Minute)}
+	user := Bucket{"user", User(1, time.Minute)}
+
+	for i, want := range []bool{true, false, false} {
+		res, err := s.Take(context.Background(), []Bucket{ip, user})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, limited := denied(res); limited == want {
+			t.Errorf("#%d: allowed %v, want %v", i, !limited, want)
+		}
+	}
+
+	// denied requests consumed no token of the ip bucket
+	res, _ := s.Take(context.Background(), []Bucket{ip})
+	if !res[0].Allowed || res[0].Remaining != 0 {
+		t.Errorf("ip bucket: got %+v, want its second token taken", res[0])
+	}
+}
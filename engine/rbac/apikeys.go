@@ -0,0 +1,79 @@
+package rbac
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"neodeliver.com/engine/db"
+)
+
+// API keys authenticate server to server requests of an organization with the X-API-Key header
+// only the sha256 hash of a key is stored, the key itself is returned once when created
+// -------------------------------------------------------------------------------------
+
+const (
+	APIKeyHeader   = "X-API-Key"
+	APIKeyPrefixID = "key_"
+	apiKeyPrefix   = "ndk_"
+)
+
+var ErrInvalidAPIKey = errors.New("Invalid or revoked api key")
+
+type APIKey struct {
+	ID             string     `bson:"_id" json:"id"`
+	OrganizationID string     `bson:"organization_id" json:"organization_id"`
+	Name           string     `bson:"name" json:"name"`
+	Hash           string     `bson:"hash" json:"-" graphql:"-"`
+	Scopes         []string   `bson:"scopes" json:"scopes"`         // granting operations, every scope for keys created before scopes
+	CreatedBy      string     `bson:"created_by" json:"created_by"` // id of the user who created the key
+	CreatedAt      time.Time  `bson:"created_at" json:"created_at"`
+	RevokedAt      *time.Time `bson:"revoked_at" json:"-" graphql:"-"`
+}
+
+// random api key & its hash
+func NewAPIKey() (string, string, error) {
+	bs := make([]byte, 32)
+	if _, err := rand.Read(bs); err != nil {
+		return "", "", err
+	}
+
+	key := apiKeyPrefix + hex.EncodeToString(bs)
+	return key, HashAPIKey(key), nil
+}
+
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// identity of a valid api key, scoped to its organization & limited to the operations of its scopes
+func loadAPIKey(ctx context.Context, key string) (RBAC, error) {
+	k := APIKey{}
+	err := db.Coll("api_keys").FindOne(ctx, bson.M{"hash": HashAPIKey(key), "revoked_at": nil}, &k)
+	if err == db.ErrNoDocuments {
+		return RBAC{}, ErrInvalidAPIKey
+	} else if err != nil {
+		return RBAC{}, err
+	}
+
+	if k.Scopes == nil {
+		k.Scopes = APIKeyScopes()
+	}
+
+	r := RBAC{
+		OrganizationID: k.OrganizationID,
+		APIKeyID:       k.ID,
+		Scopes:         map[string]bool{},
+	}
+
+	for _, s := range k.Scopes {
+		r.Scopes[s] = true
+	}
+
+	return r, nil
+}
@@ -0,0 +1,60 @@
+package rbac
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"neodeliver.com/engine/db"
+)
+
+func TestLoadAPIKey(t *testing.T) {
+	db.SetDatabase(db.NewMemory())
+	defer db.SetDatabase(nil)
+	RegisterScope("tests:read", "things")
+
+	ctx := context.Background()
+	key, hash, err := NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Coll("api_keys").InsertOne(ctx, APIKey{ID: "key_1", OrganizationID: "org_1", Hash: hash, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set(APIKeyHeader, key)
+	r, err := Load(req)
+	if err != nil {
+		t.Fatal(err)
+	} else if r.APIKeyID != "key_1" || r.OrganizationID != "org_1" || r.UserID != "" {
+		t.Errorf("loaded %+v, want key_1 of org_1 without user", r)
+	}
+
+	// keys created before scopes have all of them
+	if !r.Scopes["tests:read"] {
+		t.Errorf("scopes %v of a key without scopes, want all of them", r.Scopes)
+	}
+
+	db.Coll("api_keys").UpdateMany(ctx, bson.M{"_id": "key_1"}, bson.M{"$set": bson.M{"scopes": bson.A{"tests:write"}}})
+	if r, err = Load(req); err != nil {
+		t.Fatal(err)
+	} else if len(r.Scopes) != 1 || !r.Scopes["tests:write"] {
+		t.Errorf("scopes %v, want tests:write", r.Scopes)
+	}
+
+	req.Header.Set(APIKeyHeader, key+"0")
+	if _, err := Load(req); err != ErrInvalidAPIKey {
+		t.Errorf("unknown key: got %v, want ErrInvalidAPIKey", err)
+	}
+
+	db.Coll("api_keys").UpdateMany(ctx, bson.M{"_id": "key_1"}, bson.M{"$set": bson.M{"revoked_at": time.Now()}})
+	req.Header.Set(APIKeyHeader, key)
+	if _, err := Load(req); err != ErrInvalidAPIKey {
+		t.Errorf("revoked key: got %v, want ErrInvalidAPIKey", err)
+	}
+}
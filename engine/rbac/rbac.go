@@ -3,18 +3,24 @@ package rbac
 import (
 	"context"
 	"net/http"
-	"os"
+
+	"neodeliver.com/engine/config"
 )
 
 type RBAC struct {
 	SUB            string
 	UserID         string
 	OrganizationID string
+	APIKeyID       string // set when authenticated with an api key
 	Token          string
 	Scopes         map[string]bool
 }
 
 func Load(req *http.Request) (RBAC, error) {
+	if key := req.Header.Get(APIKeyHeader); key != "" {
+		return loadAPIKey(req.Context(), key)
+	}
+
 	// TODO load rbac from request
 	return RBAC{
 		SUB:            "oauth0|token",
@@ -22,7 +28,7 @@ func Load(req *http.Request) (RBAC, error) {
 		OrganizationID: "56cde8c6-5af5-11ee-8c99-0242ac120002",
 		// TODO : The token env is only for testing, it should be replaced with
 		// the actual access token of the user
-		Token: os.Getenv("AUTH0_ACCESS_TOKEN"),
+		Token: config.Get().Auth0.AccessToken,
 		Scopes: map[string]bool{
 			"users:read": true,
 		},
@@ -36,3 +42,10 @@ func FromContext(ctx context.Context) (RBAC, error) {
 
 	return RBAC{}, nil
 }
+
+// context authenticated as r, used by tests & background jobs
+func NewContext(ctx context.Context, r RBAC) context.Context {
+	return context.WithValue(ctx, "rbac", func() (RBAC, error) {
+		return r, nil
+	})
+}
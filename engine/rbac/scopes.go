@@ -0,0 +1,76 @@
+package rbac
+
+import (
+	"sort"
+	"sync"
+)
+
+// Scopes of api keys, each granting a set of root queries & mutations registered by the modules
+// operations without scope (eg: api keys & team management) are reserved to users
+// -------------------------------------------------------------------------------------
+
+var (
+	scopes   = map[string]map[string]bool{} // operations by scope
+	scopesMu sync.RWMutex
+)
+
+// grant the root queries & mutations to the api keys having the scope
+func RegisterScope(scope string, operations ...string) {
+	scopesMu.Lock()
+	defer scopesMu.Unlock()
+
+	if scopes[scope] == nil {
+		scopes[scope] = map[string]bool{}
+	}
+
+	for _, op := range operations {
+		scopes[scope][op] = true
+	}
+}
+
+// registered scopes, sorted
+func APIKeyScopes() []string {
+	scopesMu.RLock()
+	defer scopesMu.RUnlock()
+
+	list := make([]string, 0, len(scopes))
+	for s := range scopes {
+		list = append(list, s)
+	}
+
+	sort.Strings(list)
+	return list
+}
+
+// operations granted by the registered scopes
+func ScopedOperations() map[string]bool {
+	scopesMu.RLock()
+	defer scopesMu.RUnlock()
+
+	res := map[string]bool{}
+	for _, ops := range scopes {
+		for op := range ops {
+			res[op] = true
+		}
+	}
+
+	return res
+}
+
+// whether the root query or mutation can be executed, api keys requiring a scope granting it
+func (r RBAC) Allowed(operation string) bool {
+	if r.APIKeyID == "" {
+		return true
+	}
+
+	scopesMu.RLock()
+	defer scopesMu.RUnlock()
+
+	for scope, ops := range scopes {
+		if r.Scopes[scope] && ops[operation] {
+			return true
+		}
+	}
+
+	return false
+}
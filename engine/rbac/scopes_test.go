@@ -0,0 +1,27 @@
+package rbac
+
+import "testing"
+
+func TestAllowed(t *testing.T) {
+	RegisterScope("tests:read", "things", "thing")
+	RegisterScope("tests:write", "add_thing")
+
+	key := RBAC{APIKeyID: "key_1", Scopes: map[string]bool{"tests:read": true}}
+	tests := []struct {
+		r         RBAC
+		operation string
+		allowed   bool
+	}{
+		{key, "things", true},
+		{key, "add_thing", false},
+		{key, "create_api_key", false},
+		{RBAC{UserID: "user_1"}, "create_api_key", true},
+		{RBAC{APIKeyID: "key_2"}, "things", false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.r.Allowed(tt.operation); got != tt.allowed {
+			t.Errorf("%+v allowed %s: %v, want %v", tt.r, tt.operation, got, tt.allowed)
+		}
+	}
+}
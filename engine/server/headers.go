@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"neodeliver.com/engine/config"
+)
+
+// Cross origin requests & security headers
+// -------------------------------------------------------------------------------------
+
+// restrictive security headers of api responses
+func SecurityHeaders(w http.ResponseWriter) {
+	h := w.Header()
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("X-Frame-Options", "DENY")
+	h.Set("Referrer-Policy", "no-referrer")
+	h.Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+
+	if config.Get().IsProduction() {
+		h.Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains")
+	}
+}
+
+// set cors headers for allowed origins, returns true when the request was a preflight request
+func CORS(w http.ResponseWriter, r *http.Request) bool {
+	c := config.Get().CORS
+	origin := r.Header.Get("Origin")
+	preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+	h := w.Header()
+	h.Add("Vary", "Origin")
+
+	if origin != "" && allowedOrigin(c.AllowedOrigins, origin) {
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Set("Access-Control-Expose-Headers", "X-Request-ID, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After, Idempotent-Replayed")
+
+		if preflight {
+			h.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			h.Set("Access-Control-Allow-Headers", strings.Join(c.AllowedHeaders, ", "))
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+		}
+	}
+
+	if preflight {
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	return preflight
+}
+
+func allowedOrigin(allowed []string, origin string) bool {
+	for _, o := range allowed {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+
+	return false
+}
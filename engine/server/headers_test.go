@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"neodeliver.com/engine/config"
+)
+
+func TestCORS(t *testing.T) {
+	c, err := config.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.CORS.AllowedOrigins = []string{"https://app.neodeliver.com"}
+	config.Set(c)
+	defer config.Set(nil)
+
+	tests := []struct {
+		origin    string
+		preflight bool
+		allowed   bool
+	}{
+		{"https://app.neodeliver.com", true, true},
+		{"https://APP.neodeliver.com", false, true},
+		{"https://evil.example.com", true, false},
+		{"", false, false},
+	}
+
+	for _, tt := range tests {
+		method := "POST"
+		if tt.preflight {
+			method = "OPTIONS"
+		}
+
+		r := httptest.NewRequest(method, "/", nil)
+		r.Header.Set("Origin", tt.origin)
+		if tt.preflight {
+			r.Header.Set("Access-Control-Request-Method", "POST")
+		}
+
+		w := httptest.NewRecorder()
+		if CORS(w, r) != tt.preflight {
+			t.Errorf("%s %s: preflight not detected", method, tt.origin)
+		}
+
+		h := w.Header()
+		if allowed := h.Get("Access-Control-Allow-Origin") == tt.origin && tt.origin != ""; allowed != tt.allowed {
+			t.Errorf("%s %s: allowed %v, want %v", method, tt.origin, allowed, tt.allowed)
+		}
+
+		if tt.preflight && tt.allowed && h.Get("Access-Control-Allow-Headers") != "Authorization, Content-Type, Idempotency-Key, X-API-Key" {
+			t.Errorf("allowed headers %q", h.Get("Access-Control-Allow-Headers"))
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Health probes
+// /healthz verifies the registered dependencies, /readyz additionally fails while draining connections
+// -------------------------------------------------------------------------------------
+
+const checkTimeout = 2 * time.Second
+
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	res := s.runChecks(r.Context())
+	writeHealth(w, res)
+}
+
+func (s *Server) ready(w http.ResponseWriter, r *http.Request) {
+	if s.draining.Load() {
+		writeHealth(w, healthResponse{Status: "draining"})
+		return
+	}
+
+	writeHealth(w, s.runChecks(r.Context()))
+}
+
+func (s *Server) runChecks(ctx context.Context) healthResponse {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	res := healthResponse{Status: "ok", Checks: map[string]string{}}
+	for _, c := range s.checks {
+		if err := c.fn(ctx); err != nil {
+			res.Status = "unavailable"
+			res.Checks[c.name] = err.Error()
+		} else {
+			res.Checks[c.name] = "ok"
+		}
+	}
+
+	return res
+}
+
+func writeHealth(w http.ResponseWriter, res healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if res.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"neodeliver.com/engine/config"
+)
+
+// ip address of the client, X-Forwarded-For is only used behind the configured number of trusted proxies
+func ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	proxies := config.Get().Server.TrustedProxies
+	if proxies == 0 {
+		return ip
+	}
+
+	// each proxy appends the address it received the request from, earlier entries can be spoofed
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	if i := len(forwarded) - proxies; i >= 0 {
+		if v := strings.TrimSpace(forwarded[i]); v != "" {
+			return v
+		}
+	}
+
+	return ip
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"neodeliver.com/engine/config"
+	"neodeliver.com/engine/logger"
+)
+
+// Http server owning the api lifecycle: timeouts, body limits, health probes & graceful shutdown
+// -------------------------------------------------------------------------------------
+
+type Server struct {
+	config   config.Server
+	port     int
+	mux      *http.ServeMux
+	internal *http.ServeMux // handlers of the internal listener, eg: metrics
+	checks   []check
+	hooks    []func(ctx context.Context) error
+	limits   map[string]int64
+	draining atomic.Bool
+}
+
+type check struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func New(c *config.Config) *Server {
+	s := &Server{
+		config:   c.Server,
+		port:     c.Port,
+		mux:      http.NewServeMux(),
+		internal: http.NewServeMux(),
+		limits:   map[string]int64{},
+	}
+
+	s.mux.HandleFunc("/healthz", s.health)
+	s.mux.HandleFunc("/readyz", s.ready)
+	return s
+}
+
+// mount an additional handler (graphql, tracking, webhooks...)
+func (s *Server) Handle(pattern string, h http.Handler) *Server {
+	s.mux.Handle(pattern, h)
+	return s
+}
+
+// mount a handler on the internal listener (SERVER_INTERNAL_PORT) only, never served by serverless runtimes
+func (s *Server) HandleInternal(pattern string, h http.Handler) *Server {
+	s.internal.Handle(pattern, h)
+	return s
+}
+
+// overwrite the request body limit of a mounted pattern (eg: file uploads)
+func (s *Server) Limit(pattern string, maxBytes int64) *Server {
+	s.limits[pattern] = maxBytes
+	return s
+}
+
+// register a dependency verified by the health probes
+func (s *Server) Check(name string, fn func(ctx context.Context) error) *Server {
+	s.checks = append(s.checks, check{name, fn})
+	return s
+}
+
+// register a function called once all connections are drained, in reverse order
+func (s *Server) OnShutdown(fn func(ctx context.Context) error) *Server {
+	s.hooks = append(s.hooks, fn)
+	return s
+}
+
+// mounted handlers with request body limits, used as is by serverless runtimes
+func (s *Server) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := s.config.MaxBodyBytes
+		if _, pattern := s.mux.Handler(r); s.limits[pattern] > 0 {
+			limit = s.limits[pattern]
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		s.mux.ServeHTTP(w, r)
+	})
+}
+
+// serve until the context is cancelled or a SIGTERM / SIGINT is received, then drain open connections
+func (s *Server) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	srv := &http.Server{
+		Addr:              ":" + strconv.Itoa(s.port),
+		Handler:           s.Handler(),
+		ReadTimeout:       s.config.ReadTimeout,
+		ReadHeaderTimeout: s.config.ReadHeaderTimeout,
+		WriteTimeout:      s.config.WriteTimeout,
+		IdleTimeout:       s.config.IdleTimeout,
+	}
+
+	// internal handlers are served on their own port, not routed by the public load balancer
+	internal := &http.Server{
+		Addr:              ":" + strconv.Itoa(s.config.InternalPort),
+		Handler:           s.internal,
+		ReadHeaderTimeout: s.config.ReadHeaderTimeout,
+		IdleTimeout:       s.config.IdleTimeout,
+	}
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+
+	if s.config.InternalPort > 0 {
+		go func() {
+			errs <- internal.ListenAndServe()
+		}()
+
+		logger.Root().Info("Listening on internal port "+strconv.Itoa(s.config.InternalPort)+"...", "addr", internal.Addr)
+	}
+
+	logger.Root().Info("Listening on port "+strconv.Itoa(s.port)+"...", "addr", srv.Addr)
+
+	select {
+	case err := <-errs:
+		srv.Close()
+		internal.Close()
+		s.shutdown(context.Background())
+		return err
+	case <-ctx.Done():
+	}
+
+	// fail readiness first, giving load balancers time to stop routing new requests
+	logger.Root().Info("Shutting down, draining connections", "delay", s.config.ShutdownDelay, "timeout", s.config.ShutdownTimeout)
+	s.draining.Store(true)
+	time.Sleep(s.config.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+
+	internal.Shutdown(shutdownCtx)
+	err := srv.Shutdown(shutdownCtx)
+	if err := s.shutdown(shutdownCtx); err != nil {
+		logger.Root().Error("Could not shut down cleanly", "err", err)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	logger.Root().Info("Server stopped")
+	return nil
+}
+
+func (s *Server) shutdown(ctx context.Context) error {
+	errs := []error{}
+	for i := len(s.hooks) - 1; i >= 0; i-- {
+		if err := s.hooks[i](ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
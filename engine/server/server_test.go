@@ -0,0 +1,27 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"neodeliver.com/engine/config"
+)
+
+func TestInternalHandlers(t *testing.T) {
+	c, err := config.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	s := New(c).Handle("/graphql", ok).HandleInternal("/metrics", ok)
+
+	for path, want := range map[string]int{"/graphql": http.StatusOK, "/metrics": http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != want {
+			t.Errorf("public %s: status %d, want %d", path, w.Code, want)
+		}
+	}
+}
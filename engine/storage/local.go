@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// files stored in a local directory, the content type being kept in a .meta sidecar file
+// only suited to single instance deployments
+type Local struct {
+	dir string
+}
+
+func NewLocal(dir string) *Local {
+	return &Local{dir: dir}
+}
+
+func (l *Local) path(key string) string {
+	return filepath.Join(l.dir, filepath.FromSlash(key))
+}
+
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, contentType string) (Object, error) {
+	path := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return Object{}, err
+	}
+
+	// write to a temporary file first, readers never see partial files
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return Object{}, err
+	}
+
+	defer os.Remove(tmp.Name())
+	size, err := io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+
+	if err != nil {
+		return Object{}, err
+	}
+
+	meta, _ := json.Marshal(map[string]string{"content_type": contentType})
+	if err := os.WriteFile(path+".meta", meta, 0644); err != nil {
+		return Object{}, err
+	} else if err := os.Rename(tmp.Name(), path); err != nil {
+		return Object{}, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return Object{}, err
+	}
+
+	return Object{Key: key, Size: size, ContentType: contentType, CreatedAt: info.ModTime()}, nil
+}
+
+func (l *Local) Open(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	path := l.path(key)
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, Object{}, ErrNotFound
+	} else if err != nil {
+		return nil, Object{}, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, Object{}, err
+	}
+
+	meta := map[string]string{}
+	if bs, err := os.ReadFile(path + ".meta"); err == nil {
+		json.Unmarshal(bs, &meta)
+	}
+
+	return f, Object{Key: key, Size: info.Size(), ContentType: meta["content_type"], CreatedAt: info.ModTime()}, nil
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path := l.path(key)
+	os.Remove(path + ".meta")
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
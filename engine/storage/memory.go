@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// files kept in memory, used by tests & local development
+type Memory struct {
+	mu    sync.Mutex
+	files map[string]memoryFile
+}
+
+type memoryFile struct {
+	object  Object
+	content []byte
+}
+
+func NewMemory() *Memory {
+	return &Memory{files: map[string]memoryFile{}}
+}
+
+func (m *Memory) Put(ctx context.Context, key string, r io.Reader, contentType string) (Object, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return Object{}, err
+	}
+
+	o := Object{
+		Key:         key,
+		Size:        int64(len(content)),
+		ContentType: contentType,
+		CreatedAt:   time.Now(),
+	}
+
+	m.mu.Lock()
+	m.files[key] = memoryFile{o, content}
+	m.mu.Unlock()
+	return o, nil
+}
+
+func (m *Memory) Open(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	m.mu.Lock()
+	f, ok := m.files[key]
+	m.mu.Unlock()
+
+	if !ok {
+		return nil, Object{}, ErrNotFound
+	}
+
+	return io.NopCloser(bytes.NewReader(f.content)), f.object, nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	delete(m.files, key)
+	m.mu.Unlock()
+	return nil
+}
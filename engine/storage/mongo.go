@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"neodeliver.com/engine/db"
+)
+
+// files stored in mongodb using gridfs, shared by all instances
+// replaced files are kept as older revisions until the upload of the new revision completes
+type Mongo struct {
+	bucket string
+}
+
+func NewMongo(bucket string) *Mongo {
+	return &Mongo{bucket: bucket}
+}
+
+func (m *Mongo) open() (*gridfs.Bucket, error) {
+	d, err := db.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	return gridfs.NewBucket(d, options.GridFSBucket().SetName(m.bucket))
+}
+
+func (m *Mongo) Put(ctx context.Context, key string, r io.Reader, contentType string) (Object, error) {
+	b, err := m.open()
+	if err != nil {
+		return Object{}, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		b.SetWriteDeadline(deadline)
+	}
+
+	id, err := b.UploadFromStream(key, r, options.GridFSUpload().SetMetadata(bson.M{"content_type": contentType}))
+	if err != nil {
+		return Object{}, err
+	}
+
+	// drop older revisions
+	if err := m.delete(ctx, b, bson.M{"filename": key, "_id": bson.M{"$ne": id}}); err != nil {
+		return Object{}, err
+	}
+
+	rc, o, err := m.Open(ctx, key)
+	if err == nil {
+		rc.Close()
+	}
+
+	return o, err
+}
+
+func (m *Mongo) Open(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	b, err := m.open()
+	if err != nil {
+		return nil, Object{}, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		b.SetReadDeadline(deadline)
+	}
+
+	stream, err := b.OpenDownloadStreamByName(key)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil, Object{}, ErrNotFound
+	} else if err != nil {
+		return nil, Object{}, err
+	}
+
+	f := stream.GetFile()
+	meta := struct {
+		ContentType string `bson:"content_type"`
+	}{}
+
+	if f.Metadata != nil {
+		bson.Unmarshal(f.Metadata, &meta)
+	}
+
+	return stream, Object{Key: key, Size: f.Length, ContentType: meta.ContentType, CreatedAt: f.UploadDate}, nil
+}
+
+func (m *Mongo) Delete(ctx context.Context, key string) error {
+	b, err := m.open()
+	if err != nil {
+		return err
+	}
+
+	return m.delete(ctx, b, bson.M{"filename": key})
+}
+
+func (m *Mongo) delete(ctx context.Context, b *gridfs.Bucket, filter bson.M) error {
+	cur, err := b.FindContext(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	files := []struct {
+		ID interface{} `bson:"_id"`
+	}{}
+
+	if err := cur.All(ctx, &files); err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if err := b.DeleteContext(ctx, f.ID); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
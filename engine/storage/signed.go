@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"neodeliver.com/engine/config"
+	"neodeliver.com/engine/logger"
+	"neodeliver.com/engine/server"
+)
+
+// Signed download urls, files are only served with a valid & unexpired signature
+// -------------------------------------------------------------------------------------
+
+const DownloadPath = "/files/"
+
+// url downloading the file until the ttl expires (STORAGE_URL_TTL when 0)
+func SignedURL(key string, ttl time.Duration) (string, time.Time) {
+	c := config.Get().Storage
+	if ttl <= 0 {
+		ttl = c.URLTTL
+	}
+
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("signature", sign(key, expires.Unix()))
+
+	return strings.TrimSuffix(c.URL, "/") + DownloadPath + key + "?" + q.Encode(), expires
+}
+
+func sign(key string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(config.Get().Storage.SigningSecret))
+	mac.Write([]byte(key + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func verify(key string, q url.Values) error {
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil {
+		return errors.New("invalid signature")
+	} else if time.Now().Unix() > expires {
+		return errors.New("expired url")
+	}
+
+	expected := sign(key, expires)
+	if !hmac.Equal([]byte(expected), []byte(q.Get("signature"))) {
+		return errors.New("invalid signature")
+	}
+
+	return nil
+}
+
+// serve files downloaded with signed urls, mounted on DownloadPath
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.SecurityHeaders(w)
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		key := strings.TrimPrefix(r.URL.Path, DownloadPath)
+		if err := verify(key, r.URL.Query()); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		f, o, err := Open(r.Context(), key)
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "file not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			logger.Report(r.Context(), err, "Could not open file", "key", key)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		defer f.Close()
+
+		h := w.Header()
+		h.Set("Content-Type", o.ContentType)
+		h.Set("Content-Length", strconv.FormatInt(o.Size, 10))
+		h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(key)}))
+		h.Set("Cache-Control", "private, no-store")
+
+		if o.ContentType == "" {
+			h.Set("Content-Type", "application/octet-stream")
+		}
+
+		if r.Method == http.MethodHead {
+			return
+		}
+
+		io.Copy(w, f)
+	})
+}
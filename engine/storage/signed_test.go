@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"neodeliver.com/engine/config"
+)
+
+func TestSignedURL(t *testing.T) {
+	c, err := config.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Storage.SigningSecret = strings.Repeat("s", 32)
+	config.Set(c)
+	SetStorage(NewMemory())
+	defer func() {
+		config.Set(nil)
+		SetStorage(nil)
+	}()
+
+	for _, key := range []string{"exports/org_a/exp_1.csv", "exports/org_b/exp_2.csv"} {
+		if _, err := Put(context.Background(), key, strings.NewReader("id\n"), "text/csv"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get := func(u string) int {
+		w := httptest.NewRecorder()
+		Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, u, nil))
+		return w.Code
+	}
+
+	valid, _ := SignedURL("exports/org_a/exp_1.csv", time.Minute)
+	if code := get(valid); code != http.StatusOK {
+		t.Errorf("valid url: status %d", code)
+	}
+
+	u, _ := url.Parse(valid)
+	q := u.Query()
+
+	// signature of another file
+	other := *u
+	other.Path = DownloadPath + "exports/org_b/exp_2.csv"
+	if code := get(other.String()); code != http.StatusForbidden {
+		t.Errorf("signature of another key: status %d, want 403", code)
+	}
+
+	// expiration extended without signing it again
+	tampered := *u
+	tq := url.Values{"signature": {q.Get("signature")}}
+	expires, _ := strconv.ParseInt(q.Get("expires"), 10, 64)
+	tq.Set("expires", strconv.FormatInt(expires+3600, 10))
+	tampered.RawQuery = tq.Encode()
+	if code := get(tampered.String()); code != http.StatusForbidden {
+		t.Errorf("tampered expiration: status %d, want 403", code)
+	}
+
+	tampered.RawQuery = url.Values{"expires": {q.Get("expires")}, "signature": {strings.Repeat("0", 64)}}.Encode()
+	if code := get(tampered.String()); code != http.StatusForbidden {
+		t.Errorf("tampered signature: status %d, want 403", code)
+	}
+
+	past := time.Now().Add(-time.Minute).Unix()
+	expired := *u
+	expired.RawQuery = url.Values{"expires": {strconv.FormatInt(past, 10)}, "signature": {sign("exports/org_a/exp_1.csv", past)}}.Encode()
+	if code := get(expired.String()); code != http.StatusForbidden {
+		t.Errorf("expired url: status %d, want 403", code)
+	}
+}
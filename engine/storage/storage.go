@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"neodeliver.com/engine/config"
+	"neodeliver.com/engine/db"
+)
+
+// File storage of uploads & exports, backed by mongodb (gridfs), a local directory or memory
+// files are downloaded through time limited signed urls served by the api
+// -------------------------------------------------------------------------------------
+
+var ErrNotFound = errors.New("file not found")
+
+type Object struct {
+	Key         string
+	Size        int64
+	ContentType string
+	CreatedAt   time.Time
+}
+
+type Storage interface {
+	// store the content of r, replacing any file with the same key
+	Put(ctx context.Context, key string, r io.Reader, contentType string) (Object, error)
+	// open the file, ErrNotFound when missing
+	Open(ctx context.Context, key string) (io.ReadCloser, Object, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	storage Storage
+	mu      sync.Mutex
+)
+
+// overwrite the storage, used by tests
+func SetStorage(s Storage) {
+	mu.Lock()
+	storage = s
+	mu.Unlock()
+}
+
+func current() Storage {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if storage == nil {
+		c := config.Get().Storage
+		switch {
+		case c.Backend == "memory" || db.InMemory():
+			storage = NewMemory()
+		case c.Backend == "local":
+			storage = NewLocal(c.Dir)
+		default:
+			storage = NewMongo("files")
+		}
+	}
+
+	return storage
+}
+
+func Put(ctx context.Context, key string, r io.Reader, contentType string) (Object, error) {
+	if !validKey(key) {
+		return Object{}, errors.New("invalid file key " + key)
+	}
+
+	return current().Put(ctx, key, r, contentType)
+}
+
+func Open(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	if !validKey(key) {
+		return nil, Object{}, ErrNotFound
+	}
+
+	return current().Open(ctx, key)
+}
+
+func Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return ErrNotFound
+	}
+
+	return current().Delete(ctx, key)
+}
+
+// keys are slash separated paths, without empty or relative segments
+func validKey(key string) bool {
+	if key == "" || len(key) > 512 {
+		return false
+	}
+
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, "\\\x00") {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/segmentio/ksuid"
+	"neodeliver.com/engine/logger"
+	"neodeliver.com/engine/rbac"
+	"neodeliver.com/engine/server"
+)
+
+// File uploads, referenced by their id in later mutations (eg: import_contacts)
+// -------------------------------------------------------------------------------------
+
+const UploadPrefixID = "upl_"
+
+type Upload struct {
+	ID   string `json:"id"`
+	Size int64  `json:"size"`
+}
+
+// storage key of an upload, uploads are only visible by their organization
+func UploadKey(organizationID, id string) string {
+	return "uploads/" + organizationID + "/" + id
+}
+
+// accept files posted either as the raw request body or as the "file" field of a multipart form
+func UploadHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.SecurityHeaders(w)
+		if server.CORS(w, r) {
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST, OPTIONS")
+			writeUploadError(w, http.StatusMethodNotAllowed, "uploads must be sent using POST requests")
+			return
+		}
+
+		auth, err := rbac.Load(r)
+		if err != nil || auth.OrganizationID == "" {
+			writeUploadError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		var tooLarge *http.MaxBytesError
+		body, contentType, err := uploadBody(r)
+		if errors.As(err, &tooLarge) {
+			writeUploadError(w, http.StatusRequestEntityTooLarge, "file too large")
+			return
+		} else if err != nil {
+			writeUploadError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		defer body.Close()
+
+		id := UploadPrefixID + ksuid.New().String()
+		o, err := Put(r.Context(), UploadKey(auth.OrganizationID, id), body, contentType)
+		if errors.As(err, &tooLarge) {
+			writeUploadError(w, http.StatusRequestEntityTooLarge, "file too large")
+			return
+		} else if err != nil {
+			logger.Report(r.Context(), err, "Could not store upload")
+			writeUploadError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(Upload{ID: id, Size: o.Size})
+	})
+}
+
+func uploadBody(r *http.Request) (io.ReadCloser, string, error) {
+	contentType := r.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "multipart/form-data") {
+		return r.Body, contentType, nil
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, "", errors.New("missing file field")
+		} else if err != nil {
+			return nil, "", err
+		}
+
+		if part.FormName() == "file" {
+			return part, part.Header.Get("Content-Type"), nil
+		}
+
+		part.Close()
+	}
+}
+
+func writeUploadError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []interface{}{map[string]interface{}{"message": message}},
+	})
+}
@@ -0,0 +1,51 @@
+package tracing
+
+import (
+	"github.com/graphql-go/graphql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// create a span for each resolved field, mounted on the schema builder with Use
+func Resolvers(next graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		field := p.Info.FieldName
+		if p.Info.ParentType != nil {
+			field = p.Info.ParentType.Name() + "." + field
+		}
+
+		ctx, span := Tracer.Start(p.Context, "graphql.resolve "+field, trace.WithAttributes(
+			attribute.String("graphql.field.name", p.Info.FieldName),
+			attribute.String("graphql.field.path", pathString(p.Info.Path)),
+		))
+
+		defer span.End()
+
+		p.Context = ctx
+		res, err := next(p)
+		Error(span, err)
+
+		return res, err
+	}
+}
+
+func pathString(p *graphql.ResponsePath) string {
+	if p == nil {
+		return ""
+	}
+
+	res := ""
+	for _, k := range p.AsArray() {
+		if s, ok := k.(string); ok {
+			if res != "" {
+				res += "."
+			}
+
+			res += s
+		} else {
+			res += "[]"
+		}
+	}
+
+	return res
+}
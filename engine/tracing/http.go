@@ -0,0 +1,63 @@
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"neodeliver.com/engine/logger"
+)
+
+// http client creating a span for each outbound request & propagating the trace context
+var HTTPClient = &http.Client{
+	Transport: Transport(http.DefaultTransport),
+}
+
+func Transport(next http.RoundTripper) http.RoundTripper {
+	return transport{next: next}
+}
+
+type transport struct {
+	next http.RoundTripper
+}
+
+func (t transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := Tracer.Start(req.Context(), "http "+req.Method+" "+req.URL.Host, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.HTTPRequestMethodKey.String(req.Method),
+		semconv.ServerAddress(req.URL.Hostname()),
+		semconv.URLPath(req.URL.Path),
+	))
+
+	defer span.End()
+
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		Error(span, err)
+		return res, err
+	}
+
+	span.SetAttributes(semconv.HTTPResponseStatusCode(res.StatusCode))
+	if res.StatusCode >= 500 {
+		Error(span, fmt.Errorf("http status %d", res.StatusCode))
+	}
+
+	return res, nil
+}
+
+// flush the spans of each request before answering
+// serverless instances are frozen between requests & stopped without shutdown hook, buffered spans would be lost
+func Flushing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		if err := Flush(r.Context()); err != nil {
+			logger.Report(r.Context(), err, "Failed to flush traces")
+		}
+	})
+}
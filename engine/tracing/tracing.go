@@ -0,0 +1,104 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"neodeliver.com/engine/config"
+	"neodeliver.com/engine/db"
+)
+
+// OpenTelemetry tracing of http requests, graphql resolvers, mongodb commands & outbound calls
+// -------------------------------------------------------------------------------------
+
+const instrumentation = "neodeliver.com"
+
+// tracer used by all our spans, the global provider is used once configured by Init
+var Tracer = otel.Tracer(instrumentation)
+
+// Configure the tracer provider & W3C trace context propagation
+// the otlp exporter is configured by the standard OTEL_EXPORTER_OTLP_* env variables
+func Init(ctx context.Context, service string, c config.Tracing) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch e := c.Exporter; e {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter: %s", e)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(service),
+	))
+
+	if err != nil {
+		return nil, err
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// provider configured by Init, nil when tracing is disabled
+var provider *sdktrace.TracerProvider
+
+// export the spans buffered by the batcher
+func Flush(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+
+	return provider.ForceFlush(ctx)
+}
+
+// mongodb monitors are shared by all schemas (modules.Build is called by each test)
+var monitorOnce sync.Once
+
+// trace mongodb commands, graphql resolvers being traced by mounting the Resolvers middleware
+// (engine/graphql traces requests with Tracer & can't be imported)
+func Instrument() {
+	monitorOnce.Do(func() {
+		db.Monitor(commandMonitor(), nil)
+	})
+}
+
+// ---
+
+// mark span as failed
+func Error(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -2,12 +2,32 @@
 package graphql
 
 import (
+	"context"
+
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
-	"neodeliver.com/engine/graphql"
+	"neodeliver.com/engine/config"
+	"neodeliver.com/engine/logger"
+	"neodeliver.com/engine/tracing"
 	"neodeliver.com/modules"
 )
 
 func init() {
-	instance := modules.Build()
-	functions.HTTP("GraphQL", graphql.Route(instance))
+	cfg, err := config.Load()
+	if err != nil {
+		panic(err)
+	}
+
+	if err := logger.Init(cfg.Log); err != nil {
+		panic(err)
+	}
+
+	logger.Root().Info("Loaded configuration", cfg.Redacted()...)
+	// functions have no shutdown hook, spans are flushed after each request instead
+	if _, err := tracing.Init(context.Background(), "neodeliver-api", cfg.Tracing); err != nil {
+		panic(err)
+	}
+
+	// instances are frozen between requests: enqueued jobs are only persisted, executed by Cloud Scheduler calling jobs.TriggerPath
+	handler := tracing.Flushing(modules.Server(cfg).Handler())
+	functions.HTTP("GraphQL", handler.ServeHTTP)
 }
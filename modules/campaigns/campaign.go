@@ -1,11 +1,149 @@
 package campaigns
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/segmentio/ksuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"neodeliver.com/engine/db"
+	ggraphql "neodeliver.com/engine/graphql"
+	"neodeliver.com/engine/rbac"
+	"neodeliver.com/modules/contacts"
+	"neodeliver.com/modules/settings"
+)
+
+const CampaignPrefixID = "cmp_"
 
 type Campaign struct {
-	ID             string `bson:"_id"`
-	OrganizationID string `json:"organization_id"`
-	Transactional  bool
-	Draft          bool
-	CreatedAt      time.Time `json:"created_at"`
+	ID             string    `bson:"_id" json:"id"`
+	OrganizationID string    `bson:"organization_id" json:"organization_id"`
+	Transactional  bool      `bson:"transactional" json:"transactional"`
+	Draft          bool      `bson:"draft" json:"draft"`
+	Channel        string    `bson:"channel" json:"channel"`   // email, sms or notifications
+	Category       *string   `bson:"category" json:"category"` // communication category, required by marketing campaigns which are only sent to contacts consenting to it
+	CreatedAt      time.Time `bson:"created_at" json:"created_at"`
+}
+
+func (Campaign) GraphqlMethods() []string {
+	return []string{"RecipientsCount"}
+}
+
+// mongodb filter of the contacts receiving the campaign
+func (c Campaign) Recipients() bson.M {
+	return contacts.RecipientsQuery(c.OrganizationID, c.Channel, c.Category, c.Transactional)
+}
+
+// contacts the campaign would be sent to now
+func (c Campaign) RecipientsCount(p graphql.ResolveParams) (int64, error) {
+	return db.Coll("contacts").Count(p.Context, c.Recipients())
+}
+
+type CreateCampaign struct {
+	Channel       string  `json:"channel" validate:"oneof=email sms notifications"`
+	Category      *string `json:"category"`      // key of a communication category of the contact settings, required unless transactional
+	Transactional *bool   `json:"transactional"` // false by default
+}
+
+type CampaignData struct {
+	Channel       *string `bson:"channel" json:"channel" validate:"omitempty,oneof=email sms notifications"`
+	Category      *string `bson:"category" json:"category"`
+	Transactional *bool   `bson:"transactional" json:"transactional"`
+}
+
+type UpdateCampaign struct {
+	ID   string
+	Data CampaignData `json:"data"`
+}
+
+// create a draft campaign targeting the contacts consenting to its category on its channel
+func (Mutation) CreateCampaign(p graphql.ResolveParams, rbac rbac.RBAC, args CreateCampaign) (Campaign, error) {
+	c := Campaign{
+		ID:             CampaignPrefixID + ksuid.New().String(),
+		OrganizationID: rbac.OrganizationID,
+		Transactional:  args.Transactional != nil && *args.Transactional,
+		Draft:          true,
+		Channel:        args.Channel,
+		Category:       args.Category,
+		CreatedAt:      time.Now(),
+	}
+
+	if err := c.validate(); err != nil {
+		return c, err
+	} else if err := verifyCategory(p, rbac.OrganizationID, c.Category); err != nil {
+		return c, err
+	}
+
+	err := db.Coll("campaigns").InsertOne(p.Context, c)
+	return c, err
+}
+
+// change the channel or category of a draft campaign
+func (Mutation) UpdateCampaign(p graphql.ResolveParams, rbac rbac.RBAC, args UpdateCampaign) (Campaign, error) {
+	// only update the fields that were passed in params
+	data := ggraphql.ArgToBson(p.Args["data"], args.Data)
+	if len(data) == 0 {
+		return Campaign{}, errors.New("no data to update")
+	}
+
+	if err := verifyCategory(p, rbac.OrganizationID, args.Data.Category); err != nil {
+		return Campaign{}, err
+	}
+
+	// the updated campaign must still have a category unless it is transactional
+	c := Campaign{}
+	filter := bson.M{"_id": args.ID, "organization_id": rbac.OrganizationID, "draft": true}
+	err := db.Coll("campaigns").FindOne(p.Context, filter, &c)
+	if errors.Is(err, db.ErrNoDocuments) {
+		return c, errors.New("The campaign does not exist or was already sent")
+	} else if err != nil {
+		return c, err
+	}
+
+	// only update if both fields were not changed in the meantime
+	filter["transactional"], filter["category"] = c.Transactional, c.Category
+	if _, ok := data["category"]; ok {
+		c.Category = args.Data.Category
+	}
+
+	if args.Data.Transactional != nil {
+		c.Transactional = *args.Data.Transactional
+	}
+
+	if err := c.validate(); err != nil {
+		return c, err
+	}
+
+	err = db.Coll("campaigns").FindOneAndUpdate(p.Context, filter, bson.M{"$set": data}, false, &c)
+	if errors.Is(err, db.ErrNoDocuments) {
+		return c, errors.New("The campaign does not exist or was already sent")
+	}
+
+	return c, err
+}
+
+func (c Campaign) validate() error {
+	if !c.Transactional && c.Category == nil {
+		return errors.New("Marketing campaigns require a communication category")
+	}
+
+	return nil
+}
+
+// verify the category is configured by the organization
+func verifyCategory(p graphql.ResolveParams, organizationID string, category *string) error {
+	if category == nil {
+		return nil
+	}
+
+	s, err := settings.LoadContactSettings(p.Context, organizationID)
+	if err != nil {
+		return err
+	} else if s.Category(*category) == nil {
+		return fmt.Errorf("The communication category %s does not exist", *category)
+	}
+
+	return nil
 }
@@ -0,0 +1,94 @@
+package campaigns_test
+
+import (
+	"testing"
+
+	"neodeliver.com/modules/graphqltest"
+)
+
+type campaign struct {
+	ID              string `json:"id"`
+	Channel         string `json:"channel"`
+	Category        string `json:"category"`
+	RecipientsCount int    `json:"recipients_count"`
+}
+
+func TestCampaignRecipients(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	ids := []string{}
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		res := struct {
+			AddContact struct {
+				ID string `json:"id"`
+			} `json:"add_contact"`
+		}{}
+
+		c.Exec(`mutation($email: String) { add_contact(email: $email) { id } }`, map[string]interface{}{"email": email}, &res)
+		ids = append(ids, res.AddContact.ID)
+	}
+
+	c.Exec(`mutation($id: String!) { set_contact_consents(id: $id, consents: [{channel: "email", category: "newsletter", granted: true}]) { id } }`, map[string]interface{}{"id": ids[0]}, nil)
+
+	if r := c.Do(`mutation { create_campaign(channel: "email", category: "unknown") { id } }`, nil); len(r.Errors) == 0 {
+		t.Error("campaign created with an unknown category")
+	} else if r := c.Do(`mutation { create_campaign(channel: "email") { id } }`, nil); len(r.Errors) == 0 {
+		t.Error("marketing campaign created without category")
+	}
+
+	res := struct {
+		CreateCampaign campaign `json:"create_campaign"`
+	}{}
+
+	c.Exec(`mutation { create_campaign(channel: "email", category: "newsletter") { id channel category recipients_count } }`, nil, &res)
+	if res.CreateCampaign.RecipientsCount != 1 {
+		t.Errorf("newsletter campaign sent to %d contacts, want the consenting one", res.CreateCampaign.RecipientsCount)
+	}
+
+	update := struct {
+		UpdateCampaign campaign `json:"update_campaign"`
+	}{}
+
+	c.Exec(`mutation($id: String!) { update_campaign(id: $id, data: {transactional: true}) { category recipients_count } }`, map[string]interface{}{"id": res.CreateCampaign.ID}, &update)
+	if update.UpdateCampaign.Category != "newsletter" || update.UpdateCampaign.RecipientsCount != 2 {
+		t.Errorf("transactional campaign %+v, want newsletter sent to 2 contacts", update.UpdateCampaign)
+	}
+
+	// transactional campaigns don't require a category, marketing ones do
+	c.Exec(`mutation { create_campaign(channel: "email", transactional: true) { id } }`, nil, &res)
+	if r := c.Do(`mutation($id: String!) { update_campaign(id: $id, data: {transactional: false}) { id } }`, map[string]interface{}{"id": res.CreateCampaign.ID}); len(r.Errors) == 0 {
+		t.Error("campaign updated to marketing without category")
+	}
+
+	c.Exec(`mutation($id: String!) { update_campaign(id: $id, data: {transactional: false, category: "newsletter"}) { id } }`, map[string]interface{}{"id": res.CreateCampaign.ID}, nil)
+}
+
+func TestCampaignWithoutCategory(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		res := struct {
+			AddContact struct {
+				ID string `json:"id"`
+			} `json:"add_contact"`
+		}{}
+
+		c.Exec(`mutation($email: String) { add_contact(email: $email) { id } }`, map[string]interface{}{"email": email}, &res)
+		if email == "a@example.com" {
+			c.Exec(`mutation($id: String!) { set_contact_consents(id: $id, consents: [{channel: "email", category: "newsletter", granted: true}]) { id } }`, map[string]interface{}{"id": res.AddContact.ID}, nil)
+		}
+	}
+
+	// campaigns created before categories were required are only sent to contacts consenting on the channel
+	err := c.DB.Collection("campaigns").InsertOne(c.Context(), map[string]interface{}{"_id": "cmp_old", "organization_id": "org_test", "channel": "email", "draft": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := struct {
+		Campaign campaign `json:"campaign"`
+	}{}
+
+	c.Exec(`{ campaign(id: "cmp_old") { recipients_count } }`, nil, &res)
+	if res.Campaign.RecipientsCount != 1 {
+		t.Errorf("campaign without category sent to %d contacts, want the consenting one", res.Campaign.RecipientsCount)
+	}
+}
@@ -20,4 +20,12 @@ func Init(s *graphql.Builder) {
 			"organization_id": r.OrganizationID,
 		}
 	})
+
+	// operations of api keys
+	rbac.RegisterScope("campaigns:read", "campaign", "campaigns")
+	rbac.RegisterScope("campaigns:write", "create_campaign", "update_campaign")
+
+	s.AddMutationMethods(Mutation{})
 }
+
+type Mutation struct{}
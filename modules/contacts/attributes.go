@@ -0,0 +1,326 @@
+package contacts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/segmentio/ksuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"neodeliver.com/engine/db"
+	ggraphql "neodeliver.com/engine/graphql"
+	"neodeliver.com/engine/graphql/scalars"
+	"neodeliver.com/engine/rbac"
+)
+
+// Custom attributes of contacts, typed by definitions of the organization (contact_attributes collection)
+// values are stored in contacts.attributes by key
+// -------------------------------------------------------------------------------------
+
+const ContactAttributePrefixID = "att_"
+
+const (
+	attributesMax     = 100
+	attributeMaxChars = 1024
+)
+
+type ContactAttribute struct {
+	ID             string    `bson:"_id" json:"id"`
+	OrganizationID string    `bson:"organization_id" json:"organization_id"`
+	Key            string    `bson:"key" json:"key"`
+	Type           string    `bson:"type" json:"type"` // STRING, NUMBER, BOOLEAN, DATE or ENUM
+	Name           *string   `bson:"name" json:"name"`
+	Options        []string  `bson:"options" json:"options"` // values of ENUM attributes
+	CreatedAt      time.Time `bson:"created_at" json:"created_at"`
+}
+
+type CreateContactAttribute struct {
+	Key     string   `validate:"required"` // lower case letters, digits & _ (eg: loyalty_tier)
+	Type    string   `validate:"oneof=STRING NUMBER BOOLEAN DATE ENUM"`
+	Name    *string  `validate:"omitempty,max=100"`
+	Options []string `validate:"max=100,dive,required,max=100"`
+}
+
+type UpdateContactAttribute struct {
+	ID      string
+	Name    *string  `validate:"omitempty,max=100"`
+	Options []string `validate:"max=100,dive,required,max=100"`
+}
+
+// custom attribute values by key, exposed as json
+type Attributes map[string]interface{}
+
+func (Attributes) GraphqlType() graphql.Output {
+	return scalars.JSON
+}
+
+func (Mutation) CreateContactAttribute(p graphql.ResolveParams, rbac rbac.RBAC, args CreateContactAttribute) (ContactAttribute, error) {
+	a := ContactAttribute{
+		ID:             ContactAttributePrefixID + ksuid.New().String(),
+		OrganizationID: rbac.OrganizationID,
+		Key:            args.Key,
+		Type:           args.Type,
+		Name:           args.Name,
+		Options:        uniqueStrings(args.Options),
+		CreatedAt:      time.Now(),
+	}
+
+	if !attributeKeyRegex.MatchString(a.Key) {
+		return a, errors.New("Attribute keys must start with a letter & only contain lower case letters, digits & _")
+	} else if err := a.validate(); err != nil {
+		return a, err
+	}
+
+	defs, err := attributeDefinitions(p.Context, rbac.OrganizationID)
+	if err != nil {
+		return a, err
+	} else if _, ok := defs[a.Key]; ok {
+		return a, errors.New("The attribute already exists")
+	} else if len(defs) >= attributesMax {
+		return a, fmt.Errorf("Organizations can't define more than %d attributes", attributesMax)
+	}
+
+	// keys are unique by organization (contacts.migrate_attributes_index), concurrent creations failing
+	err = db.Coll("contact_attributes").InsertOne(p.Context, a)
+	if mongo.IsDuplicateKeyError(err) {
+		return a, errors.New("The attribute already exists")
+	}
+
+	return a, err
+}
+
+// update the name or options of an attribute, its key & type can't change
+// options still set on contacts can't be removed
+func (Mutation) UpdateContactAttribute(p graphql.ResolveParams, rbac rbac.RBAC, args UpdateContactAttribute) (ContactAttribute, error) {
+	a := ContactAttribute{}
+	err := db.Coll("contact_attributes").FindOne(p.Context, bson.M{"_id": args.ID, "organization_id": rbac.OrganizationID}, &a)
+	if errors.Is(err, db.ErrNoDocuments) {
+		return a, errors.New("The attribute does not exist")
+	} else if err != nil {
+		return a, err
+	}
+
+	set := bson.M{}
+	if args.Name != nil {
+		a.Name, set["name"] = args.Name, *args.Name
+	}
+
+	removed := []string{}
+	if args.Options != nil {
+		options := uniqueStrings(args.Options)
+		for _, o := range a.Options {
+			if !slices.Contains(options, o) {
+				removed = append(removed, o)
+			}
+		}
+
+		a.Options = options
+		set["options"] = a.Options
+	}
+
+	if err := a.validate(); err != nil {
+		return a, err
+	} else if len(set) == 0 {
+		return a, errors.New("no data to update")
+	}
+
+	if len(removed) > 0 {
+		n, err := db.Coll("contacts").Count(p.Context, bson.M{"organization_id": rbac.OrganizationID, "attributes." + a.Key: bson.M{"$in": removed}})
+		if err != nil {
+			return a, err
+		} else if n > 0 {
+			return a, fmt.Errorf("The options %s are still set on %d contacts", strings.Join(removed, ", "), n)
+		}
+	}
+
+	_, err = db.Coll("contact_attributes").UpdateMany(p.Context, bson.M{"_id": a.ID, "organization_id": rbac.OrganizationID}, bson.M{"$set": set})
+	return a, err
+}
+
+// delete an attribute & its values
+func (Mutation) DeleteContactAttribute(p graphql.ResolveParams, rbac rbac.RBAC, args ggraphql.ByID) (bool, error) {
+	a := ContactAttribute{}
+	err := db.Coll("contact_attributes").FindOne(p.Context, bson.M{"_id": args.ID, "organization_id": rbac.OrganizationID}, &a)
+	if errors.Is(err, db.ErrNoDocuments) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if _, err := db.Coll("contact_attributes").DeleteOne(p.Context, bson.M{"_id": a.ID, "organization_id": rbac.OrganizationID}); err != nil {
+		return false, err
+	}
+
+	key := "attributes." + a.Key
+	_, err = db.Coll("contacts").UpdateMany(p.Context, bson.M{"organization_id": rbac.OrganizationID, key: bson.M{"$exists": true}}, bson.M{"$unset": bson.M{key: ""}})
+	return true, err
+}
+
+// ---
+
+func (a ContactAttribute) validate() error {
+	if a.Type == "ENUM" && len(a.Options) == 0 {
+		return errors.New("ENUM attributes require options")
+	} else if a.Type != "ENUM" && len(a.Options) > 0 {
+		return errors.New("Only ENUM attributes have options")
+	}
+
+	return nil
+}
+
+// attribute definitions of the organization by key
+func attributeDefinitions(ctx context.Context, organizationID string) (map[string]ContactAttribute, error) {
+	list := []ContactAttribute{}
+	err := db.Coll("contact_attributes").Find(ctx, bson.M{"organization_id": organizationID}, &list, db.FindOptions{})
+
+	res := map[string]ContactAttribute{}
+	for _, a := range list {
+		res[a.Key] = a
+	}
+
+	return res, err
+}
+
+// validate & convert the values to the types of their attributes, nil values being kept to unset attributes
+func coerceAttributes(defs map[string]ContactAttribute, values Attributes) (Attributes, error) {
+	if values == nil {
+		return nil, nil
+	}
+
+	res := Attributes{}
+	for key, v := range values {
+		a, ok := defs[key]
+		if !ok {
+			return nil, fmt.Errorf("The attribute %s does not exist", key)
+		}
+
+		value, err := a.parse(v)
+		if err != nil {
+			return nil, err
+		}
+
+		res[key] = value
+	}
+
+	return res, nil
+}
+
+// value of the attribute from a json value or a csv cell
+func (a ContactAttribute) parse(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	invalid := func(kind string) error {
+		return fmt.Errorf("The attribute %s must be %s", a.Key, kind)
+	}
+
+	s, isString := v.(string)
+	switch a.Type {
+	case "NUMBER":
+		switch t := v.(type) {
+		case float64:
+			return t, nil
+		case int:
+			return float64(t), nil
+		case int32:
+			return float64(t), nil
+		case int64:
+			return float64(t), nil
+		}
+
+		if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); isString && err == nil {
+			return f, nil
+		}
+
+		return nil, invalid("a number")
+	case "BOOLEAN":
+		if b, ok := v.(bool); ok {
+			return b, nil
+		} else if b, err := strconv.ParseBool(strings.TrimSpace(s)); isString && err == nil {
+			return b, nil
+		}
+
+		return nil, invalid("a boolean")
+	case "DATE":
+		switch t := v.(type) {
+		case time.Time:
+			return t, nil
+		case primitive.DateTime:
+			return t.Time(), nil
+		}
+
+		for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+			if d, err := time.Parse(layout, strings.TrimSpace(s)); isString && err == nil {
+				return d, nil
+			}
+		}
+
+		return nil, invalid("a date (YYYY-MM-DD or RFC 3339)")
+	case "ENUM":
+		for _, o := range a.Options {
+			if isString && o == s {
+				return s, nil
+			}
+		}
+
+		return nil, invalid("one of " + strings.Join(a.Options, ", "))
+	default:
+		if !isString || len(s) > attributeMaxChars {
+			return nil, invalid(fmt.Sprintf("a string of at most %d characters", attributeMaxChars))
+		}
+
+		return s, nil
+	}
+}
+
+// validate & convert the values set by a mutation
+func contactAttributes(ctx context.Context, organizationID string, values Attributes) (Attributes, error) {
+	if values == nil {
+		return nil, nil
+	}
+
+	defs, err := attributeDefinitions(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	return coerceAttributes(defs, values)
+}
+
+// attributes without the nil values, which only unset attributes on updates
+func definedAttributes(values Attributes) Attributes {
+	if values == nil {
+		return nil
+	}
+
+	res := Attributes{}
+	for k, v := range values {
+		if v != nil {
+			res[k] = v
+		}
+	}
+
+	return res
+}
+
+// $set & $unset fields of the attributes, by key
+func attributeFields(values Attributes) (bson.M, bson.M) {
+	set, unset := bson.M{}, bson.M{}
+	for k, v := range values {
+		if v == nil {
+			unset["attributes."+k] = ""
+		} else {
+			set["attributes."+k] = v
+		}
+	}
+
+	return set, unset
+}
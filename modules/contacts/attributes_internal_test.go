@@ -0,0 +1,77 @@
+package contacts
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAttribute(t *testing.T) {
+	date := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		kind    string
+		value   interface{}
+		want    interface{}
+		invalid bool
+	}{
+		{"NUMBER", 12.5, 12.5, false},
+		{"NUMBER", int64(3), 3.0, false},
+		{"NUMBER", " 12.5 ", 12.5, false},
+		{"NUMBER", "twelve", nil, true},
+		{"NUMBER", true, nil, true},
+		{"BOOLEAN", true, true, false},
+		{"BOOLEAN", "false", false, false},
+		{"BOOLEAN", "yes", nil, true},
+		{"DATE", "2024-03-01", date, false},
+		{"DATE", "2024-03-01T00:00:00Z", date, false},
+		{"DATE", date, date, false},
+		{"DATE", "01/03/2024", nil, true},
+		{"ENUM", "gold", "gold", false},
+		{"ENUM", "bronze", nil, true},
+		{"STRING", "text", "text", false},
+		{"STRING", 12, nil, true},
+		{"STRING", strings.Repeat("a", attributeMaxChars+1), nil, true},
+		{"STRING", nil, nil, false},
+	}
+
+	for _, tt := range tests {
+		a := ContactAttribute{Key: "field", Type: tt.kind}
+		if tt.kind == "ENUM" {
+			a.Options = []string{"silver", "gold"}
+		}
+
+		got, err := a.parse(tt.value)
+		if tt.invalid != (err != nil) {
+			t.Errorf("%s %#v: error %v, want invalid %v", tt.kind, tt.value, err, tt.invalid)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %#v: got %#v, want %#v", tt.kind, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCoerceAttributes(t *testing.T) {
+	defs := map[string]ContactAttribute{
+		"score": {Key: "score", Type: "NUMBER"},
+		"tier":  {Key: "tier", Type: "ENUM", Options: []string{"silver", "gold"}},
+	}
+
+	got, err := coerceAttributes(defs, Attributes{"score": "7", "tier": nil})
+	if err != nil {
+		t.Fatal(err)
+	} else if want := (Attributes{"score": 7.0, "tier": nil}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v (nil values unset attributes)", got, want)
+	}
+
+	if _, err := coerceAttributes(defs, Attributes{"unknown": "x"}); err == nil || err.Error() != "The attribute unknown does not exist" {
+		t.Errorf("undefined attribute: got %v", err)
+	}
+
+	if _, err := coerceAttributes(defs, Attributes{"tier": "bronze"}); err == nil {
+		t.Error("invalid enum value accepted")
+	}
+
+	if got, err := coerceAttributes(defs, nil); got != nil || err != nil {
+		t.Errorf("nil attributes: got %#v %v, want nil", got, err)
+	}
+}
@@ -0,0 +1,182 @@
+package contacts_test
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"neodeliver.com/modules/graphqltest"
+)
+
+func createAttribute(c *graphqltest.Client, key, kind string, options []string) string {
+	res := struct {
+		CreateContactAttribute struct {
+			ID string `json:"id"`
+		} `json:"create_contact_attribute"`
+	}{}
+
+	c.Exec(`mutation($key: String!, $type: String!, $options: [String!]) { create_contact_attribute(key: $key, type: $type, options: $options) { id } }`, map[string]interface{}{
+		"key":     key,
+		"type":    kind,
+		"options": options,
+	}, &res)
+
+	return res.CreateContactAttribute.ID
+}
+
+func addContactAttributes(c *graphqltest.Client, email string, attributes map[string]interface{}) string {
+	res := struct {
+		AddContact contact `json:"add_contact"`
+	}{}
+
+	c.Exec(`mutation($email: String, $attributes: JSON) { add_contact(email: $email, attributes: $attributes) { id } }`, map[string]interface{}{
+		"email":      email,
+		"attributes": attributes,
+	}, &res)
+
+	return res.AddContact.ID
+}
+
+func TestAttributeRules(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	createAttribute(c, "score", "NUMBER", nil)
+	createAttribute(c, "tier", "ENUM", []string{"silver", "gold"})
+	createAttribute(c, "renewal", "DATE", nil)
+
+	addContactAttributes(c, "a@example.com", map[string]interface{}{"score": 12, "tier": "gold", "renewal": "2024-03-01"})
+	addContactAttributes(c, "b@example.com", map[string]interface{}{"score": "3.5", "tier": "silver"})
+	addContact(c, "c@example.com")
+
+	// values are validated against their definition
+	c.Error(`mutation { add_contact(email: "d@example.com", attributes: {tier: "bronze"}) { id } }`, nil)
+
+	tests := []struct {
+		condition string
+		want      int
+	}{
+		{`{ field: "attribute", attribute: "score", operator: "GT", number: 5 }`, 1},
+		{`{ field: "attribute", attribute: "score", operator: "LTE", number: 12 }`, 2},
+		{`{ field: "attribute", attribute: "tier", operator: "IN", values: ["silver", "gold"] }`, 2},
+		{`{ field: "attribute", attribute: "tier", operator: "EQ", value: "gold" }`, 1},
+		{`{ field: "attribute", attribute: "renewal", operator: "LT", date: "2024-06-01T00:00:00Z" }`, 1},
+		{`{ field: "attribute", attribute: "renewal", operator: "NOT_EXISTS" }`, 2},
+	}
+
+	for _, tt := range tests {
+		res := struct {
+			PreviewSegment struct {
+				ContactsCount int `json:"contacts_count"`
+			} `json:"preview_segment"`
+		}{}
+
+		c.Exec(`{ preview_segment(rules: { operator: "AND", conditions: [`+tt.condition+`] }) { contacts_count } }`, nil, &res)
+		if n := res.PreviewSegment.ContactsCount; n != tt.want {
+			t.Errorf("%s matched %d contacts, want %d", tt.condition, n, tt.want)
+		}
+	}
+
+	// operators are checked against the type of the attribute, & attributes must exist
+	for _, condition := range []string{
+		`{ field: "attribute", attribute: "score", operator: "CONTAINS", value: "1" }`,
+		`{ field: "attribute", attribute: "unknown", operator: "EXISTS" }`,
+	} {
+		c.Error(`{ preview_segment(rules: { operator: "AND", conditions: [`+condition+`] }) { contacts_count } }`, nil)
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	createAttribute(c, "tier", "ENUM", []string{"silver", "gold"})
+	id := addContactAttributes(c, "a@example.com", map[string]interface{}{"tier": "gold"})
+
+	c.Exec(`mutation($id: String!) { update_contact(id: $id, data: { given_name: "Jane", last_name: "Doe" }) { id } }`, map[string]interface{}{"id": id}, nil)
+	res := struct {
+		Contact struct {
+			MergeTags map[string]interface{} `json:"merge_tags"`
+		} `json:"contact"`
+	}{}
+
+	c.Exec(`query($id: String!) { contact(id: $id) { merge_tags } }`, map[string]interface{}{"id": id}, &res)
+	tags := res.Contact.MergeTags
+	if tags["full_name"] != "Jane Doe" || tags["email"] != "a@example.com" || tags["id"] != id {
+		t.Errorf("merge tags %v, want the fields of the contact", tags)
+	}
+
+	// missing values are rendered as empty strings
+	if tags["phone_number"] != "" || tags["external_id"] != "" {
+		t.Errorf("merge tags %v, want empty missing fields", tags)
+	}
+
+	if attributes, _ := tags["attributes"].(map[string]interface{}); attributes["tier"] != "gold" {
+		t.Errorf("merge tags attributes %v, want the tier", tags["attributes"])
+	}
+
+	// null attributes are unset on updates
+	c.Exec(`mutation($id: String!, $attributes: JSON) { update_contact(id: $id, data: { attributes: $attributes }) { id } }`, map[string]interface{}{
+		"id":         id,
+		"attributes": map[string]interface{}{"tier": nil},
+	}, nil)
+	c.Exec(`query($id: String!) { contact(id: $id) { merge_tags } }`, map[string]interface{}{"id": id}, &res)
+	if attributes, _ := res.Contact.MergeTags["attributes"].(map[string]interface{}); len(attributes) != 0 {
+		t.Errorf("attributes %v, want the tier unset", attributes)
+	}
+}
+
+func TestRemoveAttributeOptions(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	id := createAttribute(c, "tier", "ENUM", []string{"silver", "gold", "platinum"})
+	addContactAttributes(c, "a@example.com", map[string]interface{}{"tier": "gold"})
+
+	update := `mutation($id: String!, $options: [String!]) { update_contact_attribute(id: $id, options: $options) { options } }`
+	r := c.Do(update, map[string]interface{}{"id": id, "options": []string{"silver"}})
+	if len(r.Errors) == 0 || r.Errors[0].Message != "The options gold, platinum are still set on 1 contacts" {
+		t.Errorf("removing a used option: got %v", r.Errors)
+	}
+
+	// unused options can be removed
+	res := struct {
+		UpdateContactAttribute struct {
+			Options []string `json:"options"`
+		} `json:"update_contact_attribute"`
+	}{}
+
+	c.Exec(update, map[string]interface{}{"id": id, "options": []string{"gold", "silver"}}, &res)
+	if o := res.UpdateContactAttribute.Options; len(o) != 2 {
+		t.Errorf("options %v, want gold & silver", o)
+	}
+}
+
+func TestAttributesIndexMigration(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	ctx := c.Context()
+	now := time.Now()
+
+	// definitions created twice by concurrent requests
+	for i, id := range []string{"att_b", "att_a", "att_c"} {
+		doc := bson.M{"_id": id, "organization_id": "org_test", "key": "tier", "type": "STRING", "created_at": now.Add(time.Duration(i) * time.Second)}
+		if id == "att_c" {
+			doc["key"] = "plan"
+		}
+
+		if err := c.DB.Collection("contact_attributes").InsertOne(ctx, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrate(t, c, "contacts.migrate_attributes_index")
+	res := struct {
+		ContactAttributes []struct {
+			ID string `json:"id"`
+		} `json:"contact_attributes"`
+	}{}
+
+	c.Exec(`{ contact_attributes { id } }`, nil, &res)
+	ids := map[string]bool{}
+	for _, a := range res.ContactAttributes {
+		ids[a.ID] = true
+	}
+
+	if len(ids) != 2 || !ids["att_b"] || !ids["att_c"] {
+		t.Errorf("attributes %v, want the oldest tier definition & the plan", ids)
+	}
+}
@@ -0,0 +1,659 @@
+package contacts
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/segmentio/ksuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"neodeliver.com/engine/db"
+	"neodeliver.com/engine/rbac"
+)
+
+// Bulk operations on contacts, selected by ids or by a filter
+// writes are batched with db.BulkWrite & keep the tags counters in sync with contact_tags
+// -------------------------------------------------------------------------------------
+
+const bulkBatchSize = 1000
+
+type BulkUpsertContacts struct {
+	Contacts []ContactData `json:"contacts" validate:"required,min=1,max=1000"`
+	TagIDs   []string      `json:"tag_ids" graphql:"tag_ids"`                            // assigned to every contact
+	Mode     *string       `json:"mode" validate:"omitempty,oneof=CREATE UPDATE UPSERT"` // UPSERT by default
+}
+
+// contacts selected by ids (at most 1000, with a result item each) or by filter
+type BulkContacts struct {
+	IDs    []string       `json:"ids" graphql:"ids" validate:"max=1000"`
+	Filter *ContactFilter `json:"filter"`
+}
+
+type BulkTags struct {
+	TagIDs []string       `json:"tag_ids" graphql:"tag_ids" validate:"required,min=1"`
+	IDs    []string       `json:"ids" graphql:"ids" validate:"max=1000"`
+	Filter *ContactFilter `json:"filter"`
+}
+
+type BulkStatus struct {
+	Status string         `json:"status" validate:"oneof=ACTIVE UNSUBSCRIBED BOUNCED COMPLAINED CLEANED"` // contacts only become PENDING with subscribe_contact
+	Reason *string        `json:"reason" validate:"omitempty,max=200"`                                    // recorded with the transitions
+	IDs    []string       `json:"ids" graphql:"ids" validate:"max=1000"`
+	Filter *ContactFilter `json:"filter"`
+}
+
+type BulkResult struct {
+	Total     int              `json:"total"`     // contacts given or matched by the filter
+	Succeeded int              `json:"succeeded"` // including unchanged contacts
+	Failed    int              `json:"failed"`
+	Items     []BulkItemResult `json:"items"` // in the order of the given contacts or ids, empty when selecting by filter
+}
+
+type BulkItemResult struct {
+	Index  int     `json:"index"`
+	ID     *string `json:"id"`
+	Status string  `json:"status"` // CREATED, UPDATED, UNCHANGED, SKIPPED, DELETED, NOT_FOUND or FAILED
+	Error  *string `json:"error"`
+}
+
+// create or update contacts, matched to existing contacts by external_id or email like imports
+func (Mutation) BulkUpsertContacts(p graphql.ResolveParams, rbac rbac.RBAC, args BulkUpsertContacts) (BulkResult, error) {
+	if err := verifyTags(p.Context, rbac.OrganizationID, args.TagIDs); err != nil {
+		return BulkResult{}, err
+	}
+
+	mode := "UPSERT"
+	if args.Mode != nil {
+		mode = *args.Mode
+	}
+
+	defs, err := attributeDefinitions(p.Context, rbac.OrganizationID)
+	if err != nil {
+		return BulkResult{}, err
+	}
+
+	rows := make([]importRow, len(args.Contacts))
+	invalid := map[int]string{}
+	for i, c := range args.Contacts {
+		rows[i] = importRow{row: i, data: c, tags: args.TagIDs}
+		if err := c.Validate(); err != nil {
+			rows[i].err = true
+			invalid[i] = err.Error()
+		} else if rows[i].data.Attributes, err = coerceAttributes(defs, c.Attributes); err != nil {
+			rows[i].err = true
+			invalid[i] = err.Error()
+		}
+	}
+
+	outcomes, err := upsertContacts(p.Context, rbac.OrganizationID, mode, rows, StatusActive, causeOf(rbac, "BULK"))
+	if err != nil {
+		return BulkResult{}, err
+	}
+
+	for i, message := range invalid {
+		outcomes[i] = bulkOutcome{status: "FAILED", err: message}
+	}
+
+	return newBulkResult(outcomes, true), nil
+}
+
+func (Mutation) BulkDeleteContacts(p graphql.ResolveParams, rbac rbac.RBAC, args BulkContacts) (BulkResult, error) {
+	return bulkSelection(p.Context, rbac.OrganizationID, args.IDs, args.Filter, func(page []Contact) (map[string]string, error) {
+		res := map[string]string{}
+		for _, c := range page {
+			res[c.ID] = "DELETED"
+		}
+
+		return res, deleteContacts(p.Context, rbac.OrganizationID, contactIDs(page))
+	})
+}
+
+func (Mutation) AssignTags(p graphql.ResolveParams, rbac rbac.RBAC, args BulkTags) (BulkResult, error) {
+	if err := verifyTags(p.Context, rbac.OrganizationID, args.TagIDs); err != nil {
+		return BulkResult{}, err
+	}
+
+	return bulkSelection(p.Context, rbac.OrganizationID, args.IDs, args.Filter, func(page []Contact) (map[string]string, error) {
+		tags := map[string][]string{}
+		for _, c := range page {
+			tags[c.ID] = args.TagIDs
+		}
+
+		added, err := assignTags(p.Context, rbac.OrganizationID, tags)
+		return changedStatuses(page, added), err
+	})
+}
+
+func (Mutation) UnassignTags(p graphql.ResolveParams, rbac rbac.RBAC, args BulkTags) (BulkResult, error) {
+	return bulkSelection(p.Context, rbac.OrganizationID, args.IDs, args.Filter, func(page []Contact) (map[string]string, error) {
+		removed, err := unassignTags(p.Context, rbac.OrganizationID, contactIDs(page), args.TagIDs)
+		return changedStatuses(page, removed), err
+	})
+}
+
+// contacts whose status can't change to the given status (eg: COMPLAINED to ACTIVE) are SKIPPED
+func (Mutation) SetContactsStatus(p graphql.ResolveParams, rbac rbac.RBAC, args BulkStatus) (BulkResult, error) {
+	cause := causeOf(rbac, "BULK")
+	cause.reason = args.Reason
+
+	return bulkSelection(p.Context, rbac.OrganizationID, args.IDs, args.Filter, func(page []Contact) (map[string]string, error) {
+		return transitionContacts(p.Context, rbac.OrganizationID, page, args.Status, cause)
+	})
+}
+
+// ---
+
+// result of a contact given to a bulk operation
+type bulkOutcome struct {
+	id     string
+	status string
+	err    string
+}
+
+func newBulkResult(outcomes []bulkOutcome, items bool) BulkResult {
+	res := BulkResult{Total: len(outcomes), Items: []BulkItemResult{}}
+	for i, o := range outcomes {
+		if o.status == "FAILED" || o.status == "NOT_FOUND" {
+			res.Failed++
+		} else {
+			res.Succeeded++
+		}
+
+		if !items {
+			continue
+		}
+
+		item := BulkItemResult{Index: i, Status: o.status}
+		if o.id != "" {
+			id := o.id
+			item.ID = &id
+		}
+
+		if o.err != "" {
+			message := o.err
+			item.Error = &message
+		}
+
+		res.Items = append(res.Items, item)
+	}
+
+	return res
+}
+
+// apply op to the selected contacts by pages, op returning the status of each contact of the page
+func bulkSelection(ctx context.Context, organizationID string, ids []string, filter *ContactFilter, op func(page []Contact) (map[string]string, error)) (BulkResult, error) {
+	statuses, aliases := map[string]string{}, map[string]string{}
+	err := selectContacts(ctx, organizationID, ids, filter, func(page []Contact) error {
+		res, err := op(page)
+		for id, status := range res {
+			statuses[id] = status
+		}
+
+		for _, c := range page {
+			for _, alias := range c.Aliases {
+				aliases[alias] = c.ID
+			}
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return BulkResult{}, err
+	}
+
+	if filter != nil {
+		outcomes := []bulkOutcome{}
+		for id, status := range statuses {
+			outcomes = append(outcomes, bulkOutcome{id: id, status: status})
+		}
+
+		return newBulkResult(outcomes, false), nil
+	}
+
+	outcomes := make([]bulkOutcome, len(ids))
+	for i, id := range ids {
+		outcomes[i] = bulkOutcome{id: id, status: statuses[id]}
+		if outcomes[i].status == "" {
+			// merged contacts report the status of their survivor
+			outcomes[i].status = statuses[aliases[id]]
+		}
+
+		if outcomes[i].status == "" {
+			outcomes[i].status = "NOT_FOUND"
+		}
+	}
+
+	return newBulkResult(outcomes, true), nil
+}
+
+// call fn with the contacts of the organization selected either by ids or by filter, by pages of bulkBatchSize contacts
+func selectContacts(ctx context.Context, organizationID string, ids []string, filter *ContactFilter, fn func(page []Contact) error) error {
+	if (len(ids) == 0) == (filter == nil) {
+		return errors.New("Either ids or filter must be set")
+	}
+
+	query := contactsByIDs(organizationID, ids)
+	if filter != nil {
+		q, err := filter.Query(ctx, organizationID)
+		if err != nil {
+			return err
+		}
+
+		query = q
+	}
+
+	return eachContacts(ctx, query, fn)
+}
+
+// call fn with the contacts matching query by pages of bulkBatchSize contacts
+// pages are read by id, contacts updated by fn may no longer match the query
+func eachContacts(ctx context.Context, query bson.M, fn func(page []Contact) error) error {
+	last := ""
+	for {
+		page := []Contact{}
+		q := query
+		if last != "" {
+			q = bson.M{"$and": []bson.M{query, {"_id": bson.M{"$gt": last}}}}
+		}
+
+		err := db.Coll("contacts").Find(ctx, q, &page, db.FindOptions{Sort: bson.D{{Key: "_id", Value: 1}}, Limit: bulkBatchSize})
+		if err != nil || len(page) == 0 {
+			return err
+		}
+
+		if err := fn(page); err != nil {
+			return err
+		}
+
+		last = page[len(page)-1].ID
+	}
+}
+
+// UPDATED for the contacts having changes, UNCHANGED otherwise
+func changedStatuses(page []Contact, changes map[string]int) map[string]string {
+	res := map[string]string{}
+	for _, c := range page {
+		res[c.ID] = "UNCHANGED"
+		if changes[c.ID] > 0 {
+			res[c.ID] = "UPDATED"
+		}
+	}
+
+	return res
+}
+
+func contactIDs(contacts []Contact) []string {
+	ids := make([]string, len(contacts))
+	for i, c := range contacts {
+		ids[i] = c.ID
+	}
+
+	return ids
+}
+
+// verify the tags belong to the organization
+func verifyTags(ctx context.Context, organizationID string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	n, err := db.Coll("tags").Count(ctx, bson.M{"organization_id": organizationID, "_id": bson.M{"$in": ids}})
+	if err != nil {
+		return err
+	} else if int(n) != len(uniqueStrings(ids)) {
+		return errors.New("Some tags do not exist within your organization")
+	}
+
+	return nil
+}
+
+// contact created or updated by one or more rows
+type upsertTarget struct {
+	id     string
+	create bool
+	data   ContactData
+	tags   map[string]bool
+	rows   []int // indexes of the rows
+}
+
+// create or update the contacts of the rows, then assign their tags (row.tags being tag ids)
+// rows are matched by external_id or email, rows matching the same contact are merged & the last value of a field wins
+// the outcome of each row is CREATED, UPDATED, SKIPPED or FAILED, rows with errors are left untouched
+// contacts are created with the status, their first transition being caused by cause; existing contacts keep their status
+func upsertContacts(ctx context.Context, organizationID, mode string, rows []importRow, status string, cause statusCause) ([]bulkOutcome, error) {
+	outcomes := make([]bulkOutcome, len(rows))
+	existing, err := existingContacts(ctx, organizationID, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := []*upsertTarget{}
+	byKey := map[string]*upsertTarget{}
+	for i, row := range rows {
+		if row.err {
+			continue
+		}
+
+		keys := contactKeys(row.data)
+		var target *upsertTarget
+		conflict := false
+		for _, k := range keys {
+			t := byKey[k]
+			if t == nil && existing[k] != nil {
+				t = &upsertTarget{id: existing[k].ID, tags: map[string]bool{}}
+				for _, k := range contactKeys(existing[k].ContactData) {
+					byKey[k] = t
+				}
+			}
+
+			if t != nil && target != nil && t != target {
+				conflict = true
+			} else if t != nil {
+				target = t
+			}
+		}
+
+		switch {
+		case conflict:
+			outcomes[i] = bulkOutcome{status: "FAILED", err: "The email & external_id match different contacts"}
+			continue
+		case target == nil && mode == "UPDATE", target != nil && mode == "CREATE" && (!target.create || len(target.rows) > 0):
+			outcomes[i] = bulkOutcome{status: "SKIPPED"}
+			if target != nil {
+				outcomes[i].id = target.id
+			}
+
+			continue
+		case target == nil:
+			target = &upsertTarget{id: ContactPrefixID + ksuid.New().String(), create: true, tags: map[string]bool{}}
+		}
+
+		if len(target.rows) == 0 {
+			targets = append(targets, target)
+		}
+
+		mergeContactData(&target.data, row.data)
+		target.rows = append(target.rows, i)
+		for _, k := range keys {
+			byKey[k] = target
+		}
+
+		for _, id := range row.tags {
+			target.tags[id] = true
+		}
+	}
+
+	now := time.Now()
+	models := []db.WriteModel{}
+	for _, t := range targets {
+		// null attributes are unset
+		if t.create {
+			data := t.data
+			data.Attributes = definedAttributes(data.Attributes)
+			c := Contact{
+				ID:             t.id,
+				OrganizationID: organizationID,
+				Status:         status,
+				ContactData:    data,
+				SearchTokens:   searchTokens(data),
+			}
+
+			if status == StatusActive {
+				c.SubscribedAt = &now
+			}
+
+			models = append(models, db.InsertModel{Document: c})
+		} else {
+			update := bson.M{"$set": contactDataFields(t.data)}
+			if _, unset := attributeFields(t.data.Attributes); len(unset) > 0 {
+				update["$unset"] = unset
+			}
+
+			models = append(models, db.UpdateModel{
+				Filter: bson.M{"_id": t.id, "organization_id": organizationID},
+				Update: update,
+			})
+		}
+	}
+
+	res, err := db.Coll("contacts").BulkWrite(ctx, models)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, transitions, updated := map[string][]string{}, []ContactTransition{}, []string{}
+	for i, t := range targets {
+		if t.create && res.Errors[i] == nil {
+			transitions = append(transitions, cause.transition(organizationID, t.id, "", status, now))
+		} else if res.Errors[i] == nil {
+			updated = append(updated, t.id)
+		}
+
+		for j, row := range t.rows {
+			outcomes[row] = bulkOutcome{id: t.id, status: "UPDATED"}
+			if err := res.Errors[i]; err != nil {
+				outcomes[row] = bulkOutcome{status: "FAILED", err: "Could not save the contact: " + err.Error()}
+				if !t.create {
+					outcomes[row].id = t.id
+				}
+			} else if t.create && j == 0 {
+				outcomes[row].status = "CREATED"
+			}
+		}
+
+		if res.Errors[i] == nil && len(t.tags) > 0 {
+			tags[t.id] = keys(t.tags)
+		}
+	}
+
+	if err := recordTransitions(ctx, transitions); err != nil {
+		return outcomes, err
+	} else if err := reindexContacts(ctx, organizationID, updated); err != nil {
+		return outcomes, err
+	}
+
+	_, err = assignTags(ctx, organizationID, tags)
+	return outcomes, err
+}
+
+// existing contacts of the rows by dedupe key
+func existingContacts(ctx context.Context, organizationID string, rows []importRow) (map[string]*Contact, error) {
+	emails, externalIDs := []string{}, []string{}
+	for _, row := range rows {
+		if row.data.Email != nil {
+			emails = append(emails, *row.data.Email)
+		}
+
+		if row.data.ExternalID != nil {
+			externalIDs = append(externalIDs, *row.data.ExternalID)
+		}
+	}
+
+	res := map[string]*Contact{}
+	if len(emails) == 0 && len(externalIDs) == 0 {
+		return res, nil
+	}
+
+	list := []Contact{}
+	err := db.Coll("contacts").Find(ctx, bson.M{
+		"organization_id": organizationID,
+		"$or": []bson.M{
+			{"email": bson.M{"$in": emails}},
+			{"external_id": bson.M{"$in": externalIDs}},
+		},
+	}, &list, db.FindOptions{})
+
+	for i := range list {
+		for _, k := range contactKeys(list[i].ContactData) {
+			res[k] = &list[i]
+		}
+	}
+
+	return res, err
+}
+
+// assign the tag ids to the contacts when missing & update the tags counters
+// returns the number of tags assigned to each contact
+func assignTags(ctx context.Context, organizationID string, tags map[string][]string) (map[string]int, error) {
+	added := map[string]int{}
+	contactIDs, tagIDs := []string{}, map[string]bool{}
+	for contactID, ids := range tags {
+		contactIDs = append(contactIDs, contactID)
+		for _, id := range ids {
+			tagIDs[id] = true
+		}
+	}
+
+	if len(tagIDs) == 0 {
+		return added, nil
+	}
+
+	assigned := []ContactTag{}
+	err := db.Coll("contact_tags").Find(ctx, bson.M{
+		"organization_id": organizationID,
+		"contact_id":      bson.M{"$in": contactIDs},
+		"tag_id":          bson.M{"$in": keys(tagIDs)},
+	}, &assigned, db.FindOptions{})
+
+	if err != nil {
+		return added, err
+	}
+
+	exists := map[string]bool{}
+	for _, a := range assigned {
+		exists[a.ContactID+"/"+a.TagID] = true
+	}
+
+	models := []db.WriteModel{}
+	inserted := []ContactTag{}
+	for contactID, ids := range tags {
+		for _, id := range ids {
+			if exists[contactID+"/"+id] {
+				continue
+			}
+
+			exists[contactID+"/"+id] = true
+			t := ContactTag{
+				ID:             ContactTagPrefixID + ksuid.New().String(),
+				OrganizationID: organizationID,
+				ContactID:      contactID,
+				TagID:          id,
+			}
+
+			inserted = append(inserted, t)
+			models = append(models, db.InsertModel{Document: t})
+		}
+	}
+
+	res, err := db.Coll("contact_tags").BulkWrite(ctx, models)
+	if err != nil {
+		return added, err
+	}
+
+	counts, contacts := map[string]int{}, map[string][]string{}
+	for i, t := range inserted {
+		if res.Errors[i] == nil {
+			counts[t.TagID]++
+			added[t.ContactID]++
+			contacts[t.ContactID] = append(contacts[t.ContactID], t.TagID)
+		}
+	}
+
+	if err := incrementTagCounts(ctx, organizationID, counts); err != nil {
+		return added, err
+	}
+
+	return added, addContactTagIDs(ctx, organizationID, contacts)
+}
+
+// store the assigned tag ids on the contacts, queried by filters & segment rules
+func addContactTagIDs(ctx context.Context, organizationID string, tags map[string][]string) error {
+	models := []db.WriteModel{}
+	for contactID, ids := range tags {
+		models = append(models, db.UpdateModel{
+			Filter: bson.M{"_id": contactID, "organization_id": organizationID},
+			Update: bson.M{"$addToSet": bson.M{"tag_ids": bson.M{"$each": ids}}},
+		})
+	}
+
+	if len(models) == 0 {
+		return nil
+	}
+
+	res, err := db.Coll("contacts").BulkWrite(ctx, models)
+	if err != nil {
+		return err
+	}
+
+	return firstError(res)
+}
+
+// remove the tag ids from the contacts & update the tags counters
+// returns the number of tags removed from each contact
+func unassignTags(ctx context.Context, organizationID string, contactIDs, tagIDs []string) (map[string]int, error) {
+	removed := map[string]int{}
+	assigned := []ContactTag{}
+	err := db.Coll("contact_tags").Find(ctx, bson.M{
+		"organization_id": organizationID,
+		"contact_id":      bson.M{"$in": contactIDs},
+		"tag_id":          bson.M{"$in": tagIDs},
+	}, &assigned, db.FindOptions{})
+
+	if err != nil || len(assigned) == 0 {
+		return removed, err
+	}
+
+	ids, counts := []string{}, map[string]int{}
+	for _, a := range assigned {
+		ids = append(ids, a.ID)
+		counts[a.TagID]--
+		removed[a.ContactID]++
+	}
+
+	if _, err := db.Coll("contact_tags").DeleteMany(ctx, bson.M{"organization_id": organizationID, "_id": bson.M{"$in": ids}}); err != nil {
+		return removed, err
+	} else if err := incrementTagCounts(ctx, organizationID, counts); err != nil {
+		return removed, err
+	}
+
+	_, err = db.Coll("contacts").UpdateMany(ctx, bson.M{"organization_id": organizationID, "_id": bson.M{"$in": contactIDs}}, bson.M{
+		"$pull": bson.M{"tag_ids": bson.M{"$in": tagIDs}},
+	})
+
+	return removed, err
+}
+
+// delete the contacts of the organization with their tags
+func deleteContacts(ctx context.Context, organizationID string, ids []string) error {
+	assigned := []ContactTag{}
+	err := db.Coll("contact_tags").Find(ctx, bson.M{"organization_id": organizationID, "contact_id": bson.M{"$in": ids}}, &assigned, db.FindOptions{})
+	if err != nil {
+		return err
+	}
+
+	counts := map[string]int{}
+	for _, a := range assigned {
+		counts[a.TagID]--
+	}
+
+	if _, err := db.Coll("contact_tags").DeleteMany(ctx, bson.M{"organization_id": organizationID, "contact_id": bson.M{"$in": ids}}); err != nil {
+		return err
+	} else if err := incrementTagCounts(ctx, organizationID, counts); err != nil {
+		return err
+	}
+
+	for _, coll := range []string{"contact_transitions", "contact_consents"} {
+		if _, err := db.Coll(coll).DeleteMany(ctx, bson.M{"organization_id": organizationID, "contact_id": bson.M{"$in": ids}}); err != nil {
+			return err
+		}
+	}
+
+	if err := removeDuplicates(ctx, organizationID, ids); err != nil {
+		return err
+	}
+
+	_, err = db.Coll("contacts").DeleteMany(ctx, bson.M{"organization_id": organizationID, "_id": bson.M{"$in": ids}})
+	return err
+}
@@ -0,0 +1,253 @@
+package contacts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/segmentio/ksuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"neodeliver.com/engine/db"
+	"neodeliver.com/engine/rbac"
+	"neodeliver.com/modules/settings"
+)
+
+// Consents of contacts per channel & communication category (configured in the contact settings)
+// contacts keep their current consents, every change being recorded with its proof in contact_consents
+// -------------------------------------------------------------------------------------
+
+const ContactConsentPrefixID = "cns_"
+
+// consent of a contact to a communication category on a channel, the most recent one applies
+type Consent struct {
+	Channel  string       `bson:"channel" json:"channel"`   // email, sms or notifications
+	Category string       `bson:"category" json:"category"` // key of the communication category
+	Granted  bool         `bson:"granted" json:"granted"`   // false once withdrawn
+	Source   string       `bson:"source" json:"source"`     // API, SUBSCRIPTION or IMPORT
+	Proof    ConsentProof `bson:"proof" json:"proof"`
+	At       time.Time    `bson:"at" json:"at"` // when the consent was given or withdrawn
+}
+
+// evidence of a consent
+type ConsentProof struct {
+	IP        *string `bson:"ip,omitempty" json:"ip"`
+	UserAgent *string `bson:"user_agent,omitempty" json:"user_agent"`
+	Form      *string `bson:"form,omitempty" json:"form"`           // name or url of the form
+	Text      *string `bson:"text,omitempty" json:"text"`           // wording the contact agreed to
+	ImportID  *string `bson:"import_id,omitempty" json:"import_id"` // set by imports
+}
+
+// change of a consent, recorded in the history of the contact
+type ContactConsent struct {
+	ID             string `bson:"_id" json:"id"`
+	OrganizationID string `bson:"organization_id" json:"organization_id"`
+	ContactID      string `bson:"contact_id" json:"contact_id"`
+	Consent        `bson:",inline" json:",inline"`
+	Cause          string    `bson:"cause" json:"cause"`       // USER, API_KEY, CONTACT or SYSTEM
+	ActorID        *string   `bson:"actor_id" json:"actor_id"` // id of the user or api key
+	CreatedAt      time.Time `bson:"created_at" json:"created_at"`
+}
+
+type ConsentChange struct {
+	Channel  string `json:"channel" bson:"channel" validate:"oneof=email sms notifications"`
+	Category string `json:"category" bson:"category" validate:"required"`
+	Granted  bool   `json:"granted" bson:"granted"`
+}
+
+type SetContactConsents struct {
+	ID       string
+	Consents []ConsentChange `json:"consents" validate:"required,min=1,max=100,dive"`
+	Proof    *ConsentProof   `json:"proof"`
+	At       *time.Time      `json:"at"` // when the consents were collected, now by default (eg: consents collected offline)
+}
+
+type ContactConsents struct {
+	ID string // id of the contact
+}
+
+// grant or withdraw consents of a contact, older consents than the current ones are only recorded in the history
+func (Mutation) SetContactConsents(p graphql.ResolveParams, rbac rbac.RBAC, args SetContactConsents) (Contact, error) {
+	c := Contact{}
+	if err := verifyConsents(p.Context, rbac.OrganizationID, args.Consents); err != nil {
+		return c, err
+	}
+
+	err := db.Coll("contacts").FindOne(p.Context, contactsByIDs(rbac.OrganizationID, []string{args.ID}), &c)
+	if errors.Is(err, db.ErrNoDocuments) {
+		return c, errors.New("The contact does not exist")
+	} else if err != nil {
+		return c, err
+	}
+
+	at := time.Now()
+	if args.At != nil {
+		if args.At.After(at) {
+			return c, errors.New("Consents can't be collected in the future")
+		}
+
+		at = *args.At
+	}
+
+	proof := ConsentProof{}
+	if args.Proof != nil {
+		proof = *args.Proof
+	}
+
+	contacts := []Contact{c}
+	err = recordConsents(p.Context, rbac.OrganizationID, contacts, consents(args.Consents, "API", proof, at), causeOf(rbac, "API"))
+	return contacts[0], err
+}
+
+// history of the consents of a contact, oldest first
+func (Query) ContactConsents(p graphql.ResolveParams, rbac rbac.RBAC, args ContactConsents) ([]ContactConsent, error) {
+	list := []ContactConsent{}
+	id, err := resolveContactID(p.Context, rbac.OrganizationID, args.ID)
+	if err != nil {
+		return list, err
+	}
+
+	err = db.Coll("contact_consents").Find(p.Context, bson.M{"organization_id": rbac.OrganizationID, "contact_id": id}, &list, db.FindOptions{
+		Sort: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}},
+	})
+
+	return list, err
+}
+
+// ---
+
+// whether the contact granted its consent to the category on the channel
+func (c Contact) Consented(channel, category string) bool {
+	for _, consent := range c.Consents {
+		if consent.Channel == channel && consent.Category == category {
+			return consent.Granted
+		}
+	}
+
+	return false
+}
+
+// mongodb filter of the contacts receiving a message of the organization on the channel
+// marketing messages of a category are only sent to contacts consenting to it, marketing messages without category to contacts consenting to any category of the channel
+// transactional messages don't require consents
+func RecipientsQuery(organizationID, channel string, category *string, transactional bool) bson.M {
+	q := bson.M{"organization_id": organizationID, "status": bson.M{"$in": SendableStatuses(transactional)}}
+	if !transactional && category != nil {
+		q["consents"] = bson.M{"$elemMatch": bson.M{"channel": channel, "category": *category, "granted": true}}
+	} else if !transactional {
+		// marketing messages without a category still require a consent on the channel
+		q["consents"] = bson.M{"$elemMatch": bson.M{"channel": channel, "granted": true}}
+	}
+
+	return q
+}
+
+// verify the categories are configured by the organization
+func verifyConsents(ctx context.Context, organizationID string, changes []ConsentChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	s, err := settings.LoadContactSettings(ctx, organizationID)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range changes {
+		if s.Category(c.Category) == nil {
+			return fmt.Errorf("The communication category %s does not exist", c.Category)
+		}
+	}
+
+	return nil
+}
+
+func consents(changes []ConsentChange, source string, proof ConsentProof, at time.Time) []Consent {
+	res := make([]Consent, len(changes))
+	for i, c := range changes {
+		res[i] = Consent{Channel: c.Channel, Category: c.Category, Granted: c.Granted, Source: source, Proof: proof, At: at}
+	}
+
+	return res
+}
+
+// apply the consents to the contacts (updated in place) & record them in their history
+func recordConsents(ctx context.Context, organizationID string, contacts []Contact, list []Consent, cause statusCause) error {
+	if len(list) == 0 || len(contacts) == 0 {
+		return nil
+	}
+
+	// only the most recent consent of each channel & category is applied
+	applied := []Consent{}
+	for _, consent := range list {
+		applied = mergeConsent(applied, consent)
+	}
+
+	// each consent is pushed when missing or replaces an older one, leaving the other consents untouched
+	now := time.Now()
+	models, history := []db.WriteModel{}, []db.WriteModel{}
+	for i := range contacts {
+		c := &contacts[i]
+		for _, consent := range list {
+			history = append(history, db.InsertModel{Document: ContactConsent{
+				ID:             ContactConsentPrefixID + ksuid.New().String(),
+				OrganizationID: organizationID,
+				ContactID:      c.ID,
+				Consent:        consent,
+				Cause:          cause.cause,
+				ActorID:        cause.actorID,
+				CreatedAt:      now,
+			}})
+
+			c.Consents = mergeConsent(c.Consents, consent)
+		}
+
+		for _, consent := range applied {
+			key := bson.M{"channel": consent.Channel, "category": consent.Category}
+			models = append(models, db.UpdateModel{
+				Filter: bson.M{"_id": c.ID, "organization_id": organizationID, "consents": bson.M{"$not": bson.M{"$elemMatch": key}}},
+				Update: bson.M{"$push": bson.M{"consents": consent}},
+			}, db.UpdateModel{
+				Filter: bson.M{"_id": c.ID, "organization_id": organizationID, "consents": bson.M{"$elemMatch": bson.M{"channel": consent.Channel, "category": consent.Category, "at": bson.M{"$lte": consent.At}}}},
+				Update: bson.M{"$set": bson.M{"consents.$": consent}},
+			})
+		}
+	}
+
+	if res, err := db.Coll("contacts").BulkWrite(ctx, models); err != nil {
+		return err
+	} else if err := firstError(res); err != nil {
+		return err
+	}
+
+	res, err := db.Coll("contact_consents").BulkWrite(ctx, history)
+	if err != nil {
+		return err
+	}
+
+	return firstError(res)
+}
+
+// replace the consent of the same channel & category unless it is more recent
+func mergeConsent(list []Consent, consent Consent) []Consent {
+	for i, c := range list {
+		if c.Channel != consent.Channel || c.Category != consent.Category {
+			continue
+		} else if !c.At.After(consent.At) {
+			list[i] = consent
+		}
+
+		return list
+	}
+
+	return append(list, consent)
+}
+
+func firstError(res db.BulkResult) error {
+	for _, err := range res.Errors {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package contacts_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"neodeliver.com/modules/graphqltest"
+)
+
+type consent struct {
+	Channel  string    `json:"channel"`
+	Category string    `json:"category"`
+	Granted  bool      `json:"granted"`
+	At       time.Time `json:"at"`
+}
+
+func TestConsentHistory(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	add := struct {
+		AddContact struct {
+			ID string `json:"id"`
+		} `json:"add_contact"`
+	}{}
+
+	c.Exec(`mutation { add_contact(email: "john@example.com") { id } }`, nil, &add)
+	id := add.AddContact.ID
+
+	now := time.Now().UTC().Truncate(time.Second)
+	set := func(at time.Time, consents ...map[string]interface{}) {
+		t.Helper()
+
+		// history entries are sorted by creation date, stored in milliseconds
+		time.Sleep(2 * time.Millisecond)
+		vars := map[string]interface{}{"id": id, "consents": consents, "at": at.Format(time.RFC3339)}
+		c.Exec(`mutation($id: String!, $consents: [InConsentChange!]!, $at: DateTime) { set_contact_consents(id: $id, consents: $consents, at: $at) { id } }`, vars, nil)
+	}
+
+	email := map[string]interface{}{"channel": "email", "category": "newsletter", "granted": true}
+	sms := map[string]interface{}{"channel": "sms", "category": "promotions", "granted": true}
+	withdrawn := map[string]interface{}{"channel": "email", "category": "newsletter", "granted": false}
+
+	set(now.Add(-time.Hour), email, sms)
+	// older consents are recorded without replacing the current ones
+	set(now.Add(-2*time.Hour), withdrawn)
+
+	res := struct {
+		Contact struct {
+			Consents []consent `json:"consents"`
+		} `json:"contact"`
+		ContactConsents []consent `json:"contact_consents"`
+	}{}
+
+	query := `query($id: String!) {
+		contact(id: $id) { consents { channel category granted at } }
+		contact_consents(id: $id) { channel category granted at }
+	}`
+
+	c.Exec(query, map[string]interface{}{"id": id}, &res)
+	want := []consent{
+		{"email", "newsletter", true, now.Add(-time.Hour)},
+		{"sms", "promotions", true, now.Add(-time.Hour)},
+	}
+
+	if !reflect.DeepEqual(res.Contact.Consents, want) {
+		t.Errorf("consents %+v, want %+v", res.Contact.Consents, want)
+	} else if len(res.ContactConsents) != 3 || res.ContactConsents[2] != (consent{"email", "newsletter", false, now.Add(-2 * time.Hour)}) {
+		t.Errorf("history %+v, want the older withdrawal last", res.ContactConsents)
+	}
+
+	// newer consents only replace the consent of their channel & category
+	set(now, withdrawn)
+	c.Exec(query, map[string]interface{}{"id": id}, &res)
+	want[0] = consent{"email", "newsletter", false, now}
+	if !reflect.DeepEqual(res.Contact.Consents, want) {
+		t.Errorf("consents %+v, want %+v", res.Contact.Consents, want)
+	} else if len(res.ContactConsents) != 4 || res.ContactConsents[3] != want[0] {
+		t.Errorf("history %+v, want the withdrawal last", res.ContactConsents)
+	}
+}
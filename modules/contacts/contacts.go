@@ -2,54 +2,58 @@ package contacts
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/graphql-go/graphql"
 	"github.com/segmentio/ksuid"
+	"go.mongodb.org/mongo-driver/bson"
 	"neodeliver.com/engine/db"
 	ggraphql "neodeliver.com/engine/graphql"
 	"neodeliver.com/engine/rbac"
 	utils "neodeliver.com/utils"
 )
 
+const ContactPrefixID = "ctc_"
+const ContactTagPrefixID = "ctc_tag_"
+
 type ContactStats struct {
-	SMS           ContactStatsItem
-	Email         ContactStatsItem
-	Notifications ContactStatsItem
+	SMS           ContactStatsItem `bson:"sms" json:"sms"`
+	Email         ContactStatsItem `bson:"email" json:"email"`
+	Notifications ContactStatsItem `bson:"notifications" json:"notifications"`
 }
 
 type ContactStatsItem struct {
-	CampaignsSent      int
-	LastCampaignSent   time.Time
-	MessagesOpened     int
-	LastMessageOpened  time.Time
-	MessagesClicked    int
-	LastMessageClicked time.Time
+	CampaignsSent      int       `bson:"campaigns_sent" json:"campaigns_sent"`
+	LastCampaignSent   time.Time `bson:"last_campaign_sent" json:"last_campaign_sent"`
+	MessagesOpened     int       `bson:"messages_opened" json:"messages_opened"`
+	LastMessageOpened  time.Time `bson:"last_message_opened" json:"last_message_opened"`
+	MessagesClicked    int       `bson:"messages_clicked" json:"messages_clicked"`
+	LastMessageClicked time.Time `bson:"last_message_clicked" json:"last_message_clicked"`
 }
 
 // ----
 
 type ContactData struct {
-	ExternalID         *string  `bson:"external_id" json:"external_id"` // used to map to external systems => unique per org
-	GivenName          *string  `bson:"given_name" json:"given_name"`
-	LastName           *string  `bson:"last_name" json:"last_name"`
-	Email              *string  `bson:"email" json:"email"`
-	NotificationTokens []string `bson:"notification_tokens" json:"notification_tokens"`
-	PhoneNumber        *string  `bson:"phone_number" json:"phone_number"`
-	Lang               *string   `bson:"lang" json:"lang"`
+	ExternalID         *string    `bson:"external_id" json:"external_id"` // used to map to external systems => unique per org
+	GivenName          *string    `bson:"given_name" json:"given_name"`
+	LastName           *string    `bson:"last_name" json:"last_name"`
+	Email              *string    `bson:"email" json:"email"`
+	NotificationTokens []string   `bson:"notification_tokens" json:"notification_tokens"`
+	PhoneNumber        *string    `bson:"phone_number" json:"phone_number"`
+	Lang               *string    `bson:"lang" json:"lang"`
+	Attributes         Attributes `bson:"attributes,omitempty" json:"attributes"` // custom attributes by key, null values unset attributes on updates
 }
 
+// validate the fields that are set
 func (c ContactData) Validate() error {
-	match := utils.ValidateEmail(c.Email)
-	if !match {
+	if c.Email != nil && !utils.ValidateEmail(c.Email) {
 		return errors.New("Email address is not valid")
 	}
-	match = utils.ValidatePhone(c.PhoneNumber)
-	if !match {
+	if c.PhoneNumber != nil && !utils.ValidatePhone(c.PhoneNumber) {
 		return errors.New("Phone number is not valid")
 	}
-	match = utils.ValidateLanguageCode(c.Lang)
-	if !match {
+	if c.Lang != nil && !utils.ValidateLanguageCode(c.Lang) {
 		return errors.New("Language is not valid")
 	}
 	for _, token := range c.NotificationTokens {
@@ -64,11 +68,61 @@ func (c ContactData) Validate() error {
 }
 
 type Contact struct {
-	ID             string    `json:"id" bson:"_id,omitempty"`
-	OrganizationID string    `bson:"organization_id"`
-	Status         string    `bson:"status" json:"status"`
-	SubscribedAt   time.Time `bson:"subscribed_at" json:"subscribed_at"`
-	ContactData    `bson:",inline" json:",inline"`
+	ID                 string       `json:"id" bson:"_id,omitempty"`
+	OrganizationID     string       `bson:"organization_id"`
+	Status             string       `bson:"status" json:"status"`                                       // PENDING, ACTIVE, UNSUBSCRIBED, BOUNCED, COMPLAINED or CLEANED
+	SubscribedAt       *time.Time   `bson:"subscribed_at" json:"subscribed_at"`                         // last time the contact became ACTIVE
+	ConfirmationSentAt *time.Time   `bson:"confirmation_sent_at,omitempty" json:"confirmation_sent_at"` // double opt-in
+	ConfirmationToken  string       `bson:"confirmation_token,omitempty" json:"-" graphql:"-"`
+	Stats              ContactStats `bson:"stats" json:"stats"`
+	Consents           []Consent    `bson:"consents,omitempty" json:"consents"`         // current consents by channel & category
+	SegmentIDs         []string     `bson:"segment_ids,omitempty" json:"-" graphql:"-"` // static segments of the contact
+	TagIDs             []string     `bson:"tag_ids,omitempty" json:"-" graphql:"-"`     // tags of the contact, kept in sync with contact_tags
+	Aliases            []string     `bson:"aliases,omitempty" json:"aliases"`           // ids of the contacts merged into this one, still resolving to it
+	SearchTokens       []string     `bson:"search_tokens" json:"-" graphql:"-"`         // prefixes of the searchable words
+	ContactData        `bson:",inline" json:",inline"`
+}
+
+func (Contact) GraphqlMethods() []string {
+	return []string{"FullName", "MergeTags"}
+}
+
+// full name of the contact, composed of the given & last name
+func (c Contact) FullName() string {
+	names := []string{}
+	for _, n := range []*string{c.GivenName, c.LastName} {
+		if n != nil && *n != "" {
+			names = append(names, *n)
+		}
+	}
+
+	return strings.Join(names, " ")
+}
+
+// values of the contact available to templates as merge tags, eg: {{given_name}} or {{attributes.plan}}
+// missing values are empty strings so they can be rendered as is
+func (c Contact) MergeTags() Attributes {
+	attributes := Attributes{}
+	for k, v := range c.Attributes {
+		attributes[k] = v
+	}
+
+	tags := Attributes{"id": c.ID, "full_name": c.FullName(), "attributes": attributes}
+	for k, v := range map[string]*string{
+		"external_id":  c.ExternalID,
+		"given_name":   c.GivenName,
+		"last_name":    c.LastName,
+		"email":        c.Email,
+		"phone_number": c.PhoneNumber,
+		"lang":         c.Lang,
+	} {
+		tags[k] = ""
+		if v != nil {
+			tags[k] = *v
+		}
+	}
+
+	return tags
 }
 
 type ContactID struct {
@@ -77,20 +131,21 @@ type ContactID struct {
 
 type ContactEdit struct {
 	ID   string
-	Data ContactData	`json:"data" bson:"data"`
+	Data ContactData `json:"data" bson:"data"`
 }
 
 type TagAssign struct {
-	ContactID	string
-	TagID		string
+	ContactID string
+	TagID     string
 }
 
 func (Mutation) AddContact(p graphql.ResolveParams, rbac rbac.RBAC, args ContactData) (Contact, error) {
+	now := time.Now()
 	c := Contact{
-		ID:             "ctc_" + ksuid.New().String(),
+		ID:             ContactPrefixID + ksuid.New().String(),
 		OrganizationID: rbac.OrganizationID,
-		Status:         "ACTIVE", // Assuming a default status
-		SubscribedAt:   time.Now(),
+		Status:         StatusActive,
+		SubscribedAt:   &now,
 		ContactData:    args,
 	}
 
@@ -98,17 +153,33 @@ func (Mutation) AddContact(p graphql.ResolveParams, rbac rbac.RBAC, args Contact
 		return c, err
 	}
 
-	numberOfSameEmail, _ := db.Count(p.Context, &c, map[string]string{"organization_id": c.OrganizationID, "email": *args.Email})
-	if numberOfSameEmail >= 1 {
-		return c, errors.New("The email is already registered within your organization")
+	attributes, err := contactAttributes(p.Context, rbac.OrganizationID, args.Attributes)
+	if err != nil {
+		return c, err
+	}
+
+	c.Attributes = definedAttributes(attributes)
+	c.SearchTokens = searchTokens(c.ContactData)
+
+	if args.Email != nil {
+		numberOfSameEmail, _ := db.Count(p.Context, &c, map[string]string{"organization_id": c.OrganizationID, "email": *args.Email})
+		if numberOfSameEmail >= 1 {
+			return c, errors.New("The email is already registered within your organization")
+		}
+	}
+
+	if args.ExternalID != nil {
+		numberOfSameID, _ := db.Count(p.Context, &c, map[string]string{"organization_id": c.OrganizationID, "external_id": *args.ExternalID})
+		if numberOfSameID >= 1 {
+			return c, errors.New("The ID is duplicated within your organization")
+		}
 	}
 
-	numberOfSameID, _ := db.Count(p.Context, &c, map[string]string{"organization_id": c.OrganizationID, "external_id": *args.ExternalID})
-	if numberOfSameID >= 1 {
-		return c, errors.New("The ID is duplicated within your organization")
+	if err := db.Save(p.Context, &c); err != nil {
+		return c, err
 	}
 
-	_, err := db.Save(p.Context, &c)
+	err = recordTransitions(p.Context, []ContactTransition{causeOf(rbac, "API").transition(c.OrganizationID, c.ID, "", c.Status, now)})
 	return c, err
 }
 
@@ -117,9 +188,32 @@ func (Mutation) UpdateContact(p graphql.ResolveParams, rbac rbac.RBAC, args Cont
 		return Contact{}, err
 	}
 
+	// merged contacts are updated through their survivor
+	var err error
+	if args.ID, err = resolveContactID(p.Context, rbac.OrganizationID, args.ID); err != nil {
+		return Contact{}, err
+	}
+
 	// only update the fields that were passed in params
 	data := ggraphql.ArgToBson(p.Args["data"], args.Data)
-	if len(data) == 0 {
+
+	// attributes are updated by key, the others being left untouched
+	var unset bson.M
+	if _, ok := data["attributes"]; ok {
+		delete(data, "attributes")
+		attributes, err := contactAttributes(p.Context, rbac.OrganizationID, args.Data.Attributes)
+		if err != nil {
+			return Contact{}, err
+		}
+
+		var set bson.M
+		set, unset = attributeFields(attributes)
+		for k, v := range set {
+			data[k] = v
+		}
+	}
+
+	if len(data) == 0 && len(unset) == 0 {
 		return Contact{}, errors.New("no data to update")
 	}
 
@@ -139,32 +233,71 @@ func (Mutation) UpdateContact(p graphql.ResolveParams, rbac rbac.RBAC, args Cont
 		}
 	}
 
+	if len(unset) > 0 {
+		if _, err := db.Coll("contacts").UpdateMany(p.Context, bson.M{"_id": args.ID, "organization_id": rbac.OrganizationID}, bson.M{"$unset": unset}); err != nil {
+			return c, err
+		}
+	}
+
+	if len(data) == 0 {
+		err := db.Coll("contacts").FindOne(p.Context, bson.M{"_id": args.ID, "organization_id": rbac.OrganizationID}, &c)
+		return c, err
+	}
+
 	// Save the updated contact to the database
-	err := db.Update(p.Context, &c, map[string]string{
-		"_id": args.ID,
+	err = db.Update(p.Context, &c, map[string]string{
+		"_id":             args.ID,
+		"organization_id": rbac.OrganizationID,
 	}, data)
 
+	if err != nil {
+		return c, err
+	}
+
+	err = indexContacts(p.Context, []Contact{c})
 	return c, err
 }
 
 func (Mutation) DeleteContact(p graphql.ResolveParams, rbac rbac.RBAC, filter ContactID) (bool, error) {
-	c := Contact{}
-	err := db.Delete(p.Context, &c, map[string]string{"_id": filter.ID})
+	id, err := resolveContactID(p.Context, rbac.OrganizationID, filter.ID)
+	if err != nil {
+		return false, err
+	}
+
+	// tags of the contact are removed as well to keep their counters in sync
+	err = deleteContacts(p.Context, rbac.OrganizationID, []string{id})
 	return true, err
 }
 
 type ContactTag struct {
-	ID			string	`bson:"_id"`
-	ContactID	string	`bson:"contact_id" json:"contact_id"`
-	TagID		string	`bson:"tag_id" json:"tag_id"`
+	ID             string `bson:"_id"`
+	OrganizationID string `bson:"organization_id" json:"organization_id"`
+	ContactID      string `bson:"contact_id" json:"contact_id"`
+	TagID          string `bson:"tag_id" json:"tag_id"`
 }
 
 func (Mutation) AssignTag(p graphql.ResolveParams, rbac rbac.RBAC, args TagAssign) (ContactTag, error) {
-	r := ContactTag{
-		ID:			"ctc_tag_" + ksuid.New().String(),
-		ContactID:	args.ContactID,
-		TagID:		args.TagID,
+	r := ContactTag{}
+	if err := verifyTags(p.Context, rbac.OrganizationID, []string{args.TagID}); err != nil {
+		return r, err
 	}
-	_, err := db.Save(p.Context, &r)
+
+	var err error
+	if args.ContactID, err = resolveContactID(p.Context, rbac.OrganizationID, args.ContactID); err != nil {
+		return r, err
+	}
+
+	if n, err := db.Coll("contacts").Count(p.Context, map[string]string{"_id": args.ContactID, "organization_id": rbac.OrganizationID}); err != nil {
+		return r, err
+	} else if n == 0 {
+		return r, errors.New("The contact does not exist")
+	}
+
+	// assigning a tag twice returns the existing assignment
+	if _, err := assignTags(p.Context, rbac.OrganizationID, map[string][]string{args.ContactID: {args.TagID}}); err != nil {
+		return r, err
+	}
+
+	err = db.Coll("contact_tags").FindOne(p.Context, map[string]string{"organization_id": rbac.OrganizationID, "contact_id": args.ContactID, "tag_id": args.TagID}, &r)
 	return r, err
 }
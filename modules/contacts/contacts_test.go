@@ -0,0 +1,254 @@
+package contacts_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"neodeliver.com/engine/jobs"
+	"neodeliver.com/modules/graphqltest"
+)
+
+type contact struct {
+	ID     string `json:"id"`
+	Email  string `json:"email"`
+	Status string `json:"status"`
+}
+
+func addContact(c *graphqltest.Client, email string) string {
+	res := struct {
+		AddContact contact `json:"add_contact"`
+	}{}
+
+	c.Exec(`mutation($email: String) { add_contact(email: $email) { id } }`, map[string]interface{}{"email": email}, &res)
+	return res.AddContact.ID
+}
+
+func addTag(c *graphqltest.Client, name string) string {
+	res := struct {
+		AddTag struct {
+			ID string `json:"id"`
+		} `json:"add_tag"`
+	}{}
+
+	c.Exec(`mutation($name: String) { add_tag(name: $name) { id } }`, map[string]interface{}{"name": name}, &res)
+	return res.AddTag.ID
+}
+
+func tagContactsCount(c *graphqltest.Client, id string) int {
+	res := struct {
+		Tags []struct {
+			ID            string `json:"id"`
+			ContactsCount int    `json:"contacts_count"`
+		} `json:"tags"`
+	}{}
+
+	c.Exec(`{ tags { id contacts_count } }`, nil, &res)
+	for _, t := range res.Tags {
+		if t.ID == id {
+			return t.ContactsCount
+		}
+	}
+
+	return -1
+}
+
+func TestBulkTags(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	a, b := addContact(c, "a@example.com"), addContact(c, "b@example.com")
+	addContact(c, "c@example.com")
+	vip, recent := addTag(c, "vip"), addTag(c, "recent")
+
+	res := struct {
+		AssignTags struct {
+			Total     int `json:"total"`
+			Succeeded int `json:"succeeded"`
+		} `json:"assign_tags"`
+	}{}
+
+	// assigning twice keeps a single assignment
+	for i := 0; i < 2; i++ {
+		c.Exec(`mutation($tags: [String!], $ids: [String!]) { assign_tags(tag_ids: $tags, ids: $ids) { total succeeded } }`, map[string]interface{}{
+			"tags": []string{vip},
+			"ids":  []string{a, b},
+		}, &res)
+	}
+
+	if res.AssignTags.Total != 2 || res.AssignTags.Succeeded != 2 {
+		t.Errorf("assigned %+v, want 2 contacts", res.AssignTags)
+	} else if n := tagContactsCount(c, vip); n != 2 {
+		t.Errorf("vip tag counts %d contacts, want 2", n)
+	}
+
+	// contacts selected by a tag filter
+	c.Exec(`mutation($tags: [String!], $filter: [String!]) { assign_tags(tag_ids: $tags, filter: { tag_ids: $filter }) { total succeeded } }`, map[string]interface{}{
+		"tags":   []string{recent},
+		"filter": []string{vip},
+	}, &res)
+
+	if res.AssignTags.Total != 2 {
+		t.Errorf("filter matched %d contacts, want 2", res.AssignTags.Total)
+	} else if n := tagContactsCount(c, recent); n != 2 {
+		t.Errorf("recent tag counts %d contacts, want 2", n)
+	}
+
+	c.Exec(`mutation($tags: [String!], $ids: [String!]) { unassign_tags(tag_ids: $tags, ids: $ids) { total } }`, map[string]interface{}{
+		"tags": []string{vip},
+		"ids":  []string{a},
+	}, nil)
+
+	if n := tagContactsCount(c, vip); n != 1 {
+		t.Errorf("vip tag counts %d contacts once unassigned, want 1", n)
+	}
+
+	// deleted contacts leave their tags
+	c.Exec(`mutation($id: String!) { delete_contact(id: $id) }`, map[string]interface{}{"id": b}, nil)
+	if n := tagContactsCount(c, vip); n != 0 {
+		t.Errorf("vip tag counts %d contacts once deleted, want 0", n)
+	}
+}
+
+func TestContactsIsolation(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	id := addContact(c, "a@example.com")
+
+	other := graphqltest.DefaultRBAC
+	other.OrganizationID = "org_other"
+	res := struct {
+		Contacts []contact `json:"contacts"`
+	}{}
+
+	c.As(other).Exec(`{ contacts { id } }`, nil, &res)
+	if len(res.Contacts) != 0 {
+		t.Errorf("other organization lists %v", res.Contacts)
+	}
+
+	// deleting a contact of another organization is a no-op
+	c.As(other).Exec(`mutation($id: String!) { delete_contact(id: $id) }`, map[string]interface{}{"id": id}, nil)
+	c.Exec(`{ contacts { id } }`, nil, &res)
+	if len(res.Contacts) != 1 || res.Contacts[0].ID != id {
+		t.Errorf("contacts %v, want %s", res.Contacts, id)
+	}
+}
+
+func previewCount(c *graphqltest.Client, operator, tag string) int {
+	res := struct {
+		PreviewSegment struct {
+			ContactsCount int `json:"contacts_count"`
+		} `json:"preview_segment"`
+	}{}
+
+	c.Exec(`query($operator: String!, $tag: String!) {
+		preview_segment(rules: { operator: "AND", conditions: [{ field: "tags", operator: $operator, values: [$tag] }] }) { contacts_count }
+	}`, map[string]interface{}{"operator": operator, "tag": tag}, &res)
+
+	return res.PreviewSegment.ContactsCount
+}
+
+func TestTagRules(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	a := addContact(c, "a@example.com")
+	addContact(c, "b@example.com")
+	vip := addTag(c, "vip")
+
+	c.Exec(`mutation($contact: String!, $tag: String!) { assign_tag(contact_id: $contact, tag_id: $tag) { id } }`, map[string]interface{}{"contact": a, "tag": vip}, nil)
+	if n := previewCount(c, "IN", vip); n != 1 {
+		t.Errorf("IN matched %d contacts, want 1", n)
+	} else if n := previewCount(c, "NOT_IN", vip); n != 1 {
+		t.Errorf("NOT_IN matched %d contacts, want 1", n)
+	}
+}
+
+func TestSegmentRefresh(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	ctx := c.Context()
+	for i, stats := range []bson.M{
+		{"campaigns_sent": 4, "messages_opened": 2, "messages_clicked": 1},
+		{"campaigns_sent": 6, "messages_opened": 3, "messages_clicked": 2},
+		{},
+	} {
+		doc := bson.M{"_id": "ctc_" + string(rune('a'+i)), "organization_id": "org_test", "status": "ACTIVE", "stats": bson.M{"email": stats}}
+		if err := c.DB.Collection("contacts").InsertOne(ctx, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// contacts of other organizations are not counted
+	other := bson.M{"_id": "ctc_other", "organization_id": "org_other", "stats": bson.M{"email": bson.M{"campaigns_sent": 100}}}
+	if err := c.DB.Collection("contacts").InsertOne(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Exec(`mutation { create_segment(name: "all") { id } }`, nil, nil)
+	if _, err := jobs.Enqueue(ctx, "sch_test", "", "segments.refresh", bson.M{}); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Wait()
+	res := struct {
+		Segments []struct {
+			ContactsCount  int `json:"contacts_count"`
+			MailsSentCount int `json:"mails_sent_count"`
+			OpensCount     int `json:"opens_count"`
+			ClickRate      int `json:"click_rate"`
+		} `json:"segments"`
+	}{}
+
+	c.Exec(`{ segments { contacts_count mails_sent_count opens_count click_rate } }`, nil, &res)
+	if len(res.Segments) != 1 {
+		t.Fatalf("got %d segments, want 1", len(res.Segments))
+	} else if s := res.Segments[0]; s.ContactsCount != 3 || s.MailsSentCount != 10 || s.OpensCount != 5 || s.ClickRate != 30 {
+		t.Errorf("refreshed %+v, want 3 contacts, 10 sent, 5 opens & 30%% clicks", s)
+	}
+}
+
+func TestSearchContacts(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	for i := 0; i < 1000; i++ {
+		addContact(c, fmt.Sprintf("john%d@example.com", i))
+	}
+
+	// created last, thus beyond the first 1000 matches by id
+	id := addContact(c, "john@example.com")
+
+	res := struct {
+		SearchContacts struct {
+			Contacts  []contact `json:"contacts"`
+			Total     int       `json:"total"`
+			Truncated bool      `json:"truncated"`
+		} `json:"search_contacts"`
+	}{}
+
+	q := `query($query: String!, $offset: Int) { search_contacts(query: $query, first: 5, offset: $offset) { contacts { id } total truncated } }`
+	c.Exec(q, map[string]interface{}{"query": "john@example.com"}, &res)
+	if s := res.SearchContacts; len(s.Contacts) == 0 || s.Contacts[0].ID != id || s.Total != 1001 || !s.Truncated {
+		t.Errorf("search %+v, want %s first of 1001 truncated matches", s, id)
+	}
+
+	if r := c.Do(q, map[string]interface{}{"query": "john", "offset": 998}); len(r.Errors) == 0 || !strings.Contains(r.Errors[0].Message, "refine the query") {
+		t.Errorf("paging beyond the ranked matches: %v", r.Errors)
+	}
+}
+
+func TestAddContactValidation(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	res := struct {
+		AddContact contact `json:"add_contact"`
+	}{}
+
+	// unset fields are not validated
+	c.Exec(`mutation { add_contact(phone_number: "+33-6-123-45678") { id } }`, nil, &res)
+	if res.AddContact.ID == "" {
+		t.Error("contact without email not added")
+	}
+
+	for _, q := range []string{
+		`mutation { add_contact(email: "not an email") { id } }`,
+		`mutation { add_contact(phone_number: "12") { id } }`,
+	} {
+		if r := c.Do(q, nil); len(r.Errors) == 0 {
+			t.Errorf("%s: invalid field accepted", q)
+		}
+	}
+}
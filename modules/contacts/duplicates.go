@@ -0,0 +1,610 @@
+package contacts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/segmentio/ksuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"neodeliver.com/engine/db"
+	ggraphql "neodeliver.com/engine/graphql"
+	"neodeliver.com/engine/jobs"
+	"neodeliver.com/engine/rbac"
+	"neodeliver.com/utils"
+)
+
+// Duplicate contacts, detected by a background job matching normalized emails & E.164 phone numbers
+// duplicates are merged into a surviving contact, the ids of the merged contacts becoming its aliases
+// -------------------------------------------------------------------------------------
+
+const (
+	ContactDuplicatePrefixID    = "dup_"
+	DuplicatesDetectionPrefixID = "ddt_"
+)
+
+const duplicatesJob = "contacts.duplicates"
+
+// group of contacts sharing an email or a phone number, the groups of an organization being replaced by each detection
+type ContactDuplicate struct {
+	ID             string    `bson:"_id" json:"id"`
+	OrganizationID string    `bson:"organization_id" json:"organization_id"`
+	ContactIDs     []string  `bson:"contact_ids" json:"contact_ids" graphql:"contact_ids"`
+	Matches        []string  `bson:"matches" json:"matches"`           // EMAIL and/or PHONE
+	DetectionID    string    `bson:"detection_id" json:"detection_id"` // id of the detection job
+	DetectedAt     time.Time `bson:"detected_at" json:"detected_at"`
+}
+
+type DuplicatesDetection struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	Processed   int        `json:"processed"`
+	Total       int        `json:"total"`
+	Groups      int        `json:"groups"`   // groups of duplicates found
+	Contacts    int        `json:"contacts"` // contacts having duplicates
+	Error       *string    `json:"error"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
+
+type duplicatesResult struct {
+	Groups   int `bson:"groups"`
+	Contacts int `bson:"contacts"`
+}
+
+type Duplicates struct {
+	First  *int `validate:"omitempty,min=1,max=100"`
+	Offset *int `validate:"omitempty,min=0"`
+}
+
+type MergeContacts struct {
+	SurvivorID string       `json:"survivor_id" validate:"required"`
+	IDs        []string     `json:"ids" graphql:"ids" validate:"required,min=1,max=10"` // contacts merged into the survivor & deleted
+	Fields     []MergeField `json:"fields" validate:"max=50,dive"`
+}
+
+// value of a field kept from one of the merged contacts (or the survivor)
+// other fields keep the value of the survivor, or of the first merged contact having one
+type MergeField struct {
+	Field     string  `json:"field" validate:"oneof=external_id given_name last_name email phone_number lang attribute"`
+	Attribute *string `json:"attribute"` // key of the attribute
+	ContactID string  `json:"contact_id" validate:"required"`
+}
+
+func init() {
+	jobs.Register(duplicatesJob, runDuplicatesDetection)
+}
+
+func (ContactDuplicate) GraphqlMethods() []string {
+	return []string{"Contacts"}
+}
+
+// contacts of the group, merged contacts being no longer part of it
+func (d ContactDuplicate) Contacts(p graphql.ResolveParams, rbac rbac.RBAC) ([]Contact, error) {
+	list := []Contact{}
+	err := db.Coll("contacts").Find(p.Context, bson.M{"organization_id": rbac.OrganizationID, "_id": bson.M{"$in": d.ContactIDs}}, &list, db.FindOptions{
+		Sort: bson.D{{Key: "_id", Value: 1}},
+	})
+
+	return list, err
+}
+
+// start the detection of the duplicate contacts of the organization
+func (Mutation) DetectDuplicates(p graphql.ResolveParams, rbac rbac.RBAC) (DuplicatesDetection, error) {
+	j, err := jobs.Enqueue(p.Context, DuplicatesDetectionPrefixID+ksuid.New().String(), rbac.OrganizationID, duplicatesJob, bson.M{})
+	if err != nil {
+		return DuplicatesDetection{}, err
+	}
+
+	return toDuplicatesDetection(j), nil
+}
+
+// progress of a detection
+func (Query) DuplicatesDetection(p graphql.ResolveParams, rbac rbac.RBAC, args ggraphql.ByID) (*DuplicatesDetection, error) {
+	j, err := jobs.Get(p.Context, rbac.OrganizationID, args.ID)
+	if errors.Is(err, db.ErrNoDocuments) || (err == nil && j.Type != duplicatesJob) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	res := toDuplicatesDetection(j)
+	return &res, nil
+}
+
+// groups of duplicates found by the last detection
+func (Query) Duplicates(p graphql.ResolveParams, rbac rbac.RBAC, args Duplicates) ([]ContactDuplicate, error) {
+	opts := db.FindOptions{Sort: bson.D{{Key: "_id", Value: 1}}, Limit: 10}
+	if args.First != nil {
+		opts.Limit = int64(*args.First)
+	}
+
+	if args.Offset != nil {
+		opts.Skip = int64(*args.Offset)
+	}
+
+	list := []ContactDuplicate{}
+	err := db.Coll("contact_duplicates").Find(p.Context, bson.M{"organization_id": rbac.OrganizationID}, &list, opts)
+	return list, err
+}
+
+// merge contacts into the survivor: their tags, consents, history & stats move to the survivor before they are deleted
+// the ids of the merged contacts keep resolving to the survivor
+func (Mutation) MergeContacts(p graphql.ResolveParams, rbac rbac.RBAC, args MergeContacts) (Contact, error) {
+	ctx, organizationID := p.Context, rbac.OrganizationID
+
+	list := []Contact{}
+	err := db.Coll("contacts").Find(ctx, contactsByIDs(organizationID, append([]string{args.SurvivorID}, args.IDs...)), &list, db.FindOptions{})
+	if err != nil {
+		return Contact{}, err
+	}
+
+	// contacts by id & alias
+	byID := map[string]*Contact{}
+	for i := range list {
+		byID[list[i].ID] = &list[i]
+		for _, alias := range list[i].Aliases {
+			byID[alias] = &list[i]
+		}
+	}
+
+	survivor, ok := byID[args.SurvivorID]
+	if !ok {
+		return Contact{}, fmt.Errorf("The contact %s does not exist", args.SurvivorID)
+	}
+
+	merged, seen := []Contact{}, map[string]bool{survivor.ID: true}
+	for _, id := range args.IDs {
+		c, ok := byID[id]
+		if !ok {
+			return Contact{}, fmt.Errorf("The contact %s does not exist", id)
+		} else if c.ID == survivor.ID {
+			return Contact{}, errors.New("A contact can't be merged into itself")
+		} else if !seen[c.ID] {
+			seen[c.ID] = true
+			merged = append(merged, *c)
+		}
+	}
+
+	res := mergeContacts(*survivor, merged)
+	for _, f := range args.Fields {
+		c, ok := byID[f.ContactID]
+		if !ok || !seen[c.ID] {
+			return Contact{}, fmt.Errorf("The contact %s is not part of the merge", f.ContactID)
+		} else if err := res.keep(f, *c); err != nil {
+			return Contact{}, err
+		}
+	}
+
+	ids := contactIDs(merged)
+	if err := moveTags(ctx, organizationID, res.ID, ids); err != nil {
+		return res, err
+	}
+
+	for _, coll := range []string{"contact_transitions", "contact_consents"} {
+		if _, err := db.Coll(coll).UpdateMany(ctx, bson.M{"organization_id": organizationID, "contact_id": bson.M{"$in": ids}}, bson.M{"$set": bson.M{"contact_id": res.ID}}); err != nil {
+			return res, err
+		}
+	}
+
+	if err := removeDuplicates(ctx, organizationID, ids); err != nil {
+		return res, err
+	}
+
+	// merged contacts are deleted first, their email or external id may be kept by the survivor
+	if _, err := db.Coll("contacts").DeleteMany(ctx, bson.M{"organization_id": organizationID, "_id": bson.M{"$in": ids}}); err != nil {
+		return res, err
+	}
+
+	_, err = db.Coll("contacts").UpdateMany(ctx, bson.M{"organization_id": organizationID, "_id": res.ID}, bson.M{"$set": bson.M{
+		"external_id":         res.ExternalID,
+		"given_name":          res.GivenName,
+		"last_name":           res.LastName,
+		"email":               res.Email,
+		"phone_number":        res.PhoneNumber,
+		"lang":                res.Lang,
+		"notification_tokens": res.NotificationTokens,
+		"attributes":          res.Attributes,
+		"consents":            res.Consents,
+		"stats":               res.Stats,
+		"segment_ids":         res.SegmentIDs,
+		"aliases":             res.Aliases,
+		"search_tokens":       searchTokens(res.ContactData),
+	}})
+
+	if err != nil {
+		return res, err
+	}
+
+	if status := mergedStatus(*survivor, merged); status != res.Status {
+		if _, err := transitionContacts(ctx, organizationID, []Contact{res}, status, causeOf(rbac, "MERGE")); err != nil {
+			return res, err
+		}
+
+		res.Status = status
+	}
+
+	return res, nil
+}
+
+// ---
+
+func toDuplicatesDetection(j *jobs.Job) DuplicatesDetection {
+	r := duplicatesResult{}
+	j.DecodeResult(&r)
+
+	res := DuplicatesDetection{
+		ID:          j.ID,
+		Status:      string(j.Status),
+		Processed:   int(j.Processed),
+		Total:       int(j.Total),
+		Groups:      r.Groups,
+		Contacts:    r.Contacts,
+		CreatedAt:   j.CreatedAt,
+		StartedAt:   j.StartedAt,
+		CompletedAt: j.CompletedAt,
+	}
+
+	if j.Error != "" {
+		res.Error = &j.Error
+	}
+
+	return res
+}
+
+// group the contacts of the organization sharing an email or a phone number & replace the previous groups
+// resumed detections start over, groups are only replaced once every contact was read
+func runDuplicatesDetection(ctx context.Context, j *jobs.Job) error {
+	query := bson.M{"organization_id": j.OrganizationID}
+	total, err := db.Coll("contacts").Count(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	groups := newDuplicateGroups()
+	processed := int64(0)
+	err = eachContacts(ctx, query, func(page []Contact) error {
+		for _, c := range page {
+			groups.add(c)
+		}
+
+		processed += int64(len(page))
+		return j.Progress(ctx, processed, total, nil)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	now, result := time.Now(), duplicatesResult{}
+	models := []db.WriteModel{}
+	for _, g := range groups.list() {
+		result.Groups++
+		result.Contacts += len(g.ids)
+		models = append(models, db.InsertModel{Document: ContactDuplicate{
+			ID:             ContactDuplicatePrefixID + ksuid.New().String(),
+			OrganizationID: j.OrganizationID,
+			ContactIDs:     g.ids,
+			Matches:        g.matches,
+			DetectionID:    j.ID,
+			DetectedAt:     now,
+		}})
+	}
+
+	for len(models) > 0 {
+		n := len(models)
+		if n > bulkBatchSize {
+			n = bulkBatchSize
+		}
+
+		res, err := db.Coll("contact_duplicates").BulkWrite(ctx, models[:n])
+		if err != nil {
+			return err
+		} else if err := firstError(res); err != nil {
+			return err
+		}
+
+		models = models[n:]
+	}
+
+	if _, err := db.Coll("contact_duplicates").DeleteMany(ctx, bson.M{"organization_id": j.OrganizationID, "detection_id": bson.M{"$ne": j.ID}}); err != nil {
+		return err
+	}
+
+	return j.Progress(ctx, processed, total, result)
+}
+
+// union-find of the contacts sharing a normalized email or phone number
+type duplicateGroups struct {
+	parent  map[string]string          // contact id => id of a contact of the same group
+	keys    map[string]string          // normalized email or phone => first contact having it
+	matches map[string]map[string]bool // contact id => matches shared with its group
+}
+
+type duplicateGroup struct {
+	ids     []string
+	matches []string
+}
+
+func newDuplicateGroups() *duplicateGroups {
+	return &duplicateGroups{parent: map[string]string{}, keys: map[string]string{}, matches: map[string]map[string]bool{}}
+}
+
+func (g *duplicateGroups) add(c Contact) {
+	if c.Email != nil {
+		if email := utils.NormalizeEmail(*c.Email); email != "" {
+			g.link(c.ID, "email:"+email, "EMAIL")
+		}
+	}
+
+	if c.PhoneNumber != nil {
+		if phone := utils.NormalizePhone(*c.PhoneNumber); phone != "" {
+			g.link(c.ID, "phone:"+phone, "PHONE")
+		}
+	}
+}
+
+func (g *duplicateGroups) link(id, key, match string) {
+	first, ok := g.keys[key]
+	if !ok {
+		g.keys[key] = id
+		return
+	}
+
+	for _, c := range []string{first, id} {
+		if g.matches[c] == nil {
+			g.matches[c] = map[string]bool{}
+		}
+
+		g.matches[c][match] = true
+	}
+
+	if a, b := g.find(first), g.find(id); a != b {
+		g.parent[b] = a
+	}
+}
+
+func (g *duplicateGroups) find(id string) string {
+	parent, ok := g.parent[id]
+	if !ok {
+		g.parent[id] = id
+		return id
+	} else if parent == id {
+		return id
+	}
+
+	root := g.find(parent)
+	g.parent[id] = root
+	return root
+}
+
+// groups of at least 2 contacts, sorted by ids
+func (g *duplicateGroups) list() []duplicateGroup {
+	members, matches := map[string][]string{}, map[string]map[string]bool{}
+	for id := range g.parent {
+		root := g.find(id)
+		members[root] = append(members[root], id)
+		if matches[root] == nil {
+			matches[root] = map[string]bool{}
+		}
+
+		for m := range g.matches[id] {
+			matches[root][m] = true
+		}
+	}
+
+	res := []duplicateGroup{}
+	for root, ids := range members {
+		if len(ids) < 2 {
+			continue
+		}
+
+		sort.Strings(ids)
+		list := keys(matches[root])
+		sort.Strings(list)
+		res = append(res, duplicateGroup{ids: ids, matches: list})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ids[0] < res[j].ids[0]
+	})
+
+	return res
+}
+
+// filter of the contacts of the organization by ids, the ids of merged contacts matching their survivor
+func contactsByIDs(organizationID string, ids []string) bson.M {
+	return bson.M{
+		"organization_id": organizationID,
+		"$or":             []bson.M{{"_id": bson.M{"$in": ids}}, {"aliases": bson.M{"$in": ids}}},
+	}
+}
+
+// id of the contact the given id was merged into, the given id otherwise
+func resolveContactID(ctx context.Context, organizationID, id string) (string, error) {
+	c := Contact{}
+	err := db.Coll("contacts").FindOne(ctx, bson.M{"organization_id": organizationID, "aliases": id}, &c)
+	if errors.Is(err, db.ErrNoDocuments) {
+		return id, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return c.ID, nil
+}
+
+// survivor with the data of the merged contacts: fields missing on the survivor are taken from the first merged contact having one
+// lists, attributes, consents & stats are combined
+func mergeContacts(survivor Contact, merged []Contact) Contact {
+	res := survivor
+	res.ContactData = ContactData{}
+	for i := len(merged) - 1; i >= 0; i-- {
+		mergeContactData(&res.ContactData, merged[i].ContactData)
+	}
+
+	mergeContactData(&res.ContactData, survivor.ContactData)
+
+	tokens := append([]string{}, survivor.NotificationTokens...)
+	res.Consents = append([]Consent{}, survivor.Consents...)
+	res.SegmentIDs = append([]string{}, survivor.SegmentIDs...)
+	res.Aliases = append([]string{}, survivor.Aliases...)
+	for _, c := range merged {
+		tokens = append(tokens, c.NotificationTokens...)
+		for _, consent := range c.Consents {
+			res.Consents = mergeConsent(res.Consents, consent)
+		}
+
+		res.SegmentIDs = append(res.SegmentIDs, c.SegmentIDs...)
+		res.Aliases = append(res.Aliases, c.ID)
+		res.Aliases = append(res.Aliases, c.Aliases...)
+
+		mergeStats(&res.Stats.SMS, c.Stats.SMS)
+		mergeStats(&res.Stats.Email, c.Stats.Email)
+		mergeStats(&res.Stats.Notifications, c.Stats.Notifications)
+	}
+
+	res.NotificationTokens = uniqueStrings(tokens)
+	res.SegmentIDs = uniqueStrings(res.SegmentIDs)
+	res.Aliases = uniqueStrings(res.Aliases)
+	return res
+}
+
+// keep the value of the field of the contact, null values included
+func (c *Contact) keep(f MergeField, from Contact) error {
+	if f.Field == "attribute" {
+		if f.Attribute == nil {
+			return errors.New("Attribute fields require the key of the attribute")
+		}
+
+		v, ok := from.Attributes[*f.Attribute]
+		if !ok {
+			delete(c.Attributes, *f.Attribute)
+			return nil
+		}
+
+		if c.Attributes == nil {
+			c.Attributes = Attributes{}
+		}
+
+		c.Attributes[*f.Attribute] = v
+		return nil
+	}
+
+	dest, src := dataField(&c.ContactData, f.Field), dataField(&from.ContactData, f.Field)
+	*dest = *src
+	return nil
+}
+
+func dataField(d *ContactData, field string) **string {
+	switch field {
+	case "external_id":
+		return &d.ExternalID
+	case "given_name":
+		return &d.GivenName
+	case "last_name":
+		return &d.LastName
+	case "email":
+		return &d.Email
+	case "phone_number":
+		return &d.PhoneNumber
+	default:
+		return &d.Lang
+	}
+}
+
+// add the counters & keep the most recent dates
+func mergeStats(dest *ContactStatsItem, src ContactStatsItem) {
+	dest.CampaignsSent += src.CampaignsSent
+	dest.MessagesOpened += src.MessagesOpened
+	dest.MessagesClicked += src.MessagesClicked
+
+	for _, d := range []struct{ dest, src *time.Time }{
+		{&dest.LastCampaignSent, &src.LastCampaignSent},
+		{&dest.LastMessageOpened, &src.LastMessageOpened},
+		{&dest.LastMessageClicked, &src.LastMessageClicked},
+	} {
+		if d.src.After(*d.dest) {
+			*d.dest = *d.src
+		}
+	}
+}
+
+// status of the survivor once merged: contacts having complained or unsubscribed keep opting out
+func mergedStatus(survivor Contact, merged []Contact) string {
+	optOut := ""
+	for _, c := range merged {
+		if c.Status == StatusComplained || (c.Status == StatusUnsubscribed && optOut == "") {
+			optOut = c.Status
+		}
+	}
+
+	switch {
+	case optOut == "" || survivor.Status == optOut:
+		return survivor.Status
+	case canTransition(survivor.Status, optOut):
+		return optOut
+	case canTransition(survivor.Status, StatusUnsubscribed):
+		return StatusUnsubscribed
+	default:
+		return survivor.Status
+	}
+}
+
+// move the tags of the merged contacts to the survivor, tags it already has being removed from the counters
+func moveTags(ctx context.Context, organizationID, survivorID string, ids []string) error {
+	assigned := []ContactTag{}
+	err := db.Coll("contact_tags").Find(ctx, bson.M{"organization_id": organizationID, "contact_id": bson.M{"$in": append([]string{survivorID}, ids...)}}, &assigned, db.FindOptions{})
+	if err != nil {
+		return err
+	}
+
+	tagged := map[string]bool{}
+	for _, a := range assigned {
+		if a.ContactID == survivorID {
+			tagged[a.TagID] = true
+		}
+	}
+
+	moved, removed, counts := []string{}, []string{}, map[string]int{}
+	for _, a := range assigned {
+		switch {
+		case a.ContactID == survivorID:
+			continue
+		case tagged[a.TagID]:
+			removed = append(removed, a.ID)
+			counts[a.TagID]--
+		default:
+			tagged[a.TagID] = true
+			moved = append(moved, a.ID)
+		}
+	}
+
+	if _, err := db.Coll("contact_tags").UpdateMany(ctx, bson.M{"organization_id": organizationID, "_id": bson.M{"$in": moved}}, bson.M{"$set": bson.M{"contact_id": survivorID}}); err != nil {
+		return err
+	} else if _, err := db.Coll("contact_tags").DeleteMany(ctx, bson.M{"organization_id": organizationID, "_id": bson.M{"$in": removed}}); err != nil {
+		return err
+	} else if err := incrementTagCounts(ctx, organizationID, counts); err != nil {
+		return err
+	}
+
+	return addContactTagIDs(ctx, organizationID, map[string][]string{survivorID: keys(tagged)})
+}
+
+// remove the contacts from the groups of duplicates, groups left with a single contact being deleted
+func removeDuplicates(ctx context.Context, organizationID string, ids []string) error {
+	_, err := db.Coll("contact_duplicates").UpdateMany(ctx, bson.M{"organization_id": organizationID, "contact_ids": bson.M{"$in": ids}}, bson.M{"$pull": bson.M{"contact_ids": bson.M{"$in": ids}}})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Coll("contact_duplicates").DeleteMany(ctx, bson.M{"organization_id": organizationID, "$or": []bson.M{
+		{"contact_ids": bson.M{"$size": 0}},
+		{"contact_ids": bson.M{"$size": 1}},
+	}})
+
+	return err
+}
@@ -0,0 +1,190 @@
+package contacts_test
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"neodeliver.com/modules/graphqltest"
+)
+
+func seedContacts(t *testing.T, c *graphqltest.Client, docs ...bson.M) {
+	t.Helper()
+
+	for _, doc := range docs {
+		if _, ok := doc["organization_id"]; !ok {
+			doc["organization_id"] = "org_test"
+		}
+
+		if err := c.DB.Collection("contacts").InsertOne(c.Context(), doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDetectDuplicates(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	seedContacts(t, c,
+		// case variants of an email
+		bson.M{"_id": "ctc_a", "email": "John@Example.com"},
+		bson.M{"_id": "ctc_b", "email": " john@example.com"},
+		// formats of a phone number, linked to another contact by email
+		bson.M{"_id": "ctc_c", "phone_number": "+33-6-123-45678"},
+		bson.M{"_id": "ctc_d", "phone_number": "+33 6 12 34 56 78", "email": "d@example.com"},
+		bson.M{"_id": "ctc_e", "email": "D@example.com"},
+		bson.M{"_id": "ctc_f", "email": "f@example.com", "phone_number": "+44 20 7946 0000"},
+		// contacts of other organizations are never grouped
+		bson.M{"_id": "ctc_other", "organization_id": "org_other", "email": "john@example.com"},
+	)
+
+	res := struct {
+		DetectDuplicates struct {
+			ID string `json:"id"`
+		} `json:"detect_duplicates"`
+	}{}
+
+	c.Exec(`mutation { detect_duplicates { id } }`, nil, &res)
+	c.Wait()
+
+	detection := struct {
+		DuplicatesDetection struct {
+			Status   string `json:"status"`
+			Groups   int    `json:"groups"`
+			Contacts int    `json:"contacts"`
+		} `json:"duplicates_detection"`
+		Duplicates []struct {
+			ContactIDs []string `json:"contact_ids"`
+			Matches    []string `json:"matches"`
+		} `json:"duplicates"`
+	}{}
+
+	c.Exec(`query($id: String!) { duplicates_detection(id: $id) { status groups contacts } duplicates { contact_ids matches } }`, map[string]interface{}{"id": res.DetectDuplicates.ID}, &detection)
+	if d := detection.DuplicatesDetection; d.Status != "COMPLETED" || d.Groups != 2 || d.Contacts != 5 {
+		t.Errorf("detection %+v, want 2 groups of 5 contacts", d)
+	}
+
+	if len(detection.Duplicates) != 2 {
+		t.Fatalf("got %d groups, want 2", len(detection.Duplicates))
+	}
+
+	// groups created in the same second have random ids
+	sort.Slice(detection.Duplicates, func(i, j int) bool {
+		return detection.Duplicates[i].ContactIDs[0] < detection.Duplicates[j].ContactIDs[0]
+	})
+
+	if g := detection.Duplicates[0]; !reflect.DeepEqual(g.ContactIDs, []string{"ctc_a", "ctc_b"}) || !reflect.DeepEqual(g.Matches, []string{"EMAIL"}) {
+		t.Errorf("first group %+v, want ctc_a & ctc_b matching by email", g)
+	}
+
+	if g := detection.Duplicates[1]; !reflect.DeepEqual(g.ContactIDs, []string{"ctc_c", "ctc_d", "ctc_e"}) || !reflect.DeepEqual(g.Matches, []string{"EMAIL", "PHONE"}) {
+		t.Errorf("second group %+v, want ctc_c, ctc_d & ctc_e matching by email & phone", g)
+	}
+}
+
+func TestMergeContacts(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	seedContacts(t, c,
+		bson.M{"_id": "ctc_a", "email": "a@example.com", "given_name": "Ann", "status": "ACTIVE", "attributes": bson.M{"tier": "gold"}},
+		bson.M{"_id": "ctc_b", "email": "b@example.com", "given_name": "Anna", "last_name": "Lee", "status": "UNSUBSCRIBED", "attributes": bson.M{"tier": "silver"}},
+	)
+
+	vip, recent := addTag(c, "vip"), addTag(c, "recent")
+	for _, a := range [][2]string{{"ctc_a", vip}, {"ctc_b", vip}, {"ctc_b", recent}} {
+		c.Exec(`mutation($contact: String!, $tag: String!) { assign_tag(contact_id: $contact, tag_id: $tag) { id } }`, map[string]interface{}{"contact": a[0], "tag": a[1]}, nil)
+	}
+
+	res := struct {
+		MergeContacts struct {
+			ID         string                 `json:"id"`
+			GivenName  string                 `json:"given_name"`
+			LastName   string                 `json:"last_name"`
+			Email      string                 `json:"email"`
+			Status     string                 `json:"status"`
+			Aliases    []string               `json:"aliases"`
+			Attributes map[string]interface{} `json:"attributes"`
+		} `json:"merge_contacts"`
+	}{}
+
+	// fields are picked from the merged contact, others keep the value of the survivor or fill its missing values
+	c.Exec(`mutation { merge_contacts(survivor_id: "ctc_a", ids: ["ctc_b"], fields: [
+		{ field: "given_name", contact_id: "ctc_b" },
+		{ field: "attribute", attribute: "tier", contact_id: "ctc_b" }
+	]) { id given_name last_name email status aliases attributes } }`, nil, &res)
+
+	m := res.MergeContacts
+	if m.ID != "ctc_a" || m.GivenName != "Anna" || m.LastName != "Lee" || m.Email != "a@example.com" || m.Attributes["tier"] != "silver" {
+		t.Errorf("merged %+v, want the picked given name & tier, the survivor email & the merged last name", m)
+	} else if !reflect.DeepEqual(m.Aliases, []string{"ctc_b"}) {
+		t.Errorf("aliases %v, want ctc_b", m.Aliases)
+	}
+
+	// unsubscribed merged contacts keep the survivor opted out
+	if m.Status != "UNSUBSCRIBED" {
+		t.Errorf("status %s, want UNSUBSCRIBED", m.Status)
+	}
+
+	// tags shared by both contacts are counted once
+	if n := tagContactsCount(c, vip); n != 1 {
+		t.Errorf("vip has %d contacts, want 1", n)
+	} else if n := tagContactsCount(c, recent); n != 1 {
+		t.Errorf("recent has %d contacts, want 1", n)
+	} else if n := previewCount(c, "IN", recent); n != 1 {
+		t.Errorf("recent rule matched %d contacts, want the survivor", n)
+	}
+
+	// the merged id keeps resolving to the survivor
+	alias := struct {
+		Contact       contact `json:"contact"`
+		UpdateContact contact `json:"update_contact"`
+	}{}
+
+	c.Exec(`{ contact(id: "ctc_b") { id } }`, nil, &alias)
+	if alias.Contact.ID != "ctc_a" {
+		t.Errorf("contact(ctc_b) is %q, want ctc_a", alias.Contact.ID)
+	}
+
+	c.Exec(`mutation { update_contact(id: "ctc_b", data: { lang: "fr" }) { id } }`, nil, &alias)
+	if alias.UpdateContact.ID != "ctc_a" {
+		t.Errorf("update_contact(ctc_b) updated %q, want ctc_a", alias.UpdateContact.ID)
+	}
+
+	if n, _ := c.DB.Collection("contacts").Count(c.Context(), bson.M{"organization_id": "org_test"}); n != 1 {
+		t.Errorf("%d contacts left, want the survivor", n)
+	}
+}
+
+func TestMergedStatus(t *testing.T) {
+	tests := []struct {
+		survivor string
+		merged   []string
+		want     string
+	}{
+		{"ACTIVE", []string{"ACTIVE"}, "ACTIVE"},
+		{"ACTIVE", []string{"UNSUBSCRIBED", "COMPLAINED"}, "COMPLAINED"},
+		{"PENDING", []string{"COMPLAINED"}, "UNSUBSCRIBED"},
+		{"COMPLAINED", []string{"ACTIVE"}, "COMPLAINED"},
+		{"BOUNCED", []string{"UNSUBSCRIBED"}, "BOUNCED"},
+	}
+
+	for _, tt := range tests {
+		c := graphqltest.New(t, graphqltest.DefaultRBAC)
+		seedContacts(t, c, bson.M{"_id": "ctc_s", "email": "s@example.com", "status": tt.survivor})
+
+		ids := []string{}
+		for i, status := range tt.merged {
+			id := "ctc_" + string(rune('a'+i))
+			seedContacts(t, c, bson.M{"_id": id, "email": id + "@example.com", "status": status})
+			ids = append(ids, id)
+		}
+
+		res := struct {
+			MergeContacts contact `json:"merge_contacts"`
+		}{}
+
+		c.Exec(`mutation($ids: [String!]) { merge_contacts(survivor_id: "ctc_s", ids: $ids) { status } }`, map[string]interface{}{"ids": ids}, &res)
+		if s := res.MergeContacts.Status; s != tt.want {
+			t.Errorf("%s merging %v: status %s, want %s", tt.survivor, tt.merged, s, tt.want)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package contacts
+
+import "context"
+
+// replace the delivery of confirmation emails until the returned function is called
+func SetSendText(f func(ctx context.Context, to, subject, text string) error) (restore func()) {
+	previous := sendText
+	sendText = f
+	return func() { sendText = previous }
+}
@@ -0,0 +1,488 @@
+package contacts
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/segmentio/ksuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"neodeliver.com/engine/config"
+	"neodeliver.com/engine/db"
+	ggraphql "neodeliver.com/engine/graphql"
+	"neodeliver.com/engine/jobs"
+	"neodeliver.com/engine/logger"
+	"neodeliver.com/engine/rbac"
+	"neodeliver.com/engine/storage"
+)
+
+// Contact exports, streamed to csv or ndjson files by background jobs
+// files are downloaded through signed urls, renewed every time the export is queried, & deleted after EXPORTS_RETENTION
+// -------------------------------------------------------------------------------------
+
+const ContactExportPrefixID = "exp_"
+
+const (
+	exportJob       = "contacts.export"
+	exportBatchSize = 1000
+
+	exportsCleanupJob      = "contacts.exports_cleanup"
+	exportsCleanupInterval = time.Hour
+)
+
+// exported columns when none are selected, "stats" being opt-in
+var exportDefaultColumns = []string{"id", "external_id", "given_name", "last_name", "email", "phone_number", "lang", "status", "subscribed_at", "tags"}
+
+type ExportContacts struct {
+	Format  *string        `json:"format" bson:"format" validate:"omitempty,oneof=CSV NDJSON"` // CSV by default
+	Columns []string       `json:"columns" bson:"columns" validate:"dive,oneof=id external_id given_name last_name email phone_number lang notification_tokens status subscribed_at tags stats"`
+	Filter  *ContactFilter `json:"filter" bson:"filter"`
+}
+
+type ContactExport struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	Format      string     `json:"format"`
+	Processed   int        `json:"processed"`
+	Total       int        `json:"total"`
+	Size        int        `json:"size"`       // bytes, once completed
+	URL         *string    `json:"url"`        // signed download url, once completed & until the file is deleted
+	ExpiresAt   *time.Time `json:"expires_at"` // expiration of the url
+	Expired     bool       `json:"expired"`    // the file was deleted after EXPORTS_RETENTION
+	Error       *string    `json:"error"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
+
+type exportResult struct {
+	Key     string `bson:"key"`
+	Size    int64  `bson:"size"`
+	Deleted bool   `bson:"deleted"`
+}
+
+func init() {
+	jobs.Register(exportJob, runExport)
+	jobs.Register(exportsCleanupJob, runExportsCleanup)
+}
+
+func (Mutation) ExportContacts(p graphql.ResolveParams, rbac rbac.RBAC, args ExportContacts) (ContactExport, error) {
+	if args.Filter == nil {
+		args.Filter = &ContactFilter{}
+	}
+
+	// reject invalid filters before starting the export
+	if _, err := args.Filter.Query(p.Context, rbac.OrganizationID); err != nil {
+		return ContactExport{}, err
+	}
+
+	j, err := jobs.Enqueue(p.Context, ContactExportPrefixID+ksuid.New().String(), rbac.OrganizationID, exportJob, args)
+	if err != nil {
+		return ContactExport{}, err
+	}
+
+	return toContactExport(j), nil
+}
+
+// progress & download url of an export
+func (Query) ContactExport(p graphql.ResolveParams, rbac rbac.RBAC, args ggraphql.ByID) (*ContactExport, error) {
+	j, err := jobs.Get(p.Context, rbac.OrganizationID, args.ID)
+	if errors.Is(err, db.ErrNoDocuments) || (err == nil && j.Type != exportJob) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	res := toContactExport(j)
+	return &res, nil
+}
+
+// exports of the organization, most recent first
+func (Query) ContactExports(p graphql.ResolveParams, rbac rbac.RBAC, args JobsList) ([]ContactExport, error) {
+	opts := db.FindOptions{Limit: 10}
+	if args.First != nil {
+		opts.Limit = int64(*args.First)
+	}
+
+	if args.Offset != nil {
+		opts.Skip = int64(*args.Offset)
+	}
+
+	list, err := jobs.List(p.Context, rbac.OrganizationID, exportJob, opts)
+	res := []ContactExport{}
+	for i := range list {
+		res = append(res, toContactExport(&list[i]))
+	}
+
+	return res, err
+}
+
+func toContactExport(j *jobs.Job) ContactExport {
+	params := ExportContacts{}
+	j.Decode(&params)
+
+	r := exportResult{}
+	j.DecodeResult(&r)
+
+	res := ContactExport{
+		ID:          j.ID,
+		Status:      string(j.Status),
+		Format:      exportFormat(params),
+		Processed:   int(j.Processed),
+		Total:       int(j.Total),
+		CreatedAt:   j.CreatedAt,
+		CompletedAt: j.CompletedAt,
+	}
+
+	if j.Error != "" {
+		res.Error = &j.Error
+	}
+
+	if j.Status != jobs.Completed || r.Key == "" {
+		return res
+	}
+
+	// urls expire at the latest when the file is deleted
+	ttl := config.Get().Storage.URLTTL
+	if j.CompletedAt != nil {
+		ttl = min(ttl, time.Until(j.CompletedAt.Add(config.Get().Exports.Retention)))
+	}
+
+	res.Expired = r.Deleted || ttl <= 0
+	if !res.Expired {
+		url, expires := storage.SignedURL(r.Key, ttl)
+		res.URL, res.ExpiresAt, res.Size = &url, &expires, int(r.Size)
+	}
+
+	return res
+}
+
+func exportFormat(params ExportContacts) string {
+	if params.Format == nil {
+		return "CSV"
+	}
+
+	return *params.Format
+}
+
+// ---
+
+func runExport(ctx context.Context, j *jobs.Job) error {
+	params := ExportContacts{}
+	if err := j.Decode(&params); err != nil {
+		return err
+	} else if params.Filter == nil {
+		params.Filter = &ContactFilter{}
+	}
+
+	filter, err := params.Filter.Query(ctx, j.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	total, err := db.Coll("contacts").Count(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	// files can't be appended to, resumed exports start over
+	if err := j.Progress(ctx, 0, total, nil); err != nil {
+		return err
+	}
+
+	columns := params.Columns
+	if len(columns) == 0 {
+		columns = exportDefaultColumns
+	}
+
+	format, ext, contentType := exportFormat(params), ".csv", "text/csv; charset=utf-8"
+	if format == "NDJSON" {
+		ext, contentType = ".ndjson", "application/x-ndjson"
+	}
+
+	// the file is uploaded while it is written
+	key := "exports/" + j.OrganizationID + "/" + j.ID + ext
+	pr, pw := io.Pipe()
+	uploaded := make(chan error, 1)
+	var object storage.Object
+	go func() {
+		o, err := storage.Put(ctx, key, pr, contentType)
+		object = o
+		pr.CloseWithError(err)
+		uploaded <- err
+	}()
+
+	err = writeExport(ctx, j, pw, format, columns, filter, total)
+	pw.CloseWithError(err)
+	if uploadErr := <-uploaded; err == nil {
+		err = uploadErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return j.Progress(ctx, total, total, exportResult{Key: key, Size: object.Size})
+}
+
+func writeExport(ctx context.Context, j *jobs.Job, w io.Writer, format string, columns []string, filter bson.M, total int64) error {
+	buf := bufio.NewWriter(w)
+	row, flush := func(values map[string]interface{}) error {
+		return json.NewEncoder(buf).Encode(values)
+	}, buf.Flush
+
+	if format != "NDJSON" {
+		header := csvColumns(columns)
+		cw := csv.NewWriter(buf)
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+
+		row = func(values map[string]interface{}) error {
+			record := make([]string, len(header))
+			for i, c := range header {
+				record[i] = csvValue(values, c)
+			}
+
+			return cw.Write(record)
+		}
+
+		flush = func() error {
+			if cw.Flush(); cw.Error() != nil {
+				return cw.Error()
+			}
+
+			return buf.Flush()
+		}
+	}
+
+	tags, err := tagNames(ctx, j.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	// pages are read by id, contacts created meanwhile are exported when their id is greater
+	processed, last := int64(0), ""
+	for {
+		page := []Contact{}
+		query := filter
+		if last != "" {
+			query = bson.M{"$and": []bson.M{filter, {"_id": bson.M{"$gt": last}}}}
+		}
+
+		err := db.Coll("contacts").Find(ctx, query, &page, db.FindOptions{Sort: bson.D{{Key: "_id", Value: 1}}, Limit: exportBatchSize})
+		if err != nil {
+			return err
+		} else if len(page) == 0 {
+			break
+		}
+
+		contactTags, err := contactTagNames(ctx, j.OrganizationID, page, tags)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range page {
+			if err := row(exportValues(c, columns, contactTags[c.ID])); err != nil {
+				return err
+			}
+		}
+
+		processed += int64(len(page))
+		last = page[len(page)-1].ID
+		if total < processed {
+			total = processed
+		}
+
+		if err := j.Progress(ctx, processed, total, nil); err != nil {
+			return err
+		}
+	}
+
+	return flush()
+}
+
+// delete the files of the exports completed before the retention, by batches of 1000 per run
+func runExportsCleanup(ctx context.Context, j *jobs.Job) error {
+	before := time.Now().Add(-config.Get().Exports.Retention)
+	list := []jobs.Job{}
+	err := db.Coll("jobs").Find(ctx, bson.M{
+		"type":           exportJob,
+		"status":         jobs.Completed,
+		"completed_at":   bson.M{"$lt": before},
+		"result.key":     bson.M{"$exists": true},
+		"result.deleted": bson.M{"$ne": true},
+	}, &list, db.FindOptions{Limit: exportBatchSize})
+
+	if err != nil {
+		return err
+	}
+
+	for _, e := range list {
+		r := exportResult{}
+		if err := e.DecodeResult(&r); err != nil {
+			logger.Report(ctx, err, "Could not decode export result", "export_id", e.ID)
+			continue
+		}
+
+		if err := storage.Delete(ctx, r.Key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+
+		if _, err := db.Coll("jobs").UpdateMany(ctx, bson.M{"_id": e.ID}, bson.M{"$set": bson.M{"result.deleted": true}}); err != nil {
+			return err
+		}
+	}
+
+	return j.Progress(ctx, int64(len(list)), int64(len(list)), nil)
+}
+
+// values of the selected columns, stats being nested by channel
+func exportValues(c Contact, columns []string, tags []string) map[string]interface{} {
+	res := map[string]interface{}{}
+	for _, col := range columns {
+		switch col {
+		case "id":
+			res[col] = c.ID
+		case "external_id":
+			res[col] = c.ExternalID
+		case "given_name":
+			res[col] = c.GivenName
+		case "last_name":
+			res[col] = c.LastName
+		case "email":
+			res[col] = c.Email
+		case "phone_number":
+			res[col] = c.PhoneNumber
+		case "lang":
+			res[col] = c.Lang
+		case "notification_tokens":
+			res[col] = c.NotificationTokens
+		case "status":
+			res[col] = c.Status
+		case "subscribed_at":
+			res[col] = c.SubscribedAt
+		case "tags":
+			res[col] = tags
+		case "stats":
+			res[col] = map[string]interface{}{
+				"sms":           statsValues(c.Stats.SMS),
+				"email":         statsValues(c.Stats.Email),
+				"notifications": statsValues(c.Stats.Notifications),
+			}
+		}
+	}
+
+	return res
+}
+
+func statsValues(s ContactStatsItem) map[string]interface{} {
+	return map[string]interface{}{
+		"campaigns_sent":       s.CampaignsSent,
+		"last_campaign_sent":   optionalTime(s.LastCampaignSent),
+		"messages_opened":      s.MessagesOpened,
+		"last_message_opened":  optionalTime(s.LastMessageOpened),
+		"messages_clicked":     s.MessagesClicked,
+		"last_message_clicked": optionalTime(s.LastMessageClicked),
+	}
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+// csv header, stats are flattened to one column per channel & counter (eg: stats.email.messages_opened)
+func csvColumns(columns []string) []string {
+	res := []string{}
+	for _, c := range columns {
+		if c != "stats" {
+			res = append(res, c)
+			continue
+		}
+
+		for _, channel := range []string{"sms", "email", "notifications"} {
+			for _, f := range []string{"campaigns_sent", "last_campaign_sent", "messages_opened", "last_message_opened", "messages_clicked", "last_message_clicked"} {
+				res = append(res, "stats."+channel+"."+f)
+			}
+		}
+	}
+
+	return res
+}
+
+// csv cell of a column, lists are separated by ";" like imports
+func csvValue(values map[string]interface{}, column string) string {
+	var v interface{}
+	if strings.HasPrefix(column, "stats.") {
+		parts := strings.Split(column, ".")
+		v = values["stats"].(map[string]interface{})[parts[1]].(map[string]interface{})[parts[2]]
+	} else {
+		v = values[column]
+	}
+
+	switch t := v.(type) {
+	case string:
+		return t
+	case *string:
+		if t != nil {
+			return *t
+		}
+	case int:
+		return strconv.Itoa(t)
+	case []string:
+		return strings.Join(t, ";")
+	case time.Time:
+		return t.UTC().Format(time.RFC3339)
+	case *time.Time:
+		if t != nil {
+			return t.UTC().Format(time.RFC3339)
+		}
+	}
+
+	return ""
+}
+
+// names of the organization tags by id
+func tagNames(ctx context.Context, organizationID string) (map[string]string, error) {
+	list := []Tag{}
+	err := db.Coll("tags").Find(ctx, bson.M{"organization_id": organizationID}, &list, db.FindOptions{})
+
+	res := map[string]string{}
+	for _, t := range list {
+		if t.Name != nil {
+			res[t.ID] = *t.Name
+		}
+	}
+
+	return res, err
+}
+
+// tag names of the contacts by contact id
+func contactTagNames(ctx context.Context, organizationID string, contacts []Contact, names map[string]string) (map[string][]string, error) {
+	ids := make([]string, len(contacts))
+	for i, c := range contacts {
+		ids[i] = c.ID
+	}
+
+	list := []ContactTag{}
+	err := db.Coll("contact_tags").Find(ctx, bson.M{"organization_id": organizationID, "contact_id": bson.M{"$in": ids}}, &list, db.FindOptions{})
+
+	res := map[string][]string{}
+	for _, t := range list {
+		if name, ok := names[t.TagID]; ok {
+			res[t.ContactID] = append(res[t.ContactID], name)
+		}
+	}
+
+	return res, err
+}
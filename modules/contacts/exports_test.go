@@ -0,0 +1,184 @@
+package contacts_test
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"neodeliver.com/engine/jobs"
+	"neodeliver.com/engine/storage"
+	"neodeliver.com/modules/graphqltest"
+)
+
+type contactExport struct {
+	ID      string  `json:"id"`
+	Status  string  `json:"status"`
+	Total   int     `json:"total"`
+	URL     *string `json:"url"`
+	Expired bool    `json:"expired"`
+}
+
+// export the contacts of the test organization & wait for the file
+func exportContacts(t *testing.T, c *graphqltest.Client, format string, columns []string) contactExport {
+	t.Helper()
+
+	res := struct {
+		ExportContacts contactExport `json:"export_contacts"`
+	}{}
+
+	c.Exec(`mutation($format: String, $columns: [String!]) { export_contacts(format: $format, columns: $columns) { id } }`, map[string]interface{}{
+		"format":  format,
+		"columns": columns,
+	}, &res)
+
+	c.Wait()
+	return contactExportByID(t, c, res.ExportContacts.ID)
+}
+
+func contactExportByID(t *testing.T, c *graphqltest.Client, id string) contactExport {
+	t.Helper()
+
+	res := struct {
+		ContactExport contactExport `json:"contact_export"`
+	}{}
+
+	c.Exec(`query($id: String!) { contact_export(id: $id) { id status total url expired } }`, map[string]interface{}{"id": id}, &res)
+	return res.ContactExport
+}
+
+// download the file of an export through its signed url
+func download(t *testing.T, e contactExport) (int, string) {
+	t.Helper()
+
+	if e.Status != "COMPLETED" || e.URL == nil {
+		t.Fatalf("export %+v, want a completed export with an url", e)
+	}
+
+	w := httptest.NewRecorder()
+	storage.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, *e.URL, nil))
+	return w.Code, w.Body.String()
+}
+
+func seedExportContacts(t *testing.T, c *graphqltest.Client) {
+	t.Helper()
+
+	opened := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, doc := range []bson.M{
+		{"_id": "ctc_a", "organization_id": "org_test", "email": "a@example.com", "given_name": "Ann", "status": "ACTIVE", "stats": bson.M{"email": bson.M{"campaigns_sent": 4, "messages_opened": 2, "last_message_opened": opened}}},
+		{"_id": "ctc_b", "organization_id": "org_test", "email": "b@example.com", "status": "UNSUBSCRIBED"},
+		{"_id": "ctc_other", "organization_id": "org_other", "email": "other@example.com"},
+	} {
+		if err := c.DB.Collection("contacts").InsertOne(c.Context(), doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	seedExportContacts(t, c)
+
+	e := exportContacts(t, c, "CSV", []string{"id", "email", "stats"})
+	if e.Total != 2 {
+		t.Errorf("exported %d contacts, want the 2 of the organization", e.Total)
+	}
+
+	code, body := download(t, e)
+	if code != http.StatusOK {
+		t.Fatalf("download: status %d %s", code, body)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(rows) != 3 {
+		t.Fatalf("got %d rows, want a header & 2 contacts", len(rows))
+	}
+
+	// only the selected columns, stats flattened to a column per channel & counter
+	header := rows[0]
+	if len(header) != 2+3*6 || header[0] != "id" || header[1] != "email" || header[2] != "stats.sms.campaigns_sent" {
+		t.Fatalf("header %v, want id, email & the flattened stats", header)
+	}
+
+	values := map[string]string{}
+	for i, col := range header {
+		values[col] = rows[1][i]
+	}
+
+	if values["id"] != "ctc_a" || values["email"] != "a@example.com" {
+		t.Errorf("first row %v, want ctc_a", values)
+	} else if values["stats.email.campaigns_sent"] != "4" || values["stats.email.messages_opened"] != "2" || values["stats.email.last_message_opened"] != "2024-03-01T12:00:00Z" {
+		t.Errorf("email stats %v, want 4 sent & 2 opened on 2024-03-01", values)
+	} else if values["stats.email.last_campaign_sent"] != "" || values["stats.sms.campaigns_sent"] != "0" {
+		t.Errorf("stats %v, want empty missing dates & zero counters", values)
+	}
+}
+
+func TestExportNDJSON(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	seedExportContacts(t, c)
+
+	code, body := download(t, exportContacts(t, c, "NDJSON", nil))
+	if code != http.StatusOK {
+		t.Fatalf("download: status %d %s", code, body)
+	}
+
+	lines := []map[string]interface{}{}
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := map[string]interface{}{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+
+		lines = append(lines, line)
+	}
+
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2 contacts", len(lines))
+	}
+
+	// default columns, without the opt-in stats
+	if l := lines[1]; l["id"] != "ctc_b" || l["status"] != "UNSUBSCRIBED" || l["given_name"] != nil {
+		t.Errorf("second line %v, want ctc_b with its fields", l)
+	} else if _, ok := l["stats"]; ok {
+		t.Errorf("second line %v, want no stats by default", l)
+	}
+}
+
+func TestExportRetention(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	seedExportContacts(t, c)
+	e := exportContacts(t, c, "CSV", []string{"id"})
+
+	// exports completed before the retention are deleted by the cleanup job
+	old := time.Now().Add(-8 * 24 * time.Hour)
+	if _, err := c.DB.Collection("jobs").UpdateMany(c.Context(), bson.M{"_id": e.ID}, bson.M{"$set": bson.M{"completed_at": old}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the url is no longer signed once the retention elapsed, even before the cleanup
+	if e := contactExportByID(t, c, e.ID); e.URL != nil || !e.Expired {
+		t.Errorf("export %+v, want an expired export without url", e)
+	}
+
+	if _, err := jobs.Enqueue(c.Context(), "sch_test", "", "contacts.exports_cleanup", bson.M{}); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Wait()
+	if _, _, err := storage.Open(c.Context(), "exports/org_test/"+e.ID+".csv"); err != storage.ErrNotFound {
+		t.Errorf("open: got %v, want the file deleted", err)
+	}
+
+	if e := contactExportByID(t, c, e.ID); e.URL != nil || !e.Expired || e.Status != "COMPLETED" {
+		t.Errorf("export %+v, want a completed & expired export", e)
+	}
+}
@@ -0,0 +1,63 @@
+package contacts
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"neodeliver.com/engine/db"
+)
+
+// selection of contacts, shared by exports & bulk operations
+// conditions are combined, an empty filter matches every contact of the organization
+type ContactFilter struct {
+	Status     *string  `json:"status" bson:"status,omitempty"`
+	Lang       *string  `json:"lang" bson:"lang,omitempty"`
+	Email      *string  `json:"email" bson:"email,omitempty"`
+	ExternalID *string  `json:"external_id" bson:"external_id,omitempty"`
+	TagIDs     []string `json:"tag_ids" bson:"tag_ids,omitempty" graphql:"tag_ids"` // contacts having all the tags
+	SegmentID  *string  `json:"segment_id" bson:"segment_id,omitempty"`
+}
+
+// mongodb filter of the contacts collection, scoped to the organization
+func (f ContactFilter) Query(ctx context.Context, organizationID string) (bson.M, error) {
+	and := []bson.M{{"organization_id": organizationID}}
+
+	for k, v := range map[string]*string{
+		"status":      f.Status,
+		"lang":        f.Lang,
+		"email":       f.Email,
+		"external_id": f.ExternalID,
+	} {
+		if v != nil {
+			and = append(and, bson.M{k: *v})
+		}
+	}
+
+	if len(f.TagIDs) > 0 {
+		and = append(and, bson.M{"tag_ids": bson.M{"$all": f.TagIDs}})
+	}
+
+	if f.SegmentID != nil {
+		s := Segment{}
+		err := db.Coll("segments").FindOne(ctx, bson.M{"_id": *f.SegmentID, "organization_id": organizationID}, &s)
+		if errors.Is(err, db.ErrNoDocuments) {
+			return nil, errors.New("The segment does not exist")
+		} else if err != nil {
+			return nil, err
+		}
+
+		q, err := s.Query(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		and = append(and, q)
+	}
+
+	if len(and) == 1 {
+		return and[0], nil
+	}
+
+	return bson.M{"$and": and}, nil
+}
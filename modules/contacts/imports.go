@@ -0,0 +1,724 @@
+package contacts
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/graphql-go/graphql"
+	"github.com/segmentio/ksuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"neodeliver.com/engine/db"
+	ggraphql "neodeliver.com/engine/graphql"
+	"neodeliver.com/engine/jobs"
+	"neodeliver.com/engine/rbac"
+	"neodeliver.com/engine/storage"
+	utils "neodeliver.com/utils"
+)
+
+// Asynchronous csv imports, executed as background jobs
+// rows are matched to existing contacts by external_id or email, tags are created when missing
+// -------------------------------------------------------------------------------------
+
+const ContactImportPrefixID = "imp_"
+
+const (
+	importJob        = "contacts.import"
+	importBatchSize  = 500
+	importErrorsSize = 1000 // errors kept in the report, failed rows are still counted
+)
+
+// csv column mapped to a contact field or custom attribute, multiple values (tags, tokens) are separated by ";"
+type ImportMapping struct {
+	Column    string  `json:"column" bson:"column" validate:"required"`
+	Field     string  `json:"field" bson:"field" validate:"oneof=external_id given_name last_name email phone_number lang notification_tokens tags attribute"`
+	Attribute *string `json:"attribute" bson:"attribute,omitempty"` // key of the custom attribute, for the attribute field
+}
+
+type ImportContacts struct {
+	UploadID     string          `json:"upload_id" bson:"upload_id" validate:"required"`
+	Mapping      []ImportMapping `json:"mapping" bson:"mapping" validate:"required,min=1,dive"`
+	TagIDs       []string        `json:"tag_ids" bson:"tag_ids" graphql:"tag_ids"`                         // tags assigned to every imported contact
+	Mode         *string         `json:"mode" bson:"mode" validate:"omitempty,oneof=CREATE UPDATE UPSERT"` // UPSERT by default
+	Delimiter    *string         `json:"delimiter" bson:"delimiter" validate:"omitempty,len=1"`            // "," by default
+	Consents     []ConsentChange `json:"consents" bson:"consents" validate:"max=100,dive"`                 // consents of every created or updated contact, the import being their proof
+	ConsentProof *ConsentProof   `json:"consent_proof" bson:"consent_proof"`                               // eg: wording of the form the contacts agreed to
+}
+
+type ContactImport struct {
+	ID          string               `json:"id"`
+	Status      string               `json:"status"`
+	Processed   int                  `json:"processed"`
+	Total       int                  `json:"total"`
+	Created     int                  `json:"created"`
+	Updated     int                  `json:"updated"`
+	Skipped     int                  `json:"skipped"` // blank rows, rows matching no contact in UPDATE mode, or an existing one in CREATE mode
+	Failed      int                  `json:"failed"`
+	Errors      []ContactImportError `json:"errors"`
+	Error       *string              `json:"error"`
+	CreatedAt   time.Time            `json:"created_at"`
+	StartedAt   *time.Time           `json:"started_at"`
+	CompletedAt *time.Time           `json:"completed_at"`
+}
+
+type ContactImportError struct {
+	Row     int     `json:"row" bson:"row"` // 1 for the first row after the header
+	Column  *string `json:"column" bson:"column,omitempty"`
+	Message string  `json:"message" bson:"message"`
+}
+
+type importResult struct {
+	Created int                  `bson:"created"`
+	Updated int                  `bson:"updated"`
+	Skipped int                  `bson:"skipped"`
+	Failed  int                  `bson:"failed"`
+	Errors  []ContactImportError `bson:"errors"`
+}
+
+// paging of imports & exports
+type JobsList struct {
+	First  *int `validate:"omitempty,min=1,max=100"`
+	Offset *int `validate:"omitempty,min=0"`
+}
+
+func init() {
+	jobs.Register(importJob, runImport)
+}
+
+func (Mutation) ImportContacts(p graphql.ResolveParams, rbac rbac.RBAC, args ImportContacts) (ContactImport, error) {
+	defs, err := attributeDefinitions(p.Context, rbac.OrganizationID)
+	if err != nil {
+		return ContactImport{}, err
+	}
+
+	seen := map[string]bool{}
+	for _, m := range args.Mapping {
+		field := m.Field
+		if field == "attribute" {
+			if m.Attribute == nil {
+				return ContactImport{}, errors.New("Attribute mappings require the key of the attribute")
+			} else if _, ok := defs[*m.Attribute]; !ok {
+				return ContactImport{}, fmt.Errorf("The attribute %s does not exist", *m.Attribute)
+			}
+
+			field = "attributes." + *m.Attribute
+		}
+
+		if field != "tags" && seen[field] {
+			return ContactImport{}, fmt.Errorf("The field %s is mapped to multiple columns", field)
+		}
+
+		seen[field] = true
+	}
+
+	// verify the mapped columns before starting the import
+	f, _, err := storage.Open(p.Context, storage.UploadKey(rbac.OrganizationID, args.UploadID))
+	if errors.Is(err, storage.ErrNotFound) {
+		return ContactImport{}, errors.New("The upload does not exist")
+	} else if err != nil {
+		return ContactImport{}, err
+	}
+
+	defer f.Close()
+	if _, err := importColumns(newImportReader(f, args.Delimiter), args.Mapping); err != nil {
+		return ContactImport{}, err
+	}
+
+	if err := verifyTags(p.Context, rbac.OrganizationID, args.TagIDs); err != nil {
+		return ContactImport{}, err
+	} else if err := verifyConsents(p.Context, rbac.OrganizationID, args.Consents); err != nil {
+		return ContactImport{}, err
+	}
+
+	j, err := jobs.Enqueue(p.Context, ContactImportPrefixID+ksuid.New().String(), rbac.OrganizationID, importJob, args)
+	if err != nil {
+		return ContactImport{}, err
+	}
+
+	return toContactImport(j), nil
+}
+
+// progress & report of an import
+func (Query) ContactImport(p graphql.ResolveParams, rbac rbac.RBAC, args ggraphql.ByID) (*ContactImport, error) {
+	j, err := jobs.Get(p.Context, rbac.OrganizationID, args.ID)
+	if errors.Is(err, db.ErrNoDocuments) || (err == nil && j.Type != importJob) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	res := toContactImport(j)
+	return &res, nil
+}
+
+// imports of the organization, most recent first
+func (Query) ContactImports(p graphql.ResolveParams, rbac rbac.RBAC, args JobsList) ([]ContactImport, error) {
+	opts := db.FindOptions{Limit: 10}
+	if args.First != nil {
+		opts.Limit = int64(*args.First)
+	}
+
+	if args.Offset != nil {
+		opts.Skip = int64(*args.Offset)
+	}
+
+	list, err := jobs.List(p.Context, rbac.OrganizationID, importJob, opts)
+	res := []ContactImport{}
+	for i := range list {
+		res = append(res, toContactImport(&list[i]))
+	}
+
+	return res, err
+}
+
+func toContactImport(j *jobs.Job) ContactImport {
+	r := importResult{}
+	j.DecodeResult(&r)
+
+	res := ContactImport{
+		ID:          j.ID,
+		Status:      string(j.Status),
+		Processed:   int(j.Processed),
+		Total:       int(j.Total),
+		Created:     r.Created,
+		Updated:     r.Updated,
+		Skipped:     r.Skipped,
+		Failed:      r.Failed,
+		Errors:      r.Errors,
+		CreatedAt:   j.CreatedAt,
+		StartedAt:   j.StartedAt,
+		CompletedAt: j.CompletedAt,
+	}
+
+	if j.Error != "" {
+		res.Error = &j.Error
+	}
+
+	if res.Errors == nil {
+		res.Errors = []ContactImportError{}
+	}
+
+	return res
+}
+
+// ---
+
+func newImportReader(r io.Reader, delimiter *string) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	if delimiter != nil {
+		reader.Comma, _ = utf8.DecodeRuneInString(*delimiter)
+	}
+
+	return reader
+}
+
+// read the header, returning the column index of each mapping
+func importColumns(r *csv.Reader, mapping []ImportMapping) ([]int, error) {
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, errors.New("The file is empty")
+	} else if err != nil {
+		return nil, fmt.Errorf("The file is not a valid csv file: %w", err)
+	}
+
+	index := map[string]int{}
+	for i, h := range header {
+		if i == 0 {
+			h = strings.TrimPrefix(h, "\ufeff") // utf-8 byte order mark
+		}
+
+		index[strings.TrimSpace(h)] = i
+	}
+
+	res := make([]int, len(mapping))
+	for i, m := range mapping {
+		col, ok := index[m.Column]
+		if !ok {
+			return nil, fmt.Errorf("The column %s does not exist", m.Column)
+		}
+
+		res[i] = col
+	}
+
+	return res, nil
+}
+
+func runImport(ctx context.Context, j *jobs.Job) error {
+	params := ImportContacts{}
+	if err := j.Decode(&params); err != nil {
+		return err
+	}
+
+	result := importResult{}
+	if err := j.DecodeResult(&result); err != nil {
+		return err
+	}
+
+	open := func() (*csv.Reader, []int, io.Closer, error) {
+		f, _, err := storage.Open(ctx, storage.UploadKey(j.OrganizationID, params.UploadID))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		r := newImportReader(f, params.Delimiter)
+		columns, err := importColumns(r, params.Mapping)
+		if err != nil {
+			f.Close()
+			return nil, nil, nil, err
+		}
+
+		return r, columns, f, nil
+	}
+
+	// count rows first to report the progress
+	total := j.Total
+	if total == 0 {
+		r, _, f, err := open()
+		if err != nil {
+			return err
+		}
+
+		for {
+			if _, err := r.Read(); err == io.EOF {
+				break
+			} else if err != nil && !errors.As(err, new(*csv.ParseError)) {
+				f.Close()
+				return err
+			}
+
+			total++
+		}
+
+		f.Close()
+		if err := j.Progress(ctx, 0, total, result); err != nil {
+			return err
+		}
+	}
+
+	r, columns, f, err := open()
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	attributes, err := attributeDefinitions(ctx, j.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	imp := &importer{
+		organizationID: j.OrganizationID,
+		importID:       j.ID,
+		params:         params,
+		result:         &result,
+		tags:           map[string]string{},
+		attributes:     attributes,
+	}
+
+	// resume after the rows processed by previous attempts
+	row := 0
+	batch := []importRow{}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+
+		row++
+		if int64(row) <= j.Processed {
+			continue
+		}
+
+		if errors.As(err, new(*csv.ParseError)) {
+			imp.fail(row, nil, err.Error())
+		} else if err != nil {
+			return err
+		} else if blankRecord(record) {
+			imp.result.Skipped++
+		} else {
+			batch = append(batch, imp.parse(row, record, columns))
+		}
+
+		if row%importBatchSize == 0 {
+			if err := imp.apply(ctx, batch); err != nil {
+				return err
+			} else if err := j.Progress(ctx, int64(row), total, result); err != nil {
+				return err
+			}
+
+			batch = batch[:0]
+		}
+	}
+
+	if err := imp.apply(ctx, batch); err != nil {
+		return err
+	}
+
+	return j.Progress(ctx, int64(row), total, result)
+}
+
+// ---
+
+type importer struct {
+	organizationID string
+	importID       string
+	params         ImportContacts
+	result         *importResult
+	tags           map[string]string // tag ids by name
+	attributes     map[string]ContactAttribute
+}
+
+type importRow struct {
+	row  int
+	data ContactData
+	tags []string // tag names, replaced by their ids before the row is written
+	err  bool
+}
+
+func (imp *importer) fail(row int, column *string, message string) {
+	imp.result.Failed++
+	if len(imp.result.Errors) < importErrorsSize {
+		imp.result.Errors = append(imp.result.Errors, ContactImportError{Row: row, Column: column, Message: message})
+	}
+}
+
+// map the record to contact data, empty cells are ignored
+func (imp *importer) parse(row int, record []string, columns []int) importRow {
+	res := importRow{row: row}
+
+	for i, m := range imp.params.Mapping {
+		if columns[i] >= len(record) {
+			continue
+		}
+
+		value := strings.TrimSpace(record[columns[i]])
+		if value == "" {
+			continue
+		}
+
+		column := m.Column
+		invalid := func(message string) importRow {
+			imp.fail(row, &column, message)
+			return importRow{row: row, err: true}
+		}
+
+		switch m.Field {
+		case "external_id":
+			res.data.ExternalID = &value
+		case "given_name":
+			res.data.GivenName = &value
+		case "last_name":
+			res.data.LastName = &value
+		case "email":
+			value = strings.ToLower(value)
+			if !utils.ValidateEmail(&value) {
+				return invalid("Email address is not valid")
+			}
+
+			res.data.Email = &value
+		case "phone_number":
+			if !utils.ValidatePhone(&value) {
+				return invalid("Phone number is not valid")
+			}
+
+			res.data.PhoneNumber = &value
+		case "lang":
+			value = strings.ToLower(value)
+			if !utils.ValidateLanguageCode(&value) {
+				return invalid("Language is not valid")
+			}
+
+			res.data.Lang = &value
+		case "notification_tokens":
+			for _, token := range splitValues(value) {
+				if !utils.ValidateNotificationToken(&token) {
+					return invalid("Notification tokens include invalid token")
+				}
+
+				res.data.NotificationTokens = append(res.data.NotificationTokens, token)
+			}
+		case "tags":
+			res.tags = append(res.tags, splitValues(value)...)
+		case "attribute":
+			// attributes deleted since the import started are ignored
+			a, ok := imp.attributes[*m.Attribute]
+			if !ok {
+				continue
+			}
+
+			v, err := a.parse(value)
+			if err != nil {
+				return invalid(err.Error())
+			}
+
+			if res.data.Attributes == nil {
+				res.data.Attributes = Attributes{}
+			}
+
+			res.data.Attributes[a.Key] = v
+		}
+	}
+
+	return res
+}
+
+// blank lines of spreadsheets, which would create empty contacts
+func blankRecord(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+func splitValues(value string) []string {
+	res := []string{}
+	for _, v := range strings.Split(value, ";") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+// create or update the contacts of a batch, then assign their tags
+func (imp *importer) apply(ctx context.Context, batch []importRow) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	mode := "UPSERT"
+	if imp.params.Mode != nil {
+		mode = *imp.params.Mode
+	}
+
+	tagIDs, err := imp.tagIDs(ctx, batch)
+	if err != nil {
+		return err
+	}
+
+	for i, row := range batch {
+		tags := append([]string{}, imp.params.TagIDs...)
+		for _, name := range row.tags {
+			tags = append(tags, tagIDs[name])
+		}
+
+		batch[i].tags = tags
+	}
+
+	// imported contacts are created by the system, the import being the source of their transitions
+	cause := statusCause{cause: "SYSTEM", source: "IMPORT", sourceID: &imp.importID}
+	outcomes, err := upsertContacts(ctx, imp.organizationID, mode, batch, StatusActive, cause)
+	if err != nil {
+		return err
+	}
+
+	ids := []string{}
+	for i, o := range outcomes {
+		switch o.status {
+		case "CREATED":
+			imp.result.Created++
+		case "UPDATED":
+			imp.result.Updated++
+		case "SKIPPED":
+			imp.result.Skipped++
+		case "FAILED":
+			imp.fail(batch[i].row, nil, o.err)
+		}
+
+		if o.status == "CREATED" || o.status == "UPDATED" {
+			ids = append(ids, o.id)
+		}
+	}
+
+	return imp.consent(ctx, ids, cause)
+}
+
+// record the consents of the import for the contacts
+func (imp *importer) consent(ctx context.Context, ids []string, cause statusCause) error {
+	if len(imp.params.Consents) == 0 || len(ids) == 0 {
+		return nil
+	}
+
+	list := []Contact{}
+	err := db.Coll("contacts").Find(ctx, bson.M{"organization_id": imp.organizationID, "_id": bson.M{"$in": uniqueStrings(ids)}}, &list, db.FindOptions{})
+	if err != nil {
+		return err
+	}
+
+	proof := ConsentProof{}
+	if imp.params.ConsentProof != nil {
+		proof = *imp.params.ConsentProof
+	}
+
+	proof.ImportID = &imp.importID
+	return recordConsents(ctx, imp.organizationID, list, consents(imp.params.Consents, "IMPORT", proof, time.Now()), cause)
+}
+
+// dedupe keys of a contact
+func contactKeys(d ContactData) []string {
+	keys := []string{}
+	if d.ExternalID != nil {
+		keys = append(keys, "external_id:"+*d.ExternalID)
+	}
+
+	if d.Email != nil {
+		keys = append(keys, "email:"+strings.ToLower(*d.Email))
+	}
+
+	return keys
+}
+
+// ids of the tags named in the batch, creating missing tags
+func (imp *importer) tagIDs(ctx context.Context, batch []importRow) (map[string]string, error) {
+	missing := []string{}
+	for _, row := range batch {
+		for _, name := range row.tags {
+			if _, ok := imp.tags[name]; !ok {
+				imp.tags[name] = ""
+				missing = append(missing, name)
+			}
+		}
+	}
+
+	if len(missing) == 0 {
+		return imp.tags, nil
+	}
+
+	list := []Tag{}
+	err := db.Coll("tags").Find(ctx, bson.M{"organization_id": imp.organizationID, "name": bson.M{"$in": missing}}, &list, db.FindOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range list {
+		imp.tags[*t.Name] = t.ID
+	}
+
+	for _, name := range missing {
+		if imp.tags[name] != "" {
+			continue
+		}
+
+		name := name
+		t := Tag{
+			ID:             TagPrefixID + ksuid.New().String(),
+			OrganizationID: imp.organizationID,
+			CreatedAt:      time.Now(),
+			TagData:        TagData{Name: &name},
+		}
+
+		if err := db.Coll("tags").InsertOne(ctx, t); err != nil {
+			return nil, err
+		}
+
+		imp.tags[name] = t.ID
+	}
+
+	return imp.tags, nil
+}
+
+// keep Tag.ContactsCount in sync with the contact_tags collection
+func incrementTagCounts(ctx context.Context, organizationID string, counts map[string]int) error {
+	models := []db.WriteModel{}
+	for id, n := range counts {
+		if n != 0 {
+			models = append(models, db.UpdateModel{
+				Filter: bson.M{"_id": id, "organization_id": organizationID},
+				Update: bson.M{"$inc": bson.M{"contacts_count": n}},
+			})
+		}
+	}
+
+	_, err := db.Coll("tags").BulkWrite(ctx, models)
+	return err
+}
+
+// overwrite the fields of dest set in src
+func mergeContactData(dest *ContactData, src ContactData) {
+	for _, f := range []struct{ dest, src **string }{
+		{&dest.ExternalID, &src.ExternalID},
+		{&dest.GivenName, &src.GivenName},
+		{&dest.LastName, &src.LastName},
+		{&dest.Email, &src.Email},
+		{&dest.PhoneNumber, &src.PhoneNumber},
+		{&dest.Lang, &src.Lang},
+	} {
+		if *f.src != nil {
+			*f.dest = *f.src
+		}
+	}
+
+	if src.NotificationTokens != nil {
+		dest.NotificationTokens = src.NotificationTokens
+	}
+
+	for k, v := range src.Attributes {
+		if dest.Attributes == nil {
+			dest.Attributes = Attributes{}
+		}
+
+		dest.Attributes[k] = v
+	}
+}
+
+// bson fields of the data set, used to update existing contacts
+func contactDataFields(d ContactData) bson.M {
+	res := bson.M{}
+	for k, v := range map[string]*string{
+		"external_id":  d.ExternalID,
+		"given_name":   d.GivenName,
+		"last_name":    d.LastName,
+		"email":        d.Email,
+		"phone_number": d.PhoneNumber,
+		"lang":         d.Lang,
+	} {
+		if v != nil {
+			res[k] = *v
+		}
+	}
+
+	if d.NotificationTokens != nil {
+		res["notification_tokens"] = d.NotificationTokens
+	}
+
+	set, _ := attributeFields(d.Attributes)
+	for k, v := range set {
+		res[k] = v
+	}
+
+	return res
+}
+
+func keys(m map[string]bool) []string {
+	res := []string{}
+	for k := range m {
+		res = append(res, k)
+	}
+
+	return res
+}
+
+func uniqueStrings(list []string) []string {
+	seen := map[string]bool{}
+	res := []string{}
+	for _, v := range list {
+		if !seen[v] {
+			seen[v] = true
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,208 @@
+package contacts_test
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"neodeliver.com/engine/db"
+	"neodeliver.com/engine/jobs"
+	"neodeliver.com/modules/contacts"
+	"neodeliver.com/modules/graphqltest"
+)
+
+type contactImport struct {
+	ID        string `json:"id"`
+	Status    string `json:"status"`
+	Processed int    `json:"processed"`
+	Total     int    `json:"total"`
+	Created   int    `json:"created"`
+	Updated   int    `json:"updated"`
+	Skipped   int    `json:"skipped"`
+	Failed    int    `json:"failed"`
+	Errors    []struct {
+		Row     int     `json:"row"`
+		Column  *string `json:"column"`
+		Message string  `json:"message"`
+	} `json:"errors"`
+}
+
+const importFields = `id status processed total created updated skipped failed errors { row column message }`
+
+func importContacts(t *testing.T, c *graphqltest.Client, csv string, mapping []map[string]interface{}) contactImport {
+	t.Helper()
+
+	res := struct {
+		ImportContacts contactImport `json:"import_contacts"`
+	}{}
+
+	vars := map[string]interface{}{"upload": c.Upload(csv), "mapping": mapping}
+	c.Exec(`mutation($upload: String!, $mapping: [InImportMapping!]!) { import_contacts(upload_id: $upload, mapping: $mapping) { id } }`, vars, &res)
+	c.Wait()
+
+	return contactImportOf(t, c, res.ImportContacts.ID)
+}
+
+func contactImportOf(t *testing.T, c *graphqltest.Client, id string) contactImport {
+	t.Helper()
+
+	res := struct {
+		ContactImport contactImport `json:"contact_import"`
+	}{}
+
+	c.Exec(`query($id: String!) { contact_import(id: $id) { `+importFields+` } }`, map[string]interface{}{"id": id}, &res)
+	return res.ContactImport
+}
+
+// contacts by email, with the names of their tags
+func importedContacts(t *testing.T, c *graphqltest.Client) (map[string]contacts.Contact, map[string][]string) {
+	t.Helper()
+
+	tags := struct {
+		Tags []contacts.Tag `json:"tags"`
+	}{}
+
+	c.Exec(`{ tags { id name } }`, nil, &tags)
+	names := map[string]string{}
+	for _, tag := range tags.Tags {
+		names[tag.ID] = *tag.Name
+	}
+
+	list := []contacts.Contact{}
+	if err := c.DB.Collection("contacts").Find(c.Context(), bson.M{}, &list, db.FindOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, contactTags := map[string]contacts.Contact{}, map[string][]string{}
+	for _, contact := range list {
+		email := ""
+		if contact.Email != nil {
+			email = *contact.Email
+		}
+
+		res[email] = contact
+		for _, id := range contact.TagIDs {
+			contactTags[email] = append(contactTags[email], names[id])
+		}
+
+		sort.Strings(contactTags[email])
+	}
+
+	return res, contactTags
+}
+
+func TestImportContacts(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	c.Exec(`mutation { add_contact(email: "jane@example.com", given_name: "Jane") { id } }`, nil, nil)
+	c.Exec(`mutation { add_tag(name: "vip") { id } }`, nil, nil)
+	c.Exec(`mutation { create_contact_attribute(key: "score", type: "NUMBER") { id } }`, nil, nil)
+
+	mapping := []map[string]interface{}{
+		{"column": "Email", "field": "email"},
+		{"column": "First name", "field": "given_name"},
+		{"column": "Tags", "field": "tags"},
+		{"column": "Score", "field": "attribute", "attribute": "score"},
+	}
+
+	// unknown columns are rejected before the import starts
+	vars := map[string]interface{}{"upload": c.Upload("Email\njohn@example.com\n"), "mapping": mapping}
+	c.Error(`mutation($upload: String!, $mapping: [InImportMapping!]!) { import_contacts(upload_id: $upload, mapping: $mapping) { id } }`, vars)
+
+	csv := "\ufeffEmail,First name,Tags,Score,Ignored\n" +
+		"JANE@example.com,Janet,vip,12,x\n" + // matches the existing contact by email
+		"john@example.com,John,\"vip; new\",3,x\n" +
+		"not-an-email,Bad,,,x\n" +
+		"mike@example.com,Mike,,twelve,x\n" +
+		",,,,\n"
+
+	imp := importContacts(t, c, csv, mapping)
+	if imp.Status != "COMPLETED" || imp.Processed != 5 || imp.Total != 5 || imp.Created != 1 || imp.Updated != 1 || imp.Skipped != 1 || imp.Failed != 2 {
+		t.Errorf("import %+v, want 1 created, 1 updated, 1 blank skipped & 2 failed of 5 rows", imp)
+	}
+
+	// the report lists the failed rows & their column
+	errors := []string{}
+	for _, e := range imp.Errors {
+		if e.Column == nil {
+			t.Errorf("error %+v without column", e)
+			continue
+		}
+
+		errors = append(errors, *e.Column)
+		if e.Row != 3 && e.Row != 4 {
+			t.Errorf("error %+v, want rows 3 & 4", e)
+		}
+	}
+
+	if want := []string{"Email", "Score"}; !reflect.DeepEqual(errors, want) {
+		t.Errorf("errors on columns %v, want %v", errors, want)
+	}
+
+	list, tags := importedContacts(t, c)
+	if len(list) != 2 {
+		t.Fatalf("got %d contacts, want jane & john", len(list))
+	}
+
+	jane := list["jane@example.com"]
+	if *jane.GivenName != "Janet" || jane.Attributes["score"] != 12.0 || !reflect.DeepEqual(tags["jane@example.com"], []string{"vip"}) {
+		t.Errorf("jane %+v with tags %v, want Janet with a score of 12 & the vip tag", jane.ContactData, tags["jane@example.com"])
+	}
+
+	// missing tags are created, existing ones reused
+	john := list["john@example.com"]
+	if *john.GivenName != "John" || !reflect.DeepEqual(tags["john@example.com"], []string{"new", "vip"}) {
+		t.Errorf("john %+v with tags %v, want John with the new & vip tags", john.ContactData, tags["john@example.com"])
+	}
+
+	if n, err := c.DB.Collection("tags").Count(c.Context(), bson.M{}); err != nil || n != 2 {
+		t.Errorf("%d tags (%v), want vip & new", n, err)
+	}
+
+	// importing the file again updates the same contacts
+	imp = importContacts(t, c, csv, mapping)
+	if imp.Created != 0 || imp.Updated != 2 || imp.Skipped != 1 || imp.Failed != 2 {
+		t.Errorf("second import %+v, want 2 updated & 2 failed", imp)
+	} else if n, err := c.DB.Collection("contacts").Count(c.Context(), bson.M{}); err != nil || n != 2 {
+		t.Errorf("%d contacts (%v) after the second import, want 2", n, err)
+	}
+}
+
+func TestResumeImport(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	upload := c.Upload("email\na@example.com\nb@example.com\nc@example.com\nd@example.com\n")
+
+	// import interrupted after its first 2 rows, whose contacts were created
+	job := bson.M{
+		"_id":             "imp_resumed",
+		"organization_id": "org_test",
+		"type":            "contacts.import",
+		"status":          "RUNNING",
+		"params":          bson.M{"upload_id": upload, "mapping": bson.A{bson.M{"column": "email", "field": "email"}}},
+		"processed":       2,
+		"total":           4,
+		"result":          bson.M{"created": 2},
+		"attempts":        1,
+		"locked_until":    time.Now().Add(-time.Second),
+		"created_at":      time.Now(),
+	}
+
+	if err := c.DB.Collection("jobs").InsertOne(c.Context(), job); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := jobs.RunPending(c.Context(), time.Minute); n == 0 {
+		t.Fatal("the interrupted import was not executed")
+	}
+
+	imp := contactImportOf(t, c, "imp_resumed")
+	if imp.Status != "COMPLETED" || imp.Processed != 4 || imp.Created != 4 {
+		t.Errorf("import %+v, want 4 rows created", imp)
+	}
+
+	list, _ := importedContacts(t, c)
+	if _, ok := list["c@example.com"]; !ok || len(list) != 2 {
+		t.Errorf("%d contacts, want only the rows after the first 2", len(list))
+	}
+}
@@ -1,28 +1,47 @@
 package contacts
 
 import (
+	"time"
+
+	"neodeliver.com/engine/config"
 	"neodeliver.com/engine/graphql"
+	"neodeliver.com/engine/jobs"
+	"neodeliver.com/engine/ratelimit"
 	"neodeliver.com/engine/rbac"
 )
 
 func Init(s *graphql.Builder) {
-	// query single contact
+	// global object identification
+	s.Node(ContactPrefixID, Contact{}).Where(func(r rbac.RBAC, id string) map[string]interface{} {
+		return contactsByIDs(r.OrganizationID, []string{id})
+	})
+	s.Node(ContactTagPrefixID, ContactTag{})
+	s.Node(TagPrefixID, Tag{})
+	s.Node(SegmentPrefixID, Segment{})
+	s.Node(ContactAttributePrefixID, ContactAttribute{})
+	s.Node(ContactTransitionPrefixID, ContactTransition{})
+	s.Node(ContactConsentPrefixID, ContactConsent{})
+	s.Node(ContactDuplicatePrefixID, ContactDuplicate{})
+
+	// query single contact, by id or by the id of a contact merged into it
 	s.MongoQuery(Contact{}).Where(func(r rbac.RBAC, args graphql.ByID) map[string]interface{} {
-		return map[string]interface{}{
-			"_id":             args.ID,
-			"organization_id": r.OrganizationID,
-		}
+		return contactsByIDs(r.OrganizationID, []string{args.ID})
+	})
+
+	// query contacts list, optionally searched
+	s.MongoQuery([]Contact{}).Where(func(r rbac.RBAC, args ContactsList) map[string]interface{} {
+		return contactsListQuery(r.OrganizationID, args.Search)
 	})
 
-	// query contacts list
-	s.MongoQuery([]Contact{}).Where(func(r rbac.RBAC) map[string]interface{} {
+	// query tags list
+	s.MongoQuery([]Tag{}).Where(func(r rbac.RBAC) map[string]interface{} {
 		return map[string]interface{}{
 			"organization_id": r.OrganizationID,
 		}
 	})
 
-	// query tags list
-	s.MongoQuery([]Tag{}).Where(func(r rbac.RBAC) map[string]interface{} {
+	// query custom attributes definitions
+	s.MongoQuery([]ContactAttribute{}).Where(func(r rbac.RBAC) map[string]interface{} {
 		return map[string]interface{}{
 			"organization_id": r.OrganizationID,
 		}
@@ -35,7 +54,30 @@ func Init(s *graphql.Builder) {
 		}
 	})
 
+	ratelimit.Register("add_contact", ratelimit.Organization(600, time.Minute), ratelimit.APIKey(300, time.Minute))
+	ratelimit.Register("import_contacts", ratelimit.Organization(10, time.Minute))
+	ratelimit.Register("export_contacts", ratelimit.Organization(10, time.Minute))
+	ratelimit.Register("detect_duplicates", ratelimit.Organization(10, time.Minute))
+	ratelimit.Register("subscribe_contact", ratelimit.Organization(600, time.Minute), ratelimit.IP(60, time.Minute))
+
+	// operations of api keys
+	rbac.RegisterScope("contacts:read", "contact", "contacts", "search_contacts", "tags", "contact_attributes", "segments", "segment_contacts", "preview_segment",
+		"contact_consents", "contact_transitions", "duplicates", "duplicates_detection", "contact_import", "contact_imports",
+		"export_contacts", "contact_export", "contact_exports")
+	rbac.RegisterScope("contacts:write", "add_contact", "update_contact", "delete_contact", "subscribe_contact", "set_contact_consents", "set_contacts_status",
+		"bulk_upsert_contacts", "bulk_delete_contacts", "import_contacts", "add_tag", "update_tag", "delete_tag", "assign_tag", "assign_tags", "unassign_tags",
+		"create_contact_attribute", "update_contact_attribute", "delete_contact_attribute", "create_segment", "update_segment", "delete_segment", "snapshot_segment",
+		"detect_duplicates", "merge_contacts")
+
+	jobs.Schedule(searchIndexJob, searchIndexInterval)
+	jobs.Schedule(exportsCleanupJob, exportsCleanupInterval)
+	if d := config.Get().Segments.RefreshInterval; d > 0 {
+		jobs.Schedule(segmentsRefreshJob, d)
+	}
+
+	s.AddQueryMethods(Query{})
 	s.AddMutationMethods(Mutation{})
 }
 
+type Query struct{}
 type Mutation struct{}
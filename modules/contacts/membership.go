@@ -0,0 +1,252 @@
+package contacts
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"go.mongodb.org/mongo-driver/bson"
+	"neodeliver.com/engine/db"
+	ggraphql "neodeliver.com/engine/graphql"
+	"neodeliver.com/engine/jobs"
+	"neodeliver.com/engine/logger"
+	"neodeliver.com/engine/rbac"
+)
+
+// Contacts of segments: dynamic segments match their rules when queried, static segments
+// the contacts matching their rules when snapshotted (kept in contacts.segment_ids)
+// counters of segments are refreshed periodically by a background job
+// -------------------------------------------------------------------------------------
+
+const segmentsRefreshJob = "segments.refresh"
+
+type SegmentContacts struct {
+	ID     string
+	First  *int `validate:"omitempty,min=1,max=1000"` // 100 by default
+	Offset *int `validate:"omitempty,min=0"`
+}
+
+type PreviewSegment struct {
+	Rules SegmentRules `json:"rules"`
+}
+
+type SegmentPreview struct {
+	ContactsCount int `json:"contacts_count"`
+}
+
+func init() {
+	jobs.Register(segmentsRefreshJob, runSegmentsRefresh)
+}
+
+// contacts of a segment, by id
+func (Query) SegmentContacts(p graphql.ResolveParams, rbac rbac.RBAC, args SegmentContacts) ([]Contact, error) {
+	s := Segment{}
+	err := db.Coll("segments").FindOne(p.Context, bson.M{"_id": args.ID, "organization_id": rbac.OrganizationID}, &s)
+	if errors.Is(err, db.ErrNoDocuments) {
+		return nil, errors.New("The segment does not exist")
+	} else if err != nil {
+		return nil, err
+	}
+
+	q, err := s.Query(p.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := db.FindOptions{Sort: bson.D{{Key: "_id", Value: 1}}, Limit: 100}
+	if args.First != nil {
+		opts.Limit = int64(*args.First)
+	}
+
+	if args.Offset != nil {
+		opts.Skip = int64(*args.Offset)
+	}
+
+	res := []Contact{}
+	err = db.Coll("contacts").Find(p.Context, q, &res, opts)
+	return res, err
+}
+
+// number of contacts matching rules before saving them
+func (Query) PreviewSegment(p graphql.ResolveParams, rbac rbac.RBAC, args PreviewSegment) (SegmentPreview, error) {
+	q, err := args.Rules.Query(p.Context, rbac.OrganizationID)
+	if err != nil {
+		return SegmentPreview{}, err
+	}
+
+	n, err := db.Coll("contacts").Count(p.Context, q)
+	return SegmentPreview{ContactsCount: int(n)}, err
+}
+
+// snapshot again the contacts of a static segment
+func (Mutation) SnapshotSegment(p graphql.ResolveParams, rbac rbac.RBAC, args ggraphql.ByID) (Segment, error) {
+	s := Segment{}
+	err := db.Coll("segments").FindOne(p.Context, bson.M{"_id": args.ID, "organization_id": rbac.OrganizationID}, &s)
+	if errors.Is(err, db.ErrNoDocuments) {
+		return s, errors.New("The segment does not exist")
+	} else if err != nil {
+		return s, err
+	} else if !s.Static() {
+		return s, errors.New("Only static segments can be snapshotted")
+	}
+
+	return s, s.snapshot(p.Context)
+}
+
+// ---
+
+func (s Segment) Static() bool {
+	return s.Type != nil && *s.Type == "STATIC"
+}
+
+// mongodb filter of the contacts of the segment, scoped to its organization
+func (s Segment) Query(ctx context.Context) (bson.M, error) {
+	if s.Static() {
+		return bson.M{"organization_id": s.OrganizationID, "segment_ids": s.ID}, nil
+	} else if s.Rules == nil && s.Filters != nil {
+		return nil, errors.New("The filters of the segment could not be converted to rules, set its rules")
+	} else if s.Rules == nil {
+		return bson.M{"organization_id": s.OrganizationID}, nil
+	}
+
+	return s.Rules.Query(ctx, s.OrganizationID)
+}
+
+// update the members of static segments & the contacts count
+func (s *Segment) snapshot(ctx context.Context) error {
+	if !s.Static() {
+		if err := clearSegmentMembers(ctx, s.OrganizationID, s.ID); err != nil {
+			return err
+		}
+
+		q, err := s.Query(ctx)
+		if err != nil {
+			return err
+		}
+
+		n, err := db.Coll("contacts").Count(ctx, q)
+		if err != nil {
+			return err
+		}
+
+		s.ContactsCount = int(n)
+		_, err = db.Coll("segments").UpdateMany(ctx, bson.M{"_id": s.ID}, bson.M{"$set": bson.M{"contacts_count": s.ContactsCount}})
+		return err
+	}
+
+	q := bson.M{"organization_id": s.OrganizationID}
+	if s.Rules != nil {
+		var err error
+		if q, err = s.Rules.Query(ctx, s.OrganizationID); err != nil {
+			return err
+		}
+	}
+
+	// matching contacts are added before the others are removed, the segment is never empty meanwhile
+	n, err := db.Coll("contacts").UpdateMany(ctx, q, bson.M{"$addToSet": bson.M{"segment_ids": s.ID}})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Coll("contacts").UpdateMany(ctx, bson.M{"organization_id": s.OrganizationID, "segment_ids": s.ID, "$nor": []bson.M{q}}, bson.M{"$pull": bson.M{"segment_ids": s.ID}})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	s.ContactsCount, s.SnapshotAt = int(n), &now
+	_, err = db.Coll("segments").UpdateMany(ctx, bson.M{"_id": s.ID}, bson.M{"$set": bson.M{"contacts_count": s.ContactsCount, "snapshot_at": now}})
+	return err
+}
+
+func clearSegmentMembers(ctx context.Context, organizationID, segmentID string) error {
+	_, err := db.Coll("contacts").UpdateMany(ctx, bson.M{"organization_id": organizationID, "segment_ids": segmentID}, bson.M{"$pull": bson.M{"segment_ids": segmentID}})
+	return err
+}
+
+// refresh the counters of every segment from the engagement stats of their contacts
+func runSegmentsRefresh(ctx context.Context, j *jobs.Job) error {
+	total, err := db.Coll("segments").Count(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+
+	processed, last := int64(0), ""
+	for {
+		page := []Segment{}
+		err := db.Coll("segments").Find(ctx, bson.M{"_id": bson.M{"$gt": last}}, &page, db.FindOptions{Sort: bson.D{{Key: "_id", Value: 1}}, Limit: 100})
+		if err != nil {
+			return err
+		} else if len(page) == 0 {
+			return nil
+		}
+
+		for _, s := range page {
+			// segments with invalid rules are skipped, without failing the others
+			if err := refreshSegment(ctx, s); errors.Is(err, context.Canceled) || errors.Is(err, jobs.ErrLeaseLost) {
+				return err
+			} else if err != nil {
+				logger.Report(ctx, err, "Could not refresh segment", "segment", s.ID)
+			}
+		}
+
+		processed += int64(len(page))
+		last = page[len(page)-1].ID
+		if err := j.Progress(ctx, processed, total, nil); err != nil {
+			return err
+		}
+	}
+}
+
+// counters of the contacts of a segment
+type segmentTotals struct {
+	Contacts int64 `bson:"contacts"`
+	Sent     int64 `bson:"sent"`
+	Opened   int64 `bson:"opened"`
+	Clicked  int64 `bson:"clicked"`
+}
+
+func refreshSegment(ctx context.Context, s Segment) error {
+	q, err := s.Query(ctx)
+	if err != nil {
+		return err
+	}
+
+	// counters are summed by the database, without loading the contacts
+	totals := []segmentTotals{}
+	err = db.Coll("contacts").Aggregate(ctx, []bson.M{
+		{"$match": q},
+		{"$group": bson.M{
+			"_id":      nil,
+			"contacts": bson.M{"$sum": 1},
+			"sent":     bson.M{"$sum": "$stats.email.campaigns_sent"},
+			"opened":   bson.M{"$sum": "$stats.email.messages_opened"},
+			"clicked":  bson.M{"$sum": "$stats.email.messages_clicked"},
+		}},
+	}, &totals)
+
+	if err != nil {
+		return err
+	}
+
+	t := segmentTotals{}
+	if len(totals) > 0 {
+		t = totals[0]
+	}
+
+	clickRate := 0
+	if t.Sent > 0 {
+		clickRate = int(t.Clicked * 100 / t.Sent)
+	}
+
+	_, err = db.Coll("segments").UpdateMany(ctx, bson.M{"_id": s.ID}, bson.M{"$set": bson.M{
+		"contacts_count":   t.Contacts,
+		"mails_sent_count": t.Sent,
+		"opens_count":      t.Opened,
+		"click_rate":       clickRate,
+		"refreshed_at":     time.Now(),
+	}})
+
+	return err
+}
@@ -0,0 +1,417 @@
+package contacts
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"neodeliver.com/engine/db"
+	"neodeliver.com/engine/jobs"
+	"neodeliver.com/engine/logger"
+)
+
+// Migrations backfilling the documents stored before a field was introduced, run once by jobs.Migrate
+// -------------------------------------------------------------------------------------
+
+const tagIDsMigration = "contacts.migrate_tag_ids"
+
+func init() {
+	jobs.Register(tagIDsMigration, runTagIDsMigration)
+	jobs.Migrate(tagIDsMigration)
+}
+
+// index & store the tags of contact_tags on their contacts (Contact.TagIDs), contacts being matched by id as assignments may lack their organization
+func runTagIDsMigration(ctx context.Context, j *jobs.Job) error {
+	if !db.InMemory() {
+		d, err := db.Client()
+		if err == nil {
+			_, err = d.Collection("contacts").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "organization_id", Value: 1}, {Key: "tag_ids", Value: 1}},
+			})
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	total, err := db.Coll("contact_tags").Count(ctx, bson.M{})
+	if err != nil || total == 0 {
+		return err
+	}
+
+	last, processed := "", int64(0)
+	for {
+		q := bson.M{}
+		if last != "" {
+			q = bson.M{"_id": bson.M{"$gt": last}}
+		}
+
+		page := []ContactTag{}
+		if err := db.Coll("contact_tags").Find(ctx, q, &page, db.FindOptions{Sort: bson.D{{Key: "_id", Value: 1}}, Limit: bulkBatchSize}); err != nil || len(page) == 0 {
+			return err
+		}
+
+		tags := map[string][]string{}
+		for _, t := range page {
+			tags[t.ContactID] = append(tags[t.ContactID], t.TagID)
+		}
+
+		models := []db.WriteModel{}
+		for contactID, ids := range tags {
+			models = append(models, db.UpdateModel{
+				Filter: bson.M{"_id": contactID},
+				Update: bson.M{"$addToSet": bson.M{"tag_ids": bson.M{"$each": ids}}},
+			})
+		}
+
+		res, err := db.Coll("contacts").BulkWrite(ctx, models)
+		if err == nil {
+			err = firstError(res)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		last, processed = page[len(page)-1].ID, processed+int64(len(page))
+		if err := j.Progress(ctx, processed, total, nil); err != nil {
+			return err
+		}
+	}
+}
+
+// ---
+// organization of the tag assignments stored before contact_tags were scoped to it
+
+const contactTagsOrganizationMigration = "contacts.migrate_contact_tags_organization"
+
+func init() {
+	jobs.Register(contactTagsOrganizationMigration, runContactTagsOrganizationMigration)
+	jobs.Migrate(contactTagsOrganizationMigration)
+}
+
+// set the organization of the assignments from their contacts, assignments of deleted contacts being left as is
+func runContactTagsOrganizationMigration(ctx context.Context, j *jobs.Job) error {
+	query := bson.M{"organization_id": nil}
+	total, err := db.Coll("contact_tags").Count(ctx, query)
+	if err != nil || total == 0 {
+		return err
+	}
+
+	last, processed, orphans := "", int64(0), 0
+	for {
+		q := query
+		if last != "" {
+			q = bson.M{"organization_id": nil, "_id": bson.M{"$gt": last}}
+		}
+
+		page := []ContactTag{}
+		if err := db.Coll("contact_tags").Find(ctx, q, &page, db.FindOptions{Sort: bson.D{{Key: "_id", Value: 1}}, Limit: bulkBatchSize}); err != nil {
+			return err
+		} else if len(page) == 0 {
+			break
+		}
+
+		ids := []string{}
+		for _, t := range page {
+			ids = append(ids, t.ContactID)
+		}
+
+		list := []Contact{}
+		if err := db.Coll("contacts").Find(ctx, bson.M{"_id": bson.M{"$in": uniqueStrings(ids)}}, &list, db.FindOptions{}); err != nil {
+			return err
+		}
+
+		organizations := map[string]string{}
+		for _, c := range list {
+			organizations[c.ID] = c.OrganizationID
+		}
+
+		models := []db.WriteModel{}
+		for _, t := range page {
+			if org := organizations[t.ContactID]; org == "" {
+				orphans++
+			} else {
+				models = append(models, db.UpdateModel{
+					Filter: bson.M{"_id": t.ID, "organization_id": nil},
+					Update: bson.M{"$set": bson.M{"organization_id": org}},
+				})
+			}
+		}
+
+		if len(models) > 0 {
+			res, err := db.Coll("contact_tags").BulkWrite(ctx, models)
+			if err == nil {
+				err = firstError(res)
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		last, processed = page[len(page)-1].ID, processed+int64(len(page))
+		if err := j.Progress(ctx, processed, total, nil); err != nil {
+			return err
+		}
+	}
+
+	if orphans > 0 {
+		logger.FromContext(ctx).Warn("Tag assignments of deleted contacts left without organization", "count", orphans)
+	}
+
+	return nil
+}
+
+// ---
+// segment filters, raw mongodb queries replaced by typed rules
+
+const segmentRulesMigration = "contacts.migrate_segment_rules"
+
+// fields of legacy filters converted to conditions
+var legacyFilterFields = map[string]bool{"external_id": true, "given_name": true, "last_name": true, "email": true, "phone_number": true, "lang": true, "status": true, "subscribed_at": true}
+
+func init() {
+	jobs.Register(segmentRulesMigration, runSegmentRulesMigration)
+	jobs.Migrate(segmentRulesMigration)
+}
+
+// convert the filters of the segments created before rules, segments whose filters can't be converted fail to query until their rules are set
+func runSegmentRulesMigration(ctx context.Context, j *jobs.Job) error {
+	list := []Segment{}
+	query := bson.M{"filters": bson.M{"$exists": true, "$ne": nil}, "rules": nil}
+	if err := db.Coll("segments").Find(ctx, query, &list, db.FindOptions{}); err != nil {
+		return err
+	}
+
+	for i, s := range list {
+		rules, err := legacyFilterRules(*s.Filters)
+		if err != nil {
+			logger.FromContext(ctx).Warn("Could not convert segment filters to rules", "segment", s.ID, "err", err)
+		} else if _, err := db.Coll("segments").UpdateMany(ctx, bson.M{"_id": s.ID, "rules": nil}, bson.M{"$set": bson.M{"rules": rules}, "$unset": bson.M{"filters": ""}}); err != nil {
+			return err
+		}
+
+		if err := j.Progress(ctx, int64(i+1), int64(len(list)), nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rules equivalent to a json encoded mongodb filter, eg: {"$and": [{"status": "ACTIVE"}, {"lang": {"$in": ["fr", "nl"]}}]}
+func legacyFilterRules(filters string) (*SegmentRules, error) {
+	doc := bson.M{}
+	if err := bson.UnmarshalExtJSON([]byte(filters), false, &doc); err != nil {
+		return nil, err
+	}
+
+	rules, err := legacyFilterGroup(doc)
+	if err != nil {
+		return nil, err
+	} else if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &rules, nil
+}
+
+func legacyFilterGroup(doc bson.M) (SegmentRules, error) {
+	rules := SegmentRules{Operator: "AND"}
+	for key, v := range doc {
+		if key != "$and" && key != "$or" {
+			conditions, err := legacyFilterConditions(key, v)
+			if err != nil {
+				return rules, err
+			}
+
+			rules.Conditions = append(rules.Conditions, conditions...)
+			continue
+		}
+
+		list, ok := v.(bson.A)
+		if !ok || len(list) == 0 {
+			return rules, fmt.Errorf("%s requires a list of filters", key)
+		}
+
+		group := SegmentRules{Operator: strings.ToUpper(key[1:])}
+		for _, item := range list {
+			sub, ok := item.(bson.M)
+			if !ok {
+				return rules, fmt.Errorf("%s requires a list of filters", key)
+			}
+
+			r, err := legacyFilterGroup(sub)
+			if err != nil {
+				return rules, err
+			} else if len(r.Conditions) == 1 && len(r.Groups) == 0 {
+				group.Conditions = append(group.Conditions, r.Conditions[0])
+			} else {
+				group.Groups = append(group.Groups, r)
+			}
+		}
+
+		if len(doc) == 1 {
+			return group, nil
+		}
+
+		rules.Groups = append(rules.Groups, group)
+	}
+
+	return rules, nil
+}
+
+func legacyFilterConditions(field string, v interface{}) ([]SegmentCondition, error) {
+	if !legacyFilterFields[field] {
+		return nil, fmt.Errorf("the field %s can't be converted", field)
+	}
+
+	ops, ok := v.(bson.M)
+	if !ok {
+		ops = bson.M{"$eq": v}
+	}
+
+	res := []SegmentCondition{}
+	for op, arg := range ops {
+		c := SegmentCondition{Field: field}
+		switch op {
+		case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte":
+			c.Operator = strings.ToUpper(op[1:])
+			if c.Operator == "GTE" || c.Operator == "LTE" || c.Operator == "GT" || c.Operator == "LT" {
+				if field != "subscribed_at" {
+					return nil, fmt.Errorf("%s can't be converted on %s", op, field)
+				}
+			}
+
+			switch t := arg.(type) {
+			case string:
+				c.Value = &t
+			case primitive.DateTime:
+				d := t.Time()
+				c.Date = &d
+			default:
+				return nil, fmt.Errorf("%s on %s requires a string or a date", op, field)
+			}
+		case "$in", "$nin":
+			c.Operator = map[string]string{"$in": "IN", "$nin": "NOT_IN"}[op]
+			list, _ := arg.(bson.A)
+			for _, item := range list {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s on %s requires strings", op, field)
+				}
+
+				c.Values = append(c.Values, s)
+			}
+		case "$exists":
+			c.Operator = "NOT_EXISTS"
+			if b, _ := arg.(bool); b {
+				c.Operator = "EXISTS"
+			}
+		case "$regex":
+			pattern, _ := arg.(string)
+			prefix := strings.HasPrefix(pattern, "^")
+			literal := strings.TrimPrefix(pattern, "^")
+			if pattern == "" || regexp.QuoteMeta(literal) != literal || ops["$options"] != nil {
+				return nil, fmt.Errorf("the pattern %q can't be converted", pattern)
+			}
+
+			c.Operator, c.Value = "CONTAINS", &literal
+			if prefix {
+				c.Operator = "STARTS_WITH"
+			}
+		default:
+			return nil, fmt.Errorf("%s can't be converted", op)
+		}
+
+		res = append(res, c)
+	}
+
+	return res, nil
+}
+
+// ---
+// search tokens index, & tokens of the contacts created before contacts were searchable
+
+const searchIndexMigration = "contacts.migrate_search_index"
+
+func init() {
+	jobs.Register(searchIndexMigration, runSearchIndexMigration)
+	jobs.Migrate(searchIndexMigration)
+}
+
+// index the tokens with the organization, then store the missing tokens
+func runSearchIndexMigration(ctx context.Context, j *jobs.Job) error {
+	if !db.InMemory() {
+		d, err := db.Client()
+		if err == nil {
+			_, err = d.Collection("contacts").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "organization_id", Value: 1}, {Key: "search_tokens", Value: 1}},
+			})
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return runSearchIndex(ctx, j)
+}
+
+// ---
+// unique attribute keys by organization
+
+const attributesIndexMigration = "contacts.migrate_attributes_index"
+
+func init() {
+	jobs.Register(attributesIndexMigration, runAttributesIndexMigration)
+	jobs.Migrate(attributesIndexMigration)
+}
+
+// definitions created twice by concurrent requests are dropped, keeping the oldest: values are stored by key & shared by both
+func runAttributesIndexMigration(ctx context.Context, j *jobs.Job) error {
+	list := []ContactAttribute{}
+	if err := db.Coll("contact_attributes").Find(ctx, bson.M{}, &list, db.FindOptions{Sort: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}}); err != nil {
+		return err
+	}
+
+	seen, duplicates := map[string]bool{}, []string{}
+	for _, a := range list {
+		if k := a.OrganizationID + ":" + a.Key; seen[k] {
+			duplicates = append(duplicates, a.ID)
+		} else {
+			seen[k] = true
+		}
+	}
+
+	if len(duplicates) > 0 {
+		if _, err := db.Coll("contact_attributes").DeleteMany(ctx, bson.M{"_id": bson.M{"$in": duplicates}}); err != nil {
+			return err
+		}
+
+		logger.FromContext(ctx).Warn("Duplicate attribute definitions deleted", "count", len(duplicates))
+	}
+
+	if db.InMemory() {
+		return nil
+	}
+
+	d, err := db.Client()
+	if err != nil {
+		return err
+	}
+
+	_, err = d.Collection("contact_attributes").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "organization_id", Value: 1}, {Key: "key", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+
+	return err
+}
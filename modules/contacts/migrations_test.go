@@ -0,0 +1,155 @@
+package contacts_test
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"neodeliver.com/engine/jobs"
+	"neodeliver.com/modules/graphqltest"
+)
+
+// execute a migration & wait for its completion
+func migrate(t *testing.T, c *graphqltest.Client, kind string) {
+	t.Helper()
+
+	if _, err := jobs.Enqueue(c.Context(), jobs.MigrationPrefixID+kind, "", kind, bson.M{}); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Wait()
+	j, err := jobs.Get(c.Context(), "", jobs.MigrationPrefixID+kind)
+	if err != nil {
+		t.Fatal(err)
+	} else if j.Status != jobs.Completed {
+		t.Fatalf("migration %s is %s: %s", kind, j.Status, j.Error)
+	}
+}
+
+func TestTagIDsMigration(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	ctx := c.Context()
+	db := c.DB.Collection("contacts")
+	for _, id := range []string{"ctc_a", "ctc_b"} {
+		if err := db.InsertOne(ctx, bson.M{"_id": id, "organization_id": "org_test", "email": id + "@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// assignments stored before tag ids were kept on contacts, some without organization
+	for _, tag := range []bson.M{
+		{"_id": "ctc_tag_1", "organization_id": "org_test", "contact_id": "ctc_a", "tag_id": "tag_1"},
+		{"_id": "ctc_tag_2", "contact_id": "ctc_a", "tag_id": "tag_2"},
+		{"_id": "ctc_tag_3", "organization_id": "org_test", "contact_id": "ctc_b", "tag_id": "tag_2"},
+	} {
+		if err := c.DB.Collection("contact_tags").InsertOne(ctx, tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrate(t, c, "contacts.migrate_tag_ids")
+	for id, want := range map[string]int{"ctc_a": 2, "ctc_b": 1} {
+		got := struct {
+			TagIDs []string `bson:"tag_ids"`
+		}{}
+
+		if err := db.FindOne(ctx, bson.M{"_id": id}, &got); err != nil {
+			t.Fatal(err)
+		} else if len(got.TagIDs) != want {
+			t.Errorf("%s has tags %v, want %d", id, got.TagIDs, want)
+		}
+	}
+}
+
+func TestContactTagsOrganizationMigration(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	ctx := c.Context()
+	if err := c.DB.Collection("contacts").InsertOne(ctx, bson.M{"_id": "ctc_a", "organization_id": "org_test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// assignments stored before contact_tags were scoped to the organization, the last one of a deleted contact
+	tags := c.DB.Collection("contact_tags")
+	for _, tag := range []bson.M{
+		{"_id": "ctc_tag_1", "contact_id": "ctc_a", "tag_id": "tag_1"},
+		{"_id": "ctc_tag_2", "organization_id": "org_other", "contact_id": "ctc_a", "tag_id": "tag_2"},
+		{"_id": "ctc_tag_3", "contact_id": "ctc_deleted", "tag_id": "tag_1"},
+	} {
+		if err := tags.InsertOne(ctx, tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrate(t, c, "contacts.migrate_contact_tags_organization")
+	for id, want := range map[string]string{"ctc_tag_1": "org_test", "ctc_tag_2": "org_other", "ctc_tag_3": ""} {
+		got := struct {
+			OrganizationID string `bson:"organization_id"`
+		}{}
+
+		if err := tags.FindOne(ctx, bson.M{"_id": id}, &got); err != nil {
+			t.Fatal(err)
+		} else if got.OrganizationID != want {
+			t.Errorf("%s of organization %q, want %q", id, got.OrganizationID, want)
+		}
+	}
+}
+
+func TestSegmentRulesMigration(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	ctx := c.Context()
+	for _, email := range []string{"a@example.com", "b@example.org", "c@example.com"} {
+		addContact(c, email)
+	}
+
+	for id, filters := range map[string]string{
+		"sgt_or":      `{"$or": [{"email": "a@example.com"}, {"email": {"$regex": "^b@"}}]}`,
+		"sgt_and":     `{"$and": [{"email": {"$in": ["a@example.com", "c@example.com"]}}, {"email": {"$ne": "a@example.com"}}]}`,
+		"sgt_invalid": `{"$where": ["this.email"]}`,
+	} {
+		if err := c.DB.Collection("segments").InsertOne(ctx, bson.M{"_id": id, "organization_id": "org_test", "filters": filters}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrate(t, c, "contacts.migrate_segment_rules")
+	for id, want := range map[string]int{"sgt_or": 2, "sgt_and": 1} {
+		res := struct {
+			SegmentContacts []contact `json:"segment_contacts"`
+		}{}
+
+		c.Exec(`query($id: String!) { segment_contacts(id: $id) { id } }`, map[string]interface{}{"id": id}, &res)
+		if len(res.SegmentContacts) != want {
+			t.Errorf("%s has %d contacts, want %d", id, len(res.SegmentContacts), want)
+		}
+	}
+
+	// segments whose filters can't be converted fail rather than matching every contact
+	c.Error(`{ segment_contacts(id: "sgt_invalid") { id } }`, nil)
+}
+
+func TestSearchIndexMigration(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	ctx := c.Context()
+
+	// contact stored before contacts were searchable
+	if err := c.DB.Collection("contacts").InsertOne(ctx, bson.M{"_id": "ctc_a", "organization_id": "org_test", "email": "jane.doe@example.com", "given_name": "Jane"}); err != nil {
+		t.Fatal(err)
+	}
+
+	res := struct {
+		SearchContacts struct {
+			Contacts []contact `json:"contacts"`
+		} `json:"search_contacts"`
+	}{}
+
+	q := `{ search_contacts(query: "jan") { contacts { id } } }`
+	c.Exec(q, nil, &res)
+	if len(res.SearchContacts.Contacts) != 0 {
+		t.Fatalf("contact without tokens found: %+v", res.SearchContacts.Contacts)
+	}
+
+	migrate(t, c, "contacts.migrate_search_index")
+	c.Exec(q, nil, &res)
+	if len(res.SearchContacts.Contacts) != 1 || res.SearchContacts.Contacts[0].ID != "ctc_a" {
+		t.Errorf("search %+v, want ctc_a", res.SearchContacts.Contacts)
+	}
+}
@@ -0,0 +1,320 @@
+package contacts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Segment rules, a typed tree of conditions compiled server side to mongodb filters
+// user input never reaches the filter as operators or field names, only as values
+// -------------------------------------------------------------------------------------
+
+const (
+	rulesMaxDepth      = 5
+	rulesMaxConditions = 100
+)
+
+// group of conditions & nested groups, combined with AND or OR; an empty group matches every contact
+type SegmentRules struct {
+	Operator   string             `bson:"operator" json:"operator" validate:"oneof=AND OR"`
+	Conditions []SegmentCondition `bson:"conditions" json:"conditions" validate:"dive"`
+	Groups     []SegmentRules     `bson:"groups" json:"groups" validate:"dive"`
+}
+
+// condition on a contact field, a tag, a custom attribute or an engagement stat (eg: email last_message_opened WITHIN_LAST 30 days)
+type SegmentCondition struct {
+	Field     string     `bson:"field" json:"field" validate:"oneof=external_id given_name last_name email phone_number lang status subscribed_at tags attribute stats"`
+	Attribute *string    `bson:"attribute,omitempty" json:"attribute"`                                                                                                                              // key of the custom attribute
+	Channel   *string    `bson:"channel,omitempty" json:"channel" validate:"omitempty,oneof=sms email notifications"`                                                                               // channel of the stat
+	Stat      *string    `bson:"stat,omitempty" json:"stat" validate:"omitempty,oneof=campaigns_sent last_campaign_sent messages_opened last_message_opened messages_clicked last_message_clicked"` // counter or date of the stat
+	Operator  string     `bson:"operator" json:"operator" validate:"oneof=EQ NE IN NOT_IN CONTAINS STARTS_WITH EXISTS NOT_EXISTS GT GTE LT LTE WITHIN_LAST NOT_WITHIN_LAST"`
+	Value     *string    `bson:"value,omitempty" json:"value"`
+	Values    []string   `bson:"values,omitempty" json:"values"`
+	Number    *float64   `bson:"number,omitempty" json:"number"`
+	Date      *time.Time `bson:"date,omitempty" json:"date"`
+	Days      *int       `bson:"days,omitempty" json:"days" validate:"omitempty,min=1"` // WITHIN_LAST & NOT_WITHIN_LAST
+}
+
+// kinds of values compared by conditions
+const (
+	ruleText    = "text"
+	ruleDate    = "date"
+	ruleNumber  = "number"
+	ruleTags    = "tags"
+	ruleBoolean = "boolean"
+	ruleAny     = "any" // custom attributes, typed by their definition
+)
+
+var attributeKinds = map[string]string{
+	"STRING":  ruleText,
+	"ENUM":    ruleText,
+	"NUMBER":  ruleNumber,
+	"DATE":    ruleDate,
+	"BOOLEAN": ruleBoolean,
+}
+
+var ruleOperators = map[string][]string{
+	ruleText:    {"EQ", "NE", "IN", "NOT_IN", "CONTAINS", "STARTS_WITH", "EXISTS", "NOT_EXISTS"},
+	ruleDate:    {"GT", "GTE", "LT", "LTE", "WITHIN_LAST", "NOT_WITHIN_LAST"},
+	ruleNumber:  {"EQ", "NE", "GT", "GTE", "LT", "LTE"},
+	ruleTags:    {"EQ", "NE", "IN", "NOT_IN"},
+	ruleBoolean: {"EQ", "NE"},
+	ruleAny:     {"EQ", "NE", "IN", "NOT_IN", "CONTAINS", "STARTS_WITH", "EXISTS", "NOT_EXISTS", "GT", "GTE", "LT", "LTE", "WITHIN_LAST", "NOT_WITHIN_LAST"},
+}
+
+var attributeKeyRegex = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// verify the structure of the rules, values being checked when compiled
+func (r SegmentRules) Validate() error {
+	n := 0
+	return r.validate(1, &n)
+}
+
+func (r SegmentRules) validate(depth int, n *int) error {
+	if depth > rulesMaxDepth {
+		return fmt.Errorf("Segment rules can't be nested more than %d levels", rulesMaxDepth)
+	}
+
+	if *n += len(r.Conditions); *n > rulesMaxConditions {
+		return fmt.Errorf("Segment rules can't have more than %d conditions", rulesMaxConditions)
+	}
+
+	for _, c := range r.Conditions {
+		if _, _, err := c.field(); err != nil {
+			return err
+		}
+	}
+
+	for _, g := range r.Groups {
+		if err := g.validate(depth+1, n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mongodb filter of the contacts matching the rules, scoped to the organization
+func (r SegmentRules) Query(ctx context.Context, organizationID string) (bson.M, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	attributes, err := attributeDefinitions(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := r.compile(&ruleCompiler{now: time.Now(), attributes: attributes})
+	if err != nil {
+		return nil, err
+	} else if len(q) == 0 {
+		return bson.M{"organization_id": organizationID}, nil
+	}
+
+	return bson.M{"$and": []bson.M{{"organization_id": organizationID}, q}}, nil
+}
+
+// context of the compilation of rules
+type ruleCompiler struct {
+	now        time.Time
+	attributes map[string]ContactAttribute // definitions by key
+}
+
+func (r SegmentRules) compile(rc *ruleCompiler) (bson.M, error) {
+	list := []bson.M{}
+	for _, c := range r.Conditions {
+		q, err := c.compile(rc)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, q)
+	}
+
+	for _, g := range r.Groups {
+		q, err := g.compile(rc)
+		if err != nil {
+			return nil, err
+		} else if len(q) > 0 {
+			list = append(list, q)
+		}
+	}
+
+	switch {
+	case len(list) == 0:
+		return bson.M{}, nil
+	case len(list) == 1:
+		return list[0], nil
+	case r.Operator == "OR":
+		return bson.M{"$or": list}, nil
+	default:
+		return bson.M{"$and": list}, nil
+	}
+}
+
+// document key & kind of value of the condition
+func (c SegmentCondition) field() (string, string, error) {
+	key, kind := c.Field, ruleText
+	switch c.Field {
+	case "subscribed_at":
+		kind = ruleDate
+	case "tags":
+		key, kind = "tag_ids", ruleTags
+	case "attribute":
+		if c.Attribute == nil || !attributeKeyRegex.MatchString(*c.Attribute) {
+			return "", "", errors.New("Attribute conditions require a valid attribute key")
+		}
+
+		key, kind = "attributes."+*c.Attribute, ruleAny
+	case "stats":
+		if c.Channel == nil || c.Stat == nil {
+			return "", "", errors.New("Stats conditions require a channel & a stat")
+		}
+
+		key, kind = "stats."+*c.Channel+"."+*c.Stat, ruleNumber
+		if *c.Stat == "last_campaign_sent" || *c.Stat == "last_message_opened" || *c.Stat == "last_message_clicked" {
+			kind = ruleDate
+		}
+	}
+
+	if !supports(kind, c.Operator) {
+		return "", "", fmt.Errorf("The operator %s is not supported on %s conditions", c.Operator, c.Field)
+	}
+
+	return key, kind, nil
+}
+
+func supports(kind, operator string) bool {
+	for _, op := range ruleOperators[kind] {
+		if op == operator {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c SegmentCondition) compile(rc *ruleCompiler) (bson.M, error) {
+	key, kind, err := c.field()
+	if err != nil {
+		return nil, err
+	}
+
+	missing := func(value string) error {
+		return fmt.Errorf("The %s condition on %s requires %s", c.Operator, c.Field, value)
+	}
+
+	// attributes are compared like the fields of their type & may be missing
+	var attribute *ContactAttribute
+	if kind == ruleAny {
+		a, ok := rc.attributes[*c.Attribute]
+		if !ok {
+			return nil, fmt.Errorf("The attribute %s does not exist", *c.Attribute)
+		}
+
+		attribute, kind = &a, attributeKinds[a.Type]
+		if !supports(kind, c.Operator) && c.Operator != "EXISTS" && c.Operator != "NOT_EXISTS" {
+			return nil, fmt.Errorf("The operator %s is not supported on %s attributes", c.Operator, a.Type)
+		}
+	}
+
+	switch c.Operator {
+	case "EXISTS":
+		return bson.M{key: bson.M{"$exists": true, "$ne": nil}}, nil
+	case "NOT_EXISTS":
+		return bson.M{"$or": []bson.M{{key: bson.M{"$exists": false}}, {key: nil}}}, nil
+	}
+
+	if kind == ruleTags {
+		ids := c.Values
+		if c.Operator == "EQ" || c.Operator == "NE" {
+			if c.Value == nil {
+				return nil, missing("a value")
+			}
+
+			ids = []string{*c.Value}
+		} else if len(ids) == 0 {
+			return nil, missing("values")
+		}
+
+		if c.Operator == "NE" || c.Operator == "NOT_IN" {
+			return bson.M{key: bson.M{"$nin": uniqueStrings(ids)}}, nil
+		}
+
+		return bson.M{key: bson.M{"$in": uniqueStrings(ids)}}, nil
+	}
+
+	// value compared by the operator, typed by the condition
+	var value interface{}
+	switch {
+	case kind == ruleNumber && c.Number == nil:
+		return nil, missing("a number")
+	case kind == ruleNumber:
+		value = *c.Number
+	case c.Operator == "WITHIN_LAST" || c.Operator == "NOT_WITHIN_LAST":
+		if c.Days == nil {
+			return nil, missing("days")
+		}
+
+		value = rc.now.AddDate(0, 0, -*c.Days)
+	case kind == ruleDate && c.Date == nil:
+		return nil, missing("a date")
+	case kind == ruleDate:
+		value = *c.Date
+	case kind == ruleBoolean && c.Value == nil:
+		return nil, missing("a value")
+	case kind == ruleBoolean:
+		if value, err = attribute.parse(*c.Value); err != nil {
+			return nil, err
+		}
+	case c.Value != nil:
+		value = *c.Value
+	}
+
+	switch c.Operator {
+	case "IN", "NOT_IN":
+		if len(c.Values) == 0 {
+			return nil, missing("values")
+		} else if c.Operator == "IN" {
+			return bson.M{key: bson.M{"$in": c.Values}}, nil
+		}
+
+		return bson.M{key: bson.M{"$nin": c.Values}}, nil
+	case "CONTAINS", "STARTS_WITH":
+		if c.Value == nil {
+			return nil, missing("a value")
+		}
+
+		pattern := regexp.QuoteMeta(*c.Value)
+		if c.Operator == "STARTS_WITH" {
+			pattern = "^" + pattern
+		}
+
+		return bson.M{key: bson.M{"$regex": pattern, "$options": "i"}}, nil
+	}
+
+	if value == nil {
+		return nil, missing("a value")
+	}
+
+	switch c.Operator {
+	case "EQ":
+		return bson.M{key: value}, nil
+	case "NE":
+		return bson.M{key: bson.M{"$ne": value}}, nil
+	case "GT":
+		return bson.M{key: bson.M{"$gt": value}}, nil
+	case "GTE", "WITHIN_LAST":
+		return bson.M{key: bson.M{"$gte": value}}, nil
+	case "LT", "NOT_WITHIN_LAST":
+		return bson.M{key: bson.M{"$lt": value}}, nil
+	default:
+		return bson.M{key: bson.M{"$lte": value}}, nil
+	}
+}
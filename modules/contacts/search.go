@@ -0,0 +1,316 @@
+package contacts
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/graphql-go/graphql"
+	"go.mongodb.org/mongo-driver/bson"
+	"neodeliver.com/engine/db"
+	"neodeliver.com/engine/jobs"
+	"neodeliver.com/engine/rbac"
+	"neodeliver.com/utils"
+)
+
+// Search of contacts by partial names, email, phone number or external id
+// contacts store the prefixes of the words of these fields (search_tokens), indexed with the organization
+// -------------------------------------------------------------------------------------
+
+const (
+	searchMaxPrefix     = 20   // longer words are matched by their first characters
+	searchMaxWords      = 10   // words of a query
+	searchMaxCandidates = 1000 // matching contacts ranked by search_contacts
+	searchMaxExact      = 100  // contacts matching the whole query, always ranked first
+)
+
+const (
+	searchIndexJob      = "contacts.search_index"
+	searchIndexInterval = 24 * time.Hour
+)
+
+type SearchContacts struct {
+	Query  string `validate:"required,max=200"` // every word must prefix a word of the contact, eg: "jo do" or "john.doe@"
+	First  *int   `validate:"omitempty,min=1,max=100"`
+	Offset *int   `validate:"omitempty,min=0"`
+}
+
+// ranked contacts of a search
+type ContactsSearch struct {
+	Contacts  []Contact `json:"contacts"`
+	Total     int64     `json:"total"`     // contacts matching the query
+	Truncated bool      `json:"truncated"` // more than 1000 contacts match: only contacts matching the whole query & the first 1000 matches are ranked, refine the query to reach the others
+}
+
+// arguments of the contacts list
+type ContactsList struct {
+	Search *string `validate:"omitempty,max=200"` // like search_contacts, without ranking
+}
+
+func init() {
+	jobs.Register(searchIndexJob, runSearchIndex)
+}
+
+// contacts matching the query, best matches first: exact emails, phone numbers & external ids, then whole words before prefixes
+// exact matches are queried on their own, other matches are ranked among the first 1000 & can't be paged beyond them
+func (Query) SearchContacts(p graphql.ResolveParams, rbac rbac.RBAC, args SearchContacts) (ContactsSearch, error) {
+	res := ContactsSearch{Contacts: []Contact{}}
+	words := searchWords(args.Query)
+	if len(words) == 0 {
+		return res, nil
+	}
+
+	first, offset := 10, 0
+	if args.First != nil {
+		first = *args.First
+	}
+
+	if args.Offset != nil {
+		offset = *args.Offset
+	}
+
+	query := searchQuery(rbac.OrganizationID, words)
+	total, err := db.Coll("contacts").Count(p.Context, query)
+	if err != nil {
+		return res, err
+	}
+
+	res.Total, res.Truncated = total, total > searchMaxCandidates
+	if res.Truncated && offset+first > searchMaxCandidates {
+		return res, fmt.Errorf("Only the first %d matches can be paged, refine the query", searchMaxCandidates)
+	}
+
+	exact, err := exactContacts(p.Context, rbac.OrganizationID, args.Query)
+	if err != nil {
+		return res, err
+	}
+
+	list := []Contact{}
+	err = db.Coll("contacts").Find(p.Context, query, &list, db.FindOptions{
+		Sort:  bson.D{{Key: "_id", Value: 1}},
+		Limit: searchMaxCandidates,
+	})
+
+	if err != nil {
+		return res, err
+	}
+
+	// exact matches beyond the ranked candidates are ranked along with them
+	seen := map[string]bool{}
+	for _, c := range list {
+		seen[c.ID] = true
+	}
+
+	for _, c := range exact {
+		if !seen[c.ID] {
+			list = append(list, c)
+		}
+	}
+
+	scores := map[string]int{}
+	for _, c := range list {
+		scores[c.ID] = searchScore(c, args.Query, words)
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return scores[list[i].ID] > scores[list[j].ID]
+	})
+
+	if offset > len(list) {
+		offset = len(list)
+	}
+
+	if offset+first < len(list) {
+		list = list[:offset+first]
+	}
+
+	res.Contacts = list[offset:]
+	return res, nil
+}
+
+// contacts whose email, external id or phone number is the query, whatever the number of prefix matches
+func exactContacts(ctx context.Context, organizationID, query string) ([]Contact, error) {
+	q := strings.TrimSpace(query)
+	or := []bson.M{{"external_id": q}}
+	if strings.Contains(q, "@") {
+		or = append(or, bson.M{"email": bson.M{"$in": uniqueStrings([]string{q, utils.NormalizeEmail(q)})}})
+	}
+
+	// phone numbers are matched by their E.164 digits, then compared as a whole
+	phone := utils.NormalizePhone(q)
+	if len(phone) > 6 && len(phone) <= searchMaxPrefix+1 {
+		or = append(or, bson.M{"search_tokens": phone[1:]})
+	}
+
+	list := []Contact{}
+	err := db.Coll("contacts").Find(ctx, bson.M{"organization_id": organizationID, "$or": or}, &list, db.FindOptions{Limit: searchMaxExact})
+
+	res := []Contact{}
+	for _, c := range list {
+		if searchScore(c, q, nil) >= 100 {
+			res = append(res, c)
+		}
+	}
+
+	return res, err
+}
+
+// ---
+
+// filter of the contacts of the organization matching every word
+func searchQuery(organizationID string, words []string) bson.M {
+	return bson.M{"organization_id": organizationID, "search_tokens": bson.M{"$all": words}}
+}
+
+// filter of the contacts list, matching every contact without search
+func contactsListQuery(organizationID string, search *string) map[string]interface{} {
+	if search != nil {
+		if words := searchWords(*search); len(words) > 0 {
+			return searchQuery(organizationID, words)
+		}
+	}
+
+	return map[string]interface{}{"organization_id": organizationID}
+}
+
+// lower case words of the text, split on anything but letters & digits
+func splitWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// words of a query, truncated like the indexed prefixes
+func searchWords(query string) []string {
+	words := []string{}
+	for _, w := range uniqueStrings(splitWords(query)) {
+		if r := []rune(w); len(r) > searchMaxPrefix {
+			w = string(r[:searchMaxPrefix])
+		}
+
+		words = append(words, w)
+	}
+
+	if len(words) > searchMaxWords {
+		words = words[:searchMaxWords]
+	}
+
+	return words
+}
+
+// words of the searchable fields, phone numbers being searchable in E.164 format as well (eg: 33612345678)
+func searchableWords(d ContactData) []string {
+	words := []string{}
+	for _, v := range []*string{d.GivenName, d.LastName, d.Email, d.ExternalID, d.PhoneNumber} {
+		if v != nil {
+			words = append(words, splitWords(*v)...)
+		}
+	}
+
+	if d.PhoneNumber != nil {
+		if phone := utils.NormalizePhone(*d.PhoneNumber); phone != "" {
+			words = append(words, phone[1:])
+		}
+	}
+
+	return words
+}
+
+// prefixes of the searchable words
+func searchTokens(d ContactData) []string {
+	tokens := []string{}
+	for _, w := range searchableWords(d) {
+		r := []rune(w)
+		for i := 1; i <= len(r) && i <= searchMaxPrefix; i++ {
+			tokens = append(tokens, string(r[:i]))
+		}
+	}
+
+	return uniqueStrings(tokens)
+}
+
+// relevance of a matching contact: whole email, phone number or external id, then whole words before prefixes
+func searchScore(c Contact, query string, words []string) int {
+	score := 0
+	q := strings.TrimSpace(query)
+	for _, v := range []*string{c.Email, c.ExternalID} {
+		if v != nil && strings.EqualFold(*v, q) {
+			score += 100
+		}
+	}
+
+	if c.PhoneNumber != nil && utils.NormalizePhone(q) != "" && utils.NormalizePhone(*c.PhoneNumber) == utils.NormalizePhone(q) {
+		score += 100
+	}
+
+	contact := searchableWords(c.ContactData)
+	for _, w := range words {
+		best := 0
+		for _, cw := range contact {
+			if cw == w {
+				best = 3
+				break
+			} else if strings.HasPrefix(cw, w) {
+				best = 1
+			}
+		}
+
+		score += best
+	}
+
+	return score
+}
+
+// store the search tokens of the contacts
+func indexContacts(ctx context.Context, contacts []Contact) error {
+	models := []db.WriteModel{}
+	for _, c := range contacts {
+		models = append(models, db.UpdateModel{
+			Filter: bson.M{"_id": c.ID, "organization_id": c.OrganizationID},
+			Update: bson.M{"$set": bson.M{"search_tokens": searchTokens(c.ContactData)}},
+		})
+	}
+
+	res, err := db.Coll("contacts").BulkWrite(ctx, models)
+	if err != nil {
+		return err
+	}
+
+	return firstError(res)
+}
+
+// store the search tokens of the contacts of the organization by ids, eg: once updated
+func reindexContacts(ctx context.Context, organizationID string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	list := []Contact{}
+	if err := db.Coll("contacts").Find(ctx, bson.M{"organization_id": organizationID, "_id": bson.M{"$in": ids}}, &list, db.FindOptions{}); err != nil {
+		return err
+	}
+
+	return indexContacts(ctx, list)
+}
+
+// store the search tokens of the contacts missing them, the index being created by the contacts.migrate_search_index migration
+func runSearchIndex(ctx context.Context, j *jobs.Job) error {
+	query := bson.M{"search_tokens": bson.M{"$exists": false}}
+	total, err := db.Coll("contacts").Count(ctx, query)
+	if err != nil || total == 0 {
+		return err
+	}
+
+	processed := int64(0)
+	return eachContacts(ctx, query, func(page []Contact) error {
+		if err := indexContacts(ctx, page); err != nil {
+			return err
+		}
+
+		processed += int64(len(page))
+		return j.Progress(ctx, processed, total, nil)
+	})
+}
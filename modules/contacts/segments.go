@@ -9,60 +9,85 @@ import (
 	"neodeliver.com/engine/db"
 	ggraphql "neodeliver.com/engine/graphql"
 	"neodeliver.com/engine/rbac"
-	utils "neodeliver.com/utils"
 )
 
+const SegmentPrefixID = "sgt_"
+
 type Segment struct {
-	ID             string `bson:"_id,omitempty" json:"id"`
-	OrganizationID string    `bson:"organization_id"`
-	OpensCount	   int    `bson:"opens_count" json:"opens_count"`
-	ClickRate	   int	  `bson:"click_rate" json:"click_rate"`
-	MailsSentCount int	  `bson:"mails_sent_count" json:"mail_sent_count"`
-	CreatedAt      time.Time `bson:"created_at" json:"created_at"`
-	SegmentData			`bson:",inline" json:",inline"`
+	ID             string     `bson:"_id,omitempty" json:"id"`
+	OrganizationID string     `bson:"organization_id"`
+	OpensCount     int        `bson:"opens_count" json:"opens_count"`
+	ClickRate      int        `bson:"click_rate" json:"click_rate"` // percentage of the mails sent that were clicked
+	MailsSentCount int        `bson:"mails_sent_count" json:"mails_sent_count"`
+	ContactsCount  int        `bson:"contacts_count" json:"contacts_count"`
+	RefreshedAt    *time.Time `bson:"refreshed_at,omitempty" json:"refreshed_at"` // last refresh of the counters
+	SnapshotAt     *time.Time `bson:"snapshot_at,omitempty" json:"snapshot_at"`   // last snapshot of static segments
+	Filters        *string    `bson:"filters,omitempty" json:"-" graphql:"-"`     // raw mongodb filters of segments created before rules, converted by a migration
+	CreatedAt      time.Time  `bson:"created_at" json:"created_at"`
+	SegmentData    `bson:",inline" json:",inline"`
+}
+
+func (Segment) GraphqlMethods() []string {
+	return []string{"OpenRate"}
+}
+
+// ratio of opened mails over the mails sent to the segment
+func (s Segment) OpenRate() float64 {
+	if s.MailsSentCount == 0 {
+		return 0
+	}
+
+	return float64(s.OpensCount) / float64(s.MailsSentCount)
 }
 
 type SegmentData struct {
-	Name           *string `bson:"name" json:"name"`
-	Filters		   *string `bson:"filters" json:"filters"`
-	Subscription   *int	  `bson:"subscription" json:"subscription"`
+	Name         *string       `bson:"name" json:"name"`
+	Type         *string       `bson:"type" json:"type" validate:"omitempty,oneof=DYNAMIC STATIC"` // static segments keep the contacts matching their rules when snapshotted
+	Rules        *SegmentRules `bson:"rules" json:"rules"`                                         // contacts of the segment
+	Subscription *int          `bson:"subscription" json:"subscription"`
 }
 
 type SegmentID struct {
-	ID			   string `bson:"_id, omitempty"`
+	ID string `bson:"_id, omitempty"`
 }
 
 func (s SegmentData) Validate() error {
-	match := utils.ValidateMongoDBQuery(s.Filters)
-	if !match {
-		return errors.New("Filter query is not valid")
+	if s.Rules != nil {
+		return s.Rules.Validate()
 	}
 	return nil
 }
 
 func (Mutation) CreateSegment(p graphql.ResolveParams, rbac rbac.RBAC, args SegmentData) (Segment, error) {
 	s := Segment{
-		ID:				"sgt_" + ksuid.New().String(),
-		OrganizationID:	rbac.OrganizationID,
-		OpensCount:		0,
-		ClickRate:		0,
-		MailsSentCount:	0,
-		CreatedAt:		time.Now(),
-		SegmentData:	args,
+		ID:             SegmentPrefixID + ksuid.New().String(),
+		OrganizationID: rbac.OrganizationID,
+		OpensCount:     0,
+		ClickRate:      0,
+		MailsSentCount: 0,
+		CreatedAt:      time.Now(),
+		SegmentData:    args,
+	}
+
+	if s.Type == nil {
+		dynamic := "DYNAMIC"
+		s.Type = &dynamic
 	}
 
 	if err := s.Validate(); err != nil {
 		return s, err
 	}
 
-	_, err := db.Save(p.Context, &s)
+	if err := db.Save(p.Context, &s); err != nil {
+		return s, err
+	}
 
-	return s, err
+	return s, s.snapshot(p.Context)
 }
 
 type SegmentEdit struct {
-	ID		string
-	Data	SegmentData	`json:"data"`
+	ID   string
+	Data SegmentData `json:"data"`
 }
 
 func (Mutation) UpdateSegment(p graphql.ResolveParams, rbac rbac.RBAC, args SegmentEdit) (Segment, error) {
@@ -75,17 +100,33 @@ func (Mutation) UpdateSegment(p graphql.ResolveParams, rbac rbac.RBAC, args Segm
 		return Segment{}, errors.New("no data to update")
 	}
 
+	// rules are stored typed rather than as the raw argument
+	if _, ok := data["rules"]; ok {
+		data["rules"] = args.Data.Rules
+	}
+
 	s := Segment{}
 
 	err := db.Update(p.Context, &s, map[string]string{
-		"_id": args.ID,
+		"_id":             args.ID,
+		"organization_id": rbac.OrganizationID,
 	}, data)
 
+	// the contacts of static segments are snapshotted again when their rules change
+	_, rules := data["rules"]
+	_, kind := data["type"]
+	if err == nil && (rules || kind) {
+		err = s.snapshot(p.Context)
+	}
+
 	return s, err
 }
 
 func (Mutation) DeleteSegment(p graphql.ResolveParams, rbac rbac.RBAC, filter SegmentID) (bool, error) {
 	s := Segment{}
-	err := db.Delete(p.Context, &s, map[string]string{"_id": filter.ID})
+	err := db.Delete(p.Context, &s, map[string]string{"_id": filter.ID, "organization_id": rbac.OrganizationID})
+	if err == nil {
+		err = clearSegmentMembers(p.Context, rbac.OrganizationID, filter.ID)
+	}
 	return true, err
 }
@@ -0,0 +1,488 @@
+package contacts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/graphql-go/graphql"
+	"github.com/segmentio/ksuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"neodeliver.com/engine/config"
+	"neodeliver.com/engine/db"
+	"neodeliver.com/engine/logger"
+	"neodeliver.com/engine/rbac"
+	"neodeliver.com/engine/server"
+	"neodeliver.com/smtp/sender"
+)
+
+// Subscription lifecycle of contacts, a state machine whose transitions are recorded in contact_transitions
+// with who or what caused them & from which source
+// double opt-in contacts are PENDING until they follow the signed link of their confirmation email
+// -------------------------------------------------------------------------------------
+
+const ContactTransitionPrefixID = "ctr_"
+
+const ConfirmationPath = "/subscriptions/confirm"
+
+const (
+	StatusPending      = "PENDING"
+	StatusActive       = "ACTIVE"
+	StatusUnsubscribed = "UNSUBSCRIBED"
+	StatusBounced      = "BOUNCED"
+	StatusComplained   = "COMPLAINED"
+	StatusCleaned      = "CLEANED"
+)
+
+// statuses each status can change to, "" being new contacts
+var statusTransitions = map[string][]string{
+	"":                 {StatusPending, StatusActive},
+	StatusPending:      {StatusActive, StatusUnsubscribed, StatusBounced, StatusCleaned},
+	StatusActive:       {StatusUnsubscribed, StatusBounced, StatusComplained, StatusCleaned},
+	StatusUnsubscribed: {StatusPending, StatusActive, StatusCleaned},
+	StatusBounced:      {StatusPending, StatusActive, StatusCleaned},
+	StatusComplained:   {StatusPending, StatusCleaned}, // complaints are only lifted by a new opt-in
+	StatusCleaned:      {StatusPending, StatusActive},
+}
+
+type ContactTransition struct {
+	ID             string    `bson:"_id" json:"id"`
+	OrganizationID string    `bson:"organization_id" json:"organization_id"`
+	ContactID      string    `bson:"contact_id" json:"contact_id"`
+	From           *string   `bson:"from" json:"from"` // null when the contact was created
+	To             string    `bson:"to" json:"to"`
+	Cause          string    `bson:"cause" json:"cause"`         // USER, API_KEY, CONTACT or SYSTEM
+	ActorID        *string   `bson:"actor_id" json:"actor_id"`   // id of the user or api key
+	Source         string    `bson:"source" json:"source"`       // API, BULK, IMPORT, SUBSCRIPTION, CONFIRMATION or MERGE
+	SourceID       *string   `bson:"source_id" json:"source_id"` // eg: id of the import
+	Reason         *string   `bson:"reason" json:"reason"`
+	CreatedAt      time.Time `bson:"created_at" json:"created_at"`
+}
+
+type SubscribeContact struct {
+	Data        ContactData     `json:"data"`
+	DoubleOptIn *bool           `json:"double_opt_in"`                       // send a confirmation link, the contact being PENDING until confirmed
+	Reason      *string         `json:"reason" validate:"omitempty,max=200"` // eg: newsletter form
+	Consents    []ConsentChange `json:"consents" validate:"max=100,dive"`    // consents collected with the subscription
+	Proof       *ConsentProof   `json:"proof"`                               // proof of the consents (ip, form...)
+}
+
+type ContactTransitions struct {
+	ID string // id of the contact
+}
+
+// subscribe a new or existing contact (matched by external_id or email), with or without double opt-in
+// pending contacts subscribing again receive a new confirmation link
+func (Mutation) SubscribeContact(p graphql.ResolveParams, rbac rbac.RBAC, args SubscribeContact) (Contact, error) {
+	c := Contact{}
+	if err := args.Data.Validate(); err != nil {
+		return c, err
+	} else if args.Data.Email == nil && args.Data.ExternalID == nil {
+		return c, errors.New("Subscriptions require an email or an external_id")
+	}
+
+	status := StatusActive
+	if args.DoubleOptIn != nil && *args.DoubleOptIn {
+		if args.Data.Email == nil {
+			return c, errors.New("Double opt-in requires an email address")
+		} else if config.Get().Mailer.From == "" {
+			return c, errors.New("Double opt-in is unavailable, no email sender is configured")
+		}
+
+		status = StatusPending
+	}
+
+	if err := verifyConsents(p.Context, rbac.OrganizationID, args.Consents); err != nil {
+		return c, err
+	}
+
+	attributes, err := contactAttributes(p.Context, rbac.OrganizationID, args.Data.Attributes)
+	if err != nil {
+		return c, err
+	}
+
+	data := args.Data
+	data.Attributes = attributes
+
+	cause := causeOf(rbac, "SUBSCRIPTION")
+	cause.reason = args.Reason
+
+	outcomes, err := upsertContacts(p.Context, rbac.OrganizationID, "UPSERT", []importRow{{data: data}}, status, cause)
+	if err != nil {
+		return c, err
+	} else if outcomes[0].status == "FAILED" {
+		return c, errors.New(outcomes[0].err)
+	}
+
+	err = db.Coll("contacts").FindOne(p.Context, bson.M{"_id": outcomes[0].id, "organization_id": rbac.OrganizationID}, &c)
+	if err != nil {
+		return c, err
+	}
+
+	// active contacts don't need to confirm their subscription again
+	if outcomes[0].status != "CREATED" && c.Status != status && !(status == StatusPending && c.Status == StatusActive) {
+		res, err := transitionContacts(p.Context, rbac.OrganizationID, []Contact{c}, status, cause)
+		if err != nil {
+			return c, err
+		} else if res[c.ID] == "SKIPPED" {
+			return c, fmt.Errorf("The status of the contact can't change from %s to %s", c.Status, status)
+		}
+
+		if err := db.Coll("contacts").FindOne(p.Context, bson.M{"_id": c.ID, "organization_id": rbac.OrganizationID}, &c); err != nil {
+			return c, err
+		}
+	}
+
+	if len(args.Consents) > 0 {
+		proof := ConsentProof{}
+		if args.Proof != nil {
+			proof = *args.Proof
+		}
+
+		contacts := []Contact{c}
+		if err := recordConsents(p.Context, rbac.OrganizationID, contacts, consents(args.Consents, "SUBSCRIPTION", proof, time.Now()), cause); err != nil {
+			return c, err
+		}
+
+		c = contacts[0]
+	}
+
+	if c.Status == StatusPending {
+		err = sendConfirmation(p.Context, &c)
+	}
+
+	return c, err
+}
+
+// status transitions of a contact, oldest first
+func (Query) ContactTransitions(p graphql.ResolveParams, rbac rbac.RBAC, args ContactTransitions) ([]ContactTransition, error) {
+	list := []ContactTransition{}
+	id, err := resolveContactID(p.Context, rbac.OrganizationID, args.ID)
+	if err != nil {
+		return list, err
+	}
+
+	err = db.Coll("contact_transitions").Find(p.Context, bson.M{"organization_id": rbac.OrganizationID, "contact_id": id}, &list, db.FindOptions{
+		Sort: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}},
+	})
+
+	return list, err
+}
+
+// ---
+
+// statuses receiving messages: marketing messages are only sent to ACTIVE contacts
+// transactional messages (eg: confirmation emails) also to PENDING & UNSUBSCRIBED contacts, never to BOUNCED, COMPLAINED or CLEANED contacts
+func SendableStatuses(transactional bool) []string {
+	if transactional {
+		return []string{StatusActive, StatusPending, StatusUnsubscribed}
+	}
+
+	return []string{StatusActive}
+}
+
+// whether messages can be sent to the contact, recipients should be selected with SendableStatuses
+func (c Contact) Sendable(transactional bool) bool {
+	for _, s := range SendableStatuses(transactional) {
+		if c.Status == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func canTransition(from, to string) bool {
+	for _, s := range statusTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// who or what changes the status of contacts & from which source
+type statusCause struct {
+	cause    string
+	actorID  *string
+	source   string
+	sourceID *string
+	reason   *string
+}
+
+// cause of the changes made by the authenticated user or api key, background jobs changing statuses as the SYSTEM
+func causeOf(r rbac.RBAC, source string) statusCause {
+	switch {
+	case r.APIKeyID != "":
+		return statusCause{cause: "API_KEY", actorID: &r.APIKeyID, source: source}
+	case r.UserID != "":
+		return statusCause{cause: "USER", actorID: &r.UserID, source: source}
+	default:
+		return statusCause{cause: "SYSTEM", source: source}
+	}
+}
+
+func (c statusCause) transition(organizationID, contactID, from, to string, at time.Time) ContactTransition {
+	t := ContactTransition{
+		ID:             ContactTransitionPrefixID + ksuid.New().String(),
+		OrganizationID: organizationID,
+		ContactID:      contactID,
+		To:             to,
+		Cause:          c.cause,
+		ActorID:        c.actorID,
+		Source:         c.source,
+		SourceID:       c.sourceID,
+		Reason:         c.reason,
+		CreatedAt:      at,
+	}
+
+	if from != "" {
+		t.From = &from
+	}
+
+	return t
+}
+
+func recordTransitions(ctx context.Context, transitions []ContactTransition) error {
+	models := make([]db.WriteModel, len(transitions))
+	for i, t := range transitions {
+		models[i] = db.InsertModel{Document: t}
+	}
+
+	res, err := db.Coll("contact_transitions").BulkWrite(ctx, models)
+	if err != nil {
+		return err
+	}
+
+	return firstError(res)
+}
+
+// move the contacts to the status when their current status allows it & record the transitions
+// returns the status of each contact: UPDATED, UNCHANGED or SKIPPED when the transition is not allowed
+func transitionContacts(ctx context.Context, organizationID string, contacts []Contact, to string, cause statusCause) (map[string]string, error) {
+	res, byStatus := map[string]string{}, map[string][]string{}
+	for _, c := range contacts {
+		switch {
+		case c.Status == to:
+			res[c.ID] = "UNCHANGED"
+		case !canTransition(c.Status, to):
+			res[c.ID] = "SKIPPED"
+		default:
+			res[c.ID] = "UPDATED"
+			byStatus[c.Status] = append(byStatus[c.Status], c.ID)
+		}
+	}
+
+	now := time.Now()
+	update := bson.M{"$set": bson.M{"status": to}}
+	if to == StatusActive {
+		update["$set"] = bson.M{"status": to, "subscribed_at": now}
+	}
+
+	// confirmation links are only valid while the contact is pending
+	if to != StatusPending {
+		update["$unset"] = bson.M{"confirmation_token": ""}
+	}
+
+	transitions := []ContactTransition{}
+	for from, ids := range byStatus {
+		// contacts are filtered by their previous status, concurrent changes are not overwritten
+		_, err := db.Coll("contacts").UpdateMany(ctx, bson.M{"organization_id": organizationID, "_id": bson.M{"$in": ids}, "status": from}, update)
+		if err != nil {
+			return res, err
+		}
+
+		for _, id := range ids {
+			transitions = append(transitions, cause.transition(organizationID, id, from, to, now))
+		}
+	}
+
+	return res, recordTransitions(ctx, transitions)
+}
+
+// delivery of confirmation emails, replaced by tests
+var sendText = sender.SendText
+
+// sign a new confirmation link for a pending contact & send it by email, earlier links of the contact are no longer valid
+func sendConfirmation(ctx context.Context, c *Contact) error {
+	if c.Status != StatusPending || c.Email == nil {
+		return errors.New("Only pending contacts with an email address can confirm their subscription")
+	}
+
+	token, now := ksuid.New().String(), time.Now()
+	_, err := db.Coll("contacts").UpdateMany(ctx, bson.M{"_id": c.ID, "organization_id": c.OrganizationID, "status": StatusPending}, bson.M{"$set": bson.M{
+		"confirmation_token":   token,
+		"confirmation_sent_at": now,
+	}})
+
+	if err != nil {
+		return err
+	}
+
+	link, err := confirmationURL(c.ID, token, now.Add(config.Get().Confirmations.TTL))
+	if err != nil {
+		logger.Report(ctx, err, "Could not sign confirmation link", "contact", c.ID)
+		return err
+	}
+
+	c.ConfirmationToken, c.ConfirmationSentAt = token, &now
+
+	// the link is a bearer token and is never logged
+	text := "Please confirm your subscription by following this link:\n\n" + link +
+		"\n\nThe link expires on " + now.Add(config.Get().Confirmations.TTL).UTC().Format(time.RFC1123) + ". If you did not subscribe, you can ignore this email."
+
+	if err := sendText(ctx, *c.Email, "Confirm your subscription", text); err != nil {
+		logger.Report(ctx, err, "Could not send confirmation email", "contact", c.ID)
+		return errors.New("Could not send the confirmation email")
+	}
+
+	return nil
+}
+
+// ---
+// confirmation JWT helper functions
+
+type confirmationClaims struct {
+	ID    string `json:"id"` // id of the contact
+	Exp   int64  `json:"exp"`
+	Token string `json:"tk"`
+}
+
+func (c confirmationClaims) Valid() error {
+	if time.Unix(c.Exp, 0).After(time.Now()) {
+		return nil
+	}
+
+	return fmt.Errorf("confirmation token expired")
+}
+
+func confirmationsSecret() []byte {
+	return []byte(config.Get().Confirmations.Secret)
+}
+
+func confirmationURL(contactID, token string, expires time.Time) (string, error) {
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, confirmationClaims{
+		ID:    contactID,
+		Exp:   expires.Unix(),
+		Token: token,
+	}).SignedString(confirmationsSecret())
+
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("token", signed)
+	return strings.TrimSuffix(config.Get().Confirmations.URL, "/") + ConfirmationPath + "?" + q.Encode(), nil
+}
+
+var errInvalidConfirmation = errors.New("invalid or expired confirmation link")
+
+// contact of a signed confirmation link, pending or already confirmed
+func confirmationContact(ctx context.Context, token string) (Contact, error) {
+	c := Contact{}
+	claims := confirmationClaims{}
+	_, err := jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return confirmationsSecret(), nil
+	})
+
+	if err != nil {
+		return c, errInvalidConfirmation
+	}
+
+	err = db.Coll("contacts").FindOne(ctx, bson.M{"_id": claims.ID}, &c)
+	if errors.Is(err, db.ErrNoDocuments) {
+		return c, errInvalidConfirmation
+	} else if err != nil {
+		return c, err
+	} else if c.Status == StatusActive && c.ConfirmationToken == "" {
+		return c, nil
+	} else if c.Status != StatusPending || c.ConfirmationToken != claims.Token {
+		return c, errInvalidConfirmation
+	}
+
+	return c, nil
+}
+
+// activate the pending contact of a signed confirmation link, following a link again once confirmed does nothing
+func confirmSubscription(ctx context.Context, token string) (Contact, error) {
+	c, err := confirmationContact(ctx, token)
+	if err != nil || c.Status == StatusActive {
+		return c, err
+	}
+
+	_, err = transitionContacts(ctx, c.OrganizationID, []Contact{c}, StatusActive, statusCause{cause: "CONTACT", source: "CONFIRMATION"})
+	return c, err
+}
+
+// page of confirmation links, the subscription is only confirmed by submitting its form
+// so that links opened by email scanners & previews don't confirm it
+var confirmationPage = template.Must(template.New("confirmation").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Confirm your subscription</title></head>
+<body>
+{{- if .Confirmed }}
+<p>Your subscription is confirmed</p>
+{{- else }}
+<form method="post">
+<input type="hidden" name="token" value="{{ .Token }}">
+<button type="submit">Confirm my subscription</button>
+</form>
+{{- end }}
+</body>
+</html>
+`))
+
+// confirm subscriptions from the links of confirmation emails, mounted on ConfirmationPath
+// GET serves a page whose form POSTs the token, only the POST activates the contact
+func ConfirmationHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.SecurityHeaders(w)
+		w.Header().Set("Cache-Control", "private, no-store")
+
+		var c Contact
+		var err error
+		switch r.Method {
+		case http.MethodGet:
+			c, err = confirmationContact(r.Context(), r.URL.Query().Get("token"))
+		case http.MethodPost:
+			c, err = confirmSubscription(r.Context(), r.PostFormValue("token"))
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if errors.Is(err, errInvalidConfirmation) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		} else if err != nil {
+			logger.Report(r.Context(), err, "Could not confirm subscription", "contact", c.ID)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		confirmed := r.Method == http.MethodPost || c.Status == StatusActive
+		if u := config.Get().Confirmations.RedirectURL; u != "" && confirmed {
+			http.Redirect(w, r, u, http.StatusSeeOther)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err = confirmationPage.Execute(w, map[string]interface{}{"Confirmed": confirmed, "Token": r.URL.Query().Get("token")})
+		if err != nil {
+			logger.Report(r.Context(), err, "Could not render the confirmation page", "contact", c.ID)
+		}
+	})
+}
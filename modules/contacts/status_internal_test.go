@@ -0,0 +1,51 @@
+package contacts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatusTransitions(t *testing.T) {
+	statuses := []string{StatusPending, StatusActive, StatusUnsubscribed, StatusBounced, StatusComplained, StatusCleaned}
+	for _, from := range append([]string{""}, statuses...) {
+		if _, ok := statusTransitions[from]; !ok {
+			t.Errorf("no transitions from %q", from)
+		}
+
+		for _, to := range statusTransitions[from] {
+			if to == from || to == "" {
+				t.Errorf("invalid transition from %q to %q", from, to)
+			}
+		}
+	}
+
+	tests := []struct {
+		from, to string
+		allowed  bool
+	}{
+		{"", StatusPending, true},
+		{"", StatusUnsubscribed, false},
+		{StatusPending, StatusActive, true},
+		{StatusPending, StatusComplained, false},
+		{StatusActive, StatusPending, false},
+		{StatusUnsubscribed, StatusActive, true},
+		{StatusComplained, StatusActive, false},
+		{StatusComplained, StatusPending, true},
+		{StatusCleaned, StatusUnsubscribed, false},
+		{StatusCleaned, StatusActive, true},
+	}
+
+	for _, tt := range tests {
+		if got := canTransition(tt.from, tt.to); got != tt.allowed {
+			t.Errorf("transition from %q to %q allowed %v, want %v", tt.from, tt.to, got, tt.allowed)
+		}
+	}
+}
+
+func TestConfirmationClaims(t *testing.T) {
+	if err := (confirmationClaims{Exp: time.Now().Add(time.Minute).Unix()}).Valid(); err != nil {
+		t.Errorf("valid claims: %v", err)
+	} else if err := (confirmationClaims{Exp: time.Now().Add(-time.Second).Unix()}).Valid(); err == nil {
+		t.Error("expired claims are valid")
+	}
+}
@@ -0,0 +1,221 @@
+package contacts_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"neodeliver.com/engine/config"
+	"neodeliver.com/modules/contacts"
+	"neodeliver.com/modules/graphqltest"
+)
+
+type transition struct {
+	From   *string `json:"from"`
+	To     string  `json:"to"`
+	Cause  string  `json:"cause"`
+	Source string  `json:"source"`
+}
+
+func TestSetContactsStatus(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	seedContacts(t, c,
+		bson.M{"_id": "ctc_a", "status": "ACTIVE"},
+		bson.M{"_id": "ctc_b", "status": "COMPLAINED"},
+		bson.M{"_id": "ctc_c", "status": "UNSUBSCRIBED"},
+	)
+
+	res := struct {
+		SetContactsStatus struct {
+			Items []struct {
+				Status string `json:"status"`
+			} `json:"items"`
+		} `json:"set_contacts_status"`
+	}{}
+
+	c.Exec(`mutation { set_contacts_status(status: "UNSUBSCRIBED", reason: "asked by phone", ids: ["ctc_a", "ctc_b", "ctc_c", "ctc_missing"]) { items { status } } }`, nil, &res)
+	got := []string{}
+	for _, item := range res.SetContactsStatus.Items {
+		got = append(got, item.Status)
+	}
+
+	// complaints are only lifted by a new opt-in
+	if want := []string{"UPDATED", "SKIPPED", "UNCHANGED", "NOT_FOUND"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	history := struct {
+		ContactTransitions []transition `json:"contact_transitions"`
+	}{}
+
+	c.Exec(`{ contact_transitions(id: "ctc_a") { from to cause source } }`, nil, &history)
+	active := "ACTIVE"
+	if want := []transition{{&active, "UNSUBSCRIBED", "USER", "BULK"}}; !reflect.DeepEqual(history.ContactTransitions, want) {
+		t.Errorf("transitions %+v, want %+v", history.ContactTransitions, want)
+	}
+
+	c.Exec(`{ contact_transitions(id: "ctc_b") { from to cause source } }`, nil, &history)
+	if len(history.ContactTransitions) != 0 {
+		t.Errorf("skipped contact has transitions %+v", history.ContactTransitions)
+	}
+}
+
+// sends the confirmation links to the returned channel
+func confirmations(t *testing.T, ttl time.Duration) chan string {
+	t.Helper()
+
+	previous := config.Get()
+	cfg := *previous
+	cfg.Mailer.From = "noreply@example.com"
+	cfg.Confirmations.TTL = ttl
+	config.Set(&cfg)
+
+	links := make(chan string, 10)
+	restore := contacts.SetSendText(func(ctx context.Context, to, subject, text string) error {
+		for _, line := range strings.Split(text, "\n") {
+			if strings.HasPrefix(line, "/") || strings.HasPrefix(line, "http") {
+				links <- line
+			}
+		}
+
+		return nil
+	})
+
+	t.Cleanup(func() {
+		restore()
+		config.Set(previous)
+	})
+
+	return links
+}
+
+// confirmation link of the last email
+func confirmationToken(t *testing.T, links chan string) string {
+	t.Helper()
+
+	select {
+	case link := <-links:
+		u, err := url.Parse(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return u.Query().Get("token")
+	default:
+		t.Fatal("no confirmation email was sent")
+		return ""
+	}
+}
+
+func confirm(method, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, contacts.ConfirmationPath+"?token="+url.QueryEscape(token), nil)
+	if method == http.MethodPost {
+		r = httptest.NewRequest(http.MethodPost, contacts.ConfirmationPath, strings.NewReader(url.Values{"token": {token}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	w := httptest.NewRecorder()
+	contacts.ConfirmationHandler().ServeHTTP(w, r)
+	return w
+}
+
+func TestSubscribeDoubleOptIn(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	links := confirmations(t, time.Hour)
+
+	subscribe := `mutation { subscribe_contact(data: {email: "john@example.com"}, double_opt_in: true) { id status } }`
+	res := struct {
+		SubscribeContact struct {
+			ID     string `json:"id"`
+			Status string `json:"status"`
+		} `json:"subscribe_contact"`
+	}{}
+
+	c.Exec(subscribe, nil, &res)
+	if res.SubscribeContact.Status != "PENDING" {
+		t.Fatalf("subscribed %+v, want PENDING", res.SubscribeContact)
+	}
+
+	// subscribing again sends a new link, earlier links become invalid
+	first := confirmationToken(t, links)
+	c.Exec(subscribe, nil, &res)
+	token := confirmationToken(t, links)
+	if w := confirm(http.MethodPost, first); w.Code != http.StatusForbidden {
+		t.Errorf("earlier link answered %d, want 403", w.Code)
+	}
+
+	// opening the link only shows the confirmation form
+	w := confirm(http.MethodGet, token)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `method="post"`) {
+		t.Errorf("got %d %s, want the confirmation form", w.Code, w.Body.String())
+	}
+
+	status := struct {
+		Contact struct {
+			Status string `json:"status"`
+		} `json:"contact"`
+	}{}
+
+	c.Exec(`query($id: String!) { contact(id: $id) { status } }`, map[string]interface{}{"id": res.SubscribeContact.ID}, &status)
+	if status.Contact.Status != "PENDING" {
+		t.Fatalf("contact %s after opening the link, want PENDING", status.Contact.Status)
+	}
+
+	if w := confirm(http.MethodPost, token); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "confirmed") {
+		t.Errorf("got %d %s, want the subscription confirmed", w.Code, w.Body.String())
+	}
+
+	c.Exec(`query($id: String!) { contact(id: $id) { status } }`, map[string]interface{}{"id": res.SubscribeContact.ID}, &status)
+	if status.Contact.Status != "ACTIVE" {
+		t.Errorf("contact %s after confirming, want ACTIVE", status.Contact.Status)
+	}
+
+	// following the link again once confirmed does nothing
+	if w := confirm(http.MethodPost, token); w.Code != http.StatusOK {
+		t.Errorf("confirming again answered %d, want 200", w.Code)
+	}
+
+	history := struct {
+		ContactTransitions []transition `json:"contact_transitions"`
+	}{}
+
+	c.Exec(`query($id: String!) { contact_transitions(id: $id) { from to cause source } }`, map[string]interface{}{"id": res.SubscribeContact.ID}, &history)
+	pending := "PENDING"
+	want := []transition{{nil, "PENDING", "USER", "SUBSCRIPTION"}, {&pending, "ACTIVE", "CONTACT", "CONFIRMATION"}}
+	if !reflect.DeepEqual(history.ContactTransitions, want) {
+		t.Errorf("transitions %+v, want %+v", history.ContactTransitions, want)
+	}
+
+	// active contacts subscribing again don't need to confirm
+	c.Exec(subscribe, nil, &res)
+	if res.SubscribeContact.Status != "ACTIVE" || len(links) != 0 {
+		t.Errorf("resubscribed %+v with %d emails, want ACTIVE without email", res.SubscribeContact, len(links))
+	}
+}
+
+func TestExpiredConfirmation(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	links := confirmations(t, -time.Minute)
+
+	c.Exec(`mutation { subscribe_contact(data: {email: "john@example.com"}, double_opt_in: true) { id } }`, nil, nil)
+	token := confirmationToken(t, links)
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		if w := confirm(method, token); w.Code != http.StatusForbidden {
+			t.Errorf("%s of an expired link answered %d, want 403", method, w.Code)
+		}
+	}
+
+	if w := confirm(http.MethodPost, token+"x"); w.Code != http.StatusForbidden {
+		t.Errorf("tampered link answered %d, want 403", w.Code)
+	}
+
+	if n, err := c.DB.Collection("contacts").Count(c.Context(), bson.M{"status": "PENDING"}); err != nil || n != 1 {
+		t.Errorf("%d pending contacts (%v), want 1", n, err)
+	}
+}
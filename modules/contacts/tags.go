@@ -5,41 +5,43 @@ import (
 	"time"
 
 	"github.com/graphql-go/graphql"
-	"neodeliver.com/engine/rbac"
-	"neodeliver.com/engine/db"
 	"github.com/segmentio/ksuid"
+	"neodeliver.com/engine/db"
 	ggraphql "neodeliver.com/engine/graphql"
+	"neodeliver.com/engine/rbac"
 )
 
+const TagPrefixID = "tag_"
+
 type Tag struct {
-	ID             string `bson:"_id,omitempty" json:"id"`
-	OrganizationID string `bson:"organization_id"`
+	ID             string    `bson:"_id,omitempty" json:"id"`
+	OrganizationID string    `bson:"organization_id"`
 	ContactsCount  int       `bson:"contacts_count"`
 	CreatedAt      time.Time `bson:"created_at" json:"created_at"`
-	TagData		   `bson:",inline" json:",inline"`
+	TagData        `bson:",inline" json:",inline"`
 }
 
 type TagData struct {
-	Name			*string	`bson:"name" json:"name"`
-	Description		*string	`bson:"description" json:"description"`
+	Name        *string `bson:"name" json:"name"`
+	Description *string `bson:"description" json:"description"`
 }
 
 type TagEdit struct {
-	ID		string
-	Data	TagData	`json:"data"`
+	ID   string
+	Data TagData `json:"data"`
 }
 
 type TagID struct {
-	ID             string `bson:"_id, omitempty"`
+	ID string `bson:"_id, omitempty"`
 }
 
 func (Mutation) AddTag(p graphql.ResolveParams, rbac rbac.RBAC, args TagData) (Tag, error) {
 	t := Tag{
-		ID:				"tag_" + ksuid.New().String(),
-		OrganizationID:	rbac.OrganizationID,
-		ContactsCount:	0,
+		ID:             TagPrefixID + ksuid.New().String(),
+		OrganizationID: rbac.OrganizationID,
+		ContactsCount:  0,
 		CreatedAt:      time.Now(),
-		TagData:		args,
+		TagData:        args,
 	}
 
 	sameNameCount, _ := db.Count(p.Context, &t, map[string]string{"organization_id": t.OrganizationID, "name": *args.Name})
@@ -47,7 +49,7 @@ func (Mutation) AddTag(p graphql.ResolveParams, rbac rbac.RBAC, args TagData) (T
 		return t, errors.New("The name is already registered within your organization")
 	}
 
-	_, err := db.Save(p.Context, &t)
+	err := db.Save(p.Context, &t)
 	return t, err
 }
 
@@ -57,7 +59,7 @@ func (Mutation) UpdateTag(p graphql.ResolveParams, rbac rbac.RBAC, args TagEdit)
 	if len(data) == 0 {
 		return Tag{}, errors.New("no data to update")
 	}
-	
+
 	t := Tag{}
 
 	if args.Data.Name != nil {
@@ -0,0 +1,159 @@
+// Package graphqltest executes graphql operations against the api schema from tests, without external services.
+// The database is kept in memory & emptied for every test, which thus can't run in parallel.
+//
+//	func TestAddTag(t *testing.T) {
+//		c := graphqltest.New(t, graphqltest.DefaultRBAC)
+//		res := struct{ AddTag contacts.Tag `json:"add_tag"` }{}
+//		c.Exec(`mutation { add_tag(name: "vip") { id name } }`, nil, &res)
+//	}
+package graphqltest
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	gographql "github.com/graphql-go/graphql"
+	"github.com/segmentio/ksuid"
+	"neodeliver.com/engine/config"
+	"neodeliver.com/engine/db"
+	"neodeliver.com/engine/jobs"
+	"neodeliver.com/engine/logger"
+	"neodeliver.com/engine/rbac"
+	"neodeliver.com/engine/storage"
+	"neodeliver.com/modules"
+)
+
+var (
+	schema gographql.Schema
+	once   sync.Once
+)
+
+// identity operations are executed with by default
+var DefaultRBAC = rbac.RBAC{
+	SUB:            "auth0|test",
+	UserID:         "auth0|test",
+	OrganizationID: "org_test",
+	Scopes: map[string]bool{
+		"users:read": true,
+	},
+}
+
+type Client struct {
+	t    testing.TB
+	RBAC rbac.RBAC
+	DB   *db.Memory
+}
+
+// client executing operations as r, on an empty in-memory database
+func New(t testing.TB, r rbac.RBAC) *Client {
+	t.Helper()
+
+	once.Do(func() {
+		c, err := config.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c.Env = config.Test
+		c.Database = "memory"
+		c.RateLimit.Enabled = false
+		c.RateLimit.Store = "memory"
+		c.Idempotency.Store = "memory"
+		c.Storage.Backend = "memory"
+		c.Log.Level = "error"
+		config.Set(c)
+
+		logger.Init(c.Log)
+		schema = modules.Build()
+
+		// jobs are executed by the instance enqueuing them, awaited with Wait
+		jobs.Inline(true)
+	})
+
+	mem := db.NewMemory()
+	db.SetDatabase(mem)
+	storage.SetStorage(storage.NewMemory())
+	t.Cleanup(func() {
+		jobs.Wait()
+		db.SetDatabase(nil)
+		storage.SetStorage(nil)
+	})
+
+	return &Client{t: t, RBAC: r, DB: mem}
+}
+
+// client executing operations as another user or organization, sharing the database
+func (c *Client) As(r rbac.RBAC) *Client {
+	return &Client{t: c.t, RBAC: r, DB: c.DB}
+}
+
+// context of the client identity, used to seed the database with db.Save...
+func (c *Client) Context() context.Context {
+	return rbac.NewContext(context.Background(), c.RBAC)
+}
+
+// store a csv file as an upload of the client organization, returns the upload id
+func (c *Client) Upload(content string) string {
+	c.t.Helper()
+
+	id := storage.UploadPrefixID + ksuid.New().String()
+	if _, err := storage.Put(c.Context(), storage.UploadKey(c.RBAC.OrganizationID, id), strings.NewReader(content), "text/csv"); err != nil {
+		c.t.Fatal(err)
+	}
+
+	return id
+}
+
+// wait for the background jobs enqueued by the executed operations
+func (c *Client) Wait() {
+	jobs.Wait()
+}
+
+// execute an operation
+func (c *Client) Do(query string, variables map[string]interface{}) *gographql.Result {
+	return gographql.Do(gographql.Params{
+		Schema:         schema,
+		RequestString:  query,
+		VariableValues: variables,
+		Context:        c.Context(),
+	})
+}
+
+// execute an operation expected to succeed, decoding its data into out (optional)
+func (c *Client) Exec(query string, variables map[string]interface{}, out interface{}) {
+	c.t.Helper()
+
+	res := c.Do(query, variables)
+	if len(res.Errors) > 0 {
+		c.t.Fatalf("unexpected graphql errors: %v", res.Errors)
+	}
+
+	if out == nil {
+		return
+	}
+
+	bs, err := json.Marshal(res.Data)
+	if err == nil {
+		err = json.Unmarshal(bs, out)
+	}
+
+	if err != nil {
+		c.t.Fatalf("could not decode graphql data: %v", err)
+	}
+}
+
+// execute an operation expected to fail, returning its first error code (empty for errors without code)
+func (c *Client) Error(query string, variables map[string]interface{}) string {
+	c.t.Helper()
+
+	res := c.Do(query, variables)
+	if len(res.Errors) == 0 {
+		c.t.Fatalf("expected graphql errors, got data: %v", res.Data)
+	}
+
+	code, _ := res.Errors[0].Extensions["code"].(string)
+	return code
+}
@@ -1,25 +1,34 @@
 package modules
 
 import (
-	"fmt"
+	"strings"
 
 	gographql "github.com/graphql-go/graphql"
-	"github.com/joho/godotenv"
+	"neodeliver.com/engine/config"
 	"neodeliver.com/engine/db"
 	"neodeliver.com/engine/graphql"
+	"neodeliver.com/engine/jobs"
+	"neodeliver.com/engine/logger"
+	"neodeliver.com/engine/metrics"
+	"neodeliver.com/engine/ratelimit"
+	"neodeliver.com/engine/server"
+	"neodeliver.com/engine/storage"
+	"neodeliver.com/engine/tracing"
 	"neodeliver.com/modules/campaigns"
 	"neodeliver.com/modules/contacts"
 	"neodeliver.com/modules/settings"
 )
 
 func Build() gographql.Schema {
-	fmt.Println("Starting graphql server...")
-
-	godotenv.Overload()
-	defer db.Close()
+	logger.Root().Info("Starting graphql server...")
 
 	// create schema
 	scheme := graphql.New()
+	metrics.Instrument(scheme)
+	scheme.Use(tracing.Resolvers)
+	tracing.Instrument()
+	ratelimit.Instrument(scheme)
+
 	settings.Init(scheme)
 	contacts.Init(scheme)
 	campaigns.Init(scheme)
@@ -31,3 +40,27 @@ func Build() gographql.Schema {
 
 	return instance
 }
+
+// api server, mounting the graphql endpoint, file uploads & downloads, metrics & health checks
+// additional handlers (tracking, webhooks...) can be mounted with Handle
+func Server(c *config.Config) *server.Server {
+	instance := Build()
+
+	s := server.New(c).
+		Handle("/", metrics.HTTP("graphql", ratelimit.HTTP("graphql", graphql.Route(instance)))).
+		Handle("/uploads", metrics.HTTP("uploads", ratelimit.HTTP("uploads", storage.UploadHandler()))).
+		Limit("/uploads", c.Storage.MaxUploadBytes).
+		Handle(storage.DownloadPath, metrics.HTTP("files", storage.Handler())).
+		Handle(contacts.ConfirmationPath, metrics.HTTP("confirmations", ratelimit.HTTP("confirmations", contacts.ConfirmationHandler()))).
+		Handle(jobs.TriggerPath, metrics.HTTP("jobs", jobs.TriggerHandler())).
+		HandleInternal("/metrics", metrics.Handler()).
+		Check("mongodb", db.Ping).
+		OnShutdown(db.Close).
+		OnShutdown(jobs.Stop) // background jobs are stopped before the database connection is closed
+
+	if c.Playground.Enabled {
+		s.Handle(strings.TrimSuffix(c.Playground.Path, "/")+"/", graphql.Playground("/", c.Playground))
+	}
+
+	return s
+}
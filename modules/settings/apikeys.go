@@ -0,0 +1,85 @@
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/segmentio/ksuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"neodeliver.com/engine/db"
+	ggraphql "neodeliver.com/engine/graphql"
+	"neodeliver.com/engine/rbac"
+)
+
+// API keys of the organization, sent in the X-API-Key header by server to server integrations
+// -------------------------------------------------------------------------------------
+
+type CreateAPIKey struct {
+	Name   string   `validate:"required,max=100"`
+	Scopes []string `json:"scopes" validate:"required,min=1"` // eg: contacts:read, contacts:write
+}
+
+// created api key, along with the key which can't be retrieved afterwards
+type NewAPIKey struct {
+	rbac.APIKey `bson:",inline" json:",inline"`
+	Key         string `json:"key"`
+}
+
+// create an api key of the organization granting the operations of its scopes, api keys can't create other keys
+func (Mutation) CreateAPIKey(p graphql.ResolveParams, r rbac.RBAC, args CreateAPIKey) (NewAPIKey, error) {
+	if r.APIKeyID != "" {
+		return NewAPIKey{}, errors.New("API keys can only be created by users")
+	}
+
+	known := rbac.APIKeyScopes()
+	for _, s := range args.Scopes {
+		if !slices.Contains(known, s) {
+			return NewAPIKey{}, fmt.Errorf("Unknown scope %s, scopes are %s", s, strings.Join(known, ", "))
+		}
+	}
+
+	scopes := append([]string{}, args.Scopes...)
+	slices.Sort(scopes)
+	scopes = slices.Compact(scopes)
+
+	key, hash, err := rbac.NewAPIKey()
+	if err != nil {
+		return NewAPIKey{}, err
+	}
+
+	k := rbac.APIKey{
+		ID:             rbac.APIKeyPrefixID + ksuid.New().String(),
+		OrganizationID: r.OrganizationID,
+		Name:           args.Name,
+		Hash:           hash,
+		Scopes:         scopes,
+		CreatedBy:      r.UserID,
+		CreatedAt:      time.Now(),
+	}
+
+	err = db.Coll("api_keys").InsertOne(p.Context, k)
+	return NewAPIKey{k, key}, err
+}
+
+// revoke an api key of the organization, requests using it are rejected immediately
+func (Mutation) RevokeAPIKey(p graphql.ResolveParams, r rbac.RBAC, args ggraphql.ByID) (bool, error) {
+	if r.APIKeyID != "" {
+		return false, errors.New("API keys can only be revoked by users")
+	}
+
+	n, err := db.Coll("api_keys").UpdateMany(p.Context, bson.M{"_id": args.ID, "organization_id": r.OrganizationID, "revoked_at": nil}, bson.M{
+		"$set": bson.M{"revoked_at": time.Now()},
+	})
+
+	if err != nil {
+		return false, err
+	} else if n == 0 {
+		return false, errors.New("API key not found")
+	}
+
+	return true, nil
+}
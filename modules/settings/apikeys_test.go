@@ -0,0 +1,52 @@
+package settings_test
+
+import (
+	"testing"
+
+	"neodeliver.com/engine/graphql"
+	"neodeliver.com/engine/rbac"
+	"neodeliver.com/modules/graphqltest"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	if code := c.Error(`mutation { create_api_key(name: "crm", scopes: ["contacts:admin"]) { id } }`, nil); code != "" {
+		t.Errorf("got %s, want a validation error", code)
+	}
+
+	res := struct {
+		CreateAPIKey struct {
+			ID     string   `json:"id"`
+			Key    string   `json:"key"`
+			Scopes []string `json:"scopes"`
+		} `json:"create_api_key"`
+	}{}
+
+	c.Exec(`mutation { create_api_key(name: "crm", scopes: ["contacts:write", "contacts:read", "contacts:write"]) { id key scopes } }`, nil, &res)
+	if got := res.CreateAPIKey.Scopes; len(got) != 2 || got[0] != "contacts:read" || got[1] != "contacts:write" {
+		t.Errorf("scopes %v, want contacts:read & contacts:write", got)
+	}
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	c := graphqltest.New(t, graphqltest.DefaultRBAC)
+	key := c.As(rbac.RBAC{OrganizationID: "org_test", APIKeyID: "key_test", Scopes: map[string]bool{"contacts:read": true}})
+
+	key.Exec(`{ contacts { id } }`, nil, nil)
+	if code := key.Error(`mutation { add_contact(email: "john@example.com") { id } }`, nil); code != graphql.ErrForbidden {
+		t.Errorf("add_contact without contacts:write: got %q, want %s", code, graphql.ErrForbidden)
+	}
+
+	// key & team management are reserved to users, whatever the scopes
+	for _, query := range []string{
+		`{ api_keys { id } }`,
+		`{ team_members { id } }`,
+		`mutation { create_api_key(name: "other", scopes: ["contacts:read"]) { id } }`,
+		`mutation { revoke_api_key(id: "key_test") }`,
+		`mutation { invite_user(email: "jane@example.com", role: "admin") { id } }`,
+	} {
+		if code := key.Error(query, nil); code != graphql.ErrForbidden {
+			t.Errorf("%s: got %q, want %s", query, code, graphql.ErrForbidden)
+		}
+	}
+}
@@ -8,19 +8,26 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"strings"
+	"sync"
 	"time"
 
 	parser "net/url"
 
 	"github.com/golang-jwt/jwt"
-	"github.com/joho/godotenv"
+	"neodeliver.com/engine/config"
+	"neodeliver.com/engine/logger"
+	"neodeliver.com/engine/tracing"
 )
 
-var auth *auth0
+var (
+	auth   *auth0
+	authMu sync.Mutex // guards the swap of auth by concurrent requests
+)
 
 type auth0 struct {
+	mu               sync.Mutex // guards the management token
+	config           *config.Config
 	tenant           string
 	clientID         string
 	clientSecret     string
@@ -34,21 +41,27 @@ type auth0 struct {
 
 // InitAuth initializes Auth0 configurations.
 func Auth0() *auth0 {
-	if auth == nil {
+	authMu.Lock()
+	defer authMu.Unlock()
+
+	// reload the client when another configuration got injected
+	c := config.Get()
+	if auth == nil || auth.config != c {
 		auth = &auth0{
-			tenant:           os.Getenv("AUTH0_TENANT"),
-			token:            os.Getenv("AUTH0_TOKEN"),
-			clientID:         os.Getenv("AUTH0_MANAGEMENT_CLIENT_ID"),
-			clientSecret:     os.Getenv("AUTH0_MANAGEMENT_CLIENT_SECRET"),
-			audience:         os.Getenv("AUTH0_MANAGEMENT_AUDIENCE"),
-			connection:       os.Getenv("AUTH0_MANAGEMENT_CONNECTION"),
-			passClientID:     os.Getenv("AUTH0_PASSWORD_CLIENT_ID"),
-			passClientSecret: os.Getenv("AUTH0_PASSWORD_CLIENT_SECRET"),
+			config:           c,
+			tenant:           c.Auth0.Tenant,
+			token:            c.Auth0.Token,
+			clientID:         c.Auth0.ClientID,
+			clientSecret:     c.Auth0.ClientSecret,
+			audience:         c.Auth0.Audience,
+			connection:       c.Auth0.Connection,
+			passClientID:     c.Auth0.PasswordClientID,
+			passClientSecret: c.Auth0.PasswordClientSecret,
 		}
 
 		if auth.token != "" {
 			if err := auth.updateTokenExpiration(); err != nil {
-				fmt.Printf("Failed to update auth0 token expiration: %v\n", err)
+				logger.Root().Warn("Failed to update auth0 token expiration", "err", err)
 			}
 		}
 	}
@@ -57,6 +70,9 @@ func Auth0() *auth0 {
 }
 
 func (a *auth0) getToken(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
 	if a.token != "" && a.tokenExp.After(time.Now()) {
 		return a.token, nil
 	} else if a.tenant == "" {
@@ -98,12 +114,6 @@ func (a *auth0) getToken(ctx context.Context) (string, error) {
 		return res.Token, err
 	}
 
-	// save to local env
-	if mp, err := godotenv.Read(".env"); err == nil {
-		mp["AUTH0_TOKEN"] = res.Token
-		godotenv.Write(mp, ".env")
-	}
-	fmt.Println("here====")
 	return res.Token, nil
 }
 
@@ -164,7 +174,7 @@ func (a *auth0) Request(ctx context.Context, method string, url string, headers
 		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
 	}
 	// Send the HTTP request
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := tracing.HTTPClient.Do(req)
 	if err != nil {
 		return nil, http.StatusInternalServerError, err
 	}
@@ -306,7 +316,7 @@ func (a *auth0) EnrollMFA(ctx context.Context, types []string, token, method str
 	payload := map[string]interface{}{
 		"authenticator_types": types,
 	}
-	_, _, err := auth.Post(ctx, "/mfa/associate", headers, payload, &res)
+	_, _, err := a.Post(ctx, "/mfa/associate", headers, payload, &res)
 	if err != nil {
 		return false, err
 	}
@@ -328,7 +338,7 @@ func (a *auth0) EnrollAuthenticationMethod(ctx context.Context, userID, secret s
 		"totp_secret": secret, // should be a base32 encoded secret
 	}
 	url := fmt.Sprintf("/api/v2/users/%v/authentication-methods", userID)
-	_, _, err := auth.Post(ctx, url, nil, payload, res)
+	_, _, err := a.Post(ctx, url, nil, payload, res)
 	if err != nil {
 		return false, err
 	}
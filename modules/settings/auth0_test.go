@@ -0,0 +1,39 @@
+package settings
+
+import (
+	"sync"
+	"testing"
+
+	"neodeliver.com/engine/config"
+)
+
+// run with -race: requests share the client, which is swapped once another configuration is injected
+func TestAuth0Swap(t *testing.T) {
+	c, err := config.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Auth0.Tenant = "first.eu.auth0.com"
+	config.Set(c)
+	defer config.Set(nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Auth0()
+		}()
+	}
+
+	wg.Wait()
+	first := Auth0()
+
+	other := *c
+	other.Auth0.Tenant = "second.eu.auth0.com"
+	config.Set(&other)
+	if a := Auth0(); a == first || a.tenant != "second.eu.auth0.com" {
+		t.Errorf("client of tenant %s not reloaded", a.tenant)
+	}
+}
@@ -1,7 +1,14 @@
 package settings
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
 	"github.com/graphql-go/graphql"
+	"go.mongodb.org/mongo-driver/bson"
+	"neodeliver.com/engine/db"
 	"neodeliver.com/engine/rbac"
 )
 
@@ -10,7 +17,8 @@ type ContactSettings struct {
 	Tracking       TrackingSettings
 	Email          ContactEmailSettings
 	SMS            ContactSMSSettings
-	// CommunicationCategories []map[string]string
+	// categories of communications contacts consent to, per channel
+	CommunicationCategories []CommunicationCategory `bson:"communication_categories" json:"communication_categories"`
 }
 
 func (ContactSettings) Default(org string) ContactSettings {
@@ -28,7 +36,37 @@ func (ContactSettings) Default(org string) ContactSettings {
 		SMS: ContactSMSSettings{
 			UnsubscribeLink: false,
 		},
+		CommunicationCategories: []CommunicationCategory{
+			{Key: "newsletter", Name: "Newsletter"},
+			{Key: "product_updates", Name: "Product updates"},
+			{Key: "promotions", Name: "Promotions"},
+		},
+	}
+}
+
+// settings of the organization, the defaults when never saved
+func LoadContactSettings(ctx context.Context, org string) (ContactSettings, error) {
+	s := ContactSettings{}
+	err := db.Coll("contact_settings").FindOne(ctx, bson.M{"_id": org}, &s)
+	if errors.Is(err, db.ErrNoDocuments) {
+		return s.Default(org), nil
+	} else if err == nil && s.CommunicationCategories == nil {
+		// saved before categories were configurable
+		s.CommunicationCategories = s.Default(org).CommunicationCategories
+	}
+
+	return s, err
+}
+
+// communication category by key, nil when missing
+func (s ContactSettings) Category(key string) *CommunicationCategory {
+	for _, c := range s.CommunicationCategories {
+		if c.Key == key {
+			return &c
+		}
 	}
+
+	return nil
 }
 
 // ------------------ Sub structs ------------------
@@ -57,6 +95,49 @@ type GoogleAnalyticsSettings struct {
 	Content string
 }
 
+// ------------------ Communication categories ------------------
+
+// category of communications targeted by campaigns (eg: newsletter), contacts consent to each category per channel
+type CommunicationCategory struct {
+	Key         string  `bson:"key" json:"key" validate:"required,max=64"` // lower case letters, digits & _, referenced by consents & campaigns
+	Name        string  `bson:"name" json:"name" validate:"required,max=100"`
+	Description *string `bson:"description" json:"description" validate:"omitempty,max=500"`
+}
+
+type SetCommunicationCategories struct {
+	Categories []CommunicationCategory `json:"categories" validate:"max=50,dive"`
+}
+
+var categoryKeyRegex = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// replace the communication categories, consents to removed categories are kept but no longer used by campaigns
+func (Mutation) SetCommunicationCategories(p graphql.ResolveParams, rbac rbac.RBAC, args SetCommunicationCategories) (ContactSettings, error) {
+	keys := map[string]bool{}
+	for _, c := range args.Categories {
+		if !categoryKeyRegex.MatchString(c.Key) {
+			return ContactSettings{}, fmt.Errorf("Invalid category key %s, only lower case letters, digits & _ are allowed", c.Key)
+		} else if keys[c.Key] {
+			return ContactSettings{}, fmt.Errorf("The category %s is defined twice", c.Key)
+		}
+
+		keys[c.Key] = true
+	}
+
+	s := ContactSettings{}
+	err := db.Coll("contact_settings").FindOne(p.Context, bson.M{"_id": rbac.OrganizationID}, &s)
+	if errors.Is(err, db.ErrNoDocuments) {
+		s = s.Default(rbac.OrganizationID)
+		s.CommunicationCategories = args.Categories
+		return s, db.Coll("contact_settings").InsertOne(p.Context, s)
+	} else if err != nil {
+		return s, err
+	}
+
+	s.CommunicationCategories = args.Categories
+	_, err = db.Coll("contact_settings").UpdateMany(p.Context, bson.M{"_id": rbac.OrganizationID}, bson.M{"$set": bson.M{"communication_categories": s.CommunicationCategories}})
+	return s, err
+}
+
 // ------------------ Email restrictions ------------------
 
 type AddRestrictedEmailParams struct {
@@ -1,12 +1,24 @@
 package settings
 
 import (
+	"time"
+
 	"neodeliver.com/engine/graphql"
+	"neodeliver.com/engine/ratelimit"
 	"neodeliver.com/engine/rbac"
 )
 
 // register graphql queries
 func Init(s *graphql.Builder) {
+	// global object identification
+	s.Node(TeamMemberPrefixID, TeamMember{}).Where(func(r rbac.RBAC, id string) map[string]interface{} {
+		return map[string]interface{}{
+			"_id":             id,
+			"organization_id": r.OrganizationID,
+			"deleted_at":      nil,
+		}
+	})
+
 	// query user
 	s.MongoQuery(User{}).Where(func(r rbac.RBAC) map[string]interface{} {
 		return map[string]interface{}{
@@ -36,6 +48,23 @@ func Init(s *graphql.Builder) {
 		}
 	})
 
+	// active api keys of the organization
+	s.MongoQuery([]rbac.APIKey{}).Where(func(r rbac.RBAC) map[string]interface{} {
+		return map[string]interface{}{
+			"organization_id": r.OrganizationID,
+			"revoked_at":      nil,
+		}
+	})
+
+	// communication categories of consents, api keys & team management being reserved to users
+	rbac.RegisterScope("contacts:read", "contact_settings")
+
+	// brute force protection
+	ratelimit.Register("update_password", ratelimit.User(5, 15*time.Minute), ratelimit.IP(20, 15*time.Minute))
+	ratelimit.Register("confirm_mfa", ratelimit.User(5, 15*time.Minute), ratelimit.IP(20, 15*time.Minute))
+	ratelimit.Register("accept_invitation", ratelimit.IP(10, 15*time.Minute))
+	ratelimit.Register("invite_user", ratelimit.Organization(50, time.Hour))
+
 	s.AddQueryMethods(Query{})
 	s.AddMutationMethods(Mutation{})
 }
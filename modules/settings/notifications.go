@@ -14,7 +14,7 @@ type UserNotifications struct {
 }
 
 func (Mutation) EditNotificationPreferences(p graphql.ResolveParams, rbac rbac.RBAC, args UserNotifications) (UserNotifications, error) {
-	// TODO update contact prefernces within our own mailing list (our organization id is accesible from env avriable NEODELIVER_ORGANIZATION_ID)
+	// TODO update contact prefernces within our own mailing list (our organization id is accessible from config.Get().OrganizationID)
 
 	return args, nil
 }
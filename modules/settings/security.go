@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/graphql-go/graphql"
+	"neodeliver.com/engine/logger"
 	"neodeliver.com/engine/rbac"
 )
 
@@ -35,8 +36,7 @@ func (Mutation) UpdatePassword(p graphql.ResolveParams, rbac rbac.RBAC, args Upd
 	// verify current password
 	ok, connection, err := auth.VerifyPassword(p.Context, rbac.UserID, args.Old)
 	if err != nil {
-		fmt.Println(err)
-		// TODO log to sentry
+		logger.Report(p.Context, err, "Could not verify password")
 		return false, errors.New("internal_error")
 	} else if !ok {
 		return false, fmt.Errorf("invalid_password")
@@ -57,13 +57,12 @@ func (Mutation) UpdatePassword(p graphql.ResolveParams, rbac rbac.RBAC, args Upd
 
 	// verify response
 	if err != nil {
-		fmt.Println(err)
-		// TODO log to sentry
+		logger.Report(p.Context, err, "Could not update password")
 		return false, errors.New("internal_error")
 	} else if res.StatusCode == 400 {
 		return false, fmt.Errorf(res.Message)
 	} else if status != 200 {
-		fmt.Println(string(bs))
+		logger.Report(p.Context, fmt.Errorf("auth0 returned status %d", status), "Could not update password", "response", string(bs))
 		return false, fmt.Errorf("failed to update password")
 	}
 
@@ -150,8 +149,7 @@ func (Mutation) ConfirmMFA(p graphql.ResolveParams, rbac rbac.RBAC, args Confirm
 	// verify current password
 	ok, _, err := auth.VerifyPassword(p.Context, rbac.UserID, args.CurrentPassword)
 	if err != nil {
-		fmt.Println(err)
-		// TODO log to sentry
+		logger.Report(p.Context, err, "Could not verify password")
 		return res, errors.New("internal_error")
 	} else if !ok {
 		return res, fmt.Errorf("invalid_password")
@@ -193,8 +191,7 @@ func (Mutation) EnrollAuthenticationMethod(p graphql.ResolveParams, rbac rbac.RB
 	// verify current password
 	ok, _, err := auth.VerifyPassword(p.Context, rbac.UserID, args.CurrentPassword)
 	if err != nil {
-		fmt.Println(err)
-		// TODO log to sentry
+		logger.Report(p.Context, err, "Could not verify password")
 		return res, errors.New("internal_error")
 	} else if !ok {
 		return res, fmt.Errorf("invalid_password")
@@ -3,13 +3,14 @@ package settings
 import (
 	"errors"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 	"github.com/graphql-go/graphql"
 	"github.com/segmentio/ksuid"
+	"neodeliver.com/engine/config"
 	"neodeliver.com/engine/db"
+	"neodeliver.com/engine/logger"
 	"neodeliver.com/engine/rbac"
 )
 
@@ -30,6 +31,15 @@ type TeamMember struct {
 	DeletedAt           *time.Time `graphql:"-" bson:"deleted_at"`
 }
 
+func (TeamMember) GraphqlMethods() []string {
+	return []string{"IsPending"}
+}
+
+// a member is pending as long as the invitation has not been accepted
+func (m TeamMember) IsPending() bool {
+	return m.UserID == "" && m.InvitationExpiresAt != nil
+}
+
 // ---
 
 type InviteArgs struct {
@@ -73,7 +83,7 @@ func (Mutation) InviteUser(p graphql.ResolveParams, rbac rbac.RBAC, args InviteA
 			UpdatedAt:           time.Now(),
 		}
 
-		if _, err = db.Save(p.Context, &u); err != nil {
+		if err = db.Save(p.Context, &u); err != nil {
 			return u, err
 		}
 	} else {
@@ -100,12 +110,12 @@ func (Mutation) InviteUser(p graphql.ResolveParams, rbac rbac.RBAC, args InviteA
 	// Sign and get the complete encoded token as a string using the secret
 	tokenString, err := token.SignedString(invitationsSecret())
 	if err != nil {
-		fmt.Println(err) // TODO log to sentry
+		logger.Report(p.Context, err, "Could not sign invitation token", "member", u.ID)
 		return u, nil
 	}
 
 	// send invitation email to user
-	fmt.Println("todo send invitation email with token: ", tokenString)
+	logger.FromContext(p.Context).Info("TODO send invitation email", "member", u.ID, "invitation_token", tokenString)
 	// TODO send invitation mail containing acceptation token (using our internal systems)
 
 	return u, nil
@@ -197,9 +207,5 @@ func (i invitationClaims) Valid() error {
 }
 
 func invitationsSecret() []byte {
-	if s := os.Getenv("INVITATIONS_SECRET"); s != "" {
-		return []byte(s)
-	}
-
-	return []byte("dev_token")
+	return []byte(config.Get().Invitations.Secret)
 }
@@ -1,18 +1,25 @@
-package main
+package sender
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
 	"net/smtp"
 	"strings"
+	"time"
 
 	"github.com/inconshreveable/log15"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"neodeliver.com/engine/tracing"
 )
 
 // https://en.wikipedia.org/wiki/Simple_Mail_Transfer_Protocol
 
+const dialTimeout = 10 * time.Second
+
 type ClientConfig struct {
 	Server             string
 	OnlyTLS            bool
@@ -20,10 +27,10 @@ type ClientConfig struct {
 	// TODO support security settings to force TLS usage
 }
 
-func Dial(config ClientConfig, email string) (*smtp.Client, error) {
+func Dial(ctx context.Context, config ClientConfig, email string) (*smtp.Client, error) {
 	hosts, err := mxLookup(email)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	if len(hosts) == 0 {
@@ -32,7 +39,7 @@ func Dial(config ClientConfig, email string) (*smtp.Client, error) {
 
 	var e error
 	for i, host := range hosts {
-		c, err := connectSMTPServer(config, host)
+		c, err := connectSMTPServer(ctx, config, host)
 		if err == nil {
 			return c, nil
 		}
@@ -45,15 +52,33 @@ func Dial(config ClientConfig, email string) (*smtp.Client, error) {
 	return nil, e
 }
 
-func connectSMTPServer(config ClientConfig, host string) (*smtp.Client, error) {
+func connectSMTPServer(ctx context.Context, config ClientConfig, host string) (c *smtp.Client, err error) {
 	log15.Info("Connecting to client", "host", host)
 
+	_, span := tracing.Tracer.Start(ctx, "smtp.connect", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.ServerAddress(host),
+		semconv.ServerPort(25),
+	))
+
+	defer func() {
+		tracing.Error(span, err)
+		span.End()
+	}()
+
 	// Connect to the remote SMTP server on the standard port 25.
-	client, err := smtp.Dial(host + ":25")
+	dialer := net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", host+":25")
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial SMTP server: %v", err)
+	}
+
+	client, err := smtp.NewClient(conn, host)
 	if err != nil {
+		conn.Close()
 		return nil, fmt.Errorf("failed to dial SMTP server: %v", err)
 	} else if err = client.Hello(config.Server); err != nil {
-		panic(err)
+		client.Close()
+		return nil, err
 	}
 
 	// Check if the server supports the STARTTLS extension.
@@ -85,7 +110,7 @@ func mxLookup(email string) ([]string, error) {
 	if i := strings.LastIndex(email, "@"); i > 0 {
 		host = email[i+1:]
 	} else {
-		panic("invalid email address")
+		return nil, errors.New("invalid email address")
 	}
 
 	mxRecords, err := net.LookupMX(host)
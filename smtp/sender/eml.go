@@ -1,13 +1,18 @@
-package main
+package sender
 
 import (
+	"mime"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/inconshreveable/log15"
+	"github.com/segmentio/ksuid"
 	dkim "github.com/toorop/go-dkim"
+	"neodeliver.com/engine/config"
 )
 
+// signed message of an eml file
 func LoadEmlFile(filename string) ([]byte, error) {
 	bs, err := os.ReadFile(filename)
 	if err != nil {
@@ -21,22 +26,40 @@ func signDKIM(bs []byte) ([]byte, error) {
 	log15.Info("Singing DKIM")
 
 	// Read private key
-	privateKey, err := os.ReadFile("./ssl/private.key")
+	c := config.Get().DKIM
+	privateKey, err := os.ReadFile(c.PrivateKey)
 	if err != nil {
 		return nil, err
 	}
 
 	options := dkim.NewSigOptions()
 	options.PrivateKey = privateKey
-	options.Domain = "neodeliver.io"
-	options.Selector = "n1"
+	options.Domain = c.Domain
+	options.Selector = c.Selector
 	options.SignatureExpireIn = 3600
 	options.BodyLength = 50
 	options.Headers = []string{"Subject", "From", "Date", "To"}
 	options.AddSignatureTimestamp = true
 	options.Canonicalization = "relaxed/relaxed"
 
-	bs = append([]byte("Date: "+time.Now().Format("Mon, 02 Jan 2006 15:04:05 -0700")+"\n"), bs...)
+	bs = append([]byte("Date: "+time.Now().Format(time.RFC1123Z)+"\r\n"), bs...)
 	err = dkim.Sign(&bs, options)
 	return bs, err
 }
+
+// plain text message, the Date header being added when signed
+func compose(from, to, subject, text string) []byte {
+	domain := from[strings.LastIndex(from, "@")+1:]
+	headers := []string{
+		"From: " + from,
+		"To: " + to,
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject),
+		"Message-Id: <" + ksuid.New().String() + "@" + domain + ">",
+		"Mime-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Transfer-Encoding: 8bit",
+	}
+
+	body := strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\n", "\r\n")
+	return []byte(strings.Join(headers, "\r\n") + "\r\n\r\n" + body + "\r\n")
+}
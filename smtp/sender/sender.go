@@ -1,58 +1,87 @@
-package main
+package sender
 
 import (
-	"log"
+	"context"
+	"errors"
+	"strings"
 
 	"github.com/inconshreveable/log15"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"neodeliver.com/engine/config"
+	"neodeliver.com/engine/tracing"
 )
 
+// Delivery of emails to the mail servers of their recipients, signed with DKIM
 // check: https://github.com/toorop/tmail
 // TODO check inbox placement
 // BIMI ? https://www.emailonacid.com/blog/article/email-deliverability/bimi/
+// -------------------------------------------------------------------------------------
 
-func main() {
-	bs, err := LoadEmlFile("./mail.eml")
+// returned when MAILER_FROM is not configured
+var ErrNotConfigured = errors.New("no email sender is configured (MAILER_FROM)")
+
+// compose a plain text email from MAILER_FROM, sign it & deliver it to the recipient
+func SendText(ctx context.Context, to, subject, text string) error {
+	c := config.Get().Mailer
+	if c.From == "" {
+		return ErrNotConfigured
+	}
+
+	bs, err := signDKIM(compose(c.From, to, subject, text))
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	// TODO test bounce email
-	// TODO support ARC
+	return Send(ctx, c.From, to, bs)
+}
+
+// deliver a signed message to the mail server of the recipient
+func Send(ctx context.Context, from string, to string, bs []byte) (err error) {
+	ctx, span := tracing.Tracer.Start(ctx, "smtp.session", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("smtp.recipient_domain", to[strings.LastIndex(to, "@")+1:]),
+	))
 
-	to := "test-nar3e0x15@srv1.mail-tester.com"
-	c, err := Dial(ClientConfig{
-		Server: "92.eu.neodeliver.io",
+	defer func() {
+		tracing.Error(span, err)
+		span.End()
+	}()
+
+	c, err := Dial(ctx, ClientConfig{
+		Server: config.Get().Mailer.Hostname,
 	}, to)
 
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	defer c.Close()
 	log15.Info("Connected to client")
 
+	// TODO test bounce email
+	// TODO support ARC
+
 	// Set the sender and recipient first
-	if err := c.Mail("sacha@skyhark.be"); err != nil {
-		log.Fatal(err)
+	if err := c.Mail(from); err != nil {
+		return err
 	} else if err := c.Rcpt(to); err != nil { // TODO test bounce email when adding multiple receipts (call Rcpt multiple times)
-		log.Fatal(err)
+		return err
 	}
 
 	// Send the email body.
 	wc, err := c.Data()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	wc.Write(bs)
+	if _, err := wc.Write(bs); err != nil {
+		return err
+	}
 
 	if err = wc.Close(); err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	// Send the QUIT command and close the connection.
-	err = c.Quit()
-	if err != nil {
-		log.Fatal(err)
-	}
+	return c.Quit()
 }
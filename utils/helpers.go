@@ -2,6 +2,7 @@ package utils
 
 import (
 	"regexp"
+	"strings"
 
 	isolang "github.com/emvi/iso-639-1"
 )
@@ -28,8 +29,24 @@ func ValidateNotificationToken(token *string) bool {
 	return match
 }
 
-func ValidateMongoDBQuery(query *string) bool {
-	queryRegex := `\{\s*\$[a-zA-Z]+\s*:\s*\[.*\]\s*\}`
-	match, _ := regexp.MatchString(queryRegex, *query)
-	return match
+// lower case email without surrounding spaces, used to compare addresses
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// phone number in E.164 format (eg: +33612345678), empty when it has no digits
+func NormalizePhone(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+
+		return -1
+	}, phone)
+
+	if digits == "" {
+		return ""
+	}
+
+	return "+" + digits
 }